@@ -0,0 +1,202 @@
+// Package client calls the event-to-insight backend API from Go, returning
+// the same model types the server sends.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"event-to-insight/internal/models"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds each request unless WithTimeout or WithHTTPClient
+// changes it. Searches call the AI, so it allows for a slow provider.
+const DefaultTimeout = 30 * time.Second
+
+// ErrNotFound matches an Error for a 404 response, such as an unknown
+// article
+var ErrNotFound = errors.New("not found")
+
+// Error is returned when the API answers with an error status. Fields lists
+// each invalid field of a rejected request.
+type Error struct {
+	StatusCode int
+	Message    string
+	Detail     string
+	Fields     []models.FieldError
+}
+
+func (e *Error) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("api error %d: %s: %s", e.StatusCode, e.Message, e.Detail)
+	}
+	return fmt.Sprintf("api error %d: %s", e.StatusCode, e.Message)
+}
+
+// Is lets errors.Is(err, ErrNotFound) match 404 responses
+func (e *Error) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// Client calls the API of one backend
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// Option customizes a Client
+type Option func(*Client)
+
+// WithTimeout bounds how long each request may take, including reading
+// the response
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.httpClient.Timeout = timeout
+	}
+}
+
+// WithHTTPClient sends requests through the given HTTP client, for example
+// one with a custom transport. Its timeout replaces DefaultTimeout.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// New creates a client for the backend at baseURL, such as
+// http://localhost:8080. The /api prefix is added to every path.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Search asks a question, returning the AI summary and relevant articles
+func (c *Client) Search(ctx context.Context, query string) (*models.SearchResponse, error) {
+	var response models.SearchResponse
+	if err := c.do(ctx, http.MethodPost, "/search-query", nil, models.SearchRequest{Query: query}, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// GetArticle returns a single article. An unknown ID returns an Error
+// matching ErrNotFound.
+func (c *Client) GetArticle(ctx context.Context, id int) (*models.Article, error) {
+	var article models.Article
+	if err := c.do(ctx, http.MethodGet, "/articles/"+strconv.Itoa(id), nil, nil, &article); err != nil {
+		return nil, err
+	}
+	return &article, nil
+}
+
+// ListArticles returns a page of articles, ordered by ID, using the
+// server's default page size. Pages start at 1; a page below 1 returns
+// every article.
+func (c *Client) ListArticles(ctx context.Context, page int) ([]models.Article, error) {
+	var query url.Values
+	if page >= 1 {
+		query = url.Values{"page": {strconv.Itoa(page)}}
+	}
+	var articles []models.Article
+	if err := c.do(ctx, http.MethodGet, "/articles", query, nil, &articles); err != nil {
+		return nil, err
+	}
+	return articles, nil
+}
+
+// do sends a request with an optional JSON body and decodes a successful
+// response into out. Responses in the envelope format are unwrapped.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	target := c.baseURL + "/api" + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return decodeError(resp.StatusCode, data)
+	}
+
+	var envelope struct {
+		Data json.RawMessage      `json:"data"`
+		Meta *models.ResponseMeta `json:"meta"`
+	}
+	if json.Unmarshal(data, &envelope) == nil && envelope.Meta != nil {
+		data = envelope.Data
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// decodeError converts an error response, bare or enveloped, into an Error
+func decodeError(statusCode int, data []byte) error {
+	apiErr := &Error{StatusCode: statusCode}
+
+	var envelope struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil || len(envelope.Error) == 0 {
+		apiErr.Message = http.StatusText(statusCode)
+		return apiErr
+	}
+
+	var enveloped models.EnvelopeError
+	if json.Unmarshal(envelope.Error, &enveloped) == nil {
+		apiErr.Message = enveloped.Message
+		apiErr.Detail = enveloped.Detail
+		apiErr.Fields = enveloped.Fields
+		return apiErr
+	}
+
+	var bare models.ErrorResponse
+	if json.Unmarshal(data, &bare) == nil {
+		apiErr.Message = bare.Error
+		apiErr.Detail = bare.Message
+		apiErr.Fields = bare.Fields
+	}
+	return apiErr
+}
@@ -0,0 +1,166 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"event-to-insight/internal/ai"
+	"event-to-insight/internal/config"
+	"event-to-insight/internal/database"
+	"event-to-insight/internal/handlers"
+	"event-to-insight/internal/router"
+	"event-to-insight/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer runs the real router against a fresh database with the
+// mock AI. envelope switches on the response envelope.
+func newTestServer(t *testing.T, dbPath string, envelope bool) *httptest.Server {
+	db, err := database.NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	require.NoError(t, db.Initialize())
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbPath)
+	})
+
+	cfg := config.DefaultConfig()
+	handler := handlers.NewSearchHandler(service.NewSearchService(db, ai.NewMockAIService()))
+	handler.SetResponseEnvelope(envelope)
+
+	server := httptest.NewServer(router.SetupRouterWithConfig(handler, cfg))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t, "test_client.db", false)
+	c := New(server.URL + "/")
+
+	t.Run("Search", func(t *testing.T) {
+		response, err := c.Search(ctx, "How do I reset my password?")
+		require.NoError(t, err)
+
+		assert.Equal(t, "How do I reset my password?", response.Query)
+		assert.NotEmpty(t, response.AISummaryAnswer)
+		assert.NotZero(t, response.QueryID)
+		require.NotEmpty(t, response.AIRelevantArticles)
+		assert.Equal(t, "Password Reset Instructions", response.AIRelevantArticles[0].Title)
+	})
+
+	t.Run("SearchValidationError", func(t *testing.T) {
+		_, err := c.Search(ctx, "   ")
+
+		var apiErr *Error
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+		assert.Equal(t, "Validation failed", apiErr.Message)
+		require.Len(t, apiErr.Fields, 1)
+		assert.Equal(t, "query", apiErr.Fields[0].Field)
+	})
+
+	t.Run("GetArticle", func(t *testing.T) {
+		article, err := c.GetArticle(ctx, 2)
+		require.NoError(t, err)
+
+		assert.Equal(t, 2, article.ID)
+		assert.Equal(t, "VPN Connection Setup", article.Title)
+	})
+
+	t.Run("GetArticleNotFound", func(t *testing.T) {
+		_, err := c.GetArticle(ctx, 999)
+
+		assert.ErrorIs(t, err, ErrNotFound)
+		var apiErr *Error
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, "Article not found", apiErr.Message)
+	})
+
+	t.Run("ListArticles", func(t *testing.T) {
+		all, err := c.ListArticles(ctx, 0)
+		require.NoError(t, err)
+		assert.Len(t, all, 10)
+
+		first, err := c.ListArticles(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, all, first)
+
+		beyond, err := c.ListArticles(ctx, 2)
+		require.NoError(t, err)
+		assert.Empty(t, beyond)
+	})
+
+	t.Run("CancelledContext", func(t *testing.T) {
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := c.GetArticle(cancelled, 1)
+
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestClientEnvelope(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t, "test_client_envelope.db", true)
+	c := New(server.URL)
+
+	t.Run("UnwrapsData", func(t *testing.T) {
+		article, err := c.GetArticle(ctx, 1)
+		require.NoError(t, err)
+
+		assert.Equal(t, "Password Reset Instructions", article.Title)
+	})
+
+	t.Run("UnwrapsErrors", func(t *testing.T) {
+		_, err := c.Search(ctx, "")
+
+		var apiErr *Error
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+		assert.Equal(t, "Validation failed", apiErr.Message)
+		assert.NotEmpty(t, apiErr.Fields)
+
+		_, err = c.GetArticle(ctx, 999)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestClientTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer slow.Close()
+
+	c := New(slow.URL, WithTimeout(50*time.Millisecond))
+
+	_, err := c.GetArticle(context.Background(), 1)
+
+	require.Error(t, err)
+	var apiErr *Error
+	assert.False(t, errors.As(err, &apiErr))
+}
+
+func TestClientNonJSONError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upstream unavailable", http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	_, err := New(server.URL).Search(context.Background(), "vpn")
+
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadGateway, apiErr.StatusCode)
+	assert.Equal(t, "Bad Gateway", apiErr.Message)
+}
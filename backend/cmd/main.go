@@ -1,19 +1,56 @@
 package main
 
 import (
+	"context"
 	"event-to-insight/internal/ai"
+	"event-to-insight/internal/alert"
+	"event-to-insight/internal/audit"
 	"event-to-insight/internal/config"
 	"event-to-insight/internal/database"
 	"event-to-insight/internal/handlers"
 	"event-to-insight/internal/router"
 	"event-to-insight/internal/service"
+	"event-to-insight/internal/tracing"
+	"flag"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+// backfillKeywordLimit is how many keywords -backfill-keywords extracts per
+// article
+const backfillKeywordLimit = 8
+
+// shutdownTimeout bounds how long in-flight requests may take to finish
+// once the server is asked to stop
+const shutdownTimeout = 30 * time.Second
+
 func main() {
+	// Failures once the server is set up set exitCode rather than exiting,
+	// so the deferred closes still run. This defer runs after all of them.
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
+	handlers.SetStartTime(time.Now())
+
+	reindex := flag.Bool("reindex", false, "rebuild the article search index and exit")
+	backup := flag.String("backup", "", "write a snapshot of the database to the given path and exit")
+	backfillKeywords := flag.Bool("backfill-keywords", false, "extract keywords for articles that have none and exit")
+	flag.Parse()
+
 	// Load configuration
 	cfg := config.LoadConfig()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	// Initialize database
 	db, err := database.NewSQLiteDB(cfg.DBPath)
@@ -22,38 +59,185 @@ func main() {
 	}
 	defer db.Close()
 
+	db.SetSeedURL(cfg.SeedURL)
 	if err := db.Initialize(); err != nil {
 		log.Fatalf("Failed to initialize database schema: %v", err)
 	}
+	db.SetQueryTimeout(cfg.DBQueryTimeout)
+	db.SetBusyRetry(cfg.DBBusyRetries, cfg.DBBusyBackoff)
+	db.SetArticleIDStorage(database.ArticleIDStorage(cfg.ArticleIDStorage))
+
+	if *reindex {
+		count, err := db.Reindex(context.Background())
+		if err != nil {
+			log.Fatalf("Failed to reindex articles: %v", err)
+		}
+		log.Printf("Reindexed %d articles", count)
+		return
+	}
+
+	if *backfillKeywords {
+		count, err := db.BackfillKeywords(context.Background(), cfg.Stopwords, backfillKeywordLimit)
+		if err != nil {
+			log.Fatalf("Failed to backfill keywords: %v", err)
+		}
+		log.Printf("Added keywords to %d articles", count)
+		return
+	}
+
+	if *backup != "" {
+		if err := db.Backup(context.Background(), *backup); err != nil {
+			log.Fatalf("Failed to back up database: %v", err)
+		}
+		log.Printf("Backed up database to %s", *backup)
+		return
+	}
+
+	// Tracing is a no-op unless a collector is configured
+	var store database.DatabaseInterface = db
+	if cfg.OTLPEndpoint != "" {
+		shutdown, err := tracing.Setup(context.Background(), cfg.OTLPEndpoint, cfg.TracingServiceName)
+		if err != nil {
+			log.Fatalf("Failed to set up tracing: %v", err)
+		}
+		defer shutdown(context.Background())
+
+		store = database.NewTracedDB(db)
+		log.Printf("Exporting traces to %s", cfg.OTLPEndpoint)
+	}
 
 	// Initialize AI service
 	var aiService ai.AIServiceInterface
-	if cfg.UseMockAI || cfg.GeminiKey == "" {
+	if cfg.AIProvider() == config.ProviderMock {
 		log.Println("Using Mock AI service")
-		aiService = ai.NewMockAIService()
+		mockAI := ai.NewMockAIServiceWithWeights(cfg.TitleMatchWeight, cfg.ContentMatchWeight)
+		mockAI.SetFallbackSummary(cfg.FallbackSummary)
+		mockAI.SetPromptFields(ai.PromptFields(cfg.PromptArticleFields), cfg.PromptExcerptChars)
+		aiService = mockAI
 	} else {
 		log.Println("Using Gemini AI service")
-		aiService, err = ai.NewGeminiService(cfg.GeminiKey)
+		safetyThreshold, err := ai.ParseSafetyThreshold(cfg.GeminiSafetyThreshold)
+		if err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+		aiService, err = ai.NewGeminiService(cfg.GeminiKey,
+			ai.WithMaxArticleChars(cfg.PromptMaxArticleChars),
+			ai.WithArticleKeywords(cfg.AIContextKeywords),
+			ai.WithPromptFields(ai.PromptFields(cfg.PromptArticleFields), cfg.PromptExcerptChars),
+			ai.WithSummaryCleanup(cfg.AISummaryCleanup),
+			ai.WithFallbackSummary(cfg.FallbackSummary),
+			ai.WithTemperature(float32(cfg.GeminiTemperature)),
+			ai.WithTopP(float32(cfg.GeminiTopP)),
+			ai.WithMaxOutputTokens(int32(cfg.GeminiMaxOutputTokens)),
+			ai.WithSafetyThreshold(safetyThreshold),
+		)
 		if err != nil {
 			log.Fatalf("Failed to initialize Gemini AI service: %v", err)
 		}
 	}
 
 	// Initialize services
-	searchService := service.NewSearchService(db, aiService)
+	searchService := service.NewSearchServiceWithConfig(store, aiService, cfg)
+	if cfg.Debug {
+		searchService.SetLogger(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	}
+
+	if cfg.AuditAI {
+		auditFile, err := os.OpenFile(cfg.AuditAIPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			log.Fatalf("Failed to open AI audit log: %v", err)
+		}
+		defer auditFile.Close()
+
+		auditLogger := audit.NewLogger(auditFile)
+		defer auditLogger.Close()
+
+		searchService.SetAuditLogger(auditLogger)
+		log.Printf("Auditing AI prompts and responses to %s", cfg.AuditAIPath)
+	}
+
+	if cfg.Warmup {
+		// Readiness is reported once warmup finishes or times out
+		warmupCtx, cancelWarmup := context.WithTimeout(context.Background(), cfg.WarmupTimeout)
+		done := searchService.StartWarmup(warmupCtx, cfg.WarmupQueries)
+		go func() {
+			<-done
+			cancelWarmup()
+		}()
+	}
+
+	if cfg.AlertWebhookURL != "" {
+		webhook := alert.NewWebhook(cfg.AlertWebhookURL)
+		defer webhook.Close()
+
+		searchService.SetAlertWebhook(webhook)
+		log.Printf("Alerting after %d AI fallbacks in a row", cfg.AlertFallbackThreshold)
+	}
 
 	// Initialize handlers
 	searchHandler := handlers.NewSearchHandler(searchService)
+	searchHandler.SetPageSizes(cfg.DefaultPageSize, cfg.MaxPageSize)
+	searchHandler.SetResponseEnvelope(cfg.ResponseEnvelope)
+	searchHandler.SetPrettyJSON(cfg.PrettyJSON)
+	searchHandler.SetPublicArticleFields(cfg.PublicArticleFields)
+	searchHandler.SetInFlight(handlers.NewInFlight(cfg.MaxInFlightRequests))
+	searchHandler.SetDefaultLanguage(cfg.DefaultLanguage)
+	searchHandler.SetArticleCacheMaxAge(cfg.ArticleCacheMaxAge)
+	searchHandler.SetArticleLimits(cfg.ArticleMaxTitleChars, cfg.ArticleMaxContentChars)
+	// Invalid timezones are rejected when the configuration is validated
+	responseLocation, _ := cfg.ResponseLocation()
+	searchHandler.SetResponseTimezone(responseLocation)
+	if cfg.SearchDailyQuota > 0 {
+		// Invalid entries are rejected when the configuration is validated
+		exempt, _ := cfg.SearchQuotaExemptPrefixes()
+		searchHandler.SetSearchQuota(handlers.NewSearchQuota(cfg.SearchDailyQuota, exempt, handlers.NewMemoryQuotaStore()))
+	}
+
+	if cfg.AdminAPIKey == "" {
+		log.Println("WARNING: ADMIN_API_KEY is not set, admin endpoints are unauthenticated")
+	}
 
 	// Setup router
-	r := router.SetupRouter(searchHandler)
+	r := router.SetupRouterWithConfig(searchHandler, cfg)
 
 	// Start server
 	log.Printf("Server starting on port %s", cfg.Port)
 	log.Printf("Using database: %s", cfg.DBPath)
 	log.Printf("Health check: http://localhost:%s/api/health", cfg.Port)
 
-	if err := http.ListenAndServe(":"+cfg.Port, r); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	server := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           r,
+		ReadHeaderTimeout: cfg.ServerReadHeaderTimeout,
+		ReadTimeout:       cfg.ServerReadTimeout,
+		WriteTimeout:      cfg.ServerWriteTimeout,
+		IdleTimeout:       cfg.ServerIdleTimeout,
 	}
+
+	// Stop on SIGINT or SIGTERM. Returning, rather than exiting, lets the
+	// deferred closes flush the alert webhook and audit log.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		log.Printf("Server failed to start: %v", err)
+		exitCode = 1
+	case <-ctx.Done():
+		log.Println("Shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Server did not shut down cleanly: %v", err)
+		}
+	}
+
+	// Summaries of imported articles may still be running, and may still
+	// send alerts or audit entries
+	searchService.Wait()
 }
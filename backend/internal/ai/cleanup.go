@@ -0,0 +1,77 @@
+package ai
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	// fillerPattern matches conversational openers such as "Sure!" or
+	// "Here's what you need to do:" that add nothing to the answer
+	fillerPattern = regexp.MustCompile(`(?i)^(?:(?:sure|certainly|of course|absolutely|okay|great question|i'd be happy to help|happy to help)\b[!.,]*\s*|here(?:'s| is| are)\s+(?:a |an |the |some )?(?:quick |brief |short |concise )?(?:summary|answer|overview|how|what|steps|information)\b[^:.!?]{0,60}:\s*)`)
+
+	headingPattern  = regexp.MustCompile(`^#{1,6}\s+`)
+	listItemPattern = regexp.MustCompile(`^(?:[-*+•]|\d+[.)])\s+`)
+	linkPattern     = regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`)
+	boldPattern     = regexp.MustCompile(`(\*\*|__)(.+?)(\*\*|__)`)
+	italicPattern   = regexp.MustCompile(`\*([^*\s](?:[^*]*[^*\s])?)\*`)
+	codePattern     = regexp.MustCompile("`([^`]*)`")
+)
+
+// cleanSummary turns a model-written summary into plain text. Markdown
+// headings, list markers and inline formatting are removed, list items are
+// joined into sentences, and leading filler phrases are dropped.
+func cleanSummary(summary string) string {
+	var sentences []string
+	for _, line := range strings.Split(summary, "\n") {
+		line = strings.TrimSpace(line)
+		line = headingPattern.ReplaceAllString(line, "")
+		line = listItemPattern.ReplaceAllString(line, "")
+		line = stripInlineMarkdown(line)
+		if line == "" {
+			continue
+		}
+
+		// Each list item or line becomes its own sentence
+		if n := len(sentences); n > 0 && !endsSentence(sentences[n-1]) {
+			sentences[n-1] += "."
+		}
+		sentences = append(sentences, line)
+	}
+
+	text := strings.Join(strings.Fields(strings.Join(sentences, " ")), " ")
+	for {
+		trimmed := fillerPattern.ReplaceAllString(text, "")
+		if trimmed == text {
+			return text
+		}
+		text = capitalizeFirst(trimmed)
+	}
+}
+
+// stripInlineMarkdown removes links, emphasis and code spans, keeping their text
+func stripInlineMarkdown(text string) string {
+	text = linkPattern.ReplaceAllString(text, "$1")
+	text = boldPattern.ReplaceAllString(text, "$2")
+	text = italicPattern.ReplaceAllString(text, "$1")
+	text = codePattern.ReplaceAllString(text, "$1")
+	return strings.TrimSpace(text)
+}
+
+// endsSentence reports whether text already ends with punctuation
+func endsSentence(text string) bool {
+	r, _ := utf8.DecodeLastRuneInString(text)
+	return strings.ContainsRune(".!?:;", r)
+}
+
+// capitalizeFirst upper-cases the first letter, which is often left in lower
+// case after a filler phrase is removed
+func capitalizeFirst(text string) string {
+	r, size := utf8.DecodeRuneInString(text)
+	if r == utf8.RuneError {
+		return text
+	}
+	return string(unicode.ToUpper(r)) + text[size:]
+}
@@ -0,0 +1,67 @@
+package ai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanSummary(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "PlainText",
+			input:    "Go to the login page and click Forgot Password.",
+			expected: "Go to the login page and click Forgot Password.",
+		},
+		{
+			name:     "FillerPrefix",
+			input:    "Sure! Here's how to reset your password: go to the login page and click Forgot Password.",
+			expected: "Go to the login page and click Forgot Password.",
+		},
+		{
+			name:     "CertainlyPrefix",
+			input:    "Certainly, I'd be happy to help! Restart the print spooler service.",
+			expected: "Restart the print spooler service.",
+		},
+		{
+			name:     "BulletList",
+			input:    "Here is a quick summary:\n- Open **Settings**\n- Choose *Network*\n- Click `Connect`",
+			expected: "Open Settings. Choose Network. Click Connect",
+		},
+		{
+			name:     "NumberedListWithHeading",
+			input:    "## VPN Setup\n1. Install the client.\n2) Sign in with your __company__ account",
+			expected: "VPN Setup. Install the client. Sign in with your company account",
+		},
+		{
+			name:     "Link",
+			input:    "See the [self-service portal](https://portal.example.com) to reset it.",
+			expected: "See the self-service portal to reset it.",
+		},
+		{
+			name:     "MeaningfulHerePhraseKept",
+			input:    "Here is the VPN server address: vpn.example.com",
+			expected: "Here is the VPN server address: vpn.example.com",
+		},
+		{
+			name:     "LowercaseStartKept",
+			input:    "iPhone mail needs an app password.",
+			expected: "iPhone mail needs an app password.",
+		},
+		{
+			name:     "Empty",
+			input:    "",
+			expected: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, cleanSummary(tc.input))
+		})
+	}
+}
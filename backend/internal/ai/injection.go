@@ -0,0 +1,50 @@
+package ai
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Delimiters around the user's query in the prompt. The model is told that
+// everything between them is data to answer, not instructions to follow.
+const (
+	queryStartTag = "<user_query>"
+	queryEndTag   = "</user_query>"
+)
+
+// injectionPatterns match phrases commonly used to override a prompt's
+// instructions. Matching is a hint, not a guarantee: delimiting the query
+// is what protects the prompt.
+var injectionPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\b(ignore|disregard|forget|override)\b.{0,20}\b(previous|prior|above|earlier|preceding|your|all|the|system)\b.{0,20}\b(instructions?|rules|prompts?|directions|guidelines)\b`),
+	regexp.MustCompile(`\b(reveal|show|print|output|repeat|dump)\b.{0,30}\b(system prompt|your (instructions|prompt|rules)|all (the )?articles?( contents?)?|every article)\b`),
+	regexp.MustCompile(`\byou are (now|no longer)\b`),
+	regexp.MustCompile(`\b(act|pretend|behave) as\b`),
+	regexp.MustCompile(`\bnew instructions\b`),
+	regexp.MustCompile(`</?\s*user_query\s*>`),
+}
+
+// queryTagPattern matches opening and closing query tags in any case or
+// spacing
+var queryTagPattern = regexp.MustCompile(`(?i)<\s*/?\s*user_query\s*>`)
+
+// SuspectedInjection reports whether query contains a phrase typical of a
+// prompt injection attempt, such as "ignore previous instructions"
+func SuspectedInjection(query string) bool {
+	normalized := strings.Join(strings.Fields(strings.ToLower(query)), " ")
+	for _, pattern := range injectionPatterns {
+		if pattern.MatchString(normalized) {
+			return true
+		}
+	}
+	return false
+}
+
+// delimitQuery wraps query in the query tags. Tags inside the query are
+// defanged so it cannot close the block early and append instructions.
+func delimitQuery(query string) string {
+	query = queryTagPattern.ReplaceAllStringFunc(query, func(tag string) string {
+		return strings.NewReplacer("<", "‹", ">", "›").Replace(tag)
+	})
+	return queryStartTag + "\n" + query + "\n" + queryEndTag
+}
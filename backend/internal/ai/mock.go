@@ -1,48 +1,127 @@
 package ai
 
 import (
+	"context"
 	"event-to-insight/internal/models"
+	"event-to-insight/internal/textutil"
+	"sort"
 	"strings"
 )
 
+// mockKeywords are the topics the mock understands when matching articles
+var mockKeywords = []string{
+	"password",
+	"vpn",
+	"email",
+	"printer",
+	"software",
+	"backup",
+	"antivirus",
+	"remote",
+}
+
 // MockAIService implements AIServiceInterface for testing
-type MockAIService struct{}
+type MockAIService struct {
+	titleWeight     float64
+	contentWeight   float64
+	fallbackSummary string
+
+	// promptFields and excerptChars limit what of each article is matched
+	// to what a prompt built with them would carry
+	promptFields PromptFields
+	excerptChars int
+}
 
-// NewMockAIService creates a new mock AI service
+// NewMockAIService creates a new mock AI service using the default match
+// weights
 func NewMockAIService() *MockAIService {
-	return &MockAIService{}
+	return NewMockAIServiceWithWeights(textutil.DefaultTitleWeight, textutil.DefaultContentWeight)
+}
+
+// NewMockAIServiceWithWeights creates a mock AI service that weighs keyword
+// matches in article titles and contents as given
+func NewMockAIServiceWithWeights(titleWeight, contentWeight float64) *MockAIService {
+	return &MockAIService{titleWeight: titleWeight, contentWeight: contentWeight, fallbackSummary: DefaultFallbackSummary}
+}
+
+// SetFallbackSummary sets the summary given when no article matches the
+// query. An empty summary keeps DefaultFallbackSummary.
+func (m *MockAIService) SetFallbackSummary(summary string) {
+	if summary == "" {
+		summary = DefaultFallbackSummary
+	}
+	m.fallbackSummary = summary
+}
+
+// SetPromptFields matches queries only against the article fields a Gemini
+// prompt would carry with WithPromptFields, so the mock behaves like the
+// model given the same context
+func (m *MockAIService) SetPromptFields(fields PromptFields, excerptChars int) {
+	m.promptFields = fields
+	m.excerptChars = excerptChars
+}
+
+// promptContent returns the part of content a prompt would carry
+func (m *MockAIService) promptContent(content string) string {
+	switch m.promptFields {
+	case PromptFieldsTitle:
+		return ""
+	case PromptFieldsExcerpt:
+		excerpt, _ := textutil.Truncate(content, m.excerptChars)
+		return excerpt
+	default:
+		return content
+	}
+}
+
+// mockSummaryChars bounds the summaries written by the mock
+const mockSummaryChars = 200
+
+// SummarizeArticle returns the start of the article's content, with
+// whitespace collapsed, as its summary
+func (m *MockAIService) SummarizeArticle(ctx context.Context, article models.Article) (string, error) {
+	summary, _ := textutil.Truncate(strings.Join(strings.Fields(article.Content), " "), mockSummaryChars)
+	return summary, nil
+}
+
+// Ping always succeeds, since the mock has no backend
+func (m *MockAIService) Ping(ctx context.Context) error {
+	return nil
 }
 
 // AnalyzeQuery provides mock analysis of queries
-func (m *MockAIService) AnalyzeQuery(query string, articles []models.Article) (*AIAnalysisResult, error) {
+func (m *MockAIService) AnalyzeQuery(ctx context.Context, query string, articles []models.Article) (*AIAnalysisResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	query = strings.ToLower(query)
 
 	var relevantArticles []int
 	var summary string
+	scores := make(map[int]float64)
 
-	// Simple keyword matching logic for mock
+	// Simple keyword matching logic for mock. Each keyword is checked
+	// independently so an article covering several topics in the query
+	// is still matched, and each article is only listed once.
+	var queryKeywords []string
+	for _, keyword := range mockKeywords {
+		if strings.Contains(query, keyword) {
+			queryKeywords = append(queryKeywords, keyword)
+		}
+	}
 	for _, article := range articles {
-		articleText := strings.ToLower(article.Title + " " + article.Content)
-
-		if strings.Contains(query, "password") && strings.Contains(articleText, "password") {
-			relevantArticles = append(relevantArticles, article.ID)
-		} else if strings.Contains(query, "vpn") && strings.Contains(articleText, "vpn") {
-			relevantArticles = append(relevantArticles, article.ID)
-		} else if strings.Contains(query, "email") && strings.Contains(articleText, "email") {
-			relevantArticles = append(relevantArticles, article.ID)
-		} else if strings.Contains(query, "printer") && strings.Contains(articleText, "printer") {
-			relevantArticles = append(relevantArticles, article.ID)
-		} else if strings.Contains(query, "software") && strings.Contains(articleText, "software") {
-			relevantArticles = append(relevantArticles, article.ID)
-		} else if strings.Contains(query, "backup") && strings.Contains(articleText, "backup") {
-			relevantArticles = append(relevantArticles, article.ID)
-		} else if strings.Contains(query, "antivirus") && strings.Contains(articleText, "antivirus") {
-			relevantArticles = append(relevantArticles, article.ID)
-		} else if strings.Contains(query, "remote") && strings.Contains(articleText, "remote") {
+		score := textutil.MatchScore(article.Title, m.promptContent(article.Content), queryKeywords, m.titleWeight, m.contentWeight)
+		if score > 0 {
 			relevantArticles = append(relevantArticles, article.ID)
+			scores[article.ID] = score
 		}
 	}
 
+	// Best matches first, keeping article order between equal scores
+	sort.SliceStable(relevantArticles, func(i, j int) bool {
+		return scores[relevantArticles[i]] > scores[relevantArticles[j]]
+	})
+
 	// Generate summary based on query type
 	if strings.Contains(query, "password") {
 		summary = "To reset your password, go to the login page, click 'Forgot Password', enter your email address, and follow the instructions sent to your email. The reset link expires in 24 hours."
@@ -55,11 +134,12 @@ func (m *MockAIService) AnalyzeQuery(query string, articles []models.Article) (*
 	} else if len(relevantArticles) > 0 {
 		summary = "I found relevant information in our knowledge base that should help with your query. Please review the articles below for detailed instructions."
 	} else {
-		summary = "I couldn't find specific information for your query in our knowledge base. Please contact IT support for further assistance, or try rephrasing your question."
+		summary = m.fallbackSummary
 	}
 
 	return &AIAnalysisResult{
 		Summary:          summary,
 		RelevantArticles: relevantArticles,
+		Scores:           scores,
 	}, nil
 }
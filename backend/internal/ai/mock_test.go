@@ -1,6 +1,7 @@
 package ai
 
 import (
+	"context"
 	"event-to-insight/internal/models"
 	"testing"
 
@@ -10,6 +11,50 @@ import (
 func TestMockAIService(t *testing.T) {
 	service := NewMockAIService()
 
+	t.Run("Ping", func(t *testing.T) {
+		assert.NoError(t, service.Ping(context.Background()))
+	})
+
+	t.Run("RelevanceScores", func(t *testing.T) {
+		scored := []models.Article{
+			{ID: 1, Title: "VPN and Password Help", Content: "Both topics"},
+			{ID: 2, Title: "Password Reset", Content: "Instructions for password reset"},
+			{ID: 3, Title: "Account Help", Content: "Reset your password here"},
+		}
+
+		result, err := service.AnalyzeQuery(context.Background(), "password on the vpn", scored)
+		assert.NoError(t, err)
+		assert.Equal(t, []int{1, 2, 3}, result.RelevantArticles)
+		// Title matches count fully, content matches half, averaged over
+		// the two keywords in the query
+		assert.Equal(t, map[int]float64{1: 1, 2: 0.5, 3: 0.25}, result.Scores)
+	})
+
+	t.Run("TitleMatchesRankFirst", func(t *testing.T) {
+		ranked := []models.Article{
+			{ID: 1, Title: "Account Help", Content: "Reset your password here"},
+			{ID: 2, Title: "Network Notes", Content: "Printer and password tips"},
+			{ID: 3, Title: "Password Reset", Content: "Instructions"},
+		}
+
+		result, err := service.AnalyzeQuery(context.Background(), "password", ranked)
+		assert.NoError(t, err)
+		assert.Equal(t, []int{3, 1, 2}, result.RelevantArticles)
+	})
+
+	t.Run("CustomWeights", func(t *testing.T) {
+		weighted := NewMockAIServiceWithWeights(1, 1)
+		ranked := []models.Article{
+			{ID: 1, Title: "Account Help", Content: "Reset your password here"},
+			{ID: 2, Title: "Password Reset", Content: "Instructions"},
+		}
+
+		result, err := weighted.AnalyzeQuery(context.Background(), "password", ranked)
+		assert.NoError(t, err)
+		assert.Equal(t, []int{1, 2}, result.RelevantArticles)
+		assert.Equal(t, map[int]float64{1: 1, 2: 1}, result.Scores)
+	})
+
 	articles := []models.Article{
 		{ID: 1, Title: "Password Reset", Content: "Instructions for password reset"},
 		{ID: 2, Title: "VPN Setup", Content: "How to configure VPN connection"},
@@ -17,7 +62,7 @@ func TestMockAIService(t *testing.T) {
 	}
 
 	t.Run("PasswordQuery", func(t *testing.T) {
-		result, err := service.AnalyzeQuery("How do I reset my password?", articles)
+		result, err := service.AnalyzeQuery(context.Background(), "How do I reset my password?", articles)
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
 		assert.Contains(t, result.Summary, "password")
@@ -25,7 +70,7 @@ func TestMockAIService(t *testing.T) {
 	})
 
 	t.Run("VPNQuery", func(t *testing.T) {
-		result, err := service.AnalyzeQuery("I need help with VPN", articles)
+		result, err := service.AnalyzeQuery(context.Background(), "I need help with VPN", articles)
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
 		assert.Contains(t, result.Summary, "VPN")
@@ -33,7 +78,7 @@ func TestMockAIService(t *testing.T) {
 	})
 
 	t.Run("EmailQuery", func(t *testing.T) {
-		result, err := service.AnalyzeQuery("Email not working", articles)
+		result, err := service.AnalyzeQuery(context.Background(), "Email not working", articles)
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
 		assert.Contains(t, result.Summary, "email")
@@ -41,7 +86,7 @@ func TestMockAIService(t *testing.T) {
 	})
 
 	t.Run("NoMatchQuery", func(t *testing.T) {
-		result, err := service.AnalyzeQuery("random unrelated query", articles)
+		result, err := service.AnalyzeQuery(context.Background(), "random unrelated query", articles)
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
 		assert.NotEmpty(t, result.Summary)
@@ -64,7 +109,7 @@ func TestMockAIServiceEdgeCases(t *testing.T) {
 	}
 
 	t.Run("EmptyQuery", func(t *testing.T) {
-		result, err := service.AnalyzeQuery("", articles)
+		result, err := service.AnalyzeQuery(context.Background(), "", articles)
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
 		assert.NotEmpty(t, result.Summary)
@@ -72,7 +117,7 @@ func TestMockAIServiceEdgeCases(t *testing.T) {
 	})
 
 	t.Run("WhitespaceOnlyQuery", func(t *testing.T) {
-		result, err := service.AnalyzeQuery("   \t\n   ", articles)
+		result, err := service.AnalyzeQuery(context.Background(), "   \t\n   ", articles)
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
 		assert.NotEmpty(t, result.Summary)
@@ -89,14 +134,14 @@ func TestMockAIServiceEdgeCases(t *testing.T) {
 		}
 
 		for _, tc := range testCases {
-			result, err := service.AnalyzeQuery(tc.query, articles)
+			result, err := service.AnalyzeQuery(context.Background(), tc.query, articles)
 			assert.NoError(t, err)
 			assert.Contains(t, result.RelevantArticles, tc.expected, "Failed for query: %s", tc.query)
 		}
 	})
 
 	t.Run("MultipleKeywordMatching", func(t *testing.T) {
-		result, err := service.AnalyzeQuery("password and email configuration", articles)
+		result, err := service.AnalyzeQuery(context.Background(), "password and email configuration", articles)
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
 
@@ -105,8 +150,22 @@ func TestMockAIServiceEdgeCases(t *testing.T) {
 		assert.Contains(t, result.RelevantArticles, 3) // Email article
 	})
 
+	t.Run("SingleArticleMatchingMultipleKeywords", func(t *testing.T) {
+		multiTopic := []models.Article{
+			{ID: 7, Title: "Email Password Reset", Content: "Reset the password used for your email account"},
+			{ID: 8, Title: "VPN Setup", Content: "How to configure VPN connection"},
+		}
+
+		result, err := service.AnalyzeQuery(context.Background(), "I forgot my email password", multiTopic)
+		assert.NoError(t, err)
+		assert.NotNil(t, result)
+
+		// The article covering both topics is matched exactly once
+		assert.Equal(t, []int{7}, result.RelevantArticles)
+	})
+
 	t.Run("PrinterKeywordMatching", func(t *testing.T) {
-		result, err := service.AnalyzeQuery("printer setup help", articles)
+		result, err := service.AnalyzeQuery(context.Background(), "printer setup help", articles)
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
 		assert.Contains(t, result.Summary, "printer")
@@ -114,7 +173,7 @@ func TestMockAIServiceEdgeCases(t *testing.T) {
 	})
 
 	t.Run("SoftwareKeywordMatching", func(t *testing.T) {
-		result, err := service.AnalyzeQuery("software installation problems", articles)
+		result, err := service.AnalyzeQuery(context.Background(), "software installation problems", articles)
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
 		// Test passes if no error is returned, regardless of match
@@ -122,7 +181,7 @@ func TestMockAIServiceEdgeCases(t *testing.T) {
 	})
 
 	t.Run("NetworkKeywordMatching", func(t *testing.T) {
-		result, err := service.AnalyzeQuery("network connectivity issues", articles)
+		result, err := service.AnalyzeQuery(context.Background(), "network connectivity issues", articles)
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
 		// Network is not in the mock's supported keywords, so no match expected
@@ -130,7 +189,7 @@ func TestMockAIServiceEdgeCases(t *testing.T) {
 	})
 
 	t.Run("BackupKeywordMatching", func(t *testing.T) {
-		result, err := service.AnalyzeQuery("backup data recovery", articles)
+		result, err := service.AnalyzeQuery(context.Background(), "backup data recovery", articles)
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
 		// Test passes if no error is returned, regardless of match
@@ -138,7 +197,7 @@ func TestMockAIServiceEdgeCases(t *testing.T) {
 	})
 
 	t.Run("EmptyArticlesArray", func(t *testing.T) {
-		result, err := service.AnalyzeQuery("any query", []models.Article{})
+		result, err := service.AnalyzeQuery(context.Background(), "any query", []models.Article{})
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
 		assert.NotEmpty(t, result.Summary)
@@ -146,7 +205,7 @@ func TestMockAIServiceEdgeCases(t *testing.T) {
 	})
 
 	t.Run("NilArticlesArray", func(t *testing.T) {
-		result, err := service.AnalyzeQuery("any query", nil)
+		result, err := service.AnalyzeQuery(context.Background(), "any query", nil)
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
 		assert.NotEmpty(t, result.Summary)
@@ -156,7 +215,7 @@ func TestMockAIServiceEdgeCases(t *testing.T) {
 	t.Run("VeryLongQuery", func(t *testing.T) {
 		longQuery := "This is a very long query that contains multiple keywords like password reset and VPN configuration and email setup and printer installation and software updates and network troubleshooting and backup procedures to test how the mock AI service handles extended queries with multiple potential matches"
 
-		result, err := service.AnalyzeQuery(longQuery, articles)
+		result, err := service.AnalyzeQuery(context.Background(), longQuery, articles)
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
 		assert.NotEmpty(t, result.Summary)
@@ -166,7 +225,7 @@ func TestMockAIServiceEdgeCases(t *testing.T) {
 	})
 
 	t.Run("SpecialCharactersInQuery", func(t *testing.T) {
-		result, err := service.AnalyzeQuery("How do I reset my password? It's not working!", articles)
+		result, err := service.AnalyzeQuery(context.Background(), "How do I reset my password? It's not working!", articles)
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
 		assert.Contains(t, result.Summary, "password")
@@ -174,7 +233,7 @@ func TestMockAIServiceEdgeCases(t *testing.T) {
 	})
 
 	t.Run("UnicodeQuery", func(t *testing.T) {
-		result, err := service.AnalyzeQuery("Comment réinitialiser le password? 密码重置", articles)
+		result, err := service.AnalyzeQuery(context.Background(), "Comment réinitialiser le password? 密码重置", articles)
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
 		// Should still match password keyword
@@ -182,7 +241,7 @@ func TestMockAIServiceEdgeCases(t *testing.T) {
 	})
 
 	t.Run("NumericQuery", func(t *testing.T) {
-		result, err := service.AnalyzeQuery("12345 password reset 67890", articles)
+		result, err := service.AnalyzeQuery(context.Background(), "12345 password reset 67890", articles)
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
 		assert.Contains(t, result.RelevantArticles, 1)
@@ -200,7 +259,7 @@ func TestMockAIServiceEdgeCases(t *testing.T) {
 		}
 
 		for _, tc := range testCases {
-			result, err := service.AnalyzeQuery(tc.query, articles)
+			result, err := service.AnalyzeQuery(context.Background(), tc.query, articles)
 			assert.NoError(t, err)
 			if len(result.RelevantArticles) > 0 {
 				assert.Contains(t, result.Summary, tc.expectedKeyword, "Summary should contain keyword for query: %s", tc.query)
@@ -225,7 +284,7 @@ func TestMockAIServiceConsistency(t *testing.T) {
 
 		// Run the same query multiple times
 		for i := 0; i < 5; i++ {
-			result, err := service.AnalyzeQuery(query, articles)
+			result, err := service.AnalyzeQuery(context.Background(), query, articles)
 			assert.NoError(t, err)
 			assert.NotNil(t, result)
 			assert.Contains(t, result.Summary, "password")
@@ -242,8 +301,8 @@ func TestMockAIServiceConsistency(t *testing.T) {
 		assert.NotNil(t, service2)
 
 		// Both services should work independently
-		result1, err1 := service1.AnalyzeQuery("password help", articles)
-		result2, err2 := service2.AnalyzeQuery("password help", articles)
+		result1, err1 := service1.AnalyzeQuery(context.Background(), "password help", articles)
+		result2, err2 := service2.AnalyzeQuery(context.Background(), "password help", articles)
 
 		assert.NoError(t, err1)
 		assert.NoError(t, err2)
@@ -251,3 +310,88 @@ func TestMockAIServiceConsistency(t *testing.T) {
 		assert.Equal(t, result1.RelevantArticles, result2.RelevantArticles)
 	})
 }
+
+// TestMockAIServiceFallbackSummary tests the summary given when no article
+// matches
+func TestMockAIServiceFallbackSummary(t *testing.T) {
+	articles := []models.Article{
+		{ID: 1, Title: "Password Reset", Content: "Instructions for password reset"},
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		result, err := NewMockAIService().AnalyzeQuery(context.Background(), "my monitor flickers", articles)
+
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultFallbackSummary, result.Summary)
+	})
+
+	t.Run("Configured", func(t *testing.T) {
+		service := NewMockAIService()
+		service.SetFallbackSummary("No answer yet. Open a ticket at https://help.example.com.")
+
+		result, err := service.AnalyzeQuery(context.Background(), "my monitor flickers", articles)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "No answer yet. Open a ticket at https://help.example.com.", result.Summary)
+		assert.Empty(t, result.RelevantArticles)
+	})
+
+	t.Run("EmptyKeepsDefault", func(t *testing.T) {
+		service := NewMockAIService()
+		service.SetFallbackSummary("")
+
+		result, err := service.AnalyzeQuery(context.Background(), "my monitor flickers", articles)
+
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultFallbackSummary, result.Summary)
+	})
+}
+
+// TestMockAIServicePromptFields tests matching only what a prompt would carry
+func TestMockAIServicePromptFields(t *testing.T) {
+	articles := []models.Article{
+		{ID: 1, Title: "Connecting From Home", Content: "Install the VPN client from the IT portal."},
+		{ID: 2, Title: "VPN Troubleshooting", Content: "Restart the client and try again."},
+		{ID: 3, Title: "Printer Setup", Content: "Add the printer by IP address."},
+	}
+
+	t.Run("Full", func(t *testing.T) {
+		result, err := NewMockAIService().AnalyzeQuery(context.Background(), "vpn", articles)
+
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []int{1, 2}, result.RelevantArticles)
+	})
+
+	t.Run("TitleOnly", func(t *testing.T) {
+		service := NewMockAIService()
+		service.SetPromptFields(PromptFieldsTitle, DefaultExcerptChars)
+
+		result, err := service.AnalyzeQuery(context.Background(), "vpn", articles)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []int{2}, result.RelevantArticles)
+	})
+
+	t.Run("Excerpt", func(t *testing.T) {
+		service := NewMockAIService()
+		service.SetPromptFields(PromptFieldsExcerpt, 10)
+
+		result, err := service.AnalyzeQuery(context.Background(), "vpn", articles)
+
+		assert.NoError(t, err)
+		// "Install th…" leaves out article 1's mention of the VPN
+		assert.Equal(t, []int{2}, result.RelevantArticles)
+	})
+}
+
+// TestMockAIServiceCanceled tests that the mock gives up like a provider
+// once its context is done
+func TestMockAIServiceCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := NewMockAIService().AnalyzeQuery(ctx, "vpn", []models.Article{{ID: 1, Title: "VPN Setup"}})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, result)
+}
@@ -0,0 +1,107 @@
+// Package alert notifies operators of problems the service can work
+// around but should not hide, such as a failing AI provider.
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Alert is posted to the webhook as JSON
+type Alert struct {
+	Event   string    `json:"event"`
+	Message string    `json:"message"`
+	Count   int       `json:"count"`
+	Time    time.Time `json:"time"`
+}
+
+// defaultBufferSize is how many alerts can be queued before Send drops them
+const defaultBufferSize = 16
+
+// defaultTimeout bounds each webhook call
+const defaultTimeout = 10 * time.Second
+
+// Webhook posts alerts to a URL. Alerts are sent by a background goroutine
+// so the request path never waits on the receiver; delivery is best-effort,
+// and failures are logged rather than retried.
+type Webhook struct {
+	url    string
+	client *http.Client
+	logger *slog.Logger
+	alerts chan Alert
+	done   chan struct{}
+
+	closeOnce sync.Once
+}
+
+// NewWebhook creates a Webhook posting to url until Close is called
+func NewWebhook(url string) *Webhook {
+	w := &Webhook{
+		url:    url,
+		client: &http.Client{Timeout: defaultTimeout},
+		logger: slog.Default(),
+		alerts: make(chan Alert, defaultBufferSize),
+		done:   make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// run posts queued alerts until the channel is closed
+func (w *Webhook) run() {
+	defer close(w.done)
+	for alert := range w.alerts {
+		if err := w.post(alert); err != nil {
+			w.logger.Warn("failed to send alert", "event", alert.Event, "error", err)
+		}
+	}
+}
+
+// post sends a single alert
+func (w *Webhook) post(alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// Send queues an alert without waiting. If the queue is full the alert is
+// dropped and a warning logged. Send must not be called after Close.
+func (w *Webhook) Send(alert Alert) {
+	select {
+	case w.alerts <- alert:
+	default:
+		w.logger.Warn("alert queue is full, dropping alert", "event", alert.Event)
+	}
+}
+
+// Close sends any queued alerts and stops the webhook
+func (w *Webhook) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.alerts)
+	})
+	<-w.done
+	return nil
+}
@@ -0,0 +1,60 @@
+package alert
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhook(t *testing.T) {
+	t.Run("PostsAlertsAsJSON", func(t *testing.T) {
+		received := make(chan Alert, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			var alert Alert
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&alert))
+			received <- alert
+		}))
+		defer server.Close()
+
+		webhook := NewWebhook(server.URL)
+		sentAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		webhook.Send(Alert{Event: "ai_fallback", Message: "provider down", Count: 3, Time: sentAt})
+		require.NoError(t, webhook.Close())
+
+		alert := <-received
+		assert.Equal(t, "ai_fallback", alert.Event)
+		assert.Equal(t, "provider down", alert.Message)
+		assert.Equal(t, 3, alert.Count)
+		assert.True(t, sentAt.Equal(alert.Time))
+	})
+
+	t.Run("SendDoesNotBlock", func(t *testing.T) {
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer server.Close()
+		defer close(release)
+
+		webhook := NewWebhook(server.URL)
+		start := time.Now()
+		for i := 0; i < defaultBufferSize*2; i++ {
+			webhook.Send(Alert{Event: "ai_fallback", Count: i})
+		}
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("CloseTwice", func(t *testing.T) {
+		webhook := NewWebhook("http://127.0.0.1:0")
+
+		assert.NoError(t, webhook.Close())
+		assert.NoError(t, webhook.Close())
+	})
+}
@@ -0,0 +1,69 @@
+package audit
+
+import (
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// Entry is one exchange with the AI service
+type Entry struct {
+	QueryID  int
+	Query    string
+	Prompt   string
+	Response string
+}
+
+// Logger writes AI exchanges to an audit sink, one JSON object per line.
+// Entries are written by a background goroutine so the request path only
+// pays for a channel send.
+type Logger struct {
+	entries chan Entry
+	logger  *slog.Logger
+	done    chan struct{}
+
+	closeOnce sync.Once
+}
+
+// defaultBufferSize is how many entries can be queued before Log blocks
+const defaultBufferSize = 256
+
+// NewLogger creates a Logger that writes to w until Close is called
+func NewLogger(w io.Writer) *Logger {
+	l := &Logger{
+		entries: make(chan Entry, defaultBufferSize),
+		logger:  slog.New(slog.NewJSONHandler(w, nil)),
+		done:    make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// run writes queued entries until the channel is closed
+func (l *Logger) run() {
+	defer close(l.done)
+	for entry := range l.entries {
+		l.logger.Info("ai_exchange",
+			slog.Int("query_id", entry.QueryID),
+			slog.String("query", entry.Query),
+			slog.String("prompt", entry.Prompt),
+			slog.String("response", entry.Response),
+		)
+	}
+}
+
+// Log queues an entry. Entries are never dropped: if the queue is full,
+// Log waits for the writer to catch up.
+func (l *Logger) Log(entry Entry) {
+	l.entries <- entry
+}
+
+// Close writes any queued entries and stops the logger. Log must not be
+// called after Close.
+func (l *Logger) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.entries)
+	})
+	<-l.done
+	return nil
+}
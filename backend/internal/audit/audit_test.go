@@ -0,0 +1,40 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger(t *testing.T) {
+	t.Run("WritesEntriesAsJSONLines", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := NewLogger(&buf)
+
+		logger.Log(Entry{QueryID: 1, Query: "vpn", Prompt: "prompt one", Response: "SUMMARY: one"})
+		logger.Log(Entry{QueryID: 2, Query: "email", Prompt: "prompt two", Response: "SUMMARY: two"})
+		require.NoError(t, logger.Close())
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 2)
+
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+		assert.Equal(t, "ai_exchange", record["msg"])
+		assert.Equal(t, float64(1), record["query_id"])
+		assert.Equal(t, "vpn", record["query"])
+		assert.Equal(t, "prompt one", record["prompt"])
+		assert.Equal(t, "SUMMARY: one", record["response"])
+	})
+
+	t.Run("CloseTwice", func(t *testing.T) {
+		logger := NewLogger(&bytes.Buffer{})
+
+		assert.NoError(t, logger.Close())
+		assert.NoError(t, logger.Close())
+	})
+}
@@ -1,25 +1,866 @@
 package config
 
 import (
+	"event-to-insight/internal/ai"
+	"event-to-insight/internal/i18n"
+	"event-to-insight/internal/textutil"
+	"fmt"
+	"net/netip"
+	"net/url"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	// Embeds the timezone database so RESPONSE_TZ works in minimal images
+	_ "time/tzdata"
+)
+
+// AI provider names, used to key per-provider settings
+const (
+	ProviderGemini = "gemini"
+	ProviderMock   = "mock"
 )
 
+// PromptLimit caps the articles put into one AI prompt. Zero leaves a
+// value unlimited.
+type PromptLimit struct {
+	// MaxArticles is the most articles sent
+	MaxArticles int
+	// MaxChars is the most characters of article titles and contents sent
+	MaxChars int
+}
+
 // Config holds the application configuration
 type Config struct {
 	Port      string
 	DBPath    string
 	GeminiKey string
 	UseMockAI bool
+
+	// CompressMinBytes is the smallest response body that gets gzip compressed
+	CompressMinBytes int
+
+	// MaxBodyBytes caps the size of request bodies
+	MaxBodyBytes int64
+
+	// DBQueryTimeout limits how long a single database call may run; zero
+	// disables the limit
+	DBQueryTimeout time.Duration
+
+	// DBBusyRetries is how many times a write is retried while another
+	// writer holds the SQLite lock, waiting DBBusyBackoff before the first
+	// retry and twice as long before each one after. A write still locked
+	// after that fails with 503 Service Unavailable.
+	DBBusyRetries int
+	DBBusyBackoff time.Duration
+
+	// DiskWarnFreeBytes and DiskMinFreeBytes are the free space left on the
+	// database's filesystem below which a deep health check reports the
+	// service degraded and unhealthy. Zero disables either threshold.
+	DiskWarnFreeBytes int64
+	DiskMinFreeBytes  int64
+
+	// ArticleIDStorage is where the article IDs of each search result are
+	// stored: "json" in a column of the result, or "table" as ordered rows
+	// of the search_result_articles table
+	ArticleIDStorage string
+
+	// SeedURL serves a JSON array of articles to seed an empty database
+	// with. Empty, or a failed fetch, seeds the built-in articles.
+	SeedURL string
+
+	// ReadRouteTimeout bounds health checks and article reads,
+	// SearchRouteTimeout searches, which wait on the AI, and RouteTimeout
+	// every other request. Zero disables a limit.
+	ReadRouteTimeout   time.Duration
+	SearchRouteTimeout time.Duration
+	RouteTimeout       time.Duration
+
+	// Server timeouts guard against slow clients holding connections open:
+	// reading the request headers, reading the whole request, writing the
+	// response, and waiting for the next request on a kept-alive
+	// connection. Zero disables a limit. ServerWriteTimeout must be longer
+	// than the route timeouts, or their 504 responses are never sent.
+	ServerReadHeaderTimeout time.Duration
+	ServerReadTimeout       time.Duration
+	ServerWriteTimeout      time.Duration
+	ServerIdleTimeout       time.Duration
+
+	// Warmup primes the analysis cache at startup by running WarmupQueries
+	// as dry runs. The server reports not ready until it finishes or
+	// WarmupTimeout passes.
+	Warmup        bool
+	WarmupQueries []string
+	WarmupTimeout time.Duration
+
+	// CORSMaxAge is how many seconds browsers may cache preflight responses
+	CORSMaxAge int
+	// ResponseTZ is the IANA timezone, such as "Europe/Berlin", that
+	// timestamps in responses are written in
+	ResponseTZ string
+
+	// ArticleCacheMaxAge is how many seconds browsers and CDNs may cache
+	// article reads; zero disables caching headers
+	ArticleCacheMaxAge int
+
+	// ShareTokenTTL is how long a link minted to share a search result
+	// stays valid
+	ShareTokenTTL time.Duration
+
+	// KeywordBackfill suggests keyword-matched articles when the AI links none
+	KeywordBackfill bool
+	// KeywordBackfillLimit caps how many articles are suggested
+	KeywordBackfillLimit int
+
+	// TitleMatchWeight and ContentMatchWeight set how much a keyword found
+	// in an article's title or only in its content counts when ranking
+	// keyword matches
+	TitleMatchWeight   float64
+	ContentMatchWeight float64
+
+	// RankTies orders equally relevant articles by when they were last
+	// updated: "newest" first or "oldest" first
+	RankTies string
+
+	// Stopwords are ignored when matching query words against articles, so
+	// words such as "how" or "the" do not match every article
+	Stopwords []string
+
+	// DefaultPageSize is the page size of paginated endpoints when the
+	// client does not pick one, and MaxPageSize is the largest it may pick
+	DefaultPageSize int
+	MaxPageSize     int
+
+	// ArticleMaxTitleChars and ArticleMaxContentChars are the longest title
+	// and content an article may be written with, in characters
+	ArticleMaxTitleChars   int
+	ArticleMaxContentChars int
+
+	// MinRelevance drops AI-linked articles scoring below it, between 0 and 1.
+	// Articles the AI did not score are always kept.
+	MinRelevance float64
+
+	// SearchExcludedArticles are IDs of articles kept for reference but
+	// never shown to the AI or returned by searches, such as outdated
+	// ones. They can still be fetched directly.
+	SearchExcludedArticles []string
+
+	// BatchConcurrency caps how many queries of a batch search are
+	// processed at once
+	BatchConcurrency int
+
+	// AIMaxConcurrency caps how many AI analyses run at once, across all
+	// providers; zero removes the limit. Searches wait up to AIQueueTimeout
+	// for a free slot before being rejected.
+	AIMaxConcurrency int
+	AIQueueTimeout   time.Duration
+
+	// AIBreakerThreshold consecutive AI failures stop calls to the provider
+	// for AIBreakerCooldown, or longer if it sends Retry-After, answering
+	// from keyword matching meanwhile. Zero disables the breaker.
+	AIBreakerThreshold int
+	AIBreakerCooldown  time.Duration
+
+	// AISlowThreshold is how long an AI analysis may take before it is
+	// logged as slow. Zero disables the log.
+	AISlowThreshold time.Duration
+
+	// AlertWebhookURL receives a JSON alert once AlertFallbackThreshold
+	// searches in a row within AlertFallbackWindow were answered by the
+	// mock AI. Empty disables alerts.
+	AlertWebhookURL        string
+	AlertFallbackThreshold int
+	AlertFallbackWindow    time.Duration
+
+	// OTLPEndpoint is the base URL of an OpenTelemetry collector, such as
+	// http://localhost:4318, that request traces are exported to over
+	// OTLP/HTTP. Empty disables tracing.
+	OTLPEndpoint string
+	// TracingServiceName is the service name traces are reported under
+	TracingServiceName string
+
+	// SearchGetRunsAI lets GET /search-query call the AI for queries that
+	// are not cached. It is off so crawled links cannot run up AI costs.
+	SearchGetRunsAI bool
+
+	// AICacheSize is how many AI analyses are kept for repeated queries.
+	// Cached answers are discarded when any article changes; zero disables
+	// the cache.
+	AICacheSize int
+
+	// GeminiTemperature, GeminiTopP and GeminiMaxOutputTokens tune how
+	// Gemini generates answers; zero max tokens keeps the model's limit.
+	// GeminiSafetyThreshold is "none", "high", "medium" or "low", or empty
+	// for the model's default.
+	GeminiTemperature     float64
+	GeminiTopP            float64
+	GeminiMaxOutputTokens int
+	GeminiSafetyThreshold string
+
+	// AIInputCostPer1K and AIOutputCostPer1K are the price of 1,000 prompt
+	// and answer tokens, used by POST /search-query/estimate. The defaults
+	// are Gemini 2.0 Flash's prices in US dollars.
+	AIInputCostPer1K  float64
+	AIOutputCostPer1K float64
+
+	// ResponseEnvelope wraps responses as {data, meta} and errors as
+	// {error: {code, message}} instead of returning them bare
+	ResponseEnvelope bool
+
+	// PrettyJSON indents JSON responses for reading with curl. Requests can
+	// override it with ?pretty=true or ?pretty=false.
+	PrettyJSON bool
+
+	// DefaultLanguage is the language of error messages for clients whose
+	// Accept-Language header names no supported language
+	DefaultLanguage string
+
+	// Debug adds diagnostic details, such as why the AI stopped generating,
+	// to search responses and logs each step of a search
+	Debug bool
+
+	// PromptMaxArticleChars truncates each article's content in AI prompts
+	PromptMaxArticleChars int
+	// PromptArticleFields selects what of each article AI prompts carry:
+	// "full" for every field, "excerpt" for the title, keywords and the
+	// first PromptExcerptChars characters of the content, or "title" for
+	// the title alone, which suits large knowledge bases
+	PromptArticleFields string
+	PromptExcerptChars  int
+	// PromptLimits caps the articles sent to each AI provider, keyed by
+	// provider name, since models have different context windows
+	PromptLimits map[string]PromptLimit
+	// AISummaryCleanup strips markdown and filler phrases from AI summaries
+	AISummaryCleanup bool
+	// AIContextKeywords lists each article's keywords, when it has any, in
+	// the AI prompt
+	AIContextKeywords bool
+	// AutoSummarize asks the AI for a one-paragraph summary of each
+	// imported article, which is stored and shown in listings and prompts
+	AutoSummarize bool
+	// AllowProviderOverride lets a request pick the AI provider with the
+	// X-AI-Provider header, for testing against production
+	AllowProviderOverride bool
+
+	// FallbackSummary is the summary given when the AI produces none, such
+	// as when no article matches. Organizations can point it at their own
+	// support portal.
+	FallbackSummary string
+
+	// EmptyKnowledgeBaseMessage is returned instead of calling the AI when
+	// there are no articles to search
+	EmptyKnowledgeBaseMessage string
+
+	// EscalationKeywords are phrases that always direct the user to IT,
+	// with EscalationMessage prepended to the summary
+	EscalationKeywords []string
+	EscalationMessage  string
+
+	// AuditAI logs every AI prompt and raw response to AuditAIPath.
+	// It is off by default because prompts contain user queries.
+	AuditAI     bool
+	AuditAIPath string
+
+	// RedactQueries masks the parts of a query matched by RedactRules, such
+	// as card numbers, before it is stored. The AI still gets the original
+	// query unless RedactAIQuery is set.
+	RedactQueries bool
+	RedactRules   []string
+	RedactAIQuery bool
+
+	// MaxInFlightRequests is the most requests served at once; more get 503
+	// Service Unavailable. Zero disables the limit.
+	MaxInFlightRequests int
+
+	// AdminAPIKey protects admin and write endpoints; empty disables auth
+	AdminAPIKey string
+
+	// PublicArticleFields are the article fields returned to readers
+	// without AdminAPIKey: id, title, snippet, content, keywords and summary.
+	// IDs are always returned. Empty returns every field to everyone.
+	PublicArticleFields []string
+
+	// TrustedProxies lists the CIDR ranges, or single IPs, of proxies whose
+	// X-Forwarded-For and X-Real-IP headers are believed
+	TrustedProxies []string
+
+	// SearchDailyQuota caps how many searches each client IP may run per
+	// UTC day; zero disables the quota. Clients in SearchQuotaExempt, CIDR
+	// ranges or single IPs, are never limited.
+	SearchDailyQuota  int
+	SearchQuotaExempt []string
+}
+
+// DefaultConfig returns the configuration used when no environment
+// variables are set
+func DefaultConfig() *Config {
+	return &Config{
+		Port:             "8080",
+		DBPath:           "./data.db",
+		GeminiKey:        "",
+		UseMockAI:        true,
+		CompressMinBytes: 1024,
+		MaxBodyBytes:     1 << 20,
+		CORSMaxAge:       300,
+		DBQueryTimeout:   10 * time.Second,
+		DBBusyRetries:    2,
+		DBBusyBackoff:    50 * time.Millisecond,
+
+		DiskWarnFreeBytes: 1 << 30,
+		DiskMinFreeBytes:  100 << 20,
+
+		ArticleCacheMaxAge: 60,
+
+		ArticleIDStorage: "json",
+
+		ResponseTZ: "UTC",
+
+		DefaultLanguage: i18n.DefaultLanguage,
+
+		// Only loopback is exempt; a NAT or VPN shares private addresses
+		SearchQuotaExempt: []string{"127.0.0.0/8", "::1"},
+
+		ReadRouteTimeout:   5 * time.Second,
+		SearchRouteTimeout: 60 * time.Second,
+		RouteTimeout:       60 * time.Second,
+
+		ServerReadHeaderTimeout: 10 * time.Second,
+		ServerReadTimeout:       30 * time.Second,
+		ServerWriteTimeout:      90 * time.Second,
+		ServerIdleTimeout:       120 * time.Second,
+
+		WarmupTimeout: 30 * time.Second,
+
+		ShareTokenTTL: 7 * 24 * time.Hour,
+
+		KeywordBackfill:      true,
+		KeywordBackfillLimit: 3,
+
+		TitleMatchWeight:   textutil.DefaultTitleWeight,
+		ContentMatchWeight: textutil.DefaultContentWeight,
+
+		RankTies: "newest",
+
+		Stopwords: append([]string(nil), textutil.DefaultStopwords...),
+
+		DefaultPageSize: 20,
+		MaxPageSize:     100,
+
+		ArticleMaxTitleChars:   200,
+		ArticleMaxContentChars: 50000,
+
+		BatchConcurrency: 4,
+
+		AIMaxConcurrency: 8,
+		AIQueueTimeout:   10 * time.Second,
+
+		AIBreakerThreshold: 5,
+		AIBreakerCooldown:  30 * time.Second,
+
+		AISlowThreshold: 10 * time.Second,
+
+		AlertFallbackThreshold: 10,
+		AlertFallbackWindow:    5 * time.Minute,
+
+		TracingServiceName: "event-to-insight",
+
+		AICacheSize: 256,
+
+		GeminiTemperature:     0.2,
+		GeminiTopP:            0.95,
+		GeminiMaxOutputTokens: 1024,
+
+		AIInputCostPer1K:  0.0001,
+		AIOutputCostPer1K: 0.0004,
+
+		PromptMaxArticleChars: 1500,
+		PromptArticleFields:   "full",
+		PromptExcerptChars:    200,
+		AISummaryCleanup:      true,
+		AIContextKeywords:     true,
+		PromptLimits: map[string]PromptLimit{
+			ProviderGemini: {MaxArticles: 200, MaxChars: 300000},
+			ProviderMock:   {},
+		},
+
+		FallbackSummary: ai.DefaultFallbackSummary,
+
+		EmptyKnowledgeBaseMessage: "The knowledge base is empty right now, so I can't look up an answer. Please contact IT support for help with your question.",
+
+		EscalationKeywords: []string{
+			"security incident",
+			"data breach",
+			"hacked",
+			"phishing",
+			"ransomware",
+			"malware",
+			"locked out of mfa",
+			"lost my mfa",
+		},
+		EscalationMessage: "This may be urgent: please contact IT support immediately.",
+
+		AuditAIPath: "./ai_audit.log",
+
+		RedactRules: append([]string(nil), textutil.RedactionRules...),
+	}
 }
 
 // LoadConfig loads configuration from environment variables
 func LoadConfig() *Config {
+	defaults := DefaultConfig()
+
+	minRelevance := getEnvFloat("MIN_RELEVANCE", defaults.MinRelevance)
+	if !(minRelevance >= 0 && minRelevance <= 1) {
+		minRelevance = defaults.MinRelevance
+	}
+	titleWeight := getEnvFloat("TITLE_MATCH_WEIGHT", defaults.TitleMatchWeight)
+	if !(titleWeight >= 0) {
+		titleWeight = defaults.TitleMatchWeight
+	}
+	contentWeight := getEnvFloat("CONTENT_MATCH_WEIGHT", defaults.ContentMatchWeight)
+	if !(contentWeight >= 0) {
+		contentWeight = defaults.ContentMatchWeight
+	}
+	temperature := getEnvFloat("GEMINI_TEMPERATURE", defaults.GeminiTemperature)
+	if !(temperature >= 0 && temperature <= 2) {
+		temperature = defaults.GeminiTemperature
+	}
+	topP := getEnvFloat("GEMINI_TOP_P", defaults.GeminiTopP)
+	if !(topP >= 0 && topP <= 1) {
+		topP = defaults.GeminiTopP
+	}
+	maxOutputTokens := getEnvInt("GEMINI_MAX_OUTPUT_TOKENS", defaults.GeminiMaxOutputTokens)
+	if maxOutputTokens < 0 {
+		maxOutputTokens = defaults.GeminiMaxOutputTokens
+	}
+	inputCost := getEnvFloat("AI_INPUT_COST_PER_1K", defaults.AIInputCostPer1K)
+	if !(inputCost >= 0) {
+		inputCost = defaults.AIInputCostPer1K
+	}
+	outputCost := getEnvFloat("AI_OUTPUT_COST_PER_1K", defaults.AIOutputCostPer1K)
+	if !(outputCost >= 0) {
+		outputCost = defaults.AIOutputCostPer1K
+	}
+
 	return &Config{
-		Port:      getEnv("PORT", "8080"),
-		DBPath:    getEnv("DB_PATH", "./data.db"),
-		GeminiKey: getEnv("GEMINI_API_KEY", ""),
-		UseMockAI: getEnv("USE_MOCK_AI", "true") == "true",
+		Port:             getEnv("PORT", defaults.Port),
+		DBPath:           getEnv("DB_PATH", defaults.DBPath),
+		GeminiKey:        getEnv("GEMINI_API_KEY", defaults.GeminiKey),
+		UseMockAI:        getEnv("USE_MOCK_AI", "true") == "true",
+		CompressMinBytes: getEnvInt("COMPRESS_MIN_BYTES", defaults.CompressMinBytes),
+		MaxBodyBytes:     int64(getEnvInt("MAX_BODY_BYTES", int(defaults.MaxBodyBytes))),
+		CORSMaxAge:       getEnvInt("CORS_MAX_AGE", defaults.CORSMaxAge),
+		DBQueryTimeout:   getEnvDuration("DB_QUERY_TIMEOUT", defaults.DBQueryTimeout),
+		DBBusyRetries:    getEnvInt("DB_BUSY_RETRIES", defaults.DBBusyRetries),
+		DBBusyBackoff:    getEnvDuration("DB_BUSY_BACKOFF", defaults.DBBusyBackoff),
+
+		DiskWarnFreeBytes: int64(getEnvInt("DISK_WARN_FREE_BYTES", int(defaults.DiskWarnFreeBytes))),
+		DiskMinFreeBytes:  int64(getEnvInt("DISK_MIN_FREE_BYTES", int(defaults.DiskMinFreeBytes))),
+
+		MaxInFlightRequests: getEnvInt("MAX_IN_FLIGHT_REQUESTS", defaults.MaxInFlightRequests),
+
+		AdminAPIKey:    getEnv("ADMIN_API_KEY", defaults.AdminAPIKey),
+		TrustedProxies: getEnvList("TRUSTED_PROXIES", defaults.TrustedProxies),
+
+		PublicArticleFields: getEnvList("PUBLIC_ARTICLE_FIELDS", defaults.PublicArticleFields),
+
+		SearchDailyQuota:  getEnvInt("SEARCH_DAILY_QUOTA", defaults.SearchDailyQuota),
+		SearchQuotaExempt: getEnvList("SEARCH_QUOTA_EXEMPT", defaults.SearchQuotaExempt),
+
+		ArticleCacheMaxAge: getEnvInt("ARTICLE_CACHE_MAX_AGE", defaults.ArticleCacheMaxAge),
+
+		ShareTokenTTL: getEnvDuration("SHARE_TOKEN_TTL", defaults.ShareTokenTTL),
+
+		ArticleIDStorage: strings.ToLower(getEnv("ARTICLE_ID_STORAGE", defaults.ArticleIDStorage)),
+
+		SeedURL: getEnv("SEED_URL", defaults.SeedURL),
+
+		ResponseTZ: getEnv("RESPONSE_TZ", defaults.ResponseTZ),
+
+		ReadRouteTimeout:   getEnvDuration("READ_ROUTE_TIMEOUT", defaults.ReadRouteTimeout),
+		SearchRouteTimeout: getEnvDuration("SEARCH_ROUTE_TIMEOUT", defaults.SearchRouteTimeout),
+		RouteTimeout:       getEnvDuration("ROUTE_TIMEOUT", defaults.RouteTimeout),
+
+		ServerReadHeaderTimeout: getEnvDuration("SERVER_READ_HEADER_TIMEOUT", defaults.ServerReadHeaderTimeout),
+		ServerReadTimeout:       getEnvDuration("SERVER_READ_TIMEOUT", defaults.ServerReadTimeout),
+		ServerWriteTimeout:      getEnvDuration("SERVER_WRITE_TIMEOUT", defaults.ServerWriteTimeout),
+		ServerIdleTimeout:       getEnvDuration("SERVER_IDLE_TIMEOUT", defaults.ServerIdleTimeout),
+
+		Warmup:        getEnvBool("WARMUP", defaults.Warmup),
+		WarmupQueries: getEnvList("WARMUP_QUERIES", defaults.WarmupQueries),
+		WarmupTimeout: getEnvDuration("WARMUP_TIMEOUT", defaults.WarmupTimeout),
+
+		KeywordBackfill:      getEnvBool("KEYWORD_BACKFILL", defaults.KeywordBackfill),
+		KeywordBackfillLimit: getEnvInt("KEYWORD_BACKFILL_LIMIT", defaults.KeywordBackfillLimit),
+
+		TitleMatchWeight:   titleWeight,
+		ContentMatchWeight: contentWeight,
+
+		RankTies: strings.ToLower(getEnv("RANK_TIES", defaults.RankTies)),
+
+		Stopwords: getEnvList("STOPWORDS", defaults.Stopwords),
+
+		DefaultPageSize: getEnvInt("DEFAULT_PAGE_SIZE", defaults.DefaultPageSize),
+		MaxPageSize:     getEnvInt("MAX_PAGE_SIZE", defaults.MaxPageSize),
+
+		ArticleMaxTitleChars:   getEnvInt("ARTICLE_MAX_TITLE_CHARS", defaults.ArticleMaxTitleChars),
+		ArticleMaxContentChars: getEnvInt("ARTICLE_MAX_CONTENT_CHARS", defaults.ArticleMaxContentChars),
+
+		MinRelevance:     minRelevance,
+		BatchConcurrency: getEnvInt("BATCH_CONCURRENCY", defaults.BatchConcurrency),
+
+		SearchExcludedArticles: getEnvList("SEARCH_EXCLUDED_ARTICLES", defaults.SearchExcludedArticles),
+
+		AIMaxConcurrency: getEnvInt("AI_MAX_CONCURRENCY", defaults.AIMaxConcurrency),
+		AIQueueTimeout:   getEnvDuration("AI_QUEUE_TIMEOUT", defaults.AIQueueTimeout),
+
+		AIBreakerThreshold: getEnvInt("AI_BREAKER_THRESHOLD", defaults.AIBreakerThreshold),
+		AIBreakerCooldown:  getEnvDuration("AI_BREAKER_COOLDOWN", defaults.AIBreakerCooldown),
+
+		AISlowThreshold: time.Duration(getEnvInt("AI_SLOW_THRESHOLD_MS", int(defaults.AISlowThreshold.Milliseconds()))) * time.Millisecond,
+
+		AlertWebhookURL:        getEnv("ALERT_WEBHOOK_URL", defaults.AlertWebhookURL),
+		AlertFallbackThreshold: getEnvInt("ALERT_FALLBACK_THRESHOLD", defaults.AlertFallbackThreshold),
+		AlertFallbackWindow:    getEnvDuration("ALERT_FALLBACK_WINDOW", defaults.AlertFallbackWindow),
+
+		OTLPEndpoint:       getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", defaults.OTLPEndpoint),
+		TracingServiceName: getEnv("OTEL_SERVICE_NAME", defaults.TracingServiceName),
+
+		SearchGetRunsAI: getEnvBool("SEARCH_GET_RUNS_AI", defaults.SearchGetRunsAI),
+
+		AICacheSize: getEnvInt("AI_CACHE_SIZE", defaults.AICacheSize),
+
+		GeminiTemperature:     temperature,
+		GeminiTopP:            topP,
+		GeminiMaxOutputTokens: maxOutputTokens,
+		GeminiSafetyThreshold: getEnv("GEMINI_SAFETY_THRESHOLD", defaults.GeminiSafetyThreshold),
+
+		AIInputCostPer1K:  inputCost,
+		AIOutputCostPer1K: outputCost,
+
+		ResponseEnvelope: getEnvBool("RESPONSE_ENVELOPE", defaults.ResponseEnvelope),
+		PrettyJSON:       getEnvBool("PRETTY_JSON", defaults.PrettyJSON),
+		DefaultLanguage:  strings.ToLower(getEnv("DEFAULT_LANGUAGE", defaults.DefaultLanguage)),
+
+		Debug: getEnvBool("DEBUG", defaults.Debug),
+
+		PromptMaxArticleChars: getEnvInt("PROMPT_MAX_ARTICLE_CHARS", defaults.PromptMaxArticleChars),
+		PromptArticleFields:   strings.ToLower(getEnv("PROMPT_ARTICLE_FIELDS", defaults.PromptArticleFields)),
+		PromptExcerptChars:    getEnvInt("PROMPT_EXCERPT_CHARS", defaults.PromptExcerptChars),
+		AISummaryCleanup:      getEnvBool("AI_SUMMARY_CLEANUP", defaults.AISummaryCleanup),
+		AIContextKeywords:     getEnvBool("AI_CONTEXT_KEYWORDS", defaults.AIContextKeywords),
+		AutoSummarize:         getEnvBool("AUTO_SUMMARIZE", defaults.AutoSummarize),
+		PromptLimits: map[string]PromptLimit{
+			ProviderGemini: getEnvPromptLimit("GEMINI", defaults.PromptLimits[ProviderGemini]),
+			ProviderMock:   getEnvPromptLimit("MOCK", defaults.PromptLimits[ProviderMock]),
+		},
+		AllowProviderOverride: getEnvBool("ALLOW_PROVIDER_OVERRIDE", defaults.AllowProviderOverride),
+
+		FallbackSummary:           getEnv("FALLBACK_SUMMARY", defaults.FallbackSummary),
+		EmptyKnowledgeBaseMessage: getEnv("EMPTY_KB_MESSAGE", defaults.EmptyKnowledgeBaseMessage),
+
+		EscalationKeywords: getEnvList("ESCALATION_KEYWORDS", defaults.EscalationKeywords),
+		EscalationMessage:  getEnv("ESCALATION_MESSAGE", defaults.EscalationMessage),
+
+		AuditAI:     getEnvBool("AUDIT_AI", defaults.AuditAI),
+		AuditAIPath: getEnv("AUDIT_AI_PATH", defaults.AuditAIPath),
+
+		RedactQueries: getEnvBool("REDACT_QUERIES", defaults.RedactQueries),
+		RedactRules:   getEnvList("REDACT_RULES", defaults.RedactRules),
+		RedactAIQuery: getEnvBool("REDACT_AI_QUERY", defaults.RedactAIQuery),
+	}
+}
+
+// AIProvider returns the name of the configured AI provider: the mock when
+// it is requested or no Gemini key is set, otherwise Gemini
+func (c *Config) AIProvider() string {
+	if c.UseMockAI || c.GeminiKey == "" {
+		return ProviderMock
+	}
+	return ProviderGemini
+}
+
+// Validate reports settings that cannot work together, so the server can
+// refuse to start with them
+func (c *Config) Validate() error {
+	if c.MaxPageSize < 1 {
+		return fmt.Errorf("MAX_PAGE_SIZE must be at least 1, got %d", c.MaxPageSize)
+	}
+	if c.DefaultPageSize < 1 || c.DefaultPageSize > c.MaxPageSize {
+		return fmt.Errorf("DEFAULT_PAGE_SIZE must be between 1 and MAX_PAGE_SIZE (%d), got %d", c.MaxPageSize, c.DefaultPageSize)
+	}
+	if c.ArticleMaxTitleChars < 1 {
+		return fmt.Errorf("ARTICLE_MAX_TITLE_CHARS must be at least 1, got %d", c.ArticleMaxTitleChars)
+	}
+	if c.ArticleMaxContentChars < 1 {
+		return fmt.Errorf("ARTICLE_MAX_CONTENT_CHARS must be at least 1, got %d", c.ArticleMaxContentChars)
+	}
+	if c.DBBusyRetries < 0 {
+		return fmt.Errorf("DB_BUSY_RETRIES must not be negative, got %d", c.DBBusyRetries)
+	}
+	if c.DBBusyBackoff < 0 {
+		return fmt.Errorf("DB_BUSY_BACKOFF must not be negative, got %s", c.DBBusyBackoff)
+	}
+	if c.MaxInFlightRequests < 0 {
+		return fmt.Errorf("MAX_IN_FLIGHT_REQUESTS must not be negative, got %d", c.MaxInFlightRequests)
+	}
+	if c.DiskWarnFreeBytes < 0 {
+		return fmt.Errorf("DISK_WARN_FREE_BYTES must not be negative, got %d", c.DiskWarnFreeBytes)
+	}
+	if c.DiskMinFreeBytes < 0 {
+		return fmt.Errorf("DISK_MIN_FREE_BYTES must not be negative, got %d", c.DiskMinFreeBytes)
+	}
+	if c.DiskWarnFreeBytes > 0 && c.DiskMinFreeBytes > c.DiskWarnFreeBytes {
+		return fmt.Errorf("DISK_MIN_FREE_BYTES must not exceed DISK_WARN_FREE_BYTES, got %d and %d", c.DiskMinFreeBytes, c.DiskWarnFreeBytes)
+	}
+	if c.ShareTokenTTL <= 0 {
+		return fmt.Errorf("SHARE_TOKEN_TTL must be positive, got %s", c.ShareTokenTTL)
+	}
+	switch c.ArticleIDStorage {
+	case "json", "table":
+	default:
+		return fmt.Errorf("ARTICLE_ID_STORAGE must be json or table, got %q", c.ArticleIDStorage)
+	}
+	if c.SeedURL != "" {
+		if u, err := url.Parse(c.SeedURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("SEED_URL must be an http or https URL, got %q", c.SeedURL)
+		}
+	}
+	if c.OTLPEndpoint != "" {
+		if u, err := url.Parse(c.OTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("OTEL_EXPORTER_OTLP_ENDPOINT must be an http or https URL, got %q", c.OTLPEndpoint)
+		}
+		if c.TracingServiceName == "" {
+			return fmt.Errorf("OTEL_SERVICE_NAME must not be empty when tracing is enabled")
+		}
+	}
+	if c.ServerWriteTimeout > 0 {
+		routeTimeouts := []struct {
+			name    string
+			timeout time.Duration
+		}{
+			{"READ_ROUTE_TIMEOUT", c.ReadRouteTimeout},
+			{"SEARCH_ROUTE_TIMEOUT", c.SearchRouteTimeout},
+			{"ROUTE_TIMEOUT", c.RouteTimeout},
+		}
+		for _, route := range routeTimeouts {
+			if route.timeout >= c.ServerWriteTimeout {
+				return fmt.Errorf("SERVER_WRITE_TIMEOUT must be longer than %s (%s), got %s", route.name, route.timeout, c.ServerWriteTimeout)
+			}
+		}
+	}
+	for _, rule := range c.RedactRules {
+		if !isRedactionRule(rule) {
+			return fmt.Errorf("REDACT_RULES must only list %s, got %q", strings.Join(textutil.RedactionRules, ", "), rule)
+		}
+	}
+	if !i18n.Supported(c.DefaultLanguage) {
+		return fmt.Errorf("DEFAULT_LANGUAGE must be one of %s, got %q", strings.Join(i18n.Languages(), ", "), c.DefaultLanguage)
+	}
+	switch c.PromptArticleFields {
+	case "full", "excerpt", "title":
+	default:
+		return fmt.Errorf("PROMPT_ARTICLE_FIELDS must be full, excerpt or title, got %q", c.PromptArticleFields)
+	}
+	if c.PromptExcerptChars < 1 {
+		return fmt.Errorf("PROMPT_EXCERPT_CHARS must be at least 1, got %d", c.PromptExcerptChars)
+	}
+	switch c.RankTies {
+	case "newest", "oldest":
+	default:
+		return fmt.Errorf("RANK_TIES must be newest or oldest, got %q", c.RankTies)
+	}
+	switch strings.ToLower(c.GeminiSafetyThreshold) {
+	case "", "none", "high", "medium", "low":
+	default:
+		return fmt.Errorf("GEMINI_SAFETY_THRESHOLD must be none, high, medium or low, got %q", c.GeminiSafetyThreshold)
+	}
+	if _, err := c.TrustedProxyPrefixes(); err != nil {
+		return err
+	}
+	if _, err := c.SearchQuotaExemptPrefixes(); err != nil {
+		return err
+	}
+	if _, err := c.SearchExcludedArticleIDs(); err != nil {
+		return err
+	}
+	for _, field := range c.PublicArticleFields {
+		switch strings.ToLower(field) {
+		case "id", "title", "snippet", "content", "keywords", "summary":
+		default:
+			return fmt.Errorf("PUBLIC_ARTICLE_FIELDS must list id, title, snippet, content, keywords or summary, got %q", field)
+		}
+	}
+	if _, err := c.ResponseLocation(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// isRedactionRule reports whether name is a rule understood by
+// textutil.Redact, ignoring case
+func isRedactionRule(name string) bool {
+	for _, rule := range textutil.RedactionRules {
+		if strings.EqualFold(name, rule) {
+			return true
+		}
+	}
+	return false
+}
+
+// exposedFields lists the Config fields Redacted shows as they are. Any
+// other field, such as an API key or a URL that may carry a token, is
+// redacted, so a field added later stays hidden until it is listed here.
+var exposedFields = []string{
+	"Port", "DBPath", "UseMockAI",
+	"CompressMinBytes",
+	"MaxBodyBytes",
+	"DBQueryTimeout",
+	"DBBusyRetries", "DBBusyBackoff",
+	"DiskWarnFreeBytes", "DiskMinFreeBytes",
+	"ArticleIDStorage",
+	"ReadRouteTimeout", "SearchRouteTimeout", "RouteTimeout",
+	"ServerReadHeaderTimeout", "ServerReadTimeout", "ServerWriteTimeout", "ServerIdleTimeout",
+	"Warmup", "WarmupQueries", "WarmupTimeout",
+	"CORSMaxAge", "ResponseTZ",
+	"ArticleCacheMaxAge",
+	"ShareTokenTTL",
+	"KeywordBackfill", "KeywordBackfillLimit",
+	"TitleMatchWeight", "ContentMatchWeight",
+	"RankTies",
+	"Stopwords",
+	"DefaultPageSize", "MaxPageSize",
+	"ArticleMaxTitleChars", "ArticleMaxContentChars",
+	"MinRelevance",
+	"SearchExcludedArticles",
+	"BatchConcurrency",
+	"AIMaxConcurrency", "AIQueueTimeout",
+	"AIBreakerThreshold", "AIBreakerCooldown",
+	"AISlowThreshold",
+	"AlertFallbackThreshold", "AlertFallbackWindow",
+	"TracingServiceName",
+	"SearchGetRunsAI",
+	"AICacheSize",
+	"GeminiTemperature", "GeminiTopP", "GeminiMaxOutputTokens", "GeminiSafetyThreshold",
+	"AIInputCostPer1K", "AIOutputCostPer1K",
+	"ResponseEnvelope",
+	"PrettyJSON",
+	"DefaultLanguage",
+	"Debug",
+	"PromptMaxArticleChars", "PromptArticleFields", "PromptExcerptChars", "PromptLimits",
+	"AISummaryCleanup", "AIContextKeywords", "AutoSummarize", "AllowProviderOverride",
+	"FallbackSummary",
+	"EmptyKnowledgeBaseMessage",
+	"EscalationKeywords", "EscalationMessage",
+	"AuditAI", "AuditAIPath",
+	"RedactQueries", "RedactRules", "RedactAIQuery",
+	"MaxInFlightRequests",
+	"PublicArticleFields",
+	"TrustedProxies",
+	"SearchDailyQuota", "SearchQuotaExempt",
+}
+
+// isExposedField reports whether the Config field name is in exposedFields
+func isExposedField(name string) bool {
+	for _, exposed := range exposedFields {
+		if exposed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted returns the configuration as a map from field name to value, for
+// showing operators what the server loaded. Fields missing from
+// exposedFields keep at most their last four characters. Durations are
+// written like "30s".
+func (c *Config) Redacted() map[string]interface{} {
+	v := reflect.ValueOf(*c)
+	fields := make(map[string]interface{}, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		value := v.Field(i).Interface()
+		if !isExposedField(name) {
+			fields[name] = redact(fmt.Sprint(value))
+			continue
+		}
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+		fields[name] = value
+	}
+	return fields
+}
+
+// redact hides a secret, keeping its last four characters only when the
+// secret is long enough that they give little away
+func redact(secret string) string {
+	switch {
+	case secret == "":
+		return ""
+	case len(secret) < 12:
+		return "****"
+	default:
+		return "****" + secret[len(secret)-4:]
+	}
+}
+
+// ResponseLocation loads the ResponseTZ timezone
+func (c *Config) ResponseLocation() (*time.Location, error) {
+	location, err := time.LoadLocation(c.ResponseTZ)
+	if err != nil {
+		return nil, fmt.Errorf("RESPONSE_TZ %q is not a known timezone", c.ResponseTZ)
+	}
+	return location, nil
+}
+
+// TrustedProxyPrefixes parses TrustedProxies. A single IP is treated as a
+// range containing only that address.
+func (c *Config) TrustedProxyPrefixes() ([]netip.Prefix, error) {
+	return parsePrefixes("TRUSTED_PROXIES", c.TrustedProxies)
+}
+
+// SearchQuotaExemptPrefixes parses SearchQuotaExempt like
+// TrustedProxyPrefixes
+func (c *Config) SearchQuotaExemptPrefixes() ([]netip.Prefix, error) {
+	return parsePrefixes("SEARCH_QUOTA_EXEMPT", c.SearchQuotaExempt)
+}
+
+// SearchExcludedArticleIDs parses SearchExcludedArticles into article IDs
+func (c *Config) SearchExcludedArticleIDs() ([]int, error) {
+	ids := make([]int, 0, len(c.SearchExcludedArticles))
+	for _, entry := range c.SearchExcludedArticles {
+		id, err := strconv.Atoi(entry)
+		if err != nil || id < 1 {
+			return nil, fmt.Errorf("SEARCH_EXCLUDED_ARTICLES entry %q is not a valid article ID", entry)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// parsePrefixes parses a list of CIDR ranges and single IPs read from the
+// environment variable name
+func parsePrefixes(name string, entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("%s entry %q is not a valid CIDR range", name, entry)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		ip, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%s entry %q is not a valid IP address", name, entry)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(ip, ip.BitLen()))
 	}
+	return prefixes, nil
 }
 
 // getEnv gets an environment variable with a default value
@@ -29,3 +870,73 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvInt gets an integer environment variable with a default value.
+// Values that fail to parse fall back to the default.
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvBool gets a boolean environment variable with a default value.
+// Values that fail to parse fall back to the default.
+func getEnvBool(key string, defaultValue bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvFloat gets a floating point environment variable with a default
+// value. Values that fail to parse fall back to the default.
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvDuration gets a duration environment variable, such as "5s", with a
+// default value. Values that fail to parse fall back to the default.
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvPromptLimit reads a provider's prompt limit from the
+// <PREFIX>_PROMPT_MAX_ARTICLES and <PREFIX>_PROMPT_MAX_CHARS variables.
+// Negative values fall back to the default.
+func getEnvPromptLimit(prefix string, defaultValue PromptLimit) PromptLimit {
+	limit := PromptLimit{
+		MaxArticles: getEnvInt(prefix+"_PROMPT_MAX_ARTICLES", defaultValue.MaxArticles),
+		MaxChars:    getEnvInt(prefix+"_PROMPT_MAX_CHARS", defaultValue.MaxChars),
+	}
+	if limit.MaxArticles < 0 {
+		limit.MaxArticles = defaultValue.MaxArticles
+	}
+	if limit.MaxChars < 0 {
+		limit.MaxChars = defaultValue.MaxChars
+	}
+	return limit
+}
+
+// getEnvList gets a comma-separated environment variable with a default
+// value. Items are trimmed and empty items are dropped.
+func getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrPermission is returned when the database file or its directory cannot
+// be written by the server's user
+var ErrPermission = errors.New("database is not writable")
+
+// ErrLocked is returned when another process holds a lock on the database
+var ErrLocked = errors.New("database is locked")
+
+// ErrBusy is returned when a write still finds the database locked by
+// another writer after being retried. It is temporary, so the request can
+// be tried again shortly.
+var ErrBusy = errors.New("database is busy")
+
+// ErrCorrupt is returned when the database file is damaged or is not a
+// SQLite database
+var ErrCorrupt = errors.New("database is corrupt")
+
+// ErrDuplicateTitle is returned when an article would share its title with
+// another one. Titles are compared case-insensitively. Articles are never
+// soft-deleted, so every stored article's title counts.
+var ErrDuplicateTitle = errors.New("an article with this title already exists")
+
+// ErrShareExpired is returned when a share token is read after it expired
+var ErrShareExpired = errors.New("share link has expired")
+
+// checkDBPath reports problems with where the database will be stored
+// before SQLite reports them less clearly. In-memory and URI paths are left
+// to SQLite.
+func checkDBPath(dbPath string) error {
+	if dbPath == ":memory:" || strings.HasPrefix(dbPath, "file:") {
+		return nil
+	}
+
+	dir := filepath.Dir(dbPath)
+	info, err := os.Stat(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("database directory %s does not exist, create it or change DB_PATH", dir)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to inspect database directory %s: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("database directory %s is not a directory, change DB_PATH", dir)
+	}
+
+	// An existing file must be writable; a new one needs a writable directory
+	file, err := os.OpenFile(dbPath, os.O_RDWR, 0)
+	if err == nil {
+		return file.Close()
+	}
+	if errors.Is(err, os.ErrPermission) {
+		return fmt.Errorf("%w: %s cannot be opened for writing, check its owner and permissions", ErrPermission, dbPath)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to open database file %s: %w", dbPath, err)
+	}
+
+	probe, err := os.CreateTemp(dir, ".db-write-check-*")
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return fmt.Errorf("%w: cannot create files in %s, check the directory's owner and permissions", ErrPermission, dir)
+		}
+		return fmt.Errorf("failed to create files in database directory %s: %w", dir, err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// titleError reports a unique constraint failure on an article title as
+// ErrDuplicateTitle and returns other errors unchanged
+func titleError(title string, err error) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return fmt.Errorf("%w: %q", ErrDuplicateTitle, title)
+	}
+	return err
+}
+
+// isBusy reports whether err is SQLite's "database is locked" or "database
+// table is locked", which clear once the other writer finishes
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+}
+
+// classifyError describes SQLite failures that have a clear fix, such as
+// a locked or corrupt file, and returns other errors unchanged
+func classifyError(dbPath string, err error) error {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+
+	switch sqliteErr.Code {
+	case sqlite3.ErrPerm, sqlite3.ErrReadonly, sqlite3.ErrCantOpen:
+		return fmt.Errorf("%w: %s cannot be written, check the owner and permissions of the file and its directory: %v", ErrPermission, dbPath, err)
+	case sqlite3.ErrBusy, sqlite3.ErrLocked:
+		return fmt.Errorf("%w: %s is in use by another process, stop it or wait for it to finish: %v", ErrLocked, dbPath, err)
+	case sqlite3.ErrCorrupt, sqlite3.ErrNotADB:
+		return fmt.Errorf("%w: %s is damaged or is not a SQLite database, restore it from a backup: %v", ErrCorrupt, dbPath, err)
+	default:
+		return err
+	}
+}
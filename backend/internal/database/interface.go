@@ -1,25 +1,57 @@
 package database
 
 import (
+	"context"
 	"event-to-insight/internal/models"
+	"time"
 )
 
-// DatabaseInterface defines the contract for database operations
+// DatabaseInterface defines the contract for database operations. Calls
+// taking a context stop when it is cancelled or its deadline passes.
 type DatabaseInterface interface {
 	// Article operations
-	GetAllArticles() ([]models.Article, error)
-	GetArticleByID(id int) (*models.Article, error)
-	GetArticlesByIDs(ids []int) ([]models.Article, error)
+	GetAllArticles(ctx context.Context) ([]models.Article, error)
+	EachArticle(ctx context.Context, fn func(models.Article) error) error
+	GetArticleByID(ctx context.Context, id int) (*models.Article, error)
+	GetArticleByTitle(ctx context.Context, title string) (*models.Article, error)
+	GetArticlesByIDs(ctx context.Context, ids []int) ([]models.Article, error)
+	UpdateArticle(ctx context.Context, id int, title, content string) (*models.Article, error)
+	ImportArticles(ctx context.Context, articles []models.Article) ([]models.Article, error)
+	SetArticleSummary(ctx context.Context, id int, content, summary string) error
+	GetArticleHistory(ctx context.Context, articleID int) ([]models.ArticleVersion, error)
+	KeywordSearchArticles(ctx context.Context, terms []string, excludeIDs []int, limit, offset int) ([]models.Article, error)
+
+	// Article view tracking
+	RecordArticleView(ctx context.Context, articleID int) error
+	GetPopularArticles(ctx context.Context, limit, offset int) ([]models.PopularArticle, error)
 
 	// Query operations
-	CreateQuery(query string) (*models.Query, error)
-	GetQueryByID(id int) (*models.Query, error)
+	CreateQuery(ctx context.Context, query string) (*models.Query, error)
+	GetQueryByID(ctx context.Context, id int) (*models.Query, error)
+	TopQueries(ctx context.Context, since time.Time, limit int) ([]models.TopQuery, error)
+	PurgeQueriesOlderThan(ctx context.Context, cutoff time.Time) (*models.PurgeResult, error)
 
 	// Search result operations
-	CreateSearchResult(queryID int, summary string, relevantArticleIDs []int) (*models.SearchResult, error)
-	GetSearchResultByQueryID(queryID int) (*models.SearchResult, error)
+	CreateSearchResult(ctx context.Context, queryID int, summary string, relevantArticleIDs []int, scores map[int]float64) (*models.SearchResult, error)
+	GetSearchResultByQueryID(ctx context.Context, queryID int) (*models.SearchResult, error)
+	GetSearchResultsByQueryID(ctx context.Context, queryID int) ([]models.SearchResult, error)
+
+	// Idempotency key operations
+	ReserveIdempotencyKey(ctx context.Context, key, query string, staleBefore time.Time) (*models.IdempotencyRecord, bool, error)
+	CompleteIdempotencyKey(ctx context.Context, key string, response []byte) error
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+
+	// Share token operations
+	CreateShareToken(ctx context.Context, resultID int, token string, expiresAt time.Time) error
+	GetResultByShareToken(ctx context.Context, token string) (*models.SearchResult, error)
+
+	// Reporting
+	GetStats(ctx context.Context) (*models.Stats, error)
 
 	// Database management
 	Initialize() error
+	Ping(ctx context.Context) error
+	Reindex(ctx context.Context) (int, error)
+	Backup(ctx context.Context, destPath string) error
 	Close() error
 }
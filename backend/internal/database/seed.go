@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"event-to-insight/internal/models"
+	"event-to-insight/internal/textutil"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// seedFetchTimeout bounds fetching the seed articles from SEED_URL
+	seedFetchTimeout = 10 * time.Second
+	// maxSeedBytes caps the size of a seed document
+	maxSeedBytes = 10 << 20
+)
+
+// seedArticle is one entry of a seed document. Other fields, such as the
+// IDs of an exported knowledge base, are ignored; articles are numbered from
+// 1 in document order instead.
+type seedArticle struct {
+	Title    string `json:"title"`
+	Content  string `json:"content"`
+	Keywords string `json:"keywords"`
+}
+
+// fetchSeedArticles downloads the articles to seed an empty database with.
+// The document must be a non-empty JSON array of articles, each with a
+// title and content, and no two titles may be the same ignoring case.
+func fetchSeedArticles(ctx context.Context, url string) ([]models.Article, error) {
+	ctx, cancel := context.WithTimeout(ctx, seedFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("seed URL answered %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSeedBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxSeedBytes {
+		return nil, fmt.Errorf("seed document is larger than %d bytes", maxSeedBytes)
+	}
+
+	var entries []seedArticle
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("seed document is not a JSON array of articles: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("seed document has no articles")
+	}
+
+	articles := make([]models.Article, 0, len(entries))
+	titles := make(map[string]bool, len(entries))
+	for i, entry := range entries {
+		title := strings.TrimSpace(entry.Title)
+		content := strings.TrimSpace(entry.Content)
+		if title == "" || content == "" {
+			return nil, fmt.Errorf("seed article %d needs a title and content", i)
+		}
+		if titles[textutil.FoldTitle(title)] {
+			return nil, fmt.Errorf("seed article %d: %w: %q", i, ErrDuplicateTitle, title)
+		}
+		titles[textutil.FoldTitle(title)] = true
+
+		articles = append(articles, models.Article{
+			ID:       i + 1,
+			Title:    title,
+			Content:  content,
+			Keywords: strings.TrimSpace(entry.Keywords),
+		})
+	}
+
+	return articles, nil
+}
@@ -1,84 +1,527 @@
 package database
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"event-to-insight/internal/models"
+	"event-to-insight/internal/textutil"
 	"fmt"
+	"log/slog"
 	"strings"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 // SQLiteDB implements DatabaseInterface for SQLite
 type SQLiteDB struct {
 	db *sql.DB
+	// path is where the database is stored, for error messages
+	path string
+
+	// queryTimeout bounds each call on top of the caller's context. Zero
+	// means calls are only limited by the caller. Reindex and Backup work
+	// through the whole database, so they are only limited by the caller;
+	// EachArticle applies it to each page it reads.
+	queryTimeout time.Duration
+
+	// articleIDStorage is how new search results store their article IDs
+	articleIDStorage ArticleIDStorage
+
+	// seedURL, if set, serves the articles an empty database is seeded
+	// with instead of the built-in ones
+	seedURL string
+
+	// busyRetries is how many times a write is retried while another
+	// writer holds the lock, waiting busyBackoff before the first retry
+	// and twice as long before each one after
+	busyRetries int
+	busyBackoff time.Duration
+
+	logger *slog.Logger
 }
 
-// NewSQLiteDB creates a new SQLite database instance
+const (
+	// defaultBusyRetries and defaultBusyBackoff are used for locked writes
+	// unless SetBusyRetry changes them
+	defaultBusyRetries = 2
+	defaultBusyBackoff = 50 * time.Millisecond
+)
+
+// ArticleIDStorage selects how the article IDs of a search result are
+// stored. Results are read back the same way whichever was used to write
+// them, so the storage can be switched without migrating old results.
+type ArticleIDStorage string
+
+const (
+	// ArticleIDStorageJSON stores the IDs as a JSON array in the result row
+	ArticleIDStorageJSON ArticleIDStorage = "json"
+	// ArticleIDStorageTable stores one search_result_articles row per ID,
+	// ordered by position, keeping result rows small and allowing joins
+	ArticleIDStorageTable ArticleIDStorage = "table"
+)
+
+// NewSQLiteDB creates a new SQLite database instance. Errors caused by a
+// missing or unwritable directory, or a locked or corrupt file, say so and
+// wrap ErrPermission, ErrLocked or ErrCorrupt where they apply.
 func NewSQLiteDB(dbPath string) (*SQLiteDB, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+	if err := checkDBPath(dbPath); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite3", withForeignKeys(dbPath))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
-
-	// Enable foreign key constraints
-	if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
-		return nil, fmt.Errorf("failed to enable foreign keys: %w", err)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open database: %w", classifyError(dbPath, err))
 	}
 
-	sqliteDB := &SQLiteDB{db: db}
+	sqliteDB := &SQLiteDB{
+		db:               db,
+		path:             dbPath,
+		articleIDStorage: ArticleIDStorageJSON,
+		busyRetries:      defaultBusyRetries,
+		busyBackoff:      defaultBusyBackoff,
+		logger:           slog.Default(),
+	}
 	return sqliteDB, nil
 }
 
+// withForeignKeys adds the DSN parameter enabling foreign key constraints.
+// The pragma only applies to the connection it runs on, so it is set in the
+// DSN for every connection the pool opens rather than executed once.
+func withForeignKeys(dbPath string) string {
+	if strings.Contains(dbPath, "?") {
+		return dbPath + "&_foreign_keys=on"
+	}
+	return dbPath + "?_foreign_keys=on"
+}
+
+// SetQueryTimeout limits how long each database call may run. Zero removes
+// the limit.
+func (s *SQLiteDB) SetQueryTimeout(timeout time.Duration) {
+	s.queryTimeout = timeout
+}
+
+// SetArticleIDStorage selects how new search results store their article
+// IDs. It defaults to ArticleIDStorageJSON.
+func (s *SQLiteDB) SetArticleIDStorage(storage ArticleIDStorage) {
+	s.articleIDStorage = storage
+}
+
+// SetSeedURL makes Initialize seed an empty database with the JSON array of
+// articles served at url. If it cannot be fetched or is invalid, a warning
+// is logged and the built-in articles are used.
+func (s *SQLiteDB) SetSeedURL(url string) {
+	s.seedURL = url
+}
+
+// SetBusyRetry sets how many times a write is retried when SQLite reports
+// the database locked, and the wait before the first retry, which doubles
+// for each retry after it. Zero retries returns ErrBusy at once.
+func (s *SQLiteDB) SetBusyRetry(retries int, backoff time.Duration) {
+	s.busyRetries = retries
+	s.busyBackoff = backoff
+}
+
+// SetLogger replaces the logger used for warnings, which defaults to
+// slog.Default()
+func (s *SQLiteDB) SetLogger(logger *slog.Logger) {
+	s.logger = logger
+}
+
+// withTimeout derives the context for a single database call
+func (s *SQLiteDB) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.queryTimeout)
+}
+
+// retryBusy runs write until it succeeds, fails for a reason other than a
+// locked database, or has been retried busyRetries times. A write that
+// stays locked returns an error wrapping ErrBusy.
+func (s *SQLiteDB) retryBusy(ctx context.Context, write func() error) error {
+	backoff := s.busyBackoff
+	for attempt := 0; ; attempt++ {
+		err := write()
+		if !isBusy(err) {
+			return err
+		}
+		if attempt >= s.busyRetries {
+			return fmt.Errorf("%w after %d attempts: %v", ErrBusy, attempt+1, err)
+		}
+		s.logger.DebugContext(ctx, "database is locked, retrying write", "attempt", attempt+1, "backoff", backoff)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w: %v", ErrBusy, err)
+		}
+		backoff *= 2
+	}
+}
+
 // Initialize creates the database tables and seeds initial data
 func (s *SQLiteDB) Initialize() error {
-	if err := s.createTables(); err != nil {
-		return fmt.Errorf("failed to create tables: %w", err)
+	ctx := context.Background()
+
+	if err := s.createTables(ctx); err != nil {
+		return fmt.Errorf("failed to create tables: %w", classifyError(s.path, err))
+	}
+
+	if err := s.seedArticles(ctx); err != nil {
+		return fmt.Errorf("failed to seed articles: %w", classifyError(s.path, err))
 	}
 
-	if err := s.seedArticles(); err != nil {
-		return fmt.Errorf("failed to seed articles: %w", err)
+	// Databases created before the full-text index existed need it built
+	if _, err := s.Reindex(ctx); err != nil {
+		return fmt.Errorf("failed to build search index: %w", classifyError(s.path, err))
 	}
 
 	return nil
 }
 
 // createTables creates the necessary database tables
-func (s *SQLiteDB) createTables() error {
+func (s *SQLiteDB) createTables(ctx context.Context) error {
 	schema := `
 	CREATE TABLE IF NOT EXISTS articles (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		title TEXT NOT NULL,
-		content TEXT NOT NULL
+		content TEXT NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		keywords TEXT NOT NULL DEFAULT '',
+		summary TEXT NOT NULL DEFAULT ''
 	);
 
 	CREATE TABLE IF NOT EXISTS queries (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		query TEXT NOT NULL,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		normalized_query TEXT
 	);
 
 	CREATE TABLE IF NOT EXISTS search_results (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		query_id INTEGER NOT NULL,
 		ai_summary_answer TEXT NOT NULL,
-		ai_relevant_articles TEXT NOT NULL, -- JSON array
+		ai_relevant_articles TEXT NOT NULL DEFAULT '[]', -- JSON array, empty when stored in search_result_articles
+		ai_relevance_scores TEXT NOT NULL DEFAULT '{}', -- JSON object of scores by article ID, empty when stored in search_result_articles
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (query_id) REFERENCES queries(id)
 	);
+
+	-- Article IDs of results stored with ArticleIDStorageTable, in order,
+	-- with the AI's score for each, NULL when it gave none
+	CREATE TABLE IF NOT EXISTS search_result_articles (
+		search_result_id INTEGER NOT NULL,
+		position INTEGER NOT NULL,
+		article_id INTEGER NOT NULL,
+		score REAL,
+		PRIMARY KEY (search_result_id, position),
+		FOREIGN KEY (search_result_id) REFERENCES search_results(id) ON DELETE CASCADE
+	);
+
+	-- Full-text index over articles used by keyword search, kept in sync by
+	-- the triggers below
+	CREATE VIRTUAL TABLE IF NOT EXISTS articles_fts USING fts4(content="articles", title, content);
+
+	CREATE TRIGGER IF NOT EXISTS articles_fts_before_update BEFORE UPDATE ON articles BEGIN
+		DELETE FROM articles_fts WHERE docid = old.rowid;
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS articles_fts_before_delete BEFORE DELETE ON articles BEGIN
+		DELETE FROM articles_fts WHERE docid = old.rowid;
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS articles_fts_after_update AFTER UPDATE ON articles BEGIN
+		INSERT INTO articles_fts(docid, title, content) VALUES (new.rowid, new.title, new.content);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS articles_fts_after_insert AFTER INSERT ON articles BEGIN
+		INSERT INTO articles_fts(docid, title, content) VALUES (new.rowid, new.title, new.content);
+	END;
+
+	-- Prior contents of articles, one row per edit
+	CREATE TABLE IF NOT EXISTS article_versions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		article_id INTEGER NOT NULL,
+		title TEXT NOT NULL,
+		content TEXT NOT NULL,
+		edited_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (article_id) REFERENCES articles(id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_article_versions_article_id ON article_versions(article_id);
+
+	-- Tokens giving read-only access to a search result until they expire,
+	-- stored as the hex SHA-256 of the token so a copy of the database
+	-- cannot be used to open the links
+	CREATE TABLE IF NOT EXISTS share_tokens (
+		token_hash TEXT PRIMARY KEY,
+		search_result_id INTEGER NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (search_result_id) REFERENCES search_results(id) ON DELETE CASCADE
+	);
+
+	-- Searches sent with an Idempotency-Key header. response holds the JSON
+	-- returned to the client, and is NULL while the search is running.
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		key TEXT PRIMARY KEY,
+		query TEXT NOT NULL,
+		response TEXT,
+		created_at TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS article_views (
+		article_id INTEGER PRIMARY KEY,
+		view_count INTEGER NOT NULL DEFAULT 0,
+		last_viewed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (article_id) REFERENCES articles(id)
+	);
 	`
 
-	_, err := s.db.Exec(schema)
+	if _, err := s.db.ExecContext(ctx, schema); err != nil {
+		return err
+	}
+
+	// Columns added after the initial release, for existing databases
+	if err := s.addColumnIfMissing(ctx, "queries", "normalized_query", "TEXT"); err != nil {
+		return err
+	}
+	if err := s.backfillNormalizedQueries(ctx); err != nil {
+		return err
+	}
+	if err := s.addColumnIfMissing(ctx, "articles", "updated_at", "TIMESTAMP"); err != nil {
+		return err
+	}
+	// Articles from before the column existed count as updated now
+	if _, err := s.db.ExecContext(ctx, "UPDATE articles SET updated_at = ? WHERE updated_at IS NULL", time.Now()); err != nil {
+		return fmt.Errorf("failed to backfill article update times: %w", err)
+	}
+	if err := s.addColumnIfMissing(ctx, "articles", "keywords", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfMissing(ctx, "articles", "summary", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfMissing(ctx, "search_results", "ai_relevance_scores", "TEXT NOT NULL DEFAULT '{}'"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfMissing(ctx, "search_result_articles", "score", "REAL"); err != nil {
+		return err
+	}
+
+	if err := s.hashShareTokens(ctx); err != nil {
+		return err
+	}
+
+	// Results without articles were once stored as a JSON null
+	if _, err := s.db.ExecContext(ctx, "UPDATE search_results SET ai_relevant_articles = '[]' WHERE ai_relevant_articles = 'null'"); err != nil {
+		return fmt.Errorf("failed to normalize stored article IDs: %w", err)
+	}
+
+	// Titles are unique regardless of case. Databases from before the
+	// index may hold duplicates, which are renamed first.
+	if err := s.renameDuplicateTitles(ctx); err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, "CREATE UNIQUE INDEX IF NOT EXISTS idx_articles_title ON articles(title COLLATE NOCASE)"); err != nil {
+		return fmt.Errorf("articles share a title, rename the duplicates: %w", err)
+	}
+
+	_, err := s.db.ExecContext(ctx, "CREATE INDEX IF NOT EXISTS idx_queries_created_at ON queries(created_at)")
 	return err
 }
 
-// seedArticles populates the database with initial articles
-func (s *SQLiteDB) seedArticles() error {
+// hashShareTokens replaces the tokens of share_tokens tables from before
+// they were stored hashed with their hashes, so existing links keep working
+func (s *SQLiteDB) hashShareTokens(ctx context.Context) error {
+	var plain int
+	err := s.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM pragma_table_info('share_tokens') WHERE name = 'token'",
+	).Scan(&plain)
+	if err != nil {
+		return fmt.Errorf("failed to inspect table share_tokens: %w", err)
+	}
+	if plain == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT token FROM share_tokens")
+	if err != nil {
+		return fmt.Errorf("failed to read share tokens: %w", err)
+	}
+	var tokens []string
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			rows.Close()
+			return err
+		}
+		tokens = append(tokens, token)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "ALTER TABLE share_tokens RENAME COLUMN token TO token_hash"); err != nil {
+		return fmt.Errorf("failed to rename share token column: %w", err)
+	}
+	for _, token := range tokens {
+		if _, err := tx.ExecContext(ctx, "UPDATE share_tokens SET token_hash = ? WHERE token_hash = ?", hashShareToken(token), token); err != nil {
+			return fmt.Errorf("failed to hash share token: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// hashShareToken returns what share_tokens stores for token
+func hashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// backfillNormalizedQueries fills in normalized_query for queries stored
+// before the column existed
+func (s *SQLiteDB) backfillNormalizedQueries(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, query FROM queries WHERE normalized_query IS NULL")
+	if err != nil {
+		return fmt.Errorf("failed to read queries to normalize: %w", err)
+	}
+
+	pending := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var query string
+		if err := rows.Scan(&id, &query); err != nil {
+			rows.Close()
+			return err
+		}
+		pending[id] = query
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for id, query := range pending {
+		if _, err := tx.ExecContext(ctx, "UPDATE queries SET normalized_query = ? WHERE id = ?", textutil.NormalizeQuery(query), id); err != nil {
+			return fmt.Errorf("failed to normalize query %d: %w", id, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// renameDuplicateTitles appends the article ID to every title that repeats,
+// ignoring case, the title of an older article, so the unique title index
+// can be created. It does nothing once the index exists.
+func (s *SQLiteDB) renameDuplicateTitles(ctx context.Context) error {
+	var indexed int
+	err := s.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'idx_articles_title'",
+	).Scan(&indexed)
+	if err != nil {
+		return fmt.Errorf("failed to inspect indexes: %w", err)
+	}
+	if indexed > 0 {
+		return nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, title FROM articles a
+		WHERE EXISTS (SELECT 1 FROM articles b WHERE b.title = a.title COLLATE NOCASE AND b.id < a.id)
+		ORDER BY id`)
+	if err != nil {
+		return fmt.Errorf("failed to find duplicate titles: %w", err)
+	}
+	duplicates := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var title string
+		if err := rows.Scan(&id, &title); err != nil {
+			rows.Close()
+			return err
+		}
+		duplicates[id] = title
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(duplicates) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for id, title := range duplicates {
+		renamed := fmt.Sprintf("%s (%d)", title, id)
+		if _, err := tx.ExecContext(ctx, "UPDATE articles SET title = ?, updated_at = ? WHERE id = ?", renamed, time.Now(), id); err != nil {
+			return fmt.Errorf("failed to rename article %d: %w", id, err)
+		}
+		s.logger.WarnContext(ctx, "renamed article with a duplicate title", "article_id", id, "title", title, "renamed", renamed)
+	}
+
+	return tx.Commit()
+}
+
+// addColumnIfMissing adds a column to an existing table unless it is
+// already present
+func (s *SQLiteDB) addColumnIfMissing(ctx context.Context, table, column, definition string) error {
+	var count int
+	err := s.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column,
+	).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
+// seedArticles populates an empty database with initial articles, fetched
+// from the seed URL if one is set
+func (s *SQLiteDB) seedArticles(ctx context.Context) error {
 	// Check if articles already exist
 	var count int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM articles").Scan(&count)
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM articles").Scan(&count)
 	if err != nil {
 		return err
 	}
@@ -87,53 +530,93 @@ func (s *SQLiteDB) seedArticles() error {
 		return nil // Articles already seeded
 	}
 
+	// IDs are assigned rather than left to AUTOINCREMENT, since tests and
+	// clients rely on article 1 being the password reset article. They are
+	// only assigned to a table that has never held an article, since reusing
+	// the ID of a deleted one would attach its old search results, feedback
+	// and shares to the new article.
 	articles := []models.Article{
 		{
+			ID:      1,
 			Title:   "Password Reset Instructions",
 			Content: "To reset your password: 1) Go to the login page 2) Click 'Forgot Password' 3) Enter your email address 4) Check your email for reset instructions 5) Follow the link and create a new password. The reset link expires in 24 hours.",
 		},
 		{
+			ID:      2,
 			Title:   "VPN Connection Setup",
 			Content: "Setting up VPN connection: 1) Download the VPN client from the IT portal 2) Install using admin credentials 3) Use your domain username and password 4) Connect to the 'Corporate-Main' server 5) Verify connection by accessing internal resources. Contact IT if you experience connectivity issues.",
 		},
 		{
+			ID:      3,
 			Title:   "Software Installation Guidelines",
 			Content: "For software installation: 1) Check the approved software list on the IT portal 2) Submit a software request ticket if not approved 3) Admin rights are required for installation 4) IT will remotely install if you don't have admin access 5) All installations must be from official vendors only.",
 		},
 		{
+			ID:      4,
 			Title:   "Email Configuration Troubleshooting",
 			Content: "Email setup issues: 1) Verify server settings - IMAP: mail.company.com port 993 SSL, SMTP: mail.company.com port 587 STARTTLS 2) Check username format: firstname.lastname@company.com 3) Ensure password is current 4) Clear email cache and restart client 5) For mobile devices, use app-specific passwords.",
 		},
 		{
+			ID:      5,
 			Title:   "Multi-Factor Authentication Setup",
 			Content: "MFA setup process: 1) Install Microsoft Authenticator app 2) Log into company portal 3) Navigate to Security Settings 4) Click 'Add Authentication Method' 5) Scan QR code with authenticator app 6) Enter verification code 7) MFA is now required for all company logins.",
 		},
 		{
+			ID:      6,
 			Title:   "Printer Connection Issues",
 			Content: "Printer troubleshooting: 1) Ensure printer is connected to corporate network 2) Install latest printer drivers from manufacturer website 3) Add printer using IP address: 192.168.1.100 4) Check print queue for stuck jobs 5) Restart print spooler service if needed 6) For Mac users, use CUPS interface.",
 		},
 		{
+			ID:      7,
 			Title:   "File Share Access Problems",
 			Content: "File share access: 1) Connect using \\\\fileserver\\shared 2) Use domain credentials when prompted 3) Map network drive for easier access 4) Check group membership for folder permissions 5) Clear credential cache if authentication fails 6) Contact IT for permission changes.",
 		},
 		{
+			ID:      8,
 			Title:   "Remote Desktop Configuration",
 			Content: "Remote desktop setup: 1) Enable Remote Desktop on target computer 2) Add user to 'Remote Desktop Users' group 3) Configure firewall to allow RDP (port 3389) 4) Use Computer Name or IP address to connect 5) For external access, use VPN first 6) Use Network Level Authentication for security.",
 		},
 		{
+			ID:      9,
 			Title:   "Antivirus Software Management",
 			Content: "Antivirus management: 1) Corporate antivirus is automatically deployed 2) Do not install additional antivirus software 3) Scans run automatically daily at 2 AM 4) Quarantine notifications appear in system tray 5) Report false positives to IT immediately 6) Never disable real-time protection.",
 		},
 		{
+			ID:      10,
 			Title:   "Data Backup and Recovery",
 			Content: "Backup procedures: 1) OneDrive syncs user documents automatically 2) Critical data should be stored in designated share folders 3) Personal desktop/downloads are not backed up 4) File recovery available for 90 days 5) For urgent recovery, submit priority ticket 6) Test restore procedures quarterly.",
 		},
 	}
 
+	if s.seedURL != "" {
+		fetched, err := fetchSeedArticles(ctx, s.seedURL)
+		if err != nil {
+			s.logger.WarnContext(ctx, "could not seed articles from SEED_URL, using the built-in articles", "error", err)
+		} else {
+			articles = fetched
+		}
+	}
+
+	var lastID int
+	err = s.db.QueryRowContext(ctx, "SELECT seq FROM sqlite_sequence WHERE name = 'articles'").Scan(&lastID)
+	used := err == nil
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to inspect article IDs: %w", err)
+	}
+	if used {
+		s.logger.WarnContext(ctx, "articles were deleted, seeding after the last used ID", "last_id", lastID)
+	}
+
+	// Seeded articles are all the same age, so none wins a ranking tie
+	now := time.Now()
 	for _, article := range articles {
-		_, err := s.db.Exec(
-			"INSERT INTO articles (title, content) VALUES (?, ?)",
-			article.Title, article.Content,
+		var id interface{}
+		if !used {
+			id = article.ID
+		}
+		_, err := s.db.ExecContext(ctx,
+			"INSERT INTO articles (id, title, content, keywords, updated_at) VALUES (?, ?, ?, ?, ?)",
+			id, article.Title, article.Content, article.Keywords, now,
 		)
 		if err != nil {
 			return fmt.Errorf("failed to insert article '%s': %w", article.Title, err)
@@ -143,9 +626,12 @@ func (s *SQLiteDB) seedArticles() error {
 	return nil
 }
 
-// GetAllArticles retrieves all articles from the database
-func (s *SQLiteDB) GetAllArticles() ([]models.Article, error) {
-	rows, err := s.db.Query("SELECT id, title, content FROM articles")
+// GetAllArticles retrieves all articles from the database, ordered by ID
+func (s *SQLiteDB) GetAllArticles(ctx context.Context) ([]models.Article, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, "SELECT id, title, content, keywords, summary, updated_at FROM articles ORDER BY id ASC")
 	if err != nil {
 		return nil, err
 	}
@@ -154,7 +640,7 @@ func (s *SQLiteDB) GetAllArticles() ([]models.Article, error) {
 	var articles []models.Article
 	for rows.Next() {
 		var article models.Article
-		err := rows.Scan(&article.ID, &article.Title, &article.Content)
+		err := rows.Scan(&article.ID, &article.Title, &article.Content, &article.Keywords, &article.Summary, &article.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -164,155 +650,1083 @@ func (s *SQLiteDB) GetAllArticles() ([]models.Article, error) {
 	return articles, rows.Err()
 }
 
-// GetArticleByID retrieves a specific article by ID
-func (s *SQLiteDB) GetArticleByID(id int) (*models.Article, error) {
-	var article models.Article
-	err := s.db.QueryRow(
-		"SELECT id, title, content FROM articles WHERE id = ?", id,
-	).Scan(&article.ID, &article.Title, &article.Content)
-
+// Reindex rebuilds the full-text index from the articles table and returns
+// the number of articles indexed. The rebuild runs in a single transaction,
+// so readers keep seeing the old index until it commits and an interrupted
+// run leaves the previous index intact.
+func (s *SQLiteDB) Reindex(ctx context.Context) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
+	defer tx.Rollback()
 
-	return &article, nil
-}
-
-// GetArticlesByIDs retrieves multiple articles by their IDs
-func (s *SQLiteDB) GetArticlesByIDs(ids []int) ([]models.Article, error) {
-	if len(ids) == 0 {
-		return []models.Article{}, nil
+	if _, err := tx.ExecContext(ctx, "INSERT INTO articles_fts(articles_fts) VALUES('rebuild')"); err != nil {
+		return 0, fmt.Errorf("failed to rebuild full-text index: %w", err)
 	}
 
-	// Build placeholders for IN clause
-	placeholders := strings.Repeat("?,", len(ids)-1) + "?"
-	query := fmt.Sprintf("SELECT id, title, content FROM articles WHERE id IN (%s)", placeholders)
+	var count int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM articles").Scan(&count); err != nil {
+		return 0, err
+	}
 
-	// Convert int slice to interface slice
-	args := make([]interface{}, len(ids))
-	for i, id := range ids {
-		args[i] = id
+	if err := tx.Commit(); err != nil {
+		return 0, err
 	}
 
-	rows, err := s.db.Query(query, args...)
+	return count, nil
+}
+
+// BackfillKeywords gives each article without keywords up to limit of them,
+// extracted from its title and content, and returns how many articles were
+// updated. Curated keywords are never replaced.
+func (s *SQLiteDB) BackfillKeywords(ctx context.Context, stopwords []string, limit int) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
+	rows, err := tx.QueryContext(ctx, "SELECT id, title, content FROM articles WHERE keywords = ''")
+	if err != nil {
+		return 0, err
+	}
 	var articles []models.Article
 	for rows.Next() {
 		var article models.Article
-		err := rows.Scan(&article.ID, &article.Title, &article.Content)
-		if err != nil {
-			return nil, err
+		if err := rows.Scan(&article.ID, &article.Title, &article.Content); err != nil {
+			rows.Close()
+			return 0, err
 		}
 		articles = append(articles, article)
 	}
-
-	return articles, rows.Err()
-}
-
-// CreateQuery creates a new query record
-func (s *SQLiteDB) CreateQuery(query string) (*models.Query, error) {
-	result, err := s.db.Exec(
-		"INSERT INTO queries (query, created_at) VALUES (?, ?)",
-		query, time.Now(),
-	)
-	if err != nil {
-		return nil, err
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
 	}
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		return nil, err
+	updated := 0
+	for _, article := range articles {
+		keywords := textutil.ExtractKeywords(article.Title, article.Content, stopwords, limit)
+		if len(keywords) == 0 {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE articles SET keywords = ? WHERE id = ?", strings.Join(keywords, ", "), article.ID); err != nil {
+			return 0, fmt.Errorf("failed to set keywords of article %d: %w", article.ID, err)
+		}
+		updated++
 	}
 
-	return s.GetQueryByID(int(id))
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return updated, nil
 }
 
-// GetQueryByID retrieves a query by ID
-func (s *SQLiteDB) GetQueryByID(id int) (*models.Query, error) {
-	var query models.Query
-	err := s.db.QueryRow(
-		"SELECT id, query, created_at FROM queries WHERE id = ?", id,
-	).Scan(&query.ID, &query.Query, &query.CreatedAt)
+// PurgeQueriesOlderThan deletes queries created before cutoff along with
+// their search results, in a single transaction. Like Reindex it is a
+// maintenance task, so it is not subject to the per-call query timeout.
+// It is retried while the database is locked by another writer.
+func (s *SQLiteDB) PurgeQueriesOlderThan(ctx context.Context, cutoff time.Time) (*models.PurgeResult, error) {
+	var result *models.PurgeResult
+	err := s.retryBusy(ctx, func() (err error) {
+		result, err = s.purgeQueriesOlderThan(ctx, cutoff)
+		return err
+	})
+	return result, err
+}
 
+// purgeQueriesOlderThan makes one attempt at PurgeQueriesOlderThan
+func (s *SQLiteDB) purgeQueriesOlderThan(ctx context.Context, cutoff time.Time) (*models.PurgeResult, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	return &query, nil
-}
-
-// CreateSearchResult creates a new search result record
-func (s *SQLiteDB) CreateSearchResult(queryID int, summary string, relevantArticleIDs []int) (*models.SearchResult, error) {
-	// Convert slice to JSON
-	articleIDsJSON, err := json.Marshal(relevantArticleIDs)
+	// Results reference their query, so they go first. Their article rows
+	// and share tokens are removed with them.
+	results, err := tx.ExecContext(ctx,
+		"DELETE FROM search_results WHERE query_id IN (SELECT id FROM queries WHERE created_at < ?)", cutoff)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal article IDs: %w", err)
+		return nil, fmt.Errorf("failed to purge search results: %w", err)
+	}
+	queries, err := tx.ExecContext(ctx, "DELETE FROM queries WHERE created_at < ?", cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to purge queries: %w", err)
+	}
+	// Stored responses repeat the query text, so they go with it
+	if _, err := tx.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE created_at < ?", cutoff); err != nil {
+		return nil, fmt.Errorf("failed to purge idempotency keys: %w", err)
+	}
+	// Expired share links can no longer be opened, whatever their age
+	shares, err := tx.ExecContext(ctx, "DELETE FROM share_tokens WHERE expires_at <= ?", time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to purge expired share tokens: %w", err)
 	}
 
-	result, err := s.db.Exec(
-		"INSERT INTO search_results (query_id, ai_summary_answer, ai_relevant_articles, created_at) VALUES (?, ?, ?, ?)",
-		queryID, summary, string(articleIDsJSON), time.Now(),
-	)
+	resultsDeleted, err := results.RowsAffected()
 	if err != nil {
 		return nil, err
 	}
-
-	id, err := result.LastInsertId()
+	queriesDeleted, err := queries.RowsAffected()
 	if err != nil {
 		return nil, err
 	}
-
-	return s.GetSearchResultByID(int(id))
-}
-
-// GetSearchResultByID retrieves a search result by ID
-func (s *SQLiteDB) GetSearchResultByID(id int) (*models.SearchResult, error) {
-	var result models.SearchResult
-	var articleIDsJSON string
-
-	err := s.db.QueryRow(
-		"SELECT id, query_id, ai_summary_answer, ai_relevant_articles, created_at FROM search_results WHERE id = ?", id,
-	).Scan(&result.ID, &result.QueryID, &result.AISummaryAnswer, &articleIDsJSON, &result.CreatedAt)
-
+	sharesDeleted, err := shares.RowsAffected()
 	if err != nil {
 		return nil, err
 	}
 
-	// Parse JSON array
-	err = json.Unmarshal([]byte(articleIDsJSON), &result.AIRelevantArticles)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal article IDs: %w", err)
+	if err := tx.Commit(); err != nil {
+		return nil, err
 	}
 
-	return &result, nil
+	return &models.PurgeResult{
+		QueriesDeleted:       int(queriesDeleted),
+		ResultsDeleted:       int(resultsDeleted),
+		ExpiredSharesDeleted: int(sharesDeleted),
+	}, nil
 }
 
-// GetSearchResultByQueryID retrieves a search result by query ID
-func (s *SQLiteDB) GetSearchResultByQueryID(queryID int) (*models.SearchResult, error) {
-	var result models.SearchResult
-	var articleIDsJSON string
+// Backup writes a consistent snapshot of the database to destPath using
+// VACUUM INTO. The snapshot is taken inside a single read transaction, so
+// concurrent writers are not blocked. destPath must not already exist.
+func (s *SQLiteDB) Backup(ctx context.Context, destPath string) error {
+	if _, err := s.db.ExecContext(ctx, "VACUUM INTO ?", destPath); err != nil {
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+	return nil
+}
 
-	err := s.db.QueryRow(
-		"SELECT id, query_id, ai_summary_answer, ai_relevant_articles, created_at FROM search_results WHERE query_id = ?", queryID,
-	).Scan(&result.ID, &result.QueryID, &result.AISummaryAnswer, &articleIDsJSON, &result.CreatedAt)
+// eachArticlePageSize is how many articles EachArticle reads at a time
+const eachArticlePageSize = 200
 
-	if err != nil {
-		return nil, err
+// EachArticle calls fn with every article in ID order, reading them a page
+// at a time so large knowledge bases are never held in memory. No read is
+// left open while fn runs, so a slow caller does not hold up writers. It
+// stops at the first error fn returns and returns it.
+func (s *SQLiteDB) EachArticle(ctx context.Context, fn func(models.Article) error) error {
+	afterID := 0
+	for {
+		page, err := s.articlesAfter(ctx, afterID, eachArticlePageSize)
+		if err != nil {
+			return err
+		}
+		for _, article := range page {
+			if err := fn(article); err != nil {
+				return err
+			}
+		}
+		if len(page) < eachArticlePageSize {
+			return nil
+		}
+		afterID = page[len(page)-1].ID
 	}
+}
+
+// articlesAfter returns up to limit articles with IDs above afterID, in ID
+// order
+func (s *SQLiteDB) articlesAfter(ctx context.Context, afterID, limit int) ([]models.Article, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-	// Parse JSON array
-	err = json.Unmarshal([]byte(articleIDsJSON), &result.AIRelevantArticles)
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT id, title, content, keywords, summary, updated_at FROM articles WHERE id > ? ORDER BY id ASC LIMIT ?",
+		afterID, limit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal article IDs: %w", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var articles []models.Article
+	for rows.Next() {
+		var article models.Article
+		if err := rows.Scan(&article.ID, &article.Title, &article.Content, &article.Keywords, &article.Summary, &article.UpdatedAt); err != nil {
+			return nil, err
+		}
+		articles = append(articles, article)
+	}
+	return articles, rows.Err()
+}
+
+// GetArticleByID retrieves a specific article by ID
+func (s *SQLiteDB) GetArticleByID(ctx context.Context, id int) (*models.Article, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var article models.Article
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, title, content, keywords, summary, updated_at FROM articles WHERE id = ?", id,
+	).Scan(&article.ID, &article.Title, &article.Content, &article.Keywords, &article.Summary, &article.UpdatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &article, nil
+}
+
+// GetArticleByTitle returns the article with the given title, compared
+// case-insensitively. Returns sql.ErrNoRows if there is none.
+func (s *SQLiteDB) GetArticleByTitle(ctx context.Context, title string) (*models.Article, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var article models.Article
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, title, content, keywords, summary, updated_at FROM articles WHERE title = ? COLLATE NOCASE", title,
+	).Scan(&article.ID, &article.Title, &article.Content, &article.Keywords, &article.Summary, &article.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &article, nil
+}
+
+// UpdateArticle replaces an article's title and content. The previous
+// version is saved to article_versions in the same transaction; the
+// keywords are kept, and the summary is cleared when the content changes
+// since it would describe the old text. Returns sql.ErrNoRows if the article does not exist.
+// It is retried while the database is locked by another writer.
+func (s *SQLiteDB) UpdateArticle(ctx context.Context, id int, title, content string) (*models.Article, error) {
+	var article *models.Article
+	err := s.retryBusy(ctx, func() (err error) {
+		article, err = s.updateArticle(ctx, id, title, content)
+		return err
+	})
+	return article, err
+}
+
+// updateArticle makes one attempt at UpdateArticle
+func (s *SQLiteDB) updateArticle(ctx context.Context, id int, title, content string) (*models.Article, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var previous models.Article
+	err = tx.QueryRowContext(ctx,
+		"SELECT id, title, content, keywords, summary FROM articles WHERE id = ?", id,
+	).Scan(&previous.ID, &previous.Title, &previous.Content, &previous.Keywords, &previous.Summary)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO article_versions (article_id, title, content, edited_at) VALUES (?, ?, ?, ?)",
+		previous.ID, previous.Title, previous.Content, time.Now(),
+	); err != nil {
+		return nil, fmt.Errorf("failed to save article version: %w", err)
+	}
+
+	summary := previous.Summary
+	if content != previous.Content {
+		summary = ""
+	}
+
+	now := time.Now()
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE articles SET title = ?, content = ?, summary = ?, updated_at = ? WHERE id = ?",
+		title, content, summary, now, id,
+	); err != nil {
+		return nil, fmt.Errorf("failed to update article: %w", titleError(title, err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &models.Article{ID: id, Title: title, Content: content, Keywords: previous.Keywords, Summary: summary, UpdatedAt: now}, nil
+}
+
+// SetArticleSummary stores the summary of an article, written from content.
+// It returns sql.ErrNoRows if the article no longer exists or its content
+// has changed since, so a late summary never describes an edited article.
+// It is retried while the database is locked by another writer.
+func (s *SQLiteDB) SetArticleSummary(ctx context.Context, id int, content, summary string) error {
+	return s.retryBusy(ctx, func() error {
+		return s.setArticleSummary(ctx, id, content, summary)
+	})
+}
+
+// setArticleSummary makes one attempt at SetArticleSummary
+func (s *SQLiteDB) setArticleSummary(ctx context.Context, id int, content, summary string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE articles SET summary = ?, updated_at = ? WHERE id = ? AND content = ?",
+		summary, time.Now(), id, content,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store article summary: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ImportArticles inserts new articles in a single transaction, so either all
+// of them are stored or none are. The articles are returned with their IDs.
+// It is retried while the database is locked by another writer.
+func (s *SQLiteDB) ImportArticles(ctx context.Context, articles []models.Article) ([]models.Article, error) {
+	var imported []models.Article
+	err := s.retryBusy(ctx, func() (err error) {
+		imported, err = s.importArticles(ctx, articles)
+		return err
+	})
+	return imported, err
+}
+
+// importArticles makes one attempt at ImportArticles
+func (s *SQLiteDB) importArticles(ctx context.Context, articles []models.Article) ([]models.Article, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	imported := make([]models.Article, 0, len(articles))
+	for i, article := range articles {
+		result, err := tx.ExecContext(ctx,
+			"INSERT INTO articles (title, content, keywords, summary, updated_at) VALUES (?, ?, ?, ?, ?)",
+			article.Title, article.Content, article.Keywords, article.Summary, now,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert article %d: %w", i, titleError(article.Title, err))
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		imported = append(imported, models.Article{
+			ID:        int(id),
+			Title:     article.Title,
+			Content:   article.Content,
+			Keywords:  article.Keywords,
+			Summary:   article.Summary,
+			UpdatedAt: now,
+		})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return imported, nil
+}
+
+// GetArticleHistory returns the previous versions of an article, newest first
+func (s *SQLiteDB) GetArticleHistory(ctx context.Context, articleID int) ([]models.ArticleVersion, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, article_id, title, content, edited_at
+		FROM article_versions
+		WHERE article_id = ?
+		ORDER BY edited_at DESC, id DESC`,
+		articleID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get article history: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []models.ArticleVersion{}
+	for rows.Next() {
+		var version models.ArticleVersion
+		if err := rows.Scan(&version.ID, &version.ArticleID, &version.Title, &version.Content, &version.EditedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, rows.Err()
+}
+
+// GetArticlesByIDs retrieves multiple articles by their IDs
+func (s *SQLiteDB) GetArticlesByIDs(ctx context.Context, ids []int) ([]models.Article, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if len(ids) == 0 {
+		return []models.Article{}, nil
+	}
+
+	// Build placeholders for IN clause
+	placeholders := strings.Repeat("?,", len(ids)-1) + "?"
+	query := fmt.Sprintf("SELECT id, title, content, keywords, summary, updated_at FROM articles WHERE id IN (%s)", placeholders)
+
+	// Convert int slice to interface slice
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var articles []models.Article
+	for rows.Next() {
+		var article models.Article
+		err := rows.Scan(&article.ID, &article.Title, &article.Content, &article.Keywords, &article.Summary, &article.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		articles = append(articles, article)
+	}
+
+	return articles, rows.Err()
+}
+
+// RecordArticleView increments the view counter for an article. The upsert
+// is a single statement so concurrent views are never lost.
+// It is retried while the database is locked by another writer.
+func (s *SQLiteDB) RecordArticleView(ctx context.Context, articleID int) error {
+	return s.retryBusy(ctx, func() error {
+		return s.recordArticleView(ctx, articleID)
+	})
+}
+
+// recordArticleView makes one attempt at RecordArticleView
+func (s *SQLiteDB) recordArticleView(ctx context.Context, articleID int) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO article_views (article_id, view_count, last_viewed_at) VALUES (?, 1, ?)
+		ON CONFLICT(article_id) DO UPDATE SET view_count = view_count + 1, last_viewed_at = excluded.last_viewed_at`,
+		articleID, time.Now(),
+	)
+	return err
+}
+
+// GetPopularArticles retrieves the most viewed articles, most viewed first
+func (s *SQLiteDB) GetPopularArticles(ctx context.Context, limit, offset int) ([]models.PopularArticle, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT a.id, a.title, a.content, v.view_count, v.last_viewed_at
+		FROM article_views v
+		JOIN articles a ON a.id = v.article_id
+		ORDER BY v.view_count DESC, a.id ASC
+		LIMIT ? OFFSET ?`,
+		limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	articles := []models.PopularArticle{}
+	for rows.Next() {
+		var article models.PopularArticle
+		err := rows.Scan(&article.ID, &article.Title, &article.Content, &article.ViewCount, &article.LastViewedAt)
+		if err != nil {
+			return nil, err
+		}
+		articles = append(articles, article)
+	}
+
+	return articles, rows.Err()
+}
+
+// KeywordSearchArticles returns articles with a word in their title or
+// content that starts with any of terms, case-insensitively, ranked by how
+// many of the terms they match. Words are looked up in the articles_fts
+// index. Each article's Score is the fraction of terms it matched. Terms
+// come from textutil.Tokenize, so they are only letters and digits and can
+// be used as prefix queries as they are. No terms match nothing. Articles in excludeIDs are never returned, and do
+// not take up places in the pages.
+func (s *SQLiteDB) KeywordSearchArticles(ctx context.Context, terms []string, excludeIDs []int, limit, offset int) ([]models.Article, error) {
+	if len(terms) == 0 {
+		return []models.Article{}, nil
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	matches := make([]string, len(terms))
+	args := make([]interface{}, 0, len(terms)+len(excludeIDs)+2)
+	for i, term := range terms {
+		matches[i] = "(CASE WHEN id IN (SELECT docid FROM articles_fts WHERE articles_fts MATCH ?) THEN 1 ELSE 0 END)"
+		args = append(args, term+"*")
+	}
+	exclude := ""
+	if len(excludeIDs) > 0 {
+		exclude = "WHERE id NOT IN (?" + strings.Repeat(", ?", len(excludeIDs)-1) + ")"
+		for _, id := range excludeIDs {
+			args = append(args, id)
+		}
+	}
+	args = append(args, limit, offset)
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, title, content, matches FROM (
+			SELECT id, title, content, `+strings.Join(matches, " + ")+` AS matches
+			FROM articles `+exclude+`
+		)
+		WHERE matches > 0
+		ORDER BY matches DESC, id ASC
+		LIMIT ? OFFSET ?`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	articles := []models.Article{}
+	for rows.Next() {
+		var article models.Article
+		var matched int
+		if err := rows.Scan(&article.ID, &article.Title, &article.Content, &matched); err != nil {
+			return nil, err
+		}
+		article.Score = float64(matched) / float64(len(terms))
+		articles = append(articles, article)
+	}
+
+	return articles, rows.Err()
+}
+
+// CreateQuery creates a new query record
+// It is retried while the database is locked by another writer.
+func (s *SQLiteDB) CreateQuery(ctx context.Context, query string) (*models.Query, error) {
+	var created *models.Query
+	err := s.retryBusy(ctx, func() (err error) {
+		created, err = s.createQuery(ctx, query)
+		return err
+	})
+	return created, err
+}
+
+// createQuery makes one attempt at CreateQuery
+func (s *SQLiteDB) createQuery(ctx context.Context, query string) (*models.Query, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx,
+		"INSERT INTO queries (query, created_at, normalized_query) VALUES (?, ?, ?)",
+		query, time.Now(), textutil.NormalizeQuery(query),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetQueryByID(ctx, int(id))
+}
+
+// ReserveIdempotencyKey reserves key for a search of query, returning true.
+// If the key is already reserved, the existing record is returned with
+// false instead, unless it has no response and was reserved before
+// staleBefore: an attempt that never finished is taken over. It is retried
+// while the database is locked by another writer.
+func (s *SQLiteDB) ReserveIdempotencyKey(ctx context.Context, key, query string, staleBefore time.Time) (*models.IdempotencyRecord, bool, error) {
+	var record *models.IdempotencyRecord
+	var reserved bool
+	err := s.retryBusy(ctx, func() (err error) {
+		record, reserved, err = s.reserveIdempotencyKey(ctx, key, query, staleBefore)
+		return err
+	})
+	return record, reserved, err
+}
+
+// reserveIdempotencyKey makes one attempt at ReserveIdempotencyKey
+func (s *SQLiteDB) reserveIdempotencyKey(ctx context.Context, key, query string, staleBefore time.Time) (*models.IdempotencyRecord, bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	now := time.Now()
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO idempotency_keys (key, query, created_at) VALUES (?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET query = excluded.query, created_at = excluded.created_at
+		WHERE idempotency_keys.response IS NULL AND idempotency_keys.created_at < ?`,
+		key, query, now, staleBefore,
+	)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, false, err
+	} else if n > 0 {
+		return &models.IdempotencyRecord{Key: key, Query: query, CreatedAt: now}, true, nil
+	}
+
+	record := models.IdempotencyRecord{Key: key}
+	var response sql.NullString
+	err = s.db.QueryRowContext(ctx,
+		"SELECT query, response, created_at FROM idempotency_keys WHERE key = ?", key,
+	).Scan(&record.Query, &response, &record.CreatedAt)
+	if err != nil {
+		return nil, false, err
+	}
+	if response.Valid {
+		record.Response = []byte(response.String)
+	}
+	return &record, false, nil
+}
+
+// CompleteIdempotencyKey stores the response of the search reserved under
+// key. It returns sql.ErrNoRows if the key is not reserved.
+func (s *SQLiteDB) CompleteIdempotencyKey(ctx context.Context, key string, response []byte) error {
+	return s.retryBusy(ctx, func() error {
+		return s.completeIdempotencyKey(ctx, key, response)
+	})
+}
+
+// completeIdempotencyKey makes one attempt at CompleteIdempotencyKey
+func (s *SQLiteDB) completeIdempotencyKey(ctx context.Context, key string, response []byte) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, "UPDATE idempotency_keys SET response = ? WHERE key = ?", string(response), key)
+	if err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey removes the reservation of a search that failed, so
+// a retry with the same key runs it again. Keys with a stored response are
+// kept.
+func (s *SQLiteDB) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	return s.retryBusy(ctx, func() error {
+		return s.releaseIdempotencyKey(ctx, key)
+	})
+}
+
+// releaseIdempotencyKey makes one attempt at ReleaseIdempotencyKey
+func (s *SQLiteDB) releaseIdempotencyKey(ctx context.Context, key string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE key = ? AND response IS NULL", key); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// TopQueries returns the most frequently asked queries since the given
+// time, grouped by their normalized text, most frequent first
+func (s *SQLiteDB) TopQueries(ctx context.Context, since time.Time, limit int) ([]models.TopQuery, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT normalized_query, COUNT(*) AS times_asked, MAX(created_at)
+		FROM queries
+		WHERE created_at >= ? AND normalized_query IS NOT NULL AND normalized_query != ''
+		GROUP BY normalized_query
+		ORDER BY times_asked DESC, MAX(created_at) DESC
+		LIMIT ?`,
+		since, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get top queries: %w", err)
+	}
+	defer rows.Close()
+
+	topQueries := []models.TopQuery{}
+	for rows.Next() {
+		var topQuery models.TopQuery
+		var lastAsked string
+		if err := rows.Scan(&topQuery.Query, &topQuery.Count, &lastAsked); err != nil {
+			return nil, err
+		}
+
+		// Aggregates lose the column type, so the timestamp comes back as text
+		topQuery.LastAskedAt, err = parseTimestamp(lastAsked)
+		if err != nil {
+			return nil, err
+		}
+		topQueries = append(topQueries, topQuery)
+	}
+
+	return topQueries, rows.Err()
+}
+
+// parseTimestamp parses a timestamp in any of the formats the SQLite driver writes
+func parseTimestamp(value string) (time.Time, error) {
+	for _, format := range sqlite3.SQLiteTimestampFormats {
+		if t, err := time.Parse(format, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("failed to parse timestamp %q", value)
+}
+
+// GetQueryByID retrieves a query by ID
+func (s *SQLiteDB) GetQueryByID(ctx context.Context, id int) (*models.Query, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var query models.Query
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, query, created_at FROM queries WHERE id = ?", id,
+	).Scan(&query.ID, &query.Query, &query.CreatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &query, nil
+}
+
+// CreateSearchResult creates a new search result record, storing its
+// article IDs and the AI's scores for them as selected by
+// SetArticleIDStorage. Scores of articles not in relevantArticleIDs are
+// not stored.
+// It is retried while the database is locked by another writer.
+func (s *SQLiteDB) CreateSearchResult(ctx context.Context, queryID int, summary string, relevantArticleIDs []int, scores map[int]float64) (*models.SearchResult, error) {
+	var result *models.SearchResult
+	err := s.retryBusy(ctx, func() (err error) {
+		result, err = s.createSearchResult(ctx, queryID, summary, relevantArticleIDs, scores)
+		return err
+	})
+	return result, err
+}
+
+// createSearchResult makes one attempt at CreateSearchResult
+func (s *SQLiteDB) createSearchResult(ctx context.Context, queryID int, summary string, relevantArticleIDs []int, scores map[int]float64) (*models.SearchResult, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	// Convert slice and scores to JSON, unless the IDs get rows of their
+	// own. No IDs are stored as [] rather than null.
+	if relevantArticleIDs == nil {
+		relevantArticleIDs = []int{}
+	}
+	inTable := s.articleIDStorage == ArticleIDStorageTable
+	articleIDsJSON := []byte("[]")
+	scoresJSON := []byte("{}")
+	if !inTable {
+		var err error
+		articleIDsJSON, err = json.Marshal(relevantArticleIDs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal article IDs: %w", err)
+		}
+		scoresJSON, err = json.Marshal(relevantScores(relevantArticleIDs, scores))
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal article scores: %w", err)
+		}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		"INSERT INTO search_results (query_id, ai_summary_answer, ai_relevant_articles, ai_relevance_scores, created_at) VALUES (?, ?, ?, ?, ?)",
+		queryID, summary, string(articleIDsJSON), string(scoresJSON), time.Now(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	if inTable && len(relevantArticleIDs) > 0 {
+		stmt, err := tx.PrepareContext(ctx, "INSERT INTO search_result_articles (search_result_id, position, article_id, score) VALUES (?, ?, ?, ?)")
+		if err != nil {
+			return nil, err
+		}
+		defer stmt.Close()
+
+		for position, articleID := range relevantArticleIDs {
+			var score sql.NullFloat64
+			score.Float64, score.Valid = scores[articleID]
+			if _, err := stmt.ExecContext(ctx, id, position, articleID, score); err != nil {
+				return nil, fmt.Errorf("failed to store article IDs: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetSearchResultByID(ctx, int(id))
+}
+
+// relevantScores returns the scores of the given articles, leaving out
+// those of any other article
+func relevantScores(articleIDs []int, scores map[int]float64) map[int]float64 {
+	relevant := make(map[int]float64, len(articleIDs))
+	for _, id := range articleIDs {
+		if score, ok := scores[id]; ok {
+			relevant[id] = score
+		}
+	}
+	return relevant
+}
+
+// loadResultArticles sets the article IDs and scores of a search result,
+// from its search_result_articles rows if it has any and its JSON columns
+// otherwise. A result without articles gets an empty, non-nil slice.
+func (s *SQLiteDB) loadResultArticles(ctx context.Context, result *models.SearchResult, articleIDsJSON, scoresJSON string) error {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT article_id, score FROM search_result_articles WHERE search_result_id = ? ORDER BY position", result.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var articleIDs []int
+	scores := map[int]float64{}
+	for rows.Next() {
+		var articleID int
+		var score sql.NullFloat64
+		if err := rows.Scan(&articleID, &score); err != nil {
+			return err
+		}
+		articleIDs = append(articleIDs, articleID)
+		if score.Valid {
+			scores[articleID] = score.Float64
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(articleIDs) > 0 {
+		result.AIRelevantArticles, result.Scores = articleIDs, scores
+		return nil
+	}
+
+	// Parse JSON columns
+	if err := json.Unmarshal([]byte(articleIDsJSON), &articleIDs); err != nil {
+		return fmt.Errorf("failed to unmarshal article IDs: %w", err)
+	}
+	if err := json.Unmarshal([]byte(scoresJSON), &scores); err != nil {
+		return fmt.Errorf("failed to unmarshal article scores: %w", err)
+	}
+	if articleIDs == nil {
+		articleIDs = []int{}
+	}
+	result.AIRelevantArticles, result.Scores = articleIDs, scores
+	return nil
+}
+
+// GetSearchResultByID retrieves a search result by ID
+func (s *SQLiteDB) GetSearchResultByID(ctx context.Context, id int) (*models.SearchResult, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var result models.SearchResult
+	var articleIDsJSON, scoresJSON string
+
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, query_id, ai_summary_answer, ai_relevant_articles, ai_relevance_scores, created_at FROM search_results WHERE id = ?", id,
+	).Scan(&result.ID, &result.QueryID, &result.AISummaryAnswer, &articleIDsJSON, &scoresJSON, &result.CreatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.loadResultArticles(ctx, &result, articleIDsJSON, scoresJSON); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// GetSearchResultByQueryID retrieves the latest search result for a query.
+// Rerunning a query adds a result, keeping the earlier ones. Results with
+// the same creation time are told apart by ID.
+func (s *SQLiteDB) GetSearchResultByQueryID(ctx context.Context, queryID int) (*models.SearchResult, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var result models.SearchResult
+	var articleIDsJSON, scoresJSON string
+
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, query_id, ai_summary_answer, ai_relevant_articles, ai_relevance_scores, created_at FROM search_results WHERE query_id = ? ORDER BY created_at DESC, id DESC LIMIT 1", queryID,
+	).Scan(&result.ID, &result.QueryID, &result.AISummaryAnswer, &articleIDsJSON, &scoresJSON, &result.CreatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.loadResultArticles(ctx, &result, articleIDsJSON, scoresJSON); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// CreateShareToken stores token, hashed, as giving access to the search
+// result resultID until expiresAt. It returns sql.ErrNoRows if there is no
+// such result.
+// It is retried while the database is locked by another writer.
+func (s *SQLiteDB) CreateShareToken(ctx context.Context, resultID int, token string, expiresAt time.Time) error {
+	return s.retryBusy(ctx, func() error {
+		return s.createShareToken(ctx, resultID, token, expiresAt)
+	})
+}
+
+// createShareToken makes one attempt at CreateShareToken
+func (s *SQLiteDB) createShareToken(ctx context.Context, resultID int, token string, expiresAt time.Time) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx,
+		"INSERT INTO share_tokens (token_hash, search_result_id, expires_at) SELECT ?, id, ? FROM search_results WHERE id = ?",
+		hashShareToken(token), expiresAt, resultID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create share token: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetResultByShareToken retrieves the search result token gives access to.
+// It returns sql.ErrNoRows for an unknown token and ErrShareExpired once
+// the token's expiry has passed.
+func (s *SQLiteDB) GetResultByShareToken(ctx context.Context, token string) (*models.SearchResult, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var result models.SearchResult
+	var articleIDsJSON, scoresJSON string
+	var expiresAt time.Time
+
+	err := s.db.QueryRowContext(ctx,
+		`SELECT r.id, r.query_id, r.ai_summary_answer, r.ai_relevant_articles, r.ai_relevance_scores, r.created_at, t.expires_at
+		FROM share_tokens t JOIN search_results r ON r.id = t.search_result_id
+		WHERE t.token_hash = ?`, hashShareToken(token),
+	).Scan(&result.ID, &result.QueryID, &result.AISummaryAnswer, &articleIDsJSON, &scoresJSON, &result.CreatedAt, &expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if !time.Now().Before(expiresAt) {
+		return nil, ErrShareExpired
+	}
+
+	if err := s.loadResultArticles(ctx, &result, articleIDsJSON, scoresJSON); err != nil {
+		return nil, err
 	}
 
 	return &result, nil
 }
 
+// GetSearchResultsByQueryID retrieves every search result stored for a
+// query, newest first. It returns an empty slice if there are none.
+func (s *SQLiteDB) GetSearchResultsByQueryID(ctx context.Context, queryID int) ([]models.SearchResult, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT id, query_id, ai_summary_answer, ai_relevant_articles, ai_relevance_scores, created_at FROM search_results WHERE query_id = ? ORDER BY created_at DESC, id DESC", queryID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []models.SearchResult{}
+	var articleIDsJSON, scoresJSON []string
+	for rows.Next() {
+		var result models.SearchResult
+		var ids, scores string
+		if err := rows.Scan(&result.ID, &result.QueryID, &result.AISummaryAnswer, &ids, &scores, &result.CreatedAt); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+		articleIDsJSON = append(articleIDsJSON, ids)
+		scoresJSON = append(scoresJSON, scores)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// The IDs may live in another table, so they are read once the rows
+	// have released their connection
+	for i := range results {
+		if err := s.loadResultArticles(ctx, &results[i], articleIDsJSON[i], scoresJSON[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+// GetStats aggregates counts across articles, queries and search results
+// without loading any rows
+func (s *SQLiteDB) GetStats(ctx context.Context) (*models.Stats, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var stats models.Stats
+	err := s.db.QueryRowContext(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM articles),
+			(SELECT COUNT(*) FROM queries),
+			(SELECT COUNT(*) FROM search_results),
+			(SELECT COUNT(*) FROM queries WHERE created_at >= ?),
+			(SELECT COALESCE(AVG(COALESCE(json_array_length(ai_relevant_articles), 0) +
+				(SELECT COUNT(*) FROM search_result_articles WHERE search_result_id = search_results.id)), 0)
+				FROM search_results)`,
+		time.Now().Add(-24*time.Hour),
+	).Scan(
+		&stats.TotalArticles,
+		&stats.TotalQueries,
+		&stats.TotalSearchResults,
+		&stats.QueriesLast24h,
+		&stats.AvgRelevantArticles,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stats: %w", err)
+	}
+
+	return &stats, nil
+}
+
+// Ping checks the database connection is usable
+func (s *SQLiteDB) Ping(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.db.PingContext(ctx)
+}
+
 // Close closes the database connection
 func (s *SQLiteDB) Close() error {
 	return s.db.Close()
@@ -1,14 +1,36 @@
 package database
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"event-to-insight/internal/models"
+	"event-to-insight/internal/textutil"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestSQLiteDB(t *testing.T) {
+	ctx := context.Background()
+
 	// Create temporary database
 	dbPath := "test.db"
 	defer os.Remove(dbPath)
@@ -21,26 +43,26 @@ func TestSQLiteDB(t *testing.T) {
 	require.NoError(t, err)
 
 	t.Run("GetAllArticles", func(t *testing.T) {
-		articles, err := db.GetAllArticles()
+		articles, err := db.GetAllArticles(ctx)
 		assert.NoError(t, err)
 		assert.Greater(t, len(articles), 0)
 	})
 
 	t.Run("GetArticleByID", func(t *testing.T) {
-		article, err := db.GetArticleByID(1)
+		article, err := db.GetArticleByID(ctx, 1)
 		assert.NoError(t, err)
 		assert.NotNil(t, article)
 		assert.Equal(t, 1, article.ID)
 	})
 
 	t.Run("GetArticlesByIDs", func(t *testing.T) {
-		articles, err := db.GetArticlesByIDs([]int{1, 2})
+		articles, err := db.GetArticlesByIDs(ctx, []int{1, 2})
 		assert.NoError(t, err)
 		assert.Len(t, articles, 2)
 	})
 
 	t.Run("CreateQuery", func(t *testing.T) {
-		query, err := db.CreateQuery("test query")
+		query, err := db.CreateQuery(ctx, "test query")
 		assert.NoError(t, err)
 		assert.NotNil(t, query)
 		assert.Equal(t, "test query", query.Query)
@@ -49,11 +71,11 @@ func TestSQLiteDB(t *testing.T) {
 
 	t.Run("CreateSearchResult", func(t *testing.T) {
 		// First create a query
-		query, err := db.CreateQuery("test query for result")
+		query, err := db.CreateQuery(ctx, "test query for result")
 		require.NoError(t, err)
 
 		// Create search result
-		result, err := db.CreateSearchResult(query.ID, "test summary", []int{1, 2})
+		result, err := db.CreateSearchResult(ctx, query.ID, "test summary", []int{1, 2}, nil)
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
 		assert.Equal(t, query.ID, result.QueryID)
@@ -63,26 +85,228 @@ func TestSQLiteDB(t *testing.T) {
 
 	t.Run("GetSearchResultByQueryID", func(t *testing.T) {
 		// Create query and result
-		query, err := db.CreateQuery("test query for retrieval")
+		query, err := db.CreateQuery(ctx, "test query for retrieval")
 		require.NoError(t, err)
 
-		_, err = db.CreateSearchResult(query.ID, "test summary", []int{1, 2})
+		_, err = db.CreateSearchResult(ctx, query.ID, "test summary", []int{1, 2}, nil)
 		require.NoError(t, err)
 
 		// Retrieve result
-		result, err := db.GetSearchResultByQueryID(query.ID)
+		result, err := db.GetSearchResultByQueryID(ctx, query.ID)
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
 		assert.Equal(t, query.ID, result.QueryID)
 	})
+
+	t.Run("GetSearchResultByQueryIDReturnsLatest", func(t *testing.T) {
+		query, err := db.CreateQuery(ctx, "test query for rerun")
+		require.NoError(t, err)
+
+		_, err = db.CreateSearchResult(ctx, query.ID, "first summary", []int{1}, nil)
+		require.NoError(t, err)
+		latest, err := db.CreateSearchResult(ctx, query.ID, "second summary", []int{2}, nil)
+		require.NoError(t, err)
+
+		result, err := db.GetSearchResultByQueryID(ctx, query.ID)
+		require.NoError(t, err)
+		assert.Equal(t, latest.ID, result.ID)
+		assert.Equal(t, "second summary", result.AISummaryAnswer)
+	})
+
+	t.Run("GetSearchResultsByQueryID", func(t *testing.T) {
+		query, err := db.CreateQuery(ctx, "test query with two results")
+		require.NoError(t, err)
+
+		first, err := db.CreateSearchResult(ctx, query.ID, "first summary", []int{1}, nil)
+		require.NoError(t, err)
+		second, err := db.CreateSearchResult(ctx, query.ID, "second summary", []int{2, 3}, nil)
+		require.NoError(t, err)
+
+		results, err := db.GetSearchResultsByQueryID(ctx, query.ID)
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.Equal(t, second.ID, results[0].ID)
+		assert.Equal(t, []int{2, 3}, results[0].AIRelevantArticles)
+		assert.Equal(t, first.ID, results[1].ID)
+		assert.Equal(t, "first summary", results[1].AISummaryAnswer)
+
+		// The single-result lookup agrees on which is the latest
+		latest, err := db.GetSearchResultByQueryID(ctx, query.ID)
+		require.NoError(t, err)
+		assert.Equal(t, second.ID, latest.ID)
+	})
+
+	t.Run("ArticleSummary", func(t *testing.T) {
+		imported, err := db.ImportArticles(ctx, []models.Article{
+			{Title: "Summarized Article", Content: "Long content", Summary: "A short abstract."},
+		})
+		require.NoError(t, err)
+		require.Len(t, imported, 1)
+		assert.Equal(t, "A short abstract.", imported[0].Summary)
+
+		stored, err := db.GetArticleByID(ctx, imported[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, "A short abstract.", stored.Summary)
+
+		// A title change keeps the summary, a content change clears it
+		updated, err := db.UpdateArticle(ctx, stored.ID, "Summarized Article (renamed)", stored.Content)
+		require.NoError(t, err)
+		assert.Equal(t, "A short abstract.", updated.Summary)
+
+		updated, err = db.UpdateArticle(ctx, stored.ID, updated.Title, "Rewritten content")
+		require.NoError(t, err)
+		assert.Empty(t, updated.Summary)
+		stored, err = db.GetArticleByID(ctx, stored.ID)
+		require.NoError(t, err)
+		assert.Empty(t, stored.Summary)
+
+		// A summary written later is only stored for the content it describes
+		err = db.SetArticleSummary(ctx, stored.ID, "Long content", "A stale abstract.")
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		require.NoError(t, db.SetArticleSummary(ctx, stored.ID, "Rewritten content", "A new abstract."))
+		stored, err = db.GetArticleByID(ctx, stored.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "A new abstract.", stored.Summary)
+	})
+
+	t.Run("EachArticle", func(t *testing.T) {
+		all, err := db.GetAllArticles(ctx)
+		require.NoError(t, err)
+
+		var ids []int
+		err = db.EachArticle(ctx, func(article models.Article) error {
+			ids = append(ids, article.ID)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Len(t, ids, len(all))
+
+		// An error from fn stops the walk and is returned as is
+		stop := errors.New("stop")
+		visited := 0
+		err = db.EachArticle(ctx, func(models.Article) error {
+			visited++
+			return stop
+		})
+		assert.ErrorIs(t, err, stop)
+		assert.Equal(t, 1, visited)
+	})
+
+	t.Run("EachArticleAcrossPages", func(t *testing.T) {
+		var extra []models.Article
+		for i := 0; i < eachArticlePageSize+5; i++ {
+			extra = append(extra, models.Article{Title: fmt.Sprintf("Paged Article %d", i), Content: "Paged content"})
+		}
+		_, err := db.ImportArticles(ctx, extra)
+		require.NoError(t, err)
+		all, err := db.GetAllArticles(ctx)
+		require.NoError(t, err)
+
+		var ids []int
+		err = db.EachArticle(ctx, func(article models.Article) error {
+			ids = append(ids, article.ID)
+			// No read is held open between articles, so writes go through
+			if len(ids) == 1 {
+				return db.RecordArticleView(ctx, article.ID)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Len(t, ids, len(all))
+		assert.True(t, sort.IntsAreSorted(ids))
+	})
+
+	t.Run("GetSearchResultsByQueryIDNone", func(t *testing.T) {
+		query, err := db.CreateQuery(ctx, "test query without results")
+		require.NoError(t, err)
+
+		results, err := db.GetSearchResultsByQueryID(ctx, query.ID)
+		require.NoError(t, err)
+		assert.NotNil(t, results)
+		assert.Empty(t, results)
+	})
+
+	t.Run("LatestByCreationTime", func(t *testing.T) {
+		query, err := db.CreateQuery(ctx, "test query with backdated result")
+		require.NoError(t, err)
+
+		newer, err := db.CreateSearchResult(ctx, query.ID, "newer summary", []int{1}, nil)
+		require.NoError(t, err)
+		older, err := db.CreateSearchResult(ctx, query.ID, "older summary", []int{2}, nil)
+		require.NoError(t, err)
+		_, err = db.db.Exec("UPDATE search_results SET created_at = ? WHERE id = ?", time.Now().Add(-time.Hour), older.ID)
+		require.NoError(t, err)
+
+		latest, err := db.GetSearchResultByQueryID(ctx, query.ID)
+		require.NoError(t, err)
+		assert.Equal(t, newer.ID, latest.ID)
+
+		results, err := db.GetSearchResultsByQueryID(ctx, query.ID)
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.Equal(t, []int{newer.ID, older.ID}, []int{results[0].ID, results[1].ID})
+	})
 }
 
 // TestSQLiteDBErrors tests error scenarios and edge cases
 func TestSQLiteDBErrors(t *testing.T) {
+	ctx := context.Background()
+
 	t.Run("InvalidDBPath", func(t *testing.T) {
 		// Test with invalid path (read-only directory)
 		_, err := NewSQLiteDB("/root/nonexistent/test.db")
 		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "database directory /root/nonexistent does not exist")
+	})
+
+	t.Run("UnwritableDirectory", func(t *testing.T) {
+		if os.Geteuid() == 0 {
+			t.Skip("root can write to any directory")
+		}
+		dir := t.TempDir()
+		require.NoError(t, os.Chmod(dir, 0500))
+		defer os.Chmod(dir, 0700)
+
+		_, err := NewSQLiteDB(filepath.Join(dir, "test.db"))
+
+		assert.ErrorIs(t, err, ErrPermission)
+		assert.Contains(t, err.Error(), "cannot create files in "+dir)
+	})
+
+	t.Run("UnwritableFile", func(t *testing.T) {
+		if os.Geteuid() == 0 {
+			t.Skip("root can write to any file")
+		}
+		dbPath := filepath.Join(t.TempDir(), "test.db")
+		require.NoError(t, os.WriteFile(dbPath, nil, 0400))
+
+		_, err := NewSQLiteDB(dbPath)
+
+		assert.ErrorIs(t, err, ErrPermission)
+		assert.Contains(t, err.Error(), dbPath+" cannot be opened for writing")
+	})
+
+	t.Run("CorruptFile", func(t *testing.T) {
+		dbPath := filepath.Join(t.TempDir(), "test.db")
+		require.NoError(t, os.WriteFile(dbPath, []byte(strings.Repeat("not a database ", 100)), 0600))
+
+		db, err := NewSQLiteDB(dbPath)
+		if err == nil {
+			defer db.Close()
+			err = db.Initialize()
+		}
+
+		assert.ErrorIs(t, err, ErrCorrupt)
+		assert.Contains(t, err.Error(), "restore it from a backup")
+	})
+
+	t.Run("DirectoryInPlaceOfParent", func(t *testing.T) {
+		parent := filepath.Join(t.TempDir(), "file")
+		require.NoError(t, os.WriteFile(parent, nil, 0600))
+
+		_, err := NewSQLiteDB(filepath.Join(parent, "test.db"))
+
+		assert.ErrorContains(t, err, "is not a directory")
 	})
 
 	t.Run("GetNonExistentArticle", func(t *testing.T) {
@@ -97,7 +321,7 @@ func TestSQLiteDBErrors(t *testing.T) {
 		require.NoError(t, err)
 
 		// Try to get non-existent article
-		article, err := db.GetArticleByID(999)
+		article, err := db.GetArticleByID(ctx, 999)
 		assert.Error(t, err)
 		assert.Nil(t, article)
 	})
@@ -114,7 +338,7 @@ func TestSQLiteDBErrors(t *testing.T) {
 		require.NoError(t, err)
 
 		// Try to get non-existent query
-		query, err := db.GetQueryByID(999)
+		query, err := db.GetQueryByID(ctx, 999)
 		assert.Error(t, err)
 		assert.Nil(t, query)
 	})
@@ -131,7 +355,7 @@ func TestSQLiteDBErrors(t *testing.T) {
 		require.NoError(t, err)
 
 		// Try to get search result for non-existent query
-		result, err := db.GetSearchResultByQueryID(999)
+		result, err := db.GetSearchResultByQueryID(ctx, 999)
 		assert.Error(t, err)
 		assert.Nil(t, result)
 	})
@@ -148,7 +372,7 @@ func TestSQLiteDBErrors(t *testing.T) {
 		require.NoError(t, err)
 
 		// Test with empty IDs array
-		articles, err := db.GetArticlesByIDs([]int{})
+		articles, err := db.GetArticlesByIDs(ctx, []int{})
 		assert.NoError(t, err)
 		assert.Empty(t, articles)
 	})
@@ -165,7 +389,7 @@ func TestSQLiteDBErrors(t *testing.T) {
 		require.NoError(t, err)
 
 		// Test with non-existent IDs
-		articles, err := db.GetArticlesByIDs([]int{999, 1000})
+		articles, err := db.GetArticlesByIDs(ctx, []int{999, 1000})
 		assert.NoError(t, err)
 		assert.Empty(t, articles)
 	})
@@ -173,6 +397,8 @@ func TestSQLiteDBErrors(t *testing.T) {
 
 // TestSQLiteDBInitialization tests database initialization scenarios
 func TestSQLiteDBInitialization(t *testing.T) {
+	ctx := context.Background()
+
 	t.Run("InitializeAlreadySeeded", func(t *testing.T) {
 		dbPath := "test_seeded.db"
 		defer os.Remove(dbPath)
@@ -185,7 +411,7 @@ func TestSQLiteDBInitialization(t *testing.T) {
 		err = db.Initialize()
 		require.NoError(t, err)
 
-		articles1, err := db.GetAllArticles()
+		articles1, err := db.GetAllArticles(ctx)
 		require.NoError(t, err)
 		count1 := len(articles1)
 
@@ -193,7 +419,7 @@ func TestSQLiteDBInitialization(t *testing.T) {
 		err = db.Initialize()
 		require.NoError(t, err)
 
-		articles2, err := db.GetAllArticles()
+		articles2, err := db.GetAllArticles(ctx)
 		require.NoError(t, err)
 		count2 := len(articles2)
 
@@ -213,11 +439,11 @@ func TestSQLiteDBInitialization(t *testing.T) {
 		require.NoError(t, err)
 
 		// Create a query
-		query, err := db.CreateQuery("test query for retrieval")
+		query, err := db.CreateQuery(ctx, "test query for retrieval")
 		require.NoError(t, err)
 
 		// Retrieve it by ID
-		retrievedQuery, err := db.GetQueryByID(query.ID)
+		retrievedQuery, err := db.GetQueryByID(ctx, query.ID)
 		assert.NoError(t, err)
 		assert.NotNil(t, retrievedQuery)
 		assert.Equal(t, query.Query, retrievedQuery.Query)
@@ -236,23 +462,23 @@ func TestSQLiteDBInitialization(t *testing.T) {
 		require.NoError(t, err)
 
 		// Create a query first
-		query, err := db.CreateQuery("test search query")
+		query, err := db.CreateQuery(ctx, "test search query")
 		require.NoError(t, err)
 
 		// Create search result
 		relevantArticles := []int{1, 2, 3}
-		result, err := db.CreateSearchResult(query.ID, "AI analysis summary", relevantArticles)
+		result, err := db.CreateSearchResult(ctx, query.ID, "AI analysis summary", relevantArticles, nil)
 		require.NoError(t, err)
 
 		// Test GetSearchResultByID
-		retrievedResult, err := db.GetSearchResultByID(result.ID)
+		retrievedResult, err := db.GetSearchResultByID(ctx, result.ID)
 		assert.NoError(t, err)
 		assert.NotNil(t, retrievedResult)
 		assert.Equal(t, result.AISummaryAnswer, retrievedResult.AISummaryAnswer)
 		assert.Equal(t, result.AIRelevantArticles, retrievedResult.AIRelevantArticles)
 
 		// Test GetSearchResultByQueryID
-		retrievedResult2, err := db.GetSearchResultByQueryID(query.ID)
+		retrievedResult2, err := db.GetSearchResultByQueryID(ctx, query.ID)
 		assert.NoError(t, err)
 		assert.NotNil(t, retrievedResult2)
 		assert.Equal(t, result.ID, retrievedResult2.ID)
@@ -261,6 +487,8 @@ func TestSQLiteDBInitialization(t *testing.T) {
 
 // TestSQLiteDBEdgeCases tests various edge cases
 func TestSQLiteDBEdgeCases(t *testing.T) {
+	ctx := context.Background()
+
 	t.Run("LongQueryText", func(t *testing.T) {
 		dbPath := "test_long_query.db"
 		defer os.Remove(dbPath)
@@ -275,12 +503,12 @@ func TestSQLiteDBEdgeCases(t *testing.T) {
 		// Create a very long query
 		longQuery := "This is a very long query that contains lots of text to test how the database handles long string inputs and whether it properly stores and retrieves them without truncation or corruption of the data stored in the query field of the database table"
 
-		query, err := db.CreateQuery(longQuery)
+		query, err := db.CreateQuery(ctx, longQuery)
 		assert.NoError(t, err)
 		assert.Equal(t, longQuery, query.Query)
 
 		// Retrieve and verify
-		retrieved, err := db.GetQueryByID(query.ID)
+		retrieved, err := db.GetQueryByID(ctx, query.ID)
 		assert.NoError(t, err)
 		assert.Equal(t, longQuery, retrieved.Query)
 	})
@@ -306,12 +534,12 @@ func TestSQLiteDBEdgeCases(t *testing.T) {
 		}
 
 		for i, specialQuery := range specialQueries {
-			query, err := db.CreateQuery(specialQuery)
+			query, err := db.CreateQuery(ctx, specialQuery)
 			assert.NoError(t, err, "Failed for query %d: %s", i, specialQuery)
 			assert.Equal(t, specialQuery, query.Query)
 
 			// Retrieve and verify
-			retrieved, err := db.GetQueryByID(query.ID)
+			retrieved, err := db.GetQueryByID(ctx, query.ID)
 			assert.NoError(t, err, "Failed to retrieve query %d", i)
 			assert.Equal(t, specialQuery, retrieved.Query)
 		}
@@ -329,7 +557,7 @@ func TestSQLiteDBEdgeCases(t *testing.T) {
 		require.NoError(t, err)
 
 		// Create a query
-		query, err := db.CreateQuery("test query")
+		query, err := db.CreateQuery(ctx, "test query")
 		require.NoError(t, err)
 
 		// Create search result with large array of relevant articles
@@ -338,12 +566,12 @@ func TestSQLiteDBEdgeCases(t *testing.T) {
 			largeArray[i] = i + 1
 		}
 
-		result, err := db.CreateSearchResult(query.ID, "Summary for large array", largeArray)
+		result, err := db.CreateSearchResult(ctx, query.ID, "Summary for large array", largeArray, nil)
 		assert.NoError(t, err)
 		assert.Equal(t, largeArray, result.AIRelevantArticles)
 
 		// Retrieve and verify
-		retrieved, err := db.GetSearchResultByQueryID(query.ID)
+		retrieved, err := db.GetSearchResultByQueryID(ctx, query.ID)
 		assert.NoError(t, err)
 		assert.Equal(t, largeArray, retrieved.AIRelevantArticles)
 	})
@@ -351,6 +579,8 @@ func TestSQLiteDBEdgeCases(t *testing.T) {
 
 // TestSQLiteDBConcurrency tests concurrent access scenarios
 func TestSQLiteDBConcurrency(t *testing.T) {
+	ctx := context.Background()
+
 	t.Run("ConcurrentQueries", func(t *testing.T) {
 		dbPath := "test_concurrent.db"
 		defer os.Remove(dbPath)
@@ -368,12 +598,12 @@ func TestSQLiteDBConcurrency(t *testing.T) {
 			go func(i int) {
 				defer func() { done <- true }()
 
-				query, err := db.CreateQuery("concurrent query " + string(rune(i+'0')))
+				query, err := db.CreateQuery(ctx, "concurrent query "+string(rune(i+'0')))
 				assert.NoError(t, err)
 				assert.NotNil(t, query)
 
 				// Also test concurrent reads
-				articles, err := db.GetAllArticles()
+				articles, err := db.GetAllArticles(ctx)
 				assert.NoError(t, err)
 				assert.NotEmpty(t, articles)
 			}(i)
@@ -385,3 +615,1478 @@ func TestSQLiteDBConcurrency(t *testing.T) {
 		}
 	})
 }
+
+// TestSQLiteDBBusyRetry tests retrying writes while the database is locked
+func TestSQLiteDBBusyRetry(t *testing.T) {
+	ctx := context.Background()
+	locked := sqlite3.Error{Code: sqlite3.ErrBusy}
+
+	db, err := NewSQLiteDB(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetBusyRetry(2, time.Millisecond)
+
+	t.Run("RetriesUntilLockClears", func(t *testing.T) {
+		attempts := 0
+		err := db.retryBusy(ctx, func() error {
+			attempts++
+			if attempts < 3 {
+				return locked
+			}
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("GivesUpWithErrBusy", func(t *testing.T) {
+		attempts := 0
+		err := db.retryBusy(ctx, func() error {
+			attempts++
+			return fmt.Errorf("failed to create query: %w", sqlite3.Error{Code: sqlite3.ErrLocked})
+		})
+
+		assert.ErrorIs(t, err, ErrBusy)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("OtherErrorsAreNotRetried", func(t *testing.T) {
+		attempts := 0
+		err := db.retryBusy(ctx, func() error {
+			attempts++
+			return sql.ErrNoRows
+		})
+
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		assert.NotErrorIs(t, err, ErrBusy)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("NoRetries", func(t *testing.T) {
+		db.SetBusyRetry(0, time.Millisecond)
+		defer db.SetBusyRetry(2, time.Millisecond)
+
+		attempts := 0
+		err := db.retryBusy(ctx, func() error {
+			attempts++
+			return locked
+		})
+
+		assert.ErrorIs(t, err, ErrBusy)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("StopsWhenContextIsDone", func(t *testing.T) {
+		db.SetBusyRetry(2, time.Hour)
+		defer db.SetBusyRetry(2, time.Millisecond)
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		attempts := 0
+		err := db.retryBusy(ctx, func() error {
+			attempts++
+			return locked
+		})
+
+		assert.ErrorIs(t, err, ErrBusy)
+		assert.Equal(t, 1, attempts)
+	})
+}
+
+// TestSQLiteDBArticleViews tests article view tracking
+func TestSQLiteDBArticleViews(t *testing.T) {
+	ctx := context.Background()
+
+	dbPath := "test_views.db"
+	defer os.Remove(dbPath)
+
+	db, err := NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = db.Initialize()
+	require.NoError(t, err)
+
+	t.Run("NoViews", func(t *testing.T) {
+		popular, err := db.GetPopularArticles(ctx, 10, 0)
+		assert.NoError(t, err)
+		assert.NotNil(t, popular)
+		assert.Empty(t, popular)
+	})
+
+	t.Run("ConcurrentViewsAreCounted", func(t *testing.T) {
+		done := make(chan bool, 20)
+		for i := 0; i < 20; i++ {
+			go func() {
+				defer func() { done <- true }()
+				assert.NoError(t, db.RecordArticleView(ctx, 2))
+			}()
+		}
+		for i := 0; i < 20; i++ {
+			<-done
+		}
+
+		require.NoError(t, db.RecordArticleView(ctx, 1))
+
+		popular, err := db.GetPopularArticles(ctx, 10, 0)
+		assert.NoError(t, err)
+		require.Len(t, popular, 2)
+		assert.Equal(t, 2, popular[0].ID)
+		assert.Equal(t, 20, popular[0].ViewCount)
+		assert.Equal(t, 1, popular[1].ID)
+		assert.Equal(t, 1, popular[1].ViewCount)
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		popular, err := db.GetPopularArticles(ctx, 1, 1)
+		assert.NoError(t, err)
+		require.Len(t, popular, 1)
+		assert.Equal(t, 1, popular[0].ID)
+	})
+}
+
+// TestSQLiteDBReindex tests rebuilding the full-text index
+func TestSQLiteDBReindex(t *testing.T) {
+	ctx := context.Background()
+
+	dbPath := "test_reindex.db"
+	defer os.Remove(dbPath)
+
+	db, err := NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.Initialize())
+
+	ftsMatches := func(term string) int {
+		var count int
+		err := db.db.QueryRow("SELECT COUNT(*) FROM articles_fts WHERE articles_fts MATCH ?", term).Scan(&count)
+		require.NoError(t, err)
+		return count
+	}
+
+	t.Run("IndexBuiltOnInitialize", func(t *testing.T) {
+		assert.Equal(t, 1, ftsMatches("spooler"))
+	})
+
+	t.Run("RebuildAfterIndexLoss", func(t *testing.T) {
+		// Simulate an index that drifted from the articles table
+		_, err := db.db.Exec("DELETE FROM articles_fts WHERE docid = 6")
+		require.NoError(t, err)
+		assert.Equal(t, 0, ftsMatches("spooler"))
+
+		count, err := db.Reindex(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 10, count)
+		assert.Equal(t, 1, ftsMatches("spooler"))
+	})
+
+	t.Run("ConcurrentReadsDuringReindex", func(t *testing.T) {
+		done := make(chan bool, 5)
+		for i := 0; i < 5; i++ {
+			go func() {
+				defer func() { done <- true }()
+				articles, err := db.GetAllArticles(ctx)
+				assert.NoError(t, err)
+				assert.Len(t, articles, 10)
+			}()
+		}
+
+		_, err := db.Reindex(ctx)
+		assert.NoError(t, err)
+
+		for i := 0; i < 5; i++ {
+			<-done
+		}
+	})
+
+	t.Run("RunningTwiceIsSafe", func(t *testing.T) {
+		_, err := db.Reindex(ctx)
+		assert.NoError(t, err)
+		_, err = db.Reindex(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, ftsMatches("spooler"))
+	})
+}
+
+// TestSQLiteDBArticleOrder tests that articles are listed by ID whatever
+// order they were inserted in
+func TestSQLiteDBArticleOrder(t *testing.T) {
+	ctx := context.Background()
+
+	dbPath := "test_article_order.db"
+	defer os.Remove(dbPath)
+
+	db, err := NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.Initialize())
+
+	_, err = db.db.Exec("DELETE FROM articles")
+	require.NoError(t, err)
+	for _, id := range []int{42, 7, 19, 3} {
+		_, err := db.db.Exec("INSERT INTO articles (id, title, content) VALUES (?, ?, ?)",
+			id, fmt.Sprintf("Article %d", id), "Content")
+		require.NoError(t, err)
+	}
+
+	articles, err := db.GetAllArticles(ctx)
+	require.NoError(t, err)
+
+	ids := make([]int, len(articles))
+	for i, article := range articles {
+		ids[i] = article.ID
+	}
+	assert.Equal(t, []int{3, 7, 19, 42}, ids)
+}
+
+// TestSQLiteDBKeywordSearchArticles tests keyword search with LIKE
+func TestSQLiteDBKeywordSearchArticles(t *testing.T) {
+	ctx := context.Background()
+
+	dbPath := "test_keyword_search.db"
+	defer os.Remove(dbPath)
+
+	db, err := NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.Initialize())
+
+	_, err = db.db.Exec("DELETE FROM articles")
+	require.NoError(t, err)
+	for _, article := range []models.Article{
+		{ID: 1, Title: "VPN Setup", Content: "Install the software."},
+		{ID: 2, Title: "Printer Drivers", Content: "Reinstall the driver if the VPN blocks printing."},
+		{ID: 3, Title: "Password Reset", Content: "Use the self-service portal."},
+		{ID: 4, Title: "Disk Quota", Content: "Usage is capped at 100% of the quota."},
+		{ID: 5, Title: "VPN Client Troubleshooting", Content: "Reinstall the vpn client."},
+	} {
+		_, err := db.db.Exec("INSERT INTO articles (id, title, content) VALUES (?, ?, ?)",
+			article.ID, article.Title, article.Content)
+		require.NoError(t, err)
+	}
+
+	ids := func(articles []models.Article) []int {
+		result := make([]int, len(articles))
+		for i, article := range articles {
+			result[i] = article.ID
+		}
+		return result
+	}
+
+	t.Run("RankedByMatchCount", func(t *testing.T) {
+		articles, err := db.KeywordSearchArticles(ctx, []string{"vpn", "client"}, nil, 10, 0)
+		require.NoError(t, err)
+
+		// Article 5 contains both words, 1 and 2 contain one each
+		assert.Equal(t, []int{5, 1, 2}, ids(articles))
+		assert.Equal(t, 1.0, articles[0].Score)
+		assert.Equal(t, 0.5, articles[1].Score)
+	})
+
+	t.Run("CaseInsensitive", func(t *testing.T) {
+		articles, err := db.KeywordSearchArticles(ctx, []string{"password"}, nil, 10, 0)
+		require.NoError(t, err)
+
+		assert.Equal(t, []int{3}, ids(articles))
+	})
+
+	t.Run("ExcludedArticles", func(t *testing.T) {
+		articles, err := db.KeywordSearchArticles(ctx, []string{"vpn", "client"}, []int{5, 2}, 1, 0)
+		require.NoError(t, err)
+
+		// Excluded articles are skipped before paging so the page stays full
+		assert.Equal(t, []int{1}, ids(articles))
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		articles, err := db.KeywordSearchArticles(ctx, []string{"vpn", "client"}, nil, 1, 1)
+		require.NoError(t, err)
+
+		assert.Equal(t, []int{1}, ids(articles))
+	})
+
+	t.Run("NoMatches", func(t *testing.T) {
+		articles, err := db.KeywordSearchArticles(ctx, []string{"kubernetes"}, nil, 10, 0)
+		require.NoError(t, err)
+
+		assert.NotNil(t, articles)
+		assert.Empty(t, articles)
+	})
+
+	t.Run("NoTerms", func(t *testing.T) {
+		articles, err := db.KeywordSearchArticles(ctx, nil, nil, 10, 0)
+		require.NoError(t, err)
+
+		assert.NotNil(t, articles)
+		assert.Empty(t, articles)
+	})
+
+	t.Run("WordPrefixes", func(t *testing.T) {
+		articles, err := db.KeywordSearchArticles(ctx, []string{"reinstal"}, nil, 10, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []int{2, 5}, ids(articles))
+
+		// Words are matched from their start, so "stall" is not in "Install"
+		articles, err = db.KeywordSearchArticles(ctx, []string{"stall"}, nil, 10, 0)
+		require.NoError(t, err)
+		assert.Empty(t, articles)
+	})
+
+	t.Run("UsesFullTextIndex", func(t *testing.T) {
+		_, err := db.db.Exec("DELETE FROM articles_fts WHERE docid = 3")
+		require.NoError(t, err)
+
+		articles, err := db.KeywordSearchArticles(ctx, []string{"password"}, nil, 10, 0)
+		require.NoError(t, err)
+		assert.Empty(t, articles)
+
+		_, err = db.Reindex(ctx)
+		require.NoError(t, err)
+		articles, err = db.KeywordSearchArticles(ctx, []string{"password"}, nil, 10, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []int{3}, ids(articles))
+	})
+
+	t.Run("DoesNotRecordQuery", func(t *testing.T) {
+		var count int
+		require.NoError(t, db.db.QueryRow("SELECT COUNT(*) FROM queries").Scan(&count))
+		assert.Zero(t, count)
+	})
+}
+
+// TestSQLiteDBBackup tests taking a snapshot of a live database
+func TestSQLiteDBBackup(t *testing.T) {
+	ctx := context.Background()
+
+	dbPath := "test_backup_source.db"
+	defer os.Remove(dbPath)
+
+	db, err := NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.Initialize())
+
+	t.Run("SnapshotIsOpenable", func(t *testing.T) {
+		backupPath := t.TempDir() + "/backup.db"
+		require.NoError(t, db.Backup(ctx, backupPath))
+
+		backup, err := NewSQLiteDB(backupPath)
+		require.NoError(t, err)
+		defer backup.Close()
+
+		articles, err := backup.GetAllArticles(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, articles, 10)
+	})
+
+	t.Run("ExistingDestination", func(t *testing.T) {
+		backupPath := t.TempDir() + "/backup.db"
+		require.NoError(t, os.WriteFile(backupPath, []byte("existing"), 0600))
+
+		assert.Error(t, db.Backup(ctx, backupPath))
+	})
+}
+
+// TestSQLiteDBIdempotencyKeys tests reserving, completing and releasing
+// idempotency keys
+func TestSQLiteDBIdempotencyKeys(t *testing.T) {
+	ctx := context.Background()
+
+	dbPath := "test_idempotency.db"
+	defer os.Remove(dbPath)
+
+	db, err := NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.Initialize())
+	staleBefore := func() time.Time { return time.Now().Add(-time.Hour) }
+
+	t.Run("RetryReturnsStoredResponse", func(t *testing.T) {
+		record, reserved, err := db.ReserveIdempotencyKey(ctx, "key-retry", "vpn help", staleBefore())
+		require.NoError(t, err)
+		assert.True(t, reserved)
+		assert.Equal(t, "vpn help", record.Query)
+
+		// While the first attempt runs, a retry sees no response
+		record, reserved, err = db.ReserveIdempotencyKey(ctx, "key-retry", "vpn help", staleBefore())
+		require.NoError(t, err)
+		assert.False(t, reserved)
+		assert.Nil(t, record.Response)
+
+		require.NoError(t, db.CompleteIdempotencyKey(ctx, "key-retry", []byte(`{"query":"vpn help"}`)))
+
+		record, reserved, err = db.ReserveIdempotencyKey(ctx, "key-retry", "vpn help", staleBefore())
+		require.NoError(t, err)
+		assert.False(t, reserved)
+		assert.Equal(t, "vpn help", record.Query)
+		assert.JSONEq(t, `{"query":"vpn help"}`, string(record.Response))
+	})
+
+	t.Run("RecordsQueryOfFirstAttempt", func(t *testing.T) {
+		_, reserved, err := db.ReserveIdempotencyKey(ctx, "key-text", "vpn help", staleBefore())
+		require.NoError(t, err)
+		require.True(t, reserved)
+
+		record, reserved, err := db.ReserveIdempotencyKey(ctx, "key-text", "printer help", staleBefore())
+		require.NoError(t, err)
+		assert.False(t, reserved)
+		assert.Equal(t, "vpn help", record.Query)
+	})
+
+	t.Run("ReleasedKeyIsReservedAgain", func(t *testing.T) {
+		_, reserved, err := db.ReserveIdempotencyKey(ctx, "key-release", "vpn help", staleBefore())
+		require.NoError(t, err)
+		require.True(t, reserved)
+
+		require.NoError(t, db.ReleaseIdempotencyKey(ctx, "key-release"))
+
+		_, reserved, err = db.ReserveIdempotencyKey(ctx, "key-release", "vpn help", staleBefore())
+		require.NoError(t, err)
+		assert.True(t, reserved)
+	})
+
+	t.Run("ReleaseKeepsStoredResponse", func(t *testing.T) {
+		_, _, err := db.ReserveIdempotencyKey(ctx, "key-kept", "vpn help", staleBefore())
+		require.NoError(t, err)
+		require.NoError(t, db.CompleteIdempotencyKey(ctx, "key-kept", []byte(`{}`)))
+
+		require.NoError(t, db.ReleaseIdempotencyKey(ctx, "key-kept"))
+
+		record, reserved, err := db.ReserveIdempotencyKey(ctx, "key-kept", "vpn help", staleBefore())
+		require.NoError(t, err)
+		assert.False(t, reserved)
+		assert.NotNil(t, record.Response)
+	})
+
+	t.Run("StaleReservationIsTakenOver", func(t *testing.T) {
+		_, reserved, err := db.ReserveIdempotencyKey(ctx, "key-stale", "vpn help", staleBefore())
+		require.NoError(t, err)
+		require.True(t, reserved)
+
+		_, reserved, err = db.ReserveIdempotencyKey(ctx, "key-stale", "vpn help", time.Now().Add(time.Second))
+		require.NoError(t, err)
+		assert.True(t, reserved)
+	})
+
+	t.Run("CompleteUnknownKey", func(t *testing.T) {
+		err := db.CompleteIdempotencyKey(ctx, "key-unknown", []byte(`{}`))
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("ParallelReservations", func(t *testing.T) {
+		const workers = 10
+		var reservedCount atomic.Int32
+
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, reserved, err := db.ReserveIdempotencyKey(ctx, "key-parallel", "printer help", staleBefore())
+				if assert.NoError(t, err) && reserved {
+					reservedCount.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), reservedCount.Load())
+	})
+
+	t.Run("PurgedWithQueries", func(t *testing.T) {
+		_, _, err := db.ReserveIdempotencyKey(ctx, "key-purged", "vpn help", staleBefore())
+		require.NoError(t, err)
+
+		_, err = db.PurgeQueriesOlderThan(ctx, time.Now().Add(time.Second))
+		require.NoError(t, err)
+
+		var rows int
+		require.NoError(t, db.db.QueryRow("SELECT COUNT(*) FROM idempotency_keys").Scan(&rows))
+		assert.Zero(t, rows)
+	})
+}
+
+// TestSQLiteDBMigratesQueriesTable tests adding the normalized query
+// column to a database created before they existed
+func TestSQLiteDBMigratesQueriesTable(t *testing.T) {
+	ctx := context.Background()
+
+	dbPath := "test_migrate.db"
+	defer os.Remove(dbPath)
+
+	db, err := NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.db.Exec(`CREATE TABLE queries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		query TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`)
+	require.NoError(t, err)
+	_, err = db.db.Exec("INSERT INTO queries (query, created_at) VALUES (?, ?)", "How do I reset my VPN?", time.Now())
+	require.NoError(t, err)
+
+	require.NoError(t, db.Initialize())
+	// Running the migration again is a no-op
+	require.NoError(t, db.Initialize())
+
+	_, err = db.CreateQuery(ctx, "vpn help")
+	assert.NoError(t, err)
+
+	// Existing queries are normalized so they show up in top queries
+	topQueries, err := db.TopQueries(ctx, time.Now().Add(-time.Hour), 10)
+	require.NoError(t, err)
+	assert.Len(t, topQueries, 2)
+	assert.Contains(t, []string{topQueries[0].Query, topQueries[1].Query}, "how do i reset my vpn")
+}
+
+// TestSQLiteDBArticleUpdatedAt tests tracking when each article last
+// changed, including for articles stored before the column existed
+func TestSQLiteDBArticleUpdatedAt(t *testing.T) {
+	ctx := context.Background()
+
+	dbPath := "test_article_updated_at.db"
+	defer os.Remove(dbPath)
+
+	db, err := NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.db.Exec(`CREATE TABLE articles (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		title TEXT NOT NULL,
+		content TEXT NOT NULL
+	)`)
+	require.NoError(t, err)
+	_, err = db.db.Exec("INSERT INTO articles (title, content) VALUES (?, ?)", "Old Article", "Stored before updated_at")
+	require.NoError(t, err)
+
+	require.NoError(t, db.Initialize())
+
+	old, err := db.GetArticleByID(ctx, 1)
+	require.NoError(t, err)
+	assert.False(t, old.UpdatedAt.IsZero())
+
+	time.Sleep(10 * time.Millisecond)
+	updated, err := db.UpdateArticle(ctx, 1, "Old Article", "Edited since")
+	require.NoError(t, err)
+	assert.True(t, updated.UpdatedAt.After(old.UpdatedAt))
+
+	fetched, err := db.GetArticlesByIDs(ctx, []int{1})
+	require.NoError(t, err)
+	require.Len(t, fetched, 1)
+	assert.True(t, fetched[0].UpdatedAt.Equal(updated.UpdatedAt))
+}
+
+// TestSQLiteDBSeedURL tests seeding an empty database from a remote
+// document, falling back to the built-in articles when it is unusable
+func TestSQLiteDBSeedURL(t *testing.T) {
+	ctx := context.Background()
+
+	seed := func(t *testing.T, status int, body string) (*SQLiteDB, *bytes.Buffer, *atomic.Int32) {
+		var requests atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			io.WriteString(w, body)
+		}))
+		t.Cleanup(server.Close)
+
+		dbPath := filepath.Join(t.TempDir(), "seed.db")
+		db, err := NewSQLiteDB(dbPath)
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+
+		var buf bytes.Buffer
+		db.SetLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+		db.SetSeedURL(server.URL)
+		require.NoError(t, db.Initialize())
+		return db, &buf, &requests
+	}
+
+	t.Run("ValidPayload", func(t *testing.T) {
+		db, buf, requests := seed(t, http.StatusOK, `[
+			{"id": 7, "title": "Parking Permits", "content": "Apply on the facilities portal.", "keywords": "parking, permit"},
+			{"title": "Badge Replacement", "content": "Visit reception with photo ID."}
+		]`)
+
+		articles, err := db.GetAllArticles(ctx)
+		require.NoError(t, err)
+		require.Len(t, articles, 2)
+		assert.Equal(t, 1, articles[0].ID)
+		assert.Equal(t, "Parking Permits", articles[0].Title)
+		assert.Equal(t, "parking, permit", articles[0].Keywords)
+		assert.Equal(t, 2, articles[1].ID)
+		assert.Equal(t, "Badge Replacement", articles[1].Title)
+		assert.Empty(t, buf.String())
+
+		// A seeded database is not fetched again
+		require.NoError(t, db.Initialize())
+		assert.Equal(t, int32(1), requests.Load())
+	})
+
+	fallbacks := []struct {
+		name   string
+		status int
+		body   string
+		reason string
+	}{
+		{"ServerError", http.StatusInternalServerError, `[]`, "500 Internal Server Error"},
+		{"NotFound", http.StatusNotFound, `not found`, "404 Not Found"},
+		{"MalformedJSON", http.StatusOK, `[{"title": "Broken"`, "not a JSON array"},
+		{"NotAnArray", http.StatusOK, `{"title": "One", "content": "Body"}`, "not a JSON array"},
+		{"Empty", http.StatusOK, `[]`, "no articles"},
+		{"MissingContent", http.StatusOK, `[{"title": "No Body"}]`, "seed article 0 needs a title and content"},
+		{"DuplicateTitles", http.StatusOK, `[{"title": "Same", "content": "A"}, {"title": "same", "content": "B"}]`, "seed article 1"},
+		{"TooLarge", http.StatusOK, `[{"title": "Big", "content": "` + strings.Repeat("x", maxSeedBytes) + `"}]`, "larger than"},
+	}
+	for _, tc := range fallbacks {
+		t.Run(tc.name, func(t *testing.T) {
+			db, buf, _ := seed(t, tc.status, tc.body)
+
+			articles, err := db.GetAllArticles(ctx)
+			require.NoError(t, err)
+			require.Len(t, articles, 10)
+			assert.Equal(t, "Password Reset Instructions", articles[0].Title)
+
+			assert.Contains(t, buf.String(), "level=WARN")
+			assert.Contains(t, buf.String(), tc.reason)
+		})
+	}
+}
+
+// TestSQLiteDBSeedIDs tests that the built-in articles always get the same
+// IDs, which the rest of the test suite relies on
+func TestSQLiteDBSeedIDs(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := NewSQLiteDB(filepath.Join(t.TempDir(), "seed_ids.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.Initialize())
+
+	assertSeeded := func(t *testing.T) {
+		password, err := db.GetArticleByID(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, "Password Reset Instructions", password.Title)
+
+		vpn, err := db.GetArticleByID(ctx, 2)
+		require.NoError(t, err)
+		assert.Equal(t, "VPN Connection Setup", vpn.Title)
+
+		articles, err := db.GetAllArticles(ctx)
+		require.NoError(t, err)
+		for i, article := range articles {
+			assert.Equal(t, i+1, article.ID, article.Title)
+		}
+	}
+
+	t.Run("Fresh", assertSeeded)
+
+	t.Run("LaterArticlesFollow", func(t *testing.T) {
+		imported, err := db.ImportArticles(ctx, []models.Article{{Title: "Parking Permits", Content: "Apply on the facilities portal."}})
+		require.NoError(t, err)
+		require.Len(t, imported, 1)
+		assert.Equal(t, 11, imported[0].ID)
+	})
+
+	t.Run("ReseededAfterClearing", func(t *testing.T) {
+		// The IDs of deleted articles are never reused, so stored results
+		// do not come to point at the new articles
+		_, err := db.db.ExecContext(ctx, "DELETE FROM articles")
+		require.NoError(t, err)
+		require.NoError(t, db.Initialize())
+
+		_, err = db.GetArticleByID(ctx, 1)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		articles, err := db.GetAllArticles(ctx)
+		require.NoError(t, err)
+		require.Len(t, articles, 10)
+		for i, article := range articles {
+			assert.Equal(t, 12+i, article.ID, article.Title)
+		}
+		assert.Equal(t, "Password Reset Instructions", articles[0].Title)
+	})
+}
+
+// TestSQLiteDBBackfillKeywords tests extracting keywords for articles that
+// have none
+func TestSQLiteDBBackfillKeywords(t *testing.T) {
+	ctx := context.Background()
+
+	dbPath := "test_backfill_keywords.db"
+	defer os.Remove(dbPath)
+
+	db, err := NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.Initialize())
+
+	imported, err := db.ImportArticles(ctx, []models.Article{
+		{Title: "Curated", Content: "Already described.", Keywords: "hand picked"},
+	})
+	require.NoError(t, err)
+
+	count, err := db.BackfillKeywords(ctx, textutil.DefaultStopwords, 5)
+	require.NoError(t, err)
+	assert.Equal(t, 10, count)
+
+	vpn, err := db.GetArticleByTitle(ctx, "VPN Connection Setup")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(vpn.Keywords, "vpn, "), vpn.Keywords)
+	assert.Len(t, strings.Split(vpn.Keywords, ", "), 5)
+
+	curated, err := db.GetArticleByID(ctx, imported[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "hand picked", curated.Keywords)
+
+	// Running it again has nothing left to do
+	count, err = db.BackfillKeywords(ctx, textutil.DefaultStopwords, 5)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+// TestSQLiteDBGetStats tests the aggregate counts
+func TestSQLiteDBGetStats(t *testing.T) {
+	ctx := context.Background()
+
+	dbPath := "test_stats.db"
+	defer os.Remove(dbPath)
+
+	db, err := NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.Initialize())
+
+	t.Run("NoQueries", func(t *testing.T) {
+		stats, err := db.GetStats(ctx)
+		require.NoError(t, err)
+
+		assert.Equal(t, 10, stats.TotalArticles)
+		assert.Equal(t, 0, stats.TotalQueries)
+		assert.Equal(t, 0, stats.TotalSearchResults)
+		assert.Equal(t, 0.0, stats.AvgRelevantArticles)
+	})
+
+	t.Run("SeededQueries", func(t *testing.T) {
+		// A result without articles is stored as an empty array
+		for _, ids := range [][]int{{1, 2, 3}, {4}, nil} {
+			query, err := db.CreateQuery(ctx, "seeded query")
+			require.NoError(t, err)
+			_, err = db.CreateSearchResult(ctx, query.ID, "summary", ids, nil)
+			require.NoError(t, err)
+		}
+
+		// An older query counts towards the total but not the last 24 hours
+		_, err := db.db.Exec("INSERT INTO queries (query, created_at) VALUES (?, ?)",
+			"old query", time.Now().Add(-48*time.Hour))
+		require.NoError(t, err)
+
+		stats, err := db.GetStats(ctx)
+		require.NoError(t, err)
+
+		assert.Equal(t, 10, stats.TotalArticles)
+		assert.Equal(t, 4, stats.TotalQueries)
+		assert.Equal(t, 3, stats.TotalSearchResults)
+		assert.Equal(t, 3, stats.QueriesLast24h)
+		assert.InDelta(t, 4.0/3.0, stats.AvgRelevantArticles, 0.0001)
+	})
+}
+
+// TestSQLiteDBArticleIDTable tests storing result article IDs as rows of
+// search_result_articles
+func TestSQLiteDBArticleIDTable(t *testing.T) {
+	ctx := context.Background()
+
+	dbPath := "test_article_id_table.db"
+	defer os.Remove(dbPath)
+
+	db, err := NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.Initialize())
+	db.SetArticleIDStorage(ArticleIDStorageTable)
+	defer db.SetArticleIDStorage(ArticleIDStorageJSON)
+
+	newQuery := func(t *testing.T) int {
+		query, err := db.CreateQuery(ctx, "test query")
+		require.NoError(t, err)
+		return query.ID
+	}
+
+	t.Run("LargeOrderedList", func(t *testing.T) {
+		queryID := newQuery(t)
+
+		// Descending, so order only survives through the position column
+		ids := make([]int, 1000)
+		for i := range ids {
+			ids[i] = 1000 - i
+		}
+
+		result, err := db.CreateSearchResult(ctx, queryID, "Summary for large array", ids, nil)
+		require.NoError(t, err)
+		assert.Equal(t, ids, result.AIRelevantArticles)
+
+		retrieved, err := db.GetSearchResultByQueryID(ctx, queryID)
+		require.NoError(t, err)
+		assert.Equal(t, ids, retrieved.AIRelevantArticles)
+
+		var rows int
+		require.NoError(t, db.db.QueryRow("SELECT COUNT(*) FROM search_result_articles WHERE search_result_id = ?", result.ID).Scan(&rows))
+		assert.Equal(t, 1000, rows)
+		var stored string
+		require.NoError(t, db.db.QueryRow("SELECT ai_relevant_articles FROM search_results WHERE id = ?", result.ID).Scan(&stored))
+		assert.Equal(t, "[]", stored)
+	})
+
+	t.Run("NoArticles", func(t *testing.T) {
+		result, err := db.CreateSearchResult(ctx, newQuery(t), "Nothing relevant", nil, nil)
+		require.NoError(t, err)
+		assert.Empty(t, result.AIRelevantArticles)
+	})
+
+	t.Run("MixedStorage", func(t *testing.T) {
+		db.SetArticleIDStorage(ArticleIDStorageJSON)
+		jsonQueryID := newQuery(t)
+		_, err := db.CreateSearchResult(ctx, jsonQueryID, "Stored as JSON", []int{3, 1}, nil)
+		require.NoError(t, err)
+		db.SetArticleIDStorage(ArticleIDStorageTable)
+
+		retrieved, err := db.GetSearchResultByQueryID(ctx, jsonQueryID)
+		require.NoError(t, err)
+		assert.Equal(t, []int{3, 1}, retrieved.AIRelevantArticles)
+	})
+
+	t.Run("Stats", func(t *testing.T) {
+		stats, err := db.GetStats(ctx)
+		require.NoError(t, err)
+
+		// 1000, 0 and 2 articles
+		assert.InDelta(t, 1002.0/3.0, stats.AvgRelevantArticles, 0.0001)
+	})
+
+	t.Run("PurgeRemovesRows", func(t *testing.T) {
+		result, err := db.PurgeQueriesOlderThan(ctx, time.Now().Add(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 3, result.ResultsDeleted)
+
+		var rows int
+		require.NoError(t, db.db.QueryRow("SELECT COUNT(*) FROM search_result_articles").Scan(&rows))
+		assert.Zero(t, rows)
+	})
+
+	t.Run("Scores", func(t *testing.T) {
+		// Article 3 is unscored, and article 9 is not among the results
+		scores := map[int]float64{1: 0.9, 2: 0.4, 9: 0.1}
+		for _, storage := range []ArticleIDStorage{ArticleIDStorageTable, ArticleIDStorageJSON} {
+			db.SetArticleIDStorage(storage)
+			queryID := newQuery(t)
+			stored, err := db.CreateSearchResult(ctx, queryID, "Scored", []int{2, 1, 3}, scores)
+			require.NoError(t, err)
+
+			expected := map[int]float64{1: 0.9, 2: 0.4}
+			assert.Equal(t, expected, stored.Scores, storage)
+			latest, err := db.GetSearchResultByQueryID(ctx, queryID)
+			require.NoError(t, err)
+			assert.Equal(t, expected, latest.Scores, storage)
+			all, err := db.GetSearchResultsByQueryID(ctx, queryID)
+			require.NoError(t, err)
+			require.Len(t, all, 1)
+			assert.Equal(t, expected, all[0].Scores, storage)
+		}
+		db.SetArticleIDStorage(ArticleIDStorageTable)
+	})
+}
+
+// TestSQLiteDBTopQueries tests grouping queries by their normalized text
+func TestSQLiteDBEmptyRelevantArticles(t *testing.T) {
+	ctx := context.Background()
+
+	dbPath := "test_empty_relevant_articles.db"
+	defer os.Remove(dbPath)
+
+	db, err := NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.Initialize())
+
+	query, err := db.CreateQuery(ctx, "test query")
+	require.NoError(t, err)
+
+	t.Run("NilStoredAsEmptyArray", func(t *testing.T) {
+		result, err := db.CreateSearchResult(ctx, query.ID, "No relevant articles found", nil, nil)
+		require.NoError(t, err)
+
+		assert.NotNil(t, result.AIRelevantArticles)
+		assert.Empty(t, result.AIRelevantArticles)
+
+		var stored string
+		require.NoError(t, db.db.QueryRow("SELECT ai_relevant_articles FROM search_results WHERE id = ?", result.ID).Scan(&stored))
+		assert.Equal(t, "[]", stored)
+	})
+
+	t.Run("LegacyNullNormalized", func(t *testing.T) {
+		res, err := db.db.Exec("INSERT INTO search_results (query_id, ai_summary_answer, ai_relevant_articles) VALUES (?, ?, 'null')",
+			query.ID, "Stored before normalizing")
+		require.NoError(t, err)
+		id, err := res.LastInsertId()
+		require.NoError(t, err)
+
+		// It reads back as empty straight away
+		result, err := db.GetSearchResultByID(ctx, int(id))
+		require.NoError(t, err)
+		assert.NotNil(t, result.AIRelevantArticles)
+		assert.Empty(t, result.AIRelevantArticles)
+
+		// and rewritten when the database is next initialized
+		require.NoError(t, db.Initialize())
+		var stored string
+		require.NoError(t, db.db.QueryRow("SELECT ai_relevant_articles FROM search_results WHERE id = ?", id).Scan(&stored))
+		assert.Equal(t, "[]", stored)
+	})
+
+	t.Run("ColumnDefault", func(t *testing.T) {
+		res, err := db.db.Exec("INSERT INTO search_results (query_id, ai_summary_answer) VALUES (?, ?)", query.ID, "No column value")
+		require.NoError(t, err)
+		id, err := res.LastInsertId()
+		require.NoError(t, err)
+
+		result, err := db.GetSearchResultByID(ctx, int(id))
+		require.NoError(t, err)
+		assert.Equal(t, []int{}, result.AIRelevantArticles)
+	})
+}
+
+func TestSQLiteDBTopQueries(t *testing.T) {
+	ctx := context.Background()
+
+	dbPath := "test_top_queries.db"
+	defer os.Remove(dbPath)
+
+	db, err := NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.Initialize())
+
+	t.Run("NoQueries", func(t *testing.T) {
+		topQueries, err := db.TopQueries(ctx, time.Now().Add(-24*time.Hour), 10)
+		require.NoError(t, err)
+		assert.Empty(t, topQueries)
+	})
+
+	t.Run("GroupsNormalizedQueries", func(t *testing.T) {
+		for _, query := range []string{
+			"How do I reset my password?",
+			"how do i reset my password",
+			"  HOW DO I   RESET MY PASSWORD!! ",
+			"VPN not connecting",
+			"vpn not connecting.",
+			"printer jammed",
+		} {
+			_, err := db.CreateQuery(ctx, query)
+			require.NoError(t, err)
+		}
+
+		// Queries outside the window are not counted
+		_, err := db.db.Exec("INSERT INTO queries (query, created_at, normalized_query) VALUES (?, ?, ?)",
+			"printer jammed", time.Now().Add(-10*24*time.Hour), "printer jammed")
+		require.NoError(t, err)
+
+		topQueries, err := db.TopQueries(ctx, time.Now().Add(-7*24*time.Hour), 10)
+		require.NoError(t, err)
+		require.Len(t, topQueries, 3)
+
+		assert.Equal(t, "how do i reset my password", topQueries[0].Query)
+		assert.Equal(t, 3, topQueries[0].Count)
+		assert.WithinDuration(t, time.Now(), topQueries[0].LastAskedAt, time.Minute)
+		assert.Equal(t, "vpn not connecting", topQueries[1].Query)
+		assert.Equal(t, 2, topQueries[1].Count)
+		assert.Equal(t, "printer jammed", topQueries[2].Query)
+		assert.Equal(t, 1, topQueries[2].Count)
+	})
+
+	t.Run("Limit", func(t *testing.T) {
+		topQueries, err := db.TopQueries(ctx, time.Now().Add(-7*24*time.Hour), 1)
+		require.NoError(t, err)
+		require.Len(t, topQueries, 1)
+		assert.Equal(t, "how do i reset my password", topQueries[0].Query)
+	})
+}
+
+// TestSQLiteDBPurgeQueries tests deleting old queries and their results
+func TestSQLiteDBPurgeQueries(t *testing.T) {
+	ctx := context.Background()
+
+	dbPath := "test_purge_queries.db"
+	defer os.Remove(dbPath)
+
+	db, err := NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.Initialize())
+
+	insertQuery := func(query string, createdAt time.Time) int {
+		result, err := db.db.Exec("INSERT INTO queries (query, created_at, normalized_query) VALUES (?, ?, ?)",
+			query, createdAt, query)
+		require.NoError(t, err)
+		id, err := result.LastInsertId()
+		require.NoError(t, err)
+		return int(id)
+	}
+
+	oldWithResult := insertQuery("old vpn question", time.Now().Add(-60*24*time.Hour))
+	oldResult, err := db.CreateSearchResult(ctx, oldWithResult, "Use the VPN client", []int{2}, nil)
+	require.NoError(t, err)
+	require.NoError(t, db.CreateShareToken(ctx, oldResult.ID, "old-share-token", time.Now().Add(time.Hour)))
+	insertQuery("old printer question", time.Now().Add(-45*24*time.Hour))
+
+	recent, err := db.CreateQuery(ctx, "recent password question")
+	require.NoError(t, err)
+	recentResult, err := db.CreateSearchResult(ctx, recent.ID, "Reset it", []int{1}, nil)
+	require.NoError(t, err)
+	require.NoError(t, db.CreateShareToken(ctx, recentResult.ID, "expired-share-token", time.Now().Add(-time.Minute)))
+	require.NoError(t, db.CreateShareToken(ctx, recentResult.ID, "live-share-token", time.Now().Add(time.Hour)))
+
+	result, err := db.PurgeQueriesOlderThan(ctx, time.Now().Add(-30*24*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.QueriesDeleted)
+	assert.Equal(t, 1, result.ResultsDeleted)
+	assert.Equal(t, 1, result.ExpiredSharesDeleted)
+
+	_, err = db.GetResultByShareToken(ctx, "expired-share-token")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = db.GetResultByShareToken(ctx, "live-share-token")
+	assert.NoError(t, err)
+
+	_, err = db.GetQueryByID(ctx, oldWithResult)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = db.GetSearchResultByQueryID(ctx, oldWithResult)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = db.GetResultByShareToken(ctx, "old-share-token")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = db.GetQueryByID(ctx, recent.ID)
+	assert.NoError(t, err)
+	_, err = db.GetSearchResultByQueryID(ctx, recent.ID)
+	assert.NoError(t, err)
+
+	// Running again finds nothing left to purge
+	result, err = db.PurgeQueriesOlderThan(ctx, time.Now().Add(-30*24*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, &models.PurgeResult{}, result)
+}
+
+// TestSQLiteDBForeignKeysOnEveryConnection tests that foreign keys are
+// enforced on every pooled connection, so a purge through any of them
+// removes the rows that depend on a result
+func TestSQLiteDBForeignKeysOnEveryConnection(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := NewSQLiteDB(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetArticleIDStorage(ArticleIDStorageTable)
+	require.NoError(t, db.Initialize())
+
+	// Hold several connections open at once so the pool has to make new ones
+	const connections = 4
+	conns := make([]*sql.Conn, connections)
+	for i := range conns {
+		conns[i], err = db.db.Conn(ctx)
+		require.NoError(t, err)
+	}
+	for i, conn := range conns {
+		var enabled int
+		require.NoError(t, conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&enabled))
+		assert.Equal(t, 1, enabled, "connection %d", i)
+	}
+	for _, conn := range conns {
+		require.NoError(t, conn.Close())
+	}
+
+	for i := 0; i < connections; i++ {
+		_, err := db.db.ExecContext(ctx, "INSERT INTO queries (query, created_at, normalized_query) VALUES (?, ?, ?)",
+			"old question", time.Now().Add(-time.Hour), "old question")
+		require.NoError(t, err)
+	}
+	for i := 1; i <= connections; i++ {
+		_, err := db.CreateSearchResult(ctx, i, "Answer", []int{1, 2}, nil)
+		require.NoError(t, err)
+	}
+
+	_, err = db.PurgeQueriesOlderThan(ctx, time.Now())
+	require.NoError(t, err)
+
+	var orphans int
+	require.NoError(t, db.db.QueryRow("SELECT COUNT(*) FROM search_result_articles").Scan(&orphans))
+	assert.Zero(t, orphans)
+}
+
+// TestSQLiteDBShareTokens tests storing and reading share tokens
+func TestSQLiteDBShareTokens(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := NewSQLiteDB(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.Initialize())
+
+	query, err := db.CreateQuery(ctx, "vpn keeps disconnecting")
+	require.NoError(t, err)
+	stored, err := db.CreateSearchResult(ctx, query.ID, "Reinstall the VPN client", []int{2, 1}, nil)
+	require.NoError(t, err)
+
+	t.Run("Valid", func(t *testing.T) {
+		require.NoError(t, db.CreateShareToken(ctx, stored.ID, "valid-token", time.Now().Add(time.Hour)))
+
+		result, err := db.GetResultByShareToken(ctx, "valid-token")
+		require.NoError(t, err)
+		assert.Equal(t, stored.ID, result.ID)
+		assert.Equal(t, query.ID, result.QueryID)
+		assert.Equal(t, "Reinstall the VPN client", result.AISummaryAnswer)
+		assert.Equal(t, []int{2, 1}, result.AIRelevantArticles)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		require.NoError(t, db.CreateShareToken(ctx, stored.ID, "expired-token", time.Now().Add(-time.Second)))
+
+		result, err := db.GetResultByShareToken(ctx, "expired-token")
+		assert.ErrorIs(t, err, ErrShareExpired)
+		assert.Nil(t, result)
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		_, err := db.GetResultByShareToken(ctx, "no-such-token")
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("UnknownResult", func(t *testing.T) {
+		err := db.CreateShareToken(ctx, 999, "orphan-token", time.Now().Add(time.Hour))
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("StoredHashed", func(t *testing.T) {
+		require.NoError(t, db.CreateShareToken(ctx, stored.ID, "hashed-token", time.Now().Add(time.Hour)))
+
+		var count int
+		require.NoError(t, db.db.QueryRow("SELECT COUNT(*) FROM share_tokens WHERE token_hash = ?", "hashed-token").Scan(&count))
+		assert.Zero(t, count)
+		sum := sha256.Sum256([]byte("hashed-token"))
+		require.NoError(t, db.db.QueryRow("SELECT COUNT(*) FROM share_tokens WHERE token_hash = ?", hex.EncodeToString(sum[:])).Scan(&count))
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("PlaintextTokensMigrated", func(t *testing.T) {
+		legacy, err := NewSQLiteDB(filepath.Join(t.TempDir(), "legacy.db"))
+		require.NoError(t, err)
+		defer legacy.Close()
+
+		_, err = legacy.db.Exec(`CREATE TABLE search_results (id INTEGER PRIMARY KEY AUTOINCREMENT, query_id INTEGER NOT NULL, ai_summary_answer TEXT NOT NULL, ai_relevant_articles TEXT NOT NULL DEFAULT '[]', created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP);
+			CREATE TABLE share_tokens (token TEXT PRIMARY KEY, search_result_id INTEGER NOT NULL, expires_at TIMESTAMP NOT NULL, created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP);
+			INSERT INTO search_results (query_id, ai_summary_answer, ai_relevant_articles) VALUES (1, 'Reinstall the VPN client', '[2]')`)
+		require.NoError(t, err)
+		_, err = legacy.db.Exec("INSERT INTO share_tokens (token, search_result_id, expires_at) VALUES (?, 1, ?)", "legacy-token", time.Now().Add(time.Hour))
+		require.NoError(t, err)
+
+		require.NoError(t, legacy.Initialize())
+		// Running the migration again is a no-op
+		require.NoError(t, legacy.Initialize())
+
+		result, err := legacy.GetResultByShareToken(ctx, "legacy-token")
+		require.NoError(t, err)
+		assert.Equal(t, "Reinstall the VPN client", result.AISummaryAnswer)
+
+		var count int
+		require.NoError(t, legacy.db.QueryRow("SELECT COUNT(*) FROM share_tokens WHERE token_hash = ?", "legacy-token").Scan(&count))
+		assert.Zero(t, count)
+	})
+}
+
+// TestSQLiteDBArticleHistory tests that updating an article keeps its
+// previous versions
+func TestSQLiteDBArticleHistory(t *testing.T) {
+	ctx := context.Background()
+
+	dbPath := "test_article_history.db"
+	defer os.Remove(dbPath)
+
+	db, err := NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.Initialize())
+
+	original, err := db.GetArticleByID(ctx, 1)
+	require.NoError(t, err)
+
+	t.Run("NoEdits", func(t *testing.T) {
+		history, err := db.GetArticleHistory(ctx, 1)
+		require.NoError(t, err)
+		assert.Empty(t, history)
+	})
+
+	t.Run("UpdateArticle", func(t *testing.T) {
+		updated, err := db.UpdateArticle(ctx, 1, "Resetting your password", "Use the self-service portal.")
+		require.NoError(t, err)
+		assert.Equal(t, "Resetting your password", updated.Title)
+
+		article, err := db.GetArticleByID(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, "Use the self-service portal.", article.Content)
+
+		// The search index follows the new content
+		var docID int
+		err = db.db.QueryRow("SELECT docid FROM articles_fts WHERE articles_fts MATCH ?", "portal").Scan(&docID)
+		require.NoError(t, err)
+		assert.Equal(t, 1, docID)
+	})
+
+	t.Run("HistoryNewestFirst", func(t *testing.T) {
+		_, err := db.UpdateArticle(ctx, 1, "Password help", "Call the help desk.")
+		require.NoError(t, err)
+
+		history, err := db.GetArticleHistory(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, history, 2)
+
+		assert.Equal(t, "Resetting your password", history[0].Title)
+		assert.Equal(t, original.Title, history[1].Title)
+		assert.Equal(t, original.Content, history[1].Content)
+		assert.Equal(t, 1, history[1].ArticleID)
+		assert.False(t, history[0].EditedAt.Before(history[1].EditedAt))
+	})
+
+	t.Run("UnknownArticle", func(t *testing.T) {
+		_, err := db.UpdateArticle(ctx, 999, "Title", "Content")
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		history, err := db.GetArticleHistory(ctx, 999)
+		require.NoError(t, err)
+		assert.Empty(t, history)
+	})
+}
+
+func TestSQLiteDBImportArticles(t *testing.T) {
+	ctx := context.Background()
+
+	dbPath := "test_import_articles.db"
+	defer os.Remove(dbPath)
+
+	db, err := NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.Initialize())
+
+	before, err := db.GetAllArticles(ctx)
+	require.NoError(t, err)
+
+	t.Run("InsertsAll", func(t *testing.T) {
+		imported, err := db.ImportArticles(ctx, []models.Article{
+			{Title: "Badge Access", Content: "Request a new badge from facilities."},
+			{Title: "Desk Booking", Content: "Reserve hot desks in the workplace app."},
+		})
+		require.NoError(t, err)
+		require.Len(t, imported, 2)
+		assert.Equal(t, imported[0].ID+1, imported[1].ID)
+
+		article, err := db.GetArticleByID(ctx, imported[1].ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Desk Booking", article.Title)
+
+		// New articles are searchable straight away
+		found, err := db.KeywordSearchArticles(ctx, []string{"facilities"}, nil, 10, 0)
+		require.NoError(t, err)
+		require.Len(t, found, 1)
+		assert.Equal(t, imported[0].ID, found[0].ID)
+	})
+
+	t.Run("WritesNothingOnFailure", func(t *testing.T) {
+		current, err := db.GetAllArticles(ctx)
+		require.NoError(t, err)
+
+		// Make the second insert fail after the first has gone through
+		_, err = db.db.Exec(`CREATE TRIGGER reject_import BEFORE INSERT ON articles WHEN new.title = 'Rejected'
+			BEGIN SELECT RAISE(ABORT, 'rejected'); END`)
+		require.NoError(t, err)
+		defer db.db.Exec("DROP TRIGGER reject_import")
+
+		_, err = db.ImportArticles(ctx, []models.Article{
+			{Title: "Lost", Content: "Never stored."},
+			{Title: "Rejected", Content: "Fails to insert."},
+		})
+		require.Error(t, err)
+
+		after, err := db.GetAllArticles(ctx)
+		require.NoError(t, err)
+		assert.Len(t, after, len(current))
+		assert.Len(t, after, len(before)+2)
+	})
+
+	t.Run("StoresKeywords", func(t *testing.T) {
+		imported, err := db.ImportArticles(ctx, []models.Article{
+			{Title: "Parking Permits", Content: "Apply through the facilities portal.", Keywords: "parking, car park, permit"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "parking, car park, permit", imported[0].Keywords)
+
+		article, err := db.GetArticleByID(ctx, imported[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, "parking, car park, permit", article.Keywords)
+
+		// Editing the title and content keeps the keywords
+		updated, err := db.UpdateArticle(ctx, article.ID, "Parking Permits", "Apply through the new portal.")
+		require.NoError(t, err)
+		assert.Equal(t, "parking, car park, permit", updated.Keywords)
+	})
+}
+
+func TestSQLiteDBUniqueTitles(t *testing.T) {
+	ctx := context.Background()
+
+	dbPath := "test_unique_titles.db"
+	defer os.Remove(dbPath)
+
+	db, err := NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.Initialize())
+
+	t.Run("GetArticleByTitle", func(t *testing.T) {
+		article, err := db.GetArticleByTitle(ctx, "vpn connection SETUP")
+		require.NoError(t, err)
+		assert.Equal(t, 2, article.ID)
+
+		_, err = db.GetArticleByTitle(ctx, "VPN")
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("UpdateToTakenTitle", func(t *testing.T) {
+		_, err := db.UpdateArticle(ctx, 1, "VPN CONNECTION SETUP", "Copied content")
+		assert.ErrorIs(t, err, ErrDuplicateTitle)
+
+		// Nothing changed, not even the history
+		history, err := db.GetArticleHistory(ctx, 1)
+		require.NoError(t, err)
+		assert.Empty(t, history)
+	})
+
+	t.Run("ImportTakenTitle", func(t *testing.T) {
+		before, err := db.GetAllArticles(ctx)
+		require.NoError(t, err)
+
+		_, err = db.ImportArticles(ctx, []models.Article{
+			{Title: "Badge Access", Content: "Ask facilities."},
+			{Title: "badge access", Content: "Ask facilities again."},
+		})
+		assert.ErrorIs(t, err, ErrDuplicateTitle)
+
+		after, err := db.GetAllArticles(ctx)
+		require.NoError(t, err)
+		assert.Len(t, after, len(before))
+	})
+
+	t.Run("ExistingDuplicatesRenamed", func(t *testing.T) {
+		legacyPath := "test_unique_titles_legacy.db"
+		defer os.Remove(legacyPath)
+
+		legacy, err := NewSQLiteDB(legacyPath)
+		require.NoError(t, err)
+		defer legacy.Close()
+		var buf bytes.Buffer
+		legacy.SetLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+
+		// Titles differing only in non-ASCII case are distinct under NOCASE
+		_, err = legacy.db.Exec(`CREATE TABLE articles (id INTEGER PRIMARY KEY AUTOINCREMENT, title TEXT NOT NULL, content TEXT NOT NULL);
+			INSERT INTO articles (title, content) VALUES ('VPN Setup', 'One'), ('vpn setup', 'Two'), ('Écran', 'Three'), ('écran', 'Four'), ('VPN SETUP', 'Five')`)
+		require.NoError(t, err)
+
+		require.NoError(t, legacy.Initialize())
+
+		articles, err := legacy.GetAllArticles(ctx)
+		require.NoError(t, err)
+		titles := []string{}
+		for _, article := range articles {
+			titles = append(titles, article.Title)
+		}
+		assert.Equal(t, []string{"VPN Setup", "vpn setup (2)", "Écran", "écran", "VPN SETUP (5)"}, titles)
+		assert.Contains(t, buf.String(), "renamed article with a duplicate title")
+
+		// The index now keeps new duplicates out
+		_, err = legacy.ImportArticles(ctx, []models.Article{{Title: "Vpn Setup", Content: "Six"}})
+		assert.ErrorIs(t, err, ErrDuplicateTitle)
+	})
+}
+
+// TestSQLiteDBContext tests that database calls stop when their context is
+// cancelled or times out
+func TestSQLiteDBContext(t *testing.T) {
+	dbPath := "test_context.db"
+	defer os.Remove(dbPath)
+
+	db, err := NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.Initialize())
+
+	t.Run("CancelledContext", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := db.GetAllArticles(ctx)
+		assert.ErrorIs(t, err, context.Canceled)
+
+		_, err = db.CreateQuery(ctx, "never stored")
+		assert.ErrorIs(t, err, context.Canceled)
+
+		stats, err := db.GetStats(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 0, stats.TotalQueries)
+	})
+
+	t.Run("AbortsRunningQuery", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		// Counts far enough to run for minutes if it is not interrupted
+		start := time.Now()
+		var count int
+		err := db.db.QueryRowContext(ctx, `
+			WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 1000000000)
+			SELECT COUNT(*) FROM n`).Scan(&count)
+
+		assert.Error(t, err)
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("QueryTimeout", func(t *testing.T) {
+		db.SetQueryTimeout(time.Nanosecond)
+		defer db.SetQueryTimeout(0)
+
+		_, err := db.GetAllArticles(context.Background())
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("NoTimeout", func(t *testing.T) {
+		articles, err := db.GetAllArticles(context.Background())
+		require.NoError(t, err)
+		assert.NotEmpty(t, articles)
+	})
+}
@@ -0,0 +1,267 @@
+package database
+
+import (
+	"context"
+	"event-to-insight/internal/models"
+	"event-to-insight/internal/tracing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracedDB records a span for each operation of the database it wraps
+type TracedDB struct {
+	db DatabaseInterface
+}
+
+// NewTracedDB wraps db so each operation taking a context is traced as a
+// child of the span in that context
+func NewTracedDB(db DatabaseInterface) *TracedDB {
+	return &TracedDB{db: db}
+}
+
+// start starts the span of the named operation
+func (t *TracedDB) start(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "db."+operation,
+		attribute.String("db.system", "sqlite"),
+		attribute.String("db.operation", operation))
+}
+
+// GetAllArticles traces DatabaseInterface.GetAllArticles
+func (t *TracedDB) GetAllArticles(ctx context.Context) ([]models.Article, error) {
+	ctx, span := t.start(ctx, "GetAllArticles")
+	articles, err := t.db.GetAllArticles(ctx)
+	span.SetAttributes(tracing.ArticleCountKey.Int(len(articles)))
+	tracing.End(span, err)
+	return articles, err
+}
+
+// EachArticle traces DatabaseInterface.EachArticle
+func (t *TracedDB) EachArticle(ctx context.Context, fn func(models.Article) error) error {
+	ctx, span := t.start(ctx, "EachArticle")
+	err := t.db.EachArticle(ctx, fn)
+	tracing.End(span, err)
+	return err
+}
+
+// GetArticleByID traces DatabaseInterface.GetArticleByID
+func (t *TracedDB) GetArticleByID(ctx context.Context, id int) (*models.Article, error) {
+	ctx, span := t.start(ctx, "GetArticleByID")
+	article, err := t.db.GetArticleByID(ctx, id)
+	tracing.End(span, err)
+	return article, err
+}
+
+// GetArticleByTitle traces DatabaseInterface.GetArticleByTitle
+func (t *TracedDB) GetArticleByTitle(ctx context.Context, title string) (*models.Article, error) {
+	ctx, span := t.start(ctx, "GetArticleByTitle")
+	article, err := t.db.GetArticleByTitle(ctx, title)
+	tracing.End(span, err)
+	return article, err
+}
+
+// GetArticlesByIDs traces DatabaseInterface.GetArticlesByIDs
+func (t *TracedDB) GetArticlesByIDs(ctx context.Context, ids []int) ([]models.Article, error) {
+	ctx, span := t.start(ctx, "GetArticlesByIDs")
+	articles, err := t.db.GetArticlesByIDs(ctx, ids)
+	span.SetAttributes(tracing.ArticleCountKey.Int(len(articles)))
+	tracing.End(span, err)
+	return articles, err
+}
+
+// UpdateArticle traces DatabaseInterface.UpdateArticle
+func (t *TracedDB) UpdateArticle(ctx context.Context, id int, title, content string) (*models.Article, error) {
+	ctx, span := t.start(ctx, "UpdateArticle")
+	article, err := t.db.UpdateArticle(ctx, id, title, content)
+	tracing.End(span, err)
+	return article, err
+}
+
+// ImportArticles traces DatabaseInterface.ImportArticles
+func (t *TracedDB) ImportArticles(ctx context.Context, articles []models.Article) ([]models.Article, error) {
+	ctx, span := t.start(ctx, "ImportArticles")
+	span.SetAttributes(tracing.ArticleCountKey.Int(len(articles)))
+	imported, err := t.db.ImportArticles(ctx, articles)
+	tracing.End(span, err)
+	return imported, err
+}
+
+// SetArticleSummary traces DatabaseInterface.SetArticleSummary
+func (t *TracedDB) SetArticleSummary(ctx context.Context, id int, content, summary string) error {
+	ctx, span := t.start(ctx, "SetArticleSummary")
+	err := t.db.SetArticleSummary(ctx, id, content, summary)
+	tracing.End(span, err)
+	return err
+}
+
+// GetArticleHistory traces DatabaseInterface.GetArticleHistory
+func (t *TracedDB) GetArticleHistory(ctx context.Context, articleID int) ([]models.ArticleVersion, error) {
+	ctx, span := t.start(ctx, "GetArticleHistory")
+	versions, err := t.db.GetArticleHistory(ctx, articleID)
+	tracing.End(span, err)
+	return versions, err
+}
+
+// KeywordSearchArticles traces DatabaseInterface.KeywordSearchArticles
+func (t *TracedDB) KeywordSearchArticles(ctx context.Context, terms []string, excludeIDs []int, limit, offset int) ([]models.Article, error) {
+	ctx, span := t.start(ctx, "KeywordSearchArticles")
+	articles, err := t.db.KeywordSearchArticles(ctx, terms, excludeIDs, limit, offset)
+	span.SetAttributes(tracing.ArticleCountKey.Int(len(articles)))
+	tracing.End(span, err)
+	return articles, err
+}
+
+// RecordArticleView traces DatabaseInterface.RecordArticleView
+func (t *TracedDB) RecordArticleView(ctx context.Context, articleID int) error {
+	ctx, span := t.start(ctx, "RecordArticleView")
+	err := t.db.RecordArticleView(ctx, articleID)
+	tracing.End(span, err)
+	return err
+}
+
+// GetPopularArticles traces DatabaseInterface.GetPopularArticles
+func (t *TracedDB) GetPopularArticles(ctx context.Context, limit, offset int) ([]models.PopularArticle, error) {
+	ctx, span := t.start(ctx, "GetPopularArticles")
+	articles, err := t.db.GetPopularArticles(ctx, limit, offset)
+	tracing.End(span, err)
+	return articles, err
+}
+
+// CreateQuery traces DatabaseInterface.CreateQuery
+func (t *TracedDB) CreateQuery(ctx context.Context, query string) (*models.Query, error) {
+	ctx, span := t.start(ctx, "CreateQuery")
+	created, err := t.db.CreateQuery(ctx, query)
+	tracing.End(span, err)
+	return created, err
+}
+
+// GetQueryByID traces DatabaseInterface.GetQueryByID
+func (t *TracedDB) GetQueryByID(ctx context.Context, id int) (*models.Query, error) {
+	ctx, span := t.start(ctx, "GetQueryByID")
+	query, err := t.db.GetQueryByID(ctx, id)
+	tracing.End(span, err)
+	return query, err
+}
+
+// TopQueries traces DatabaseInterface.TopQueries
+func (t *TracedDB) TopQueries(ctx context.Context, since time.Time, limit int) ([]models.TopQuery, error) {
+	ctx, span := t.start(ctx, "TopQueries")
+	queries, err := t.db.TopQueries(ctx, since, limit)
+	tracing.End(span, err)
+	return queries, err
+}
+
+// PurgeQueriesOlderThan traces DatabaseInterface.PurgeQueriesOlderThan
+func (t *TracedDB) PurgeQueriesOlderThan(ctx context.Context, cutoff time.Time) (*models.PurgeResult, error) {
+	ctx, span := t.start(ctx, "PurgeQueriesOlderThan")
+	result, err := t.db.PurgeQueriesOlderThan(ctx, cutoff)
+	tracing.End(span, err)
+	return result, err
+}
+
+// CreateSearchResult traces DatabaseInterface.CreateSearchResult
+func (t *TracedDB) CreateSearchResult(ctx context.Context, queryID int, summary string, relevantArticleIDs []int, scores map[int]float64) (*models.SearchResult, error) {
+	ctx, span := t.start(ctx, "CreateSearchResult")
+	result, err := t.db.CreateSearchResult(ctx, queryID, summary, relevantArticleIDs, scores)
+	tracing.End(span, err)
+	return result, err
+}
+
+// GetSearchResultByQueryID traces DatabaseInterface.GetSearchResultByQueryID
+func (t *TracedDB) GetSearchResultByQueryID(ctx context.Context, queryID int) (*models.SearchResult, error) {
+	ctx, span := t.start(ctx, "GetSearchResultByQueryID")
+	result, err := t.db.GetSearchResultByQueryID(ctx, queryID)
+	tracing.End(span, err)
+	return result, err
+}
+
+// GetSearchResultsByQueryID traces DatabaseInterface.GetSearchResultsByQueryID
+func (t *TracedDB) GetSearchResultsByQueryID(ctx context.Context, queryID int) ([]models.SearchResult, error) {
+	ctx, span := t.start(ctx, "GetSearchResultsByQueryID")
+	results, err := t.db.GetSearchResultsByQueryID(ctx, queryID)
+	tracing.End(span, err)
+	return results, err
+}
+
+// ReserveIdempotencyKey traces DatabaseInterface.ReserveIdempotencyKey
+func (t *TracedDB) ReserveIdempotencyKey(ctx context.Context, key, query string, staleBefore time.Time) (*models.IdempotencyRecord, bool, error) {
+	ctx, span := t.start(ctx, "ReserveIdempotencyKey")
+	record, reserved, err := t.db.ReserveIdempotencyKey(ctx, key, query, staleBefore)
+	tracing.End(span, err)
+	return record, reserved, err
+}
+
+// CompleteIdempotencyKey traces DatabaseInterface.CompleteIdempotencyKey
+func (t *TracedDB) CompleteIdempotencyKey(ctx context.Context, key string, response []byte) error {
+	ctx, span := t.start(ctx, "CompleteIdempotencyKey")
+	err := t.db.CompleteIdempotencyKey(ctx, key, response)
+	tracing.End(span, err)
+	return err
+}
+
+// ReleaseIdempotencyKey traces DatabaseInterface.ReleaseIdempotencyKey
+func (t *TracedDB) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	ctx, span := t.start(ctx, "ReleaseIdempotencyKey")
+	err := t.db.ReleaseIdempotencyKey(ctx, key)
+	tracing.End(span, err)
+	return err
+}
+
+// CreateShareToken traces DatabaseInterface.CreateShareToken
+func (t *TracedDB) CreateShareToken(ctx context.Context, resultID int, token string, expiresAt time.Time) error {
+	ctx, span := t.start(ctx, "CreateShareToken")
+	err := t.db.CreateShareToken(ctx, resultID, token, expiresAt)
+	tracing.End(span, err)
+	return err
+}
+
+// GetResultByShareToken traces DatabaseInterface.GetResultByShareToken
+func (t *TracedDB) GetResultByShareToken(ctx context.Context, token string) (*models.SearchResult, error) {
+	ctx, span := t.start(ctx, "GetResultByShareToken")
+	result, err := t.db.GetResultByShareToken(ctx, token)
+	tracing.End(span, err)
+	return result, err
+}
+
+// GetStats traces DatabaseInterface.GetStats
+func (t *TracedDB) GetStats(ctx context.Context) (*models.Stats, error) {
+	ctx, span := t.start(ctx, "GetStats")
+	stats, err := t.db.GetStats(ctx)
+	tracing.End(span, err)
+	return stats, err
+}
+
+// Initialize is not traced, as it runs before any request
+func (t *TracedDB) Initialize() error {
+	return t.db.Initialize()
+}
+
+// Ping traces DatabaseInterface.Ping
+func (t *TracedDB) Ping(ctx context.Context) error {
+	ctx, span := t.start(ctx, "Ping")
+	err := t.db.Ping(ctx)
+	tracing.End(span, err)
+	return err
+}
+
+// Reindex traces DatabaseInterface.Reindex
+func (t *TracedDB) Reindex(ctx context.Context) (int, error) {
+	ctx, span := t.start(ctx, "Reindex")
+	count, err := t.db.Reindex(ctx)
+	tracing.End(span, err)
+	return count, err
+}
+
+// Backup traces DatabaseInterface.Backup
+func (t *TracedDB) Backup(ctx context.Context, destPath string) error {
+	ctx, span := t.start(ctx, "Backup")
+	err := t.db.Backup(ctx, destPath)
+	tracing.End(span, err)
+	return err
+}
+
+// Close closes the wrapped database
+func (t *TracedDB) Close() error {
+	return t.db.Close()
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"event-to-insight/internal/models"
+	"event-to-insight/internal/service"
+	"event-to-insight/internal/textutil"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Reindex handles POST /admin/reindex
+func (h *SearchHandler) Reindex(w http.ResponseWriter, r *http.Request) {
+	result, err := h.searchService.Reindex(r.Context())
+	if err != nil {
+		h.sendErrorResponse(w, r, http.StatusInternalServerError, "Failed to reindex articles", err.Error())
+		return
+	}
+
+	h.sendJSONResponse(w, r, http.StatusOK, result)
+}
+
+// GetStats handles GET /stats
+func (h *SearchHandler) GetStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.searchService.GetStats(r.Context())
+	if err != nil {
+		h.sendErrorResponse(w, r, http.StatusInternalServerError, "Failed to get stats", err.Error())
+		return
+	}
+
+	h.sendJSONResponse(w, r, http.StatusOK, stats)
+}
+
+// TopQueries handles GET /queries/top, listing the most frequently asked
+// queries within a time window
+func (h *SearchHandler) TopQueries(w http.ResponseWriter, r *http.Request) {
+	window, limit, err := parseTopQueriesParams(r)
+	if err != nil {
+		h.sendErrorResponse(w, r, http.StatusBadRequest, "Invalid query parameters", err.Error())
+		return
+	}
+
+	topQueries, err := h.searchService.TopQueries(r.Context(), time.Now().Add(-window), limit)
+	if err != nil {
+		h.sendErrorResponse(w, r, http.StatusInternalServerError, "Failed to get top queries", err.Error())
+		return
+	}
+
+	for i := range topQueries {
+		topQueries[i].LastAskedAt = h.inZone(topQueries[i].LastAskedAt)
+	}
+	h.sendJSONResponse(w, r, http.StatusOK, topQueries)
+}
+
+// RerunQuery handles POST /queries/{id}/rerun, answering a stored query
+// again against the current articles. The fresh result becomes the one
+// returned for the query. It takes the same options as POST /search-query.
+func (h *SearchHandler) RerunQuery(w http.ResponseWriter, r *http.Request) {
+	setNoStore(w)
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.sendErrorResponse(w, r, http.StatusBadRequest, "Invalid query ID", "")
+		return
+	}
+
+	opts, ok := h.parseSearchOptions(w, r)
+	if !ok {
+		return
+	}
+
+	response, err := h.searchService.RerunQuery(r.Context(), id, opts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			h.sendErrorResponse(w, r, http.StatusNotFound, "Query not found", "")
+			return
+		}
+		h.sendSearchError(w, r, "Failed to rerun query", err)
+		return
+	}
+
+	response.Timestamp = h.inZone(response.Timestamp)
+	h.sendJSONResponse(w, r, http.StatusOK, h.searchResponseBody(r, response))
+}
+
+// GetConfig handles GET /admin/config, showing the configuration the server
+// loaded so operators can check an environment variable took effect.
+// Secrets are redacted to their last four characters.
+func (h *SearchHandler) GetConfig(w http.ResponseWriter, r *http.Request) {
+	setNoStore(w)
+	h.sendJSONResponse(w, r, http.StatusOK, h.searchService.EffectiveConfig())
+}
+
+// Purge handles POST /admin/purge?older_than=30d, deleting queries and
+// their results older than the window, and expired share links. older_than is required so a bare
+// request cannot wipe the history.
+func (h *SearchHandler) Purge(w http.ResponseWriter, r *http.Request) {
+	value := r.URL.Query().Get("older_than")
+	if value == "" {
+		h.sendErrorResponse(w, r, http.StatusBadRequest, "Invalid query parameters", "older_than is required, such as 30d")
+		return
+	}
+	olderThan, err := parseWindow(value)
+	if err != nil {
+		h.sendErrorResponse(w, r, http.StatusBadRequest, "Invalid query parameters", "older_than: "+err.Error())
+		return
+	}
+
+	result, err := h.searchService.PurgeQueries(r.Context(), time.Now().Add(-olderThan))
+	if err != nil {
+		h.sendStorageError(w, r, "Failed to purge queries", err)
+		return
+	}
+
+	h.sendJSONResponse(w, r, http.StatusOK, result)
+}
+
+// ImportArticles handles POST /admin/articles/import. Every article is
+// validated before any is stored, and all failures are reported together
+// with the index of the article they belong to, so a large import file can
+// be fixed in one pass. Nothing is written unless every article is valid.
+func (h *SearchHandler) ImportArticles(w http.ResponseWriter, r *http.Request) {
+	var body importArticlesBody
+	if !h.decodeRequest(w, r, &body) {
+		return
+	}
+
+	var fieldErrs []models.FieldError
+	articles := make([]models.Article, 0, len(body.Articles))
+	firstWithTitle := map[string]int{}
+	for i, article := range body.Articles {
+		errs := h.validateArticle(article.updateArticleBody)
+		if utf8.RuneCountInString(article.Keywords) > maxKeywordsChars {
+			errs = append(errs, models.FieldError{
+				Field:   "keywords",
+				Message: fmt.Sprintf("keywords must be at most %d characters", maxKeywordsChars),
+			})
+		}
+		if len(errs) == 0 {
+			title := textutil.FoldTitle(*article.Title)
+			if first, ok := firstWithTitle[title]; ok {
+				errs = append(errs, models.FieldError{
+					Field:   "title",
+					Message: fmt.Sprintf("title repeats the title of article %d", first),
+				})
+			} else {
+				firstWithTitle[title] = i
+			}
+		}
+		for j := range errs {
+			index := i
+			errs[j].Index = &index
+		}
+		fieldErrs = append(fieldErrs, errs...)
+		if len(errs) == 0 {
+			articles = append(articles, models.Article{
+				Title:    *article.Title,
+				Content:  *article.Content,
+				Keywords: strings.TrimSpace(article.Keywords),
+			})
+		}
+	}
+	if len(fieldErrs) > 0 {
+		h.sendValidationError(w, r, fieldErrs)
+		return
+	}
+
+	imported, err := h.searchService.ImportArticles(r.Context(), articles)
+	if errors.Is(err, service.ErrDuplicateTitle) {
+		h.sendErrorResponse(w, r, http.StatusConflict, "Duplicate article title", err.Error())
+		return
+	}
+	if err != nil {
+		h.sendStorageError(w, r, "Failed to import articles", err)
+		return
+	}
+
+	h.sendJSONResponse(w, r, http.StatusCreated, models.ImportResult{
+		ArticlesImported: len(imported),
+		Articles:         imported,
+	})
+}
+
+// Backup handles GET /admin/backup by streaming a consistent snapshot of the
+// database as a file download
+func (h *SearchHandler) Backup(w http.ResponseWriter, r *http.Request) {
+	filename := fmt.Sprintf("event-to-insight-%s.db", time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	written, err := h.searchService.Backup(r.Context(), w)
+	if err != nil {
+		if written == 0 {
+			w.Header().Del("Content-Disposition")
+			h.sendErrorResponse(w, r, http.StatusInternalServerError, "Failed to back up database", err.Error())
+			return
+		}
+		// The download has already started, so the client sees a truncated file
+		log.Printf("Backup interrupted after %d bytes: %v", written, err)
+	}
+}
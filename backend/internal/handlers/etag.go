@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"event-to-insight/internal/models"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// articlesETag computes a strong ETag over every article field, so any
+// change to the articles of a response changes the ETag. Each text field is
+// length-prefixed so that different field boundaries never hash the same.
+func articlesETag(articles ...models.Article) string {
+	hash := sha256.New()
+	buf := make([]byte, 8)
+
+	writeNumber := func(value uint64) {
+		binary.BigEndian.PutUint64(buf, value)
+		hash.Write(buf)
+	}
+	writeField := func(value string) {
+		writeNumber(uint64(len(value)))
+		hash.Write([]byte(value))
+	}
+
+	for _, article := range articles {
+		writeNumber(uint64(article.ID))
+		writeField(article.Title)
+		writeField(article.Content)
+		writeField(article.Keywords)
+		writeField(article.Summary)
+		writeNumber(math.Float64bits(article.Score))
+		writeNumber(uint64(article.UpdatedAt.Unix()))
+		writeNumber(uint64(article.UpdatedAt.Nanosecond()))
+	}
+
+	return `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+}
+
+// etagMatches reports whether the If-None-Match header matches the ETag
+func etagMatches(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// setArticleCacheControl lets browsers and CDNs cache an article read for
+// the configured max-age
+func (h *SearchHandler) setArticleCacheControl(w http.ResponseWriter, r *http.Request) {
+	// With public fields the body depends on the API key, so caches must
+	// key on it and may not share what a key holder sees
+	if h.publicFields != nil {
+		w.Header().Add("Vary", "Authorization, X-API-Key")
+	}
+	if h.articleMaxAge > 0 {
+		scope := "public"
+		if h.publicFields != nil && Authenticated(r.Context()) {
+			scope = "private"
+		}
+		w.Header().Set("Cache-Control", scope+", max-age="+strconv.Itoa(h.articleMaxAge))
+	}
+}
+
+// articlesETag is the ETag of an article read. Every representation is
+// computed over the stored articles, so the public and indented ones, which
+// are different bytes, are marked apart.
+func (h *SearchHandler) articlesETag(r *http.Request, articles ...models.Article) string {
+	etag := strings.TrimSuffix(articlesETag(articles...), `"`)
+	if h.restricted(r) {
+		etag += "-public"
+	}
+	if h.prettyJSON(r) {
+		etag += "-pretty"
+	}
+	return etag + `"`
+}
+
+// setNoStore stops search results, which depend on the AI and change with
+// every question, from being cached anywhere
+func setNoStore(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+// checkNotModified sets the ETag header and writes a 304 response when the
+// client already has the current representation
+func checkNotModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	if etagMatches(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"event-to-insight/internal/models"
+	"net/http"
+)
+
+// articleFieldsSummary is the ?fields value that cuts the articles of a
+// search response down to their id, title and score
+const articleFieldsSummary = "summary"
+
+// articleSummary is an article of a search response sent with
+// ?fields=summary
+type articleSummary struct {
+	ID    int     `json:"id"`
+	Title string  `json:"title"`
+	Score float64 `json:"score,omitempty"`
+}
+
+// summarySearchResponse is a search response sent with ?fields=summary. Its
+// article lists take the place of the full ones of the embedded response.
+type summarySearchResponse struct {
+	*models.SearchResponse
+	AIRelevantArticles []articleSummary `json:"ai_relevant_articles"`
+	SuggestedArticles  []articleSummary `json:"suggested_articles,omitempty"`
+}
+
+// batchSearchResult is a batch search result as sent, its result projected
+// like a single search response
+type batchSearchResult struct {
+	models.BatchSearchResult
+	Result interface{} `json:"result,omitempty"`
+}
+
+// searchResponseBody returns what a search response is sent as: cut down
+// to article summaries when r asks for ?fields=summary, which has been
+// validated with the other search options by then, and limited to the
+// public article fields when r does not carry the API key
+func (h *SearchHandler) searchResponseBody(r *http.Request, response *models.SearchResponse) interface{} {
+	restricted := h.restricted(r)
+	if r.URL.Query().Get("fields") == articleFieldsSummary {
+		return &summarySearchResponse{
+			SearchResponse:     response,
+			AIRelevantArticles: h.summarizeArticles(response.AIRelevantArticles, restricted),
+			SuggestedArticles:  h.summarizeArticles(response.SuggestedArticles, restricted),
+		}
+	}
+	if restricted {
+		return &publicSearchResponse{
+			SearchResponse:     response,
+			AIRelevantArticles: h.publicArticles(response.AIRelevantArticles),
+			SuggestedArticles:  h.publicArticles(response.SuggestedArticles),
+		}
+	}
+	return response
+}
+
+// batchResultsBody returns what the results of a batch search are sent as,
+// each projected like searchResponseBody
+func (h *SearchHandler) batchResultsBody(r *http.Request, results []models.BatchSearchResult) []batchSearchResult {
+	bodies := make([]batchSearchResult, len(results))
+	for i, result := range results {
+		bodies[i].BatchSearchResult = result
+		if result.Result != nil {
+			bodies[i].Result = h.searchResponseBody(r, result.Result)
+		}
+	}
+	return bodies
+}
+
+// summarizeArticles projects articles down to their id, title and score,
+// leaving the title out unless it is public when restricted is set. Nil
+// stays nil so that an absent list stays absent.
+func (h *SearchHandler) summarizeArticles(articles []models.Article, restricted bool) []articleSummary {
+	if articles == nil {
+		return nil
+	}
+	summaries := make([]articleSummary, len(articles))
+	for i, article := range articles {
+		if restricted {
+			article = h.publicArticle(article).Article
+		}
+		summaries[i] = articleSummary{ID: article.ID, Title: article.Title, Score: article.Score}
+	}
+	return summaries
+}
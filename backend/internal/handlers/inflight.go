@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"event-to-insight/internal/models"
+	"net/http"
+	"sync/atomic"
+)
+
+// InFlight counts the requests being served and, when it has a limit, turns
+// away those beyond it so a traffic spike cannot pile work onto the
+// database and the paid AI
+type InFlight struct {
+	limit    int64
+	active   atomic.Int64
+	rejected atomic.Int64
+}
+
+// NewInFlight creates a counter allowing limit requests at once. Zero or
+// less only counts them.
+func NewInFlight(limit int) *InFlight {
+	return &InFlight{limit: int64(max(limit, 0))}
+}
+
+// Acquire counts a request in. It reports false, counting the request as
+// rejected, when the limit is already reached; only requests it accepted
+// may be released.
+func (f *InFlight) Acquire() bool {
+	active := f.active.Add(1)
+	if f.limit > 0 && active > f.limit {
+		f.active.Add(-1)
+		f.rejected.Add(1)
+		return false
+	}
+	return true
+}
+
+// Release counts an accepted request out
+func (f *InFlight) Release() {
+	f.active.Add(-1)
+}
+
+// Active returns how many requests are being served
+func (f *InFlight) Active() int64 {
+	return f.active.Load()
+}
+
+// Rejected returns how many requests were turned away since startup
+func (f *InFlight) Rejected() int64 {
+	return f.rejected.Load()
+}
+
+// Limit returns the most requests served at once, zero for no limit
+func (f *InFlight) Limit() int64 {
+	return f.limit
+}
+
+// SetInFlight replaces the counter of requests being served. It must be
+// called before the router is set up, since the router's middleware counts
+// requests with it.
+func (h *SearchHandler) SetInFlight(inFlight *InFlight) {
+	h.inFlight = inFlight
+}
+
+// InFlight returns the counter of requests being served
+func (h *SearchHandler) InFlight() *InFlight {
+	return h.inFlight
+}
+
+// Metrics handles GET /metrics, reporting the load on the server
+func (h *SearchHandler) Metrics(w http.ResponseWriter, r *http.Request) {
+	setNoStore(w)
+	h.sendJSONResponse(w, r, http.StatusOK, models.Metrics{
+		InFlightRequests:    h.inFlight.Active(),
+		MaxInFlightRequests: h.inFlight.Limit(),
+		RejectedRequests:    h.inFlight.Rejected(),
+	})
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	// defaultPageSize is used when the client does not specify a page size,
+	// unless SetPageSizes changes it
+	defaultPageSize = 20
+	// maxPageSize caps how many items a single page can return, unless
+	// SetPageSizes changes it
+	maxPageSize = 100
+)
+
+// parsePagination reads the page and page_size query parameters and
+// converts them into a limit and offset. defaultSize is used when page_size
+// is missing, and page sizes above maxSize are rejected.
+func parsePagination(r *http.Request, defaultSize, maxSize int) (limit int, offset int, err error) {
+	page := 1
+	pageSize := defaultSize
+
+	if value := r.URL.Query().Get("page"); value != "" {
+		page, err = strconv.Atoi(value)
+		if err != nil || page < 1 {
+			return 0, 0, fmt.Errorf("page must be a positive integer")
+		}
+	}
+
+	if value := r.URL.Query().Get("page_size"); value != "" {
+		pageSize, err = strconv.Atoi(value)
+		if err != nil || pageSize < 1 || pageSize > maxSize {
+			return 0, 0, fmt.Errorf("page_size must be between 1 and %d", maxSize)
+		}
+	}
+
+	return pageSize, (page - 1) * pageSize, nil
+}
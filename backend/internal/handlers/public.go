@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"event-to-insight/internal/models"
+	"event-to-insight/internal/textutil"
+	"net/http"
+	"strings"
+)
+
+// publicSnippetChars is how many characters of content make up the snippet
+// shown to clients that may not read the content itself
+const publicSnippetChars = 200
+
+// authenticatedKey is the context key marking requests that carried the API key
+type authenticatedKey struct{}
+
+// WithAuthenticated marks a request context as coming from a client that
+// holds the API key
+func WithAuthenticated(ctx context.Context) context.Context {
+	return context.WithValue(ctx, authenticatedKey{}, true)
+}
+
+// Authenticated reports whether a request context was marked by
+// WithAuthenticated
+func Authenticated(ctx context.Context) bool {
+	authenticated, _ := ctx.Value(authenticatedKey{}).(bool)
+	return authenticated
+}
+
+// SetPublicArticleFields limits article reads by clients without the API
+// key to the named fields: id, title, snippet, content, keywords and
+// summary. IDs are always returned. An empty list leaves every field public.
+func (h *SearchHandler) SetPublicArticleFields(fields []string) {
+	if len(fields) == 0 {
+		h.publicFields = nil
+		return
+	}
+	h.publicFields = make(map[string]bool, len(fields))
+	for _, field := range fields {
+		h.publicFields[strings.ToLower(strings.TrimSpace(field))] = true
+	}
+}
+
+// restricted reports whether a request only gets the public article fields
+func (h *SearchHandler) restricted(r *http.Request) bool {
+	return h.publicFields != nil && !Authenticated(r.Context())
+}
+
+// articleView is an article projected to the public fields. Its content
+// shadows the article's own, so content that is not public is left out of
+// the JSON rather than sent empty.
+type articleView struct {
+	models.Article
+	Content *string `json:"content,omitempty"`
+}
+
+// publicArticle keeps the fields of article that may be shown publicly
+func (h *SearchHandler) publicArticle(article models.Article) articleView {
+	public := articleView{Article: models.Article{ID: article.ID, Score: article.Score, UpdatedAt: article.UpdatedAt}}
+	if h.publicFields["title"] {
+		public.Title = article.Title
+	}
+	if h.publicFields["content"] {
+		public.Article.Content = article.Content
+		public.Content = &public.Article.Content
+	}
+	if h.publicFields["keywords"] {
+		public.Keywords = article.Keywords
+	}
+	if h.publicFields["summary"] {
+		public.Summary = article.Summary
+	}
+	return public
+}
+
+// publicSnippet returns the start of content when snippets are public
+func (h *SearchHandler) publicSnippet(content string) string {
+	if !h.publicFields["snippet"] {
+		return ""
+	}
+	snippet, _ := textutil.Truncate(content, publicSnippetChars)
+	return snippet
+}
+
+// articleResponse is an article response as sent, with its content left
+// out when it is not public
+type articleResponse struct {
+	models.ArticleResponse
+	Content *string `json:"content,omitempty"`
+}
+
+// publicResponse projects an article response to the public fields, adding
+// a snippet of the stored content when snippets are public
+func (h *SearchHandler) publicResponse(response models.ArticleResponse, stored models.Article) articleResponse {
+	public := h.publicArticle(response.Article)
+	response.Article = public.Article
+	response.Snippet = h.publicSnippet(stored.Content)
+	return articleResponse{ArticleResponse: response, Content: public.Content}
+}
+
+// publicPopularArticle is a popular article sent to a client without the
+// API key
+type publicPopularArticle struct {
+	models.PopularArticle
+	Content *string `json:"content,omitempty"`
+}
+
+// publicExportArticle is a line of an export sent to a client without the
+// API key
+type publicExportArticle struct {
+	articleView
+	Snippet string `json:"snippet,omitempty"`
+}
+
+// publicSearchResponse is a search response sent to a client without the
+// API key. Its article lists take the place of those of the embedded
+// response.
+type publicSearchResponse struct {
+	*models.SearchResponse
+	AIRelevantArticles []articleView `json:"ai_relevant_articles"`
+	SuggestedArticles  []articleView `json:"suggested_articles,omitempty"`
+}
+
+// publicSharedResult is a shared search result sent to a client without
+// the API key
+type publicSharedResult struct {
+	*models.SharedResult
+	AIRelevantArticles []articleView `json:"ai_relevant_articles"`
+}
+
+// publicArticles projects each of articles to the public fields
+func (h *SearchHandler) publicArticles(articles []models.Article) []articleView {
+	if articles == nil {
+		return nil
+	}
+	public := make([]articleView, len(articles))
+	for i, article := range articles {
+		public[i] = h.publicArticle(article)
+	}
+	return public
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// QuotaStore counts how many searches each client has run per day. The
+// quota only needs Add, so a store shared between instances, such as one
+// backed by the database or Redis, can replace MemoryQuotaStore.
+type QuotaStore interface {
+	// Add adds n to the count of key for the day starting at day and
+	// returns the new count
+	Add(key string, day time.Time, n int) (int, error)
+}
+
+// MemoryQuotaStore is a QuotaStore that keeps counts in memory. Counts are
+// lost on restart and are not shared between instances. Only the current
+// day is kept, so memory stays bounded by the number of clients per day.
+type MemoryQuotaStore struct {
+	mu     sync.Mutex
+	day    time.Time
+	counts map[string]int
+}
+
+// NewMemoryQuotaStore creates an empty in-memory quota store
+func NewMemoryQuotaStore() *MemoryQuotaStore {
+	return &MemoryQuotaStore{counts: make(map[string]int)}
+}
+
+// Add adds n to the count of key, forgetting every count of an earlier day
+func (s *MemoryQuotaStore) Add(key string, day time.Time, n int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !day.Equal(s.day) {
+		s.day = day
+		s.counts = make(map[string]int)
+	}
+	s.counts[key] += n
+	return s.counts[key], nil
+}
+
+// SearchQuota caps how many searches each client IP may run per UTC day,
+// bounding the AI cost a single client can cause
+type SearchQuota struct {
+	limit  int
+	exempt []netip.Prefix
+	store  QuotaStore
+	now    func() time.Time
+}
+
+// NewSearchQuota creates a quota of limit searches per client IP per day,
+// counted in store. Clients in the exempt ranges are never limited.
+func NewSearchQuota(limit int, exempt []netip.Prefix, store QuotaStore) *SearchQuota {
+	return &SearchQuota{
+		limit:  limit,
+		exempt: exempt,
+		store:  store,
+		now:    time.Now,
+	}
+}
+
+// take counts n searches by the client of r. It returns false, with when
+// the quota resets, if that takes the client over its limit. Searches
+// refused this way still count, so a client cannot retry its way in.
+func (q *SearchQuota) take(r *http.Request, n int) (bool, time.Time) {
+	now := q.now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	resetAt := day.AddDate(0, 0, 1)
+
+	key := r.RemoteAddr
+	if ip := requestIP(r); ip.IsValid() {
+		for _, prefix := range q.exempt {
+			if prefix.Contains(ip) {
+				return true, resetAt
+			}
+		}
+		key = ip.String()
+	}
+
+	count, err := q.store.Add(key, day, n)
+	if err != nil {
+		// Searching matters more than the quota, so fail open
+		log.Printf("[%s] Failed to count search quota: %v", middleware.GetReqID(r.Context()), err)
+		return true, resetAt
+	}
+	return count <= q.limit, resetAt
+}
+
+// requestIP parses the client IP of r. The router's ClientIP middleware
+// stores the resolved IP in r.RemoteAddr.
+func requestIP(r *http.Request) netip.Addr {
+	addr := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return ip.Unmap()
+}
+
+// checkQuota counts n searches against the client's daily quota. If the
+// quota is exceeded a 429 response is sent and false is returned.
+func (h *SearchHandler) checkQuota(w http.ResponseWriter, r *http.Request, n int) bool {
+	if h.quota == nil || n == 0 {
+		return true
+	}
+
+	allowed, resetAt := h.quota.take(r, n)
+	if allowed {
+		return true
+	}
+
+	retryAfter := int(resetAt.Sub(h.quota.now()).Seconds()) + 1
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	h.sendErrorResponse(w, r, http.StatusTooManyRequests, "Daily search quota exceeded",
+		fmt.Sprintf("at most %d searches are allowed per day, the quota resets at %s", h.quota.limit, resetAt.Format(time.RFC3339)))
+	return false
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"event-to-insight/internal/models"
+	"event-to-insight/internal/service"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// searchOptionsParams holds the search option query parameters as sent, so
+// every malformed value can be reported at once
+type searchOptionsParams struct {
+	DryRun       string `json:"dry_run" validate:"omitempty,boolean"`
+	MinRelevance string `json:"min_relevance" validate:"omitempty,relevance"`
+	Fields       string `json:"fields" validate:"omitempty,oneof=full summary"`
+	Format       string `json:"format" validate:"omitempty,oneof=text html"`
+}
+
+// searchOptionsFromRequest validates the search query parameters and
+// converts them, with the X-AI-Provider header, into search options
+func searchOptionsFromRequest(r *http.Request) (service.SearchOptions, []models.FieldError) {
+	query := r.URL.Query()
+	params := searchOptionsParams{
+		DryRun:       query.Get("dry_run"),
+		MinRelevance: query.Get("min_relevance"),
+		Fields:       query.Get("fields"),
+		Format:       query.Get("format"),
+	}
+
+	opts := service.SearchOptions{
+		Provider: r.Header.Get("X-AI-Provider"),
+	}
+	if fieldErrs := validateRequest(params); len(fieldErrs) > 0 {
+		return opts, fieldErrs
+	}
+
+	if params.DryRun != "" {
+		opts.DryRun, _ = strconv.ParseBool(params.DryRun)
+	}
+	if params.MinRelevance != "" {
+		minRelevance, _ := strconv.ParseFloat(params.MinRelevance, 64)
+		opts.MinRelevance = &minRelevance
+	}
+	opts.Format = service.ContentFormat(params.Format)
+	return opts, nil
+}
+
+// searchQueryRequest is a POST /search-query request that passed validation
+type searchQueryRequest struct {
+	Query   string
+	Options service.SearchOptions
+}
+
+// searchQueryRequestKey is the context key of a validated searchQueryRequest
+type searchQueryRequestKey struct{}
+
+// ValidateSearchQuery checks a POST /search-query request, both its JSON
+// body and its query parameters, before it reaches the handler. Every
+// failing field is listed in a single 400 response.
+func (h *SearchHandler) ValidateSearchQuery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body searchRequestBody
+		if !h.readJSON(w, r, &body) {
+			return
+		}
+
+		fieldErrs := validateRequest(body)
+		opts, optionErrs := searchOptionsFromRequest(r)
+		fieldErrs = append(fieldErrs, optionErrs...)
+		if len(fieldErrs) > 0 {
+			h.sendValidationError(w, r, fieldErrs)
+			return
+		}
+
+		opts.ArticleIDs = body.ArticleIDs
+		req := searchQueryRequest{Query: *body.Query, Options: opts}
+		ctx := context.WithValue(r.Context(), searchQueryRequestKey{}, req)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// CheckSearchQuery handles POST /search-query/validate, applying the body
+// rules of POST /search-query without searching, so a client can flag an
+// invalid query before submitting it. It always answers 200, listing a
+// message for each problem; query parameters are not checked.
+func (h *SearchHandler) CheckSearchQuery(w http.ResponseWriter, r *http.Request) {
+	setNoStore(w)
+
+	var body searchRequestBody
+	data, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = decodeJSON(data, &body)
+	}
+
+	errs := []string{}
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		errs = append(errs, "request body is too large")
+	case errors.Is(err, errInvalidUTF8):
+		errs = append(errs, err.Error())
+	case err != nil:
+		errs = append(errs, fmt.Sprintf("request body is not valid JSON: %v", err))
+	default:
+		for _, fieldErr := range validateRequest(body) {
+			errs = append(errs, fieldErr.Message)
+		}
+	}
+
+	h.sendJSONResponse(w, r, http.StatusOK, models.QueryValidation{Valid: len(errs) == 0, Errors: errs})
+}
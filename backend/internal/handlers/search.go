@@ -1,102 +1,961 @@
 package handlers
 
 import (
+	"bytes"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"event-to-insight/internal/i18n"
 	"event-to-insight/internal/models"
 	"event-to-insight/internal/service"
+	"event-to-insight/internal/textutil"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"strconv"
-	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 )
 
+// startTime is when the server started, reported by the health check
+var startTime = time.Now()
+
+// SetStartTime records when the server started. It defaults to when the
+// package was loaded.
+func SetStartTime(t time.Time) {
+	startTime = t
+}
+
 // SearchHandler handles search-related HTTP requests
 type SearchHandler struct {
 	searchService *service.SearchService
+
+	// defaultPageSize and maxPageSize bound paginated endpoints
+	defaultPageSize int
+	maxPageSize     int
+
+	// envelope wraps responses in models.DataEnvelope and models.ErrorEnvelope
+	envelope bool
+
+	// pretty indents JSON responses unless a request asks with ?pretty=false
+	pretty bool
+
+	// articleMaxAge is how many seconds article reads may be cached, zero
+	// for no caching headers
+	articleMaxAge int
+
+	// maxTitleChars and maxContentChars bound the articles clients write
+	maxTitleChars   int
+	maxContentChars int
+
+	// quota caps searches per client per day; nil means no quota
+	quota *SearchQuota
+
+	// location is the timezone timestamps are written in
+	location *time.Location
+
+	// language is the language of error messages for clients whose
+	// Accept-Language names no supported language
+	language string
+
+	// publicFields are the article fields shown to clients without the API
+	// key; nil shows them every field
+	publicFields map[string]bool
+
+	// inFlight counts the requests being served
+	inFlight *InFlight
 }
 
 // NewSearchHandler creates a new search handler
 func NewSearchHandler(searchService *service.SearchService) *SearchHandler {
 	return &SearchHandler{
-		searchService: searchService,
+		searchService:   searchService,
+		defaultPageSize: defaultPageSize,
+		maxPageSize:     maxPageSize,
+		maxTitleChars:   defaultMaxTitleChars,
+		maxContentChars: defaultMaxContentChars,
+		location:        time.UTC,
+		language:        i18n.DefaultLanguage,
+		inFlight:        NewInFlight(0),
 	}
 }
 
-// SearchQuery handles POST /search-query
-func (h *SearchHandler) SearchQuery(w http.ResponseWriter, r *http.Request) {
-	var req models.SearchRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON", err.Error())
-		return
+// SetPageSizes sets the page size used when a client does not pick one and
+// the largest page size a client may ask for
+func (h *SearchHandler) SetPageSizes(defaultSize, maxSize int) {
+	h.defaultPageSize = defaultSize
+	h.maxPageSize = maxSize
+}
+
+// SetResponseEnvelope controls whether responses are wrapped, successes as
+// {data, meta} and errors as {error: {code, message}}. Responses are bare
+// by default.
+func (h *SearchHandler) SetResponseEnvelope(enabled bool) {
+	h.envelope = enabled
+}
+
+// SetPrettyJSON controls whether JSON responses are indented. Either way a
+// request can choose with ?pretty=true or ?pretty=false.
+func (h *SearchHandler) SetPrettyJSON(enabled bool) {
+	h.pretty = enabled
+}
+
+// SetDefaultLanguage sets the language of error messages for clients that
+// do not ask for a supported one with Accept-Language. It defaults to
+// English.
+func (h *SearchHandler) SetDefaultLanguage(lang string) {
+	h.language = lang
+}
+
+// SetArticleCacheMaxAge sets how many seconds browsers and CDNs may cache
+// article reads. Zero or less leaves out the Cache-Control header.
+func (h *SearchHandler) SetArticleCacheMaxAge(seconds int) {
+	h.articleMaxAge = seconds
+}
+
+// SetArticleLimits sets the longest title and content, in characters, an
+// article may be written with
+func (h *SearchHandler) SetArticleLimits(titleChars, contentChars int) {
+	h.maxTitleChars = titleChars
+	h.maxContentChars = contentChars
+}
+
+// SetResponseTimezone sets the timezone of timestamps in responses, so
+// clients can show them without converting. It defaults to UTC.
+func (h *SearchHandler) SetResponseTimezone(location *time.Location) {
+	h.location = location
+}
+
+// inZone converts t to the response timezone. Zero times are left as they
+// are, so they still read as unset.
+func (h *SearchHandler) inZone(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return t.In(h.location)
+}
+
+// SetSearchQuota enforces a daily search quota per client. Passing nil
+// removes it.
+func (h *SearchHandler) SetSearchQuota(quota *SearchQuota) {
+	h.quota = quota
+}
+
+// searchRequestBody mirrors models.SearchRequest with pointer fields so a
+// missing field can be told apart from an empty one
+type searchRequestBody struct {
+	Query      *string `json:"query" validate:"required,notblank,max=2000"`
+	ArticleIDs []int   `json:"article_ids" validate:"omitempty,max=100,unique,dive,gt=0"`
+}
+
+// batchSearchRequestBody is the request body for a batch search, capped at
+// 50 queries
+type batchSearchRequestBody struct {
+	Queries []string `json:"queries" validate:"required,min=1,max=50"`
+}
+
+const (
+	// defaultMaxTitleChars and defaultMaxContentChars bound written
+	// articles unless SetArticleLimits changes them
+	defaultMaxTitleChars   = 200
+	defaultMaxContentChars = 50000
+
+	// maxKeywordsChars bounds the keywords of an imported article, which
+	// are sent with every prompt
+	maxKeywordsChars = 500
+)
+
+// updateArticleBody is the request body for updating an article. Lengths
+// are checked by validateArticle, as their limits are configurable.
+type updateArticleBody struct {
+	Title   *string `json:"title" validate:"required,notblank"`
+	Content *string `json:"content" validate:"required,notblank"`
+}
+
+// importArticleBody is one article of a bulk import, optionally with
+// comma-separated keywords for the AI to match on
+type importArticleBody struct {
+	updateArticleBody
+	Keywords string `json:"keywords"`
+}
+
+// importArticlesBody is the request body for a bulk import, capped at 1000
+// articles
+type importArticlesBody struct {
+	Articles []importArticleBody `json:"articles" validate:"required,min=1,max=1000"`
+}
+
+// validateArticle validates an article being written, including the
+// configured length limits. Title errors are listed before content errors.
+func (h *SearchHandler) validateArticle(body updateArticleBody) []models.FieldError {
+	var titleErrs, contentErrs []models.FieldError
+	for _, fieldErr := range validateRequest(body) {
+		if fieldErr.Field == "title" {
+			titleErrs = append(titleErrs, fieldErr)
+		} else {
+			contentErrs = append(contentErrs, fieldErr)
+		}
+	}
+
+	if len(titleErrs) == 0 && utf8.RuneCountInString(*body.Title) > h.maxTitleChars {
+		titleErrs = append(titleErrs, models.FieldError{
+			Field:   "title",
+			Message: fmt.Sprintf("title must be at most %d characters", h.maxTitleChars),
+		})
+	}
+	if len(contentErrs) == 0 && utf8.RuneCountInString(*body.Content) > h.maxContentChars {
+		contentErrs = append(contentErrs, models.FieldError{
+			Field:   "content",
+			Message: fmt.Sprintf("content must be at most %d characters", h.maxContentChars),
+		})
+	}
+	return append(titleErrs, contentErrs...)
+}
+
+// decodeRequest decodes and validates a JSON request body. If the body is
+// invalid an error response is sent and false is returned.
+func (h *SearchHandler) decodeRequest(w http.ResponseWriter, r *http.Request, body interface{}) bool {
+	if !h.readJSON(w, r, body) {
+		return false
 	}
 
 	// Validate request
-	if strings.TrimSpace(req.Query) == "" {
-		h.sendErrorResponse(w, http.StatusBadRequest, "Query is required", "")
+	if fieldErrs := validateRequest(body); len(fieldErrs) > 0 {
+		h.sendValidationError(w, r, fieldErrs)
+		return false
+	}
+	return true
+}
+
+// readJSON decodes a JSON request body without validating it. If the body
+// cannot be read or decoded an error response is sent and false is returned.
+func (h *SearchHandler) readJSON(w http.ResponseWriter, r *http.Request, body interface{}) bool {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			h.sendErrorResponse(w, r, http.StatusRequestEntityTooLarge, "Request body too large", "")
+			return false
+		}
+		h.sendErrorResponse(w, r, http.StatusBadRequest, "Invalid request body", err.Error())
+		return false
+	}
+
+	err = decodeJSON(data, body)
+	switch {
+	case errors.Is(err, errInvalidUTF8):
+		h.sendErrorResponse(w, r, http.StatusBadRequest, "Invalid UTF-8", err.Error())
+		return false
+	case err != nil:
+		h.sendErrorResponse(w, r, http.StatusBadRequest, "Invalid JSON", err.Error())
+		return false
+	}
+	return true
+}
+
+// errInvalidUTF8 is returned by decodeJSON for a body that is not UTF-8
+var errInvalidUTF8 = errors.New("request body must be valid UTF-8")
+
+// decodeJSON decodes a request body, rejecting unknown fields
+func decodeJSON(data []byte, body interface{}) error {
+	// The JSON decoder silently replaces malformed bytes, so check the raw
+	// body before they can reach storage or the AI prompt
+	if !utf8.Valid(data) {
+		return errInvalidUTF8
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(body)
+}
+
+// SearchQuery handles POST /search-query. Passing ?dry_run=true analyzes
+// the query without storing the query or its result, ?fields=summary
+// returns only the id and title of each article, ?format=html renders
+// article steps as HTML lists, and ?min_relevance drops articles the AI
+// scored below the threshold. Retries sent with the same Idempotency-Key
+// header return the original result. When provider overrides are allowed,
+// X-AI-Provider: mock uses the mock AI service. The request is checked by
+// ValidateSearchQuery.
+func (h *SearchHandler) SearchQuery(w http.ResponseWriter, r *http.Request) {
+	setNoStore(w)
+
+	req, ok := r.Context().Value(searchQueryRequestKey{}).(searchQueryRequest)
+	if !ok {
+		// Not routed through the middleware, so validate here
+		h.ValidateSearchQuery(http.HandlerFunc(h.SearchQuery)).ServeHTTP(w, r)
 		return
 	}
+	if !h.checkQuota(w, r, 1) {
+		return
+	}
+	opts := req.Options
+	opts.IdempotencyKey = r.Header.Get("Idempotency-Key")
 
 	// Process search query
-	response, err := h.searchService.ProcessSearchQuery(req.Query)
+	response, err := h.searchService.ProcessSearchQueryWithOptions(r.Context(), req.Query, opts)
+	if err != nil {
+		h.sendSearchError(w, r, "Failed to process search query", err)
+		return
+	}
+
+	response.Timestamp = h.inZone(response.Timestamp)
+	h.sendJSONResponse(w, r, http.StatusOK, h.searchResponseBody(r, response))
+}
+
+// EstimateSearchQuery handles POST /search-query/estimate, taking the same
+// body, query parameters and X-AI-Provider header as POST /search-query.
+// It returns the estimated prompt size and cost of the search without
+// calling the AI, so it does not count toward the search quota. The
+// request is checked by ValidateSearchQuery.
+func (h *SearchHandler) EstimateSearchQuery(w http.ResponseWriter, r *http.Request) {
+	setNoStore(w)
+
+	req, ok := r.Context().Value(searchQueryRequestKey{}).(searchQueryRequest)
+	if !ok {
+		// Not routed through the middleware, so validate here
+		h.ValidateSearchQuery(http.HandlerFunc(h.EstimateSearchQuery)).ServeHTTP(w, r)
+		return
+	}
+
+	estimate, err := h.searchService.EstimateSearchQuery(r.Context(), req.Query, req.Options)
 	if err != nil {
-		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to process search query", err.Error())
+		h.sendSearchError(w, r, "Failed to estimate search query", err)
 		return
 	}
 
-	h.sendJSONResponse(w, http.StatusOK, response)
+	h.sendJSONResponse(w, r, http.StatusOK, estimate)
 }
 
-// GetArticle handles GET /articles/{id}
+// searchQueryParams holds the query parameters of GET /search-query
+type searchQueryParams struct {
+	Q *string `json:"q" validate:"required,notblank,max=2000"`
+}
+
+// SharedSearch handles GET /search-query?q=..., so a search can be shared
+// as a link. It accepts the same options as the POST but never stores
+// anything, and answers 404 for searches that have not been computed yet
+// unless the server allows GETs to call the AI. It counts towards the
+// search quota like a POST.
+func (h *SearchHandler) SharedSearch(w http.ResponseWriter, r *http.Request) {
+	setNoStore(w)
+
+	var params searchQueryParams
+	if r.URL.Query().Has("q") {
+		q := r.URL.Query().Get("q")
+		params.Q = &q
+	}
+	if fieldErrs := validateRequest(params); len(fieldErrs) > 0 {
+		h.sendValidationError(w, r, fieldErrs)
+		return
+	}
+	if !utf8.ValidString(*params.Q) {
+		h.sendErrorResponse(w, r, http.StatusBadRequest, "Invalid UTF-8", "q must be valid UTF-8")
+		return
+	}
+
+	opts, ok := h.parseSearchOptions(w, r)
+	if !ok {
+		return
+	}
+	if !h.checkQuota(w, r, 1) {
+		return
+	}
+
+	response, err := h.searchService.ProcessSharedSearch(r.Context(), *params.Q, opts)
+	if errors.Is(err, service.ErrNotCached) {
+		h.sendErrorResponse(w, r, http.StatusNotFound, "Search not computed", "run this search with POST /api/search-query first")
+		return
+	}
+	if err != nil {
+		h.sendSearchError(w, r, "Failed to process search query", err)
+		return
+	}
+
+	response.Timestamp = h.inZone(response.Timestamp)
+	h.sendJSONResponse(w, r, http.StatusOK, h.searchResponseBody(r, response))
+}
+
+// SearchBatch handles POST /search-query/batch. Each query is processed
+// like a single search, accepting the same query parameters and
+// X-AI-Provider header, and succeeds or fails on its own. Results are
+// returned in the order the queries were sent.
+func (h *SearchHandler) SearchBatch(w http.ResponseWriter, r *http.Request) {
+	setNoStore(w)
+
+	var body batchSearchRequestBody
+	if !h.decodeRequest(w, r, &body) {
+		return
+	}
+
+	opts, ok := h.parseSearchOptions(w, r)
+	if !ok {
+		return
+	}
+
+	// Invalid queries fail on their own without reaching the service
+	results := make([]models.BatchSearchResult, len(body.Queries))
+	var queries []string
+	var positions []int
+	for i, query := range body.Queries {
+		results[i].Query = query
+		if fieldErrs := validateRequest(searchRequestBody{Query: &query}); len(fieldErrs) > 0 {
+			results[i].Error = fieldErrs[0].Message
+			continue
+		}
+		queries = append(queries, query)
+		positions = append(positions, i)
+	}
+
+	// Each query of a batch counts towards the quota
+	if !h.checkQuota(w, r, len(queries)) {
+		return
+	}
+
+	processed, err := h.searchService.ProcessSearchBatch(r.Context(), queries, opts)
+	if err != nil {
+		h.sendSearchError(w, r, "Failed to process search batch", err)
+		return
+	}
+	for i, result := range processed {
+		if result.Result != nil {
+			result.Result.Timestamp = h.inZone(result.Result.Timestamp)
+		}
+		results[positions[i]] = result
+	}
+
+	h.sendJSONResponse(w, r, http.StatusOK, h.batchResultsBody(r, results))
+}
+
+// parseSearchOptions reads the search query parameters and the
+// X-AI-Provider header. If any parameter is invalid a validation error
+// listing each of them is sent and false is returned.
+func (h *SearchHandler) parseSearchOptions(w http.ResponseWriter, r *http.Request) (service.SearchOptions, bool) {
+	opts, fieldErrs := searchOptionsFromRequest(r)
+	if len(fieldErrs) > 0 {
+		h.sendValidationError(w, r, fieldErrs)
+		return opts, false
+	}
+	return opts, true
+}
+
+// parseContentFormat reads the ?format parameter. If it is invalid an error
+// response is sent and false is returned.
+func (h *SearchHandler) parseContentFormat(w http.ResponseWriter, r *http.Request) (service.ContentFormat, bool) {
+	switch format := service.ContentFormat(r.URL.Query().Get("format")); format {
+	case "", service.ContentFormatText, service.ContentFormatHTML:
+		return format, true
+	default:
+		h.sendErrorResponse(w, r, http.StatusBadRequest, "Invalid format parameter", "format must be 'text' or 'html'")
+		return format, false
+	}
+}
+
+// sendSearchError maps a search failure to a status code: 400 for invalid
+// search options, 429 when too many AI analyses are queued, 503 when the AI
+// service timed out, 502 when it failed and 500 for storage and other
+// errors, which are reported under title
+func (h *SearchHandler) sendSearchError(w http.ResponseWriter, r *http.Request, title string, err error) {
+	var validationErr *service.ValidationError
+	var aiErr *service.AIError
+	switch {
+	case errors.Is(err, service.ErrAIBusy):
+		w.Header().Set("Retry-After", "1")
+		h.sendErrorResponse(w, r, http.StatusTooManyRequests, "Too many requests", err.Error())
+	case errors.Is(err, service.ErrUnknownProvider):
+		h.sendErrorResponse(w, r, http.StatusBadRequest, "Invalid X-AI-Provider header", err.Error())
+	case errors.Is(err, service.ErrInvalidRelevance):
+		h.sendErrorResponse(w, r, http.StatusBadRequest, "Invalid min_relevance parameter", err.Error())
+	case errors.Is(err, service.ErrUnknownArticle), errors.Is(err, service.ErrExcludedArticle):
+		h.sendErrorResponse(w, r, http.StatusBadRequest, "Invalid article_ids", err.Error())
+	case errors.Is(err, service.ErrSearchInProgress):
+		w.Header().Set("Retry-After", "1")
+		h.sendErrorResponse(w, r, http.StatusConflict, "Search in progress", err.Error())
+	case errors.Is(err, service.ErrIdempotencyKeyReused):
+		h.sendErrorResponse(w, r, http.StatusUnprocessableEntity, "Idempotency key reused", err.Error())
+	case errors.As(err, &validationErr):
+		h.sendErrorResponse(w, r, http.StatusBadRequest, "Invalid search request", err.Error())
+	case errors.As(err, &aiErr) && aiErr.Unavailable():
+		h.sendErrorResponse(w, r, http.StatusServiceUnavailable, "AI service unavailable", err.Error())
+	case errors.As(err, &aiErr):
+		h.sendErrorResponse(w, r, http.StatusBadGateway, "AI service error", err.Error())
+	default:
+		h.sendStorageError(w, r, title, err)
+	}
+}
+
+// sendStorageError answers a failed database operation: 503 with a
+// Retry-After header while the database is locked by another writer, and
+// 500 with the given title otherwise
+func (h *SearchHandler) sendStorageError(w http.ResponseWriter, r *http.Request, title string, err error) {
+	if errors.Is(err, service.ErrDatabaseBusy) {
+		w.Header().Set("Retry-After", "1")
+		h.sendErrorResponse(w, r, http.StatusServiceUnavailable, "Database busy", err.Error())
+		return
+	}
+	h.sendErrorResponse(w, r, http.StatusInternalServerError, title, err.Error())
+}
+
+// GetArticle handles GET /articles/{id}. Passing ?format=html renders the
+// content's numbered steps as an HTML list.
 func (h *SearchHandler) GetArticle(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid article ID", "")
+		h.sendErrorResponse(w, r, http.StatusBadRequest, "Invalid article ID", "")
 		return
 	}
 
-	article, err := h.searchService.GetArticleByID(id)
+	format, ok := h.parseContentFormat(w, r)
+	if !ok {
+		return
+	}
+
+	article, err := h.searchService.GetArticleByID(r.Context(), id)
 	if err != nil {
-		h.sendErrorResponse(w, http.StatusNotFound, "Article not found", "")
+		h.sendErrorResponse(w, r, http.StatusNotFound, "Article not found", "")
 		return
 	}
+	formatted := service.FormatArticles([]models.Article{*article}, format)[0]
 
-	h.sendJSONResponse(w, http.StatusOK, article)
+	h.setArticleCacheControl(w, r)
+	if checkNotModified(w, r, h.articlesETag(r, formatted)) {
+		return
+	}
+
+	h.sendJSONResponse(w, r, http.StatusOK, h.articleResponses(r, []models.Article{*article}, []models.Article{formatted})[0])
+}
+
+// UpdateArticle handles PUT /articles/{id}. The previous title and content
+// are kept in the article's history.
+func (h *SearchHandler) UpdateArticle(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		h.sendErrorResponse(w, r, http.StatusBadRequest, "Invalid article ID", "")
+		return
+	}
+
+	var body updateArticleBody
+	if !h.readJSON(w, r, &body) {
+		return
+	}
+	if fieldErrs := h.validateArticle(body); len(fieldErrs) > 0 {
+		h.sendValidationError(w, r, fieldErrs)
+		return
+	}
+
+	article, err := h.searchService.UpdateArticle(r.Context(), id, *body.Title, *body.Content)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			h.sendErrorResponse(w, r, http.StatusNotFound, "Article not found", "")
+			return
+		}
+		if errors.Is(err, service.ErrDuplicateTitle) {
+			h.sendErrorResponse(w, r, http.StatusConflict, "Duplicate article title", err.Error())
+			return
+		}
+		h.sendStorageError(w, r, "Failed to update article", err)
+		return
+	}
+
+	h.sendJSONResponse(w, r, http.StatusOK, article)
+}
+
+// GetArticleHistory handles GET /articles/{id}/history, returning the
+// previous versions of an article newest first. Past versions carry their
+// content, so clients without the API key are refused when it is not public.
+func (h *SearchHandler) GetArticleHistory(w http.ResponseWriter, r *http.Request) {
+	if h.restricted(r) && !h.publicFields["content"] {
+		h.sendErrorResponse(w, r, http.StatusUnauthorized, "Unauthorized", "API key is required")
+		return
+	}
+
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		h.sendErrorResponse(w, r, http.StatusBadRequest, "Invalid article ID", "")
+		return
+	}
+
+	history, err := h.searchService.GetArticleHistory(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			h.sendErrorResponse(w, r, http.StatusNotFound, "Article not found", "")
+			return
+		}
+		h.sendErrorResponse(w, r, http.StatusInternalServerError, "Failed to get article history", err.Error())
+		return
+	}
+
+	for i := range history {
+		history[i].EditedAt = h.inZone(history[i].EditedAt)
+	}
+	h.sendJSONResponse(w, r, http.StatusOK, history)
 }
 
-// GetAllArticles handles GET /articles
+// GetAllArticles handles GET /articles. Passing ?format=html renders each
+// article's numbered steps as an HTML list. All articles are returned
+// unless page or page_size is passed.
 func (h *SearchHandler) GetAllArticles(w http.ResponseWriter, r *http.Request) {
-	articles, err := h.searchService.GetAllArticles()
+	format, ok := h.parseContentFormat(w, r)
+	if !ok {
+		return
+	}
+
+	paginate := r.URL.Query().Has("page") || r.URL.Query().Has("page_size")
+	limit, offset, err := parsePagination(r, h.defaultPageSize, h.maxPageSize)
+	if paginate && err != nil {
+		h.sendErrorResponse(w, r, http.StatusBadRequest, "Invalid pagination parameters", err.Error())
+		return
+	}
+
+	articles, err := h.searchService.GetAllArticles(r.Context())
+	if err != nil {
+		h.sendErrorResponse(w, r, http.StatusInternalServerError, "Failed to get articles", err.Error())
+		return
+	}
+	if paginate {
+		articles = articles[min(offset, len(articles)):min(offset+limit, len(articles))]
+	}
+	formatted := service.FormatArticles(articles, format)
+
+	h.setArticleCacheControl(w, r)
+	if checkNotModified(w, r, h.articlesETag(r, formatted...)) {
+		return
+	}
+
+	h.sendJSONResponse(w, r, http.StatusOK, h.articleResponses(r, articles, formatted))
+}
+
+// exportFlushEvery is how many exported articles are written between
+// flushes, so a slow export still reaches the client steadily
+const exportFlushEvery = 100
+
+// ExportArticles handles GET /articles/export, streaming every article as
+// newline-delimited JSON, one article per line in ID order, for syncing the
+// knowledge base elsewhere. Articles are read a page at a time and written
+// one at a time. The export is not bound by the server's write timeout.
+func (h *SearchHandler) ExportArticles(w http.ResponseWriter, r *http.Request) {
+	// Articles are not categorized, so a category filter cannot be honored
+	// and exporting everything instead would surprise the caller
+	if r.URL.Query().Has("category") {
+		h.sendErrorResponse(w, r, http.StatusBadRequest, "Invalid filter", "articles have no categories to filter by")
+		return
+	}
+
+	// The write timeout is sized for ordinary responses, not for streaming
+	// the whole knowledge base. Writers that cannot lift it keep it.
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("[%s] Article export keeps the write timeout: %v", middleware.GetReqID(r.Context()), err)
+	}
+
+	// The status is only sent with the first article, so a failure to read
+	// any can still be answered with an error
+	started := false
+	start := func() {
+		started = true
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		setNoStore(w)
+		w.WriteHeader(http.StatusOK)
+	}
+
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	restricted := h.restricted(r)
+	written := 0
+	err := h.searchService.ExportArticles(r.Context(), func(article models.Article) error {
+		if !started {
+			start()
+		}
+		var line interface{} = article
+		if restricted {
+			line = publicExportArticle{articleView: h.publicArticle(article), Snippet: h.publicSnippet(article.Content)}
+		}
+		if err := encoder.Encode(line); err != nil {
+			return err
+		}
+		written++
+		if flusher != nil && written%exportFlushEvery == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if !started {
+			h.sendErrorResponse(w, r, http.StatusInternalServerError, "Failed to export articles", err.Error())
+			return
+		}
+		// The stream has already started, so the client sees it end early
+		log.Printf("Article export interrupted after %d articles: %v", written, err)
+		return
+	}
+	if !started {
+		start()
+	}
+}
+
+// articleSearchParams holds the query parameters of GET /articles/search
+type articleSearchParams struct {
+	Q *string `json:"q" validate:"required,notblank,max=2000"`
+}
+
+// SearchArticles handles GET /articles/search?q=..., a keyword search over
+// article titles and content that does not call the AI or record the
+// query. Results are ranked by how many words they match and paginated
+// like the other article lists; ?format=html is supported.
+func (h *SearchHandler) SearchArticles(w http.ResponseWriter, r *http.Request) {
+	var params articleSearchParams
+	if r.URL.Query().Has("q") {
+		q := r.URL.Query().Get("q")
+		params.Q = &q
+	}
+	if fieldErrs := validateRequest(params); len(fieldErrs) > 0 {
+		h.sendValidationError(w, r, fieldErrs)
+		return
+	}
+
+	limit, offset, err := parsePagination(r, h.defaultPageSize, h.maxPageSize)
 	if err != nil {
-		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to get articles", err.Error())
+		h.sendErrorResponse(w, r, http.StatusBadRequest, "Invalid pagination parameters", err.Error())
 		return
 	}
+	format, ok := h.parseContentFormat(w, r)
+	if !ok {
+		return
+	}
+
+	articles, err := h.searchService.SearchArticles(r.Context(), *params.Q, limit, offset)
+	if err != nil {
+		h.sendErrorResponse(w, r, http.StatusInternalServerError, "Failed to search articles", err.Error())
+		return
+	}
+
+	h.sendJSONResponse(w, r, http.StatusOK, h.articleResponses(r, articles, service.FormatArticles(articles, format)))
+}
 
-	h.sendJSONResponse(w, http.StatusOK, articles)
+// articleResponses pairs each formatted article with the word and
+// character counts of its stored content, so they do not depend on the
+// requested format. Clients without the API key only get the public fields.
+func (h *SearchHandler) articleResponses(r *http.Request, stored, formatted []models.Article) []articleResponse {
+	restricted := h.restricted(r)
+	responses := make([]articleResponse, len(formatted))
+	for i, article := range formatted {
+		response := models.ArticleResponse{
+			Article:   article,
+			WordCount: textutil.WordCount(stored[i].Content),
+			CharCount: utf8.RuneCountInString(stored[i].Content),
+		}
+		if restricted {
+			responses[i] = h.publicResponse(response, stored[i])
+		} else {
+			responses[i] = articleResponse{ArticleResponse: response, Content: &formatted[i].Content}
+		}
+	}
+	return responses
 }
 
-// HealthCheck handles GET /health
+// RecordArticleView handles POST /articles/{id}/view
+func (h *SearchHandler) RecordArticleView(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		h.sendErrorResponse(w, r, http.StatusBadRequest, "Invalid article ID", "")
+		return
+	}
+
+	if err := h.searchService.RecordArticleView(r.Context(), id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			h.sendErrorResponse(w, r, http.StatusNotFound, "Article not found", "")
+			return
+		}
+		h.sendStorageError(w, r, "Failed to record article view", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetPopularArticles handles GET /articles/popular
+func (h *SearchHandler) GetPopularArticles(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePagination(r, h.defaultPageSize, h.maxPageSize)
+	if err != nil {
+		h.sendErrorResponse(w, r, http.StatusBadRequest, "Invalid pagination parameters", err.Error())
+		return
+	}
+
+	articles, err := h.searchService.GetPopularArticles(r.Context(), limit, offset)
+	if err != nil {
+		h.sendErrorResponse(w, r, http.StatusInternalServerError, "Failed to get popular articles", err.Error())
+		return
+	}
+
+	for i := range articles {
+		articles[i].LastViewedAt = h.inZone(articles[i].LastViewedAt)
+	}
+	if !h.restricted(r) {
+		h.sendJSONResponse(w, r, http.StatusOK, articles)
+		return
+	}
+
+	public := make([]publicPopularArticle, len(articles))
+	for i, article := range articles {
+		view := h.publicArticle(article.Article)
+		article.Snippet = h.publicSnippet(article.Content)
+		article.Article = view.Article
+		public[i] = publicPopularArticle{PopularArticle: article, Content: view.Content}
+	}
+	h.sendJSONResponse(w, r, http.StatusOK, public)
+}
+
+// HealthCheck handles GET /health. With ?deep=true the AI backend is also
+// checked. The response is 503 only when the database is unavailable; a
+// degraded AI still returns 200 since articles can be read without it.
 func (h *SearchHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
-	response := map[string]string{
-		"status":  "healthy",
-		"service": "event-to-insight-backend",
+	deep := false
+	if value := r.URL.Query().Get("deep"); value != "" {
+		var err error
+		deep, err = strconv.ParseBool(value)
+		if err != nil {
+			h.sendErrorResponse(w, r, http.StatusBadRequest, "Invalid deep parameter", "deep must be true or false")
+			return
+		}
+	}
+
+	health := h.searchService.CheckHealth(r.Context(), deep)
+	health.Service = "event-to-insight-backend"
+	now := time.Now()
+	health.StartedAt = h.inZone(startTime)
+	health.Time = h.inZone(now)
+	health.UptimeSeconds = int64(now.Sub(startTime).Seconds())
+	health.InFlightRequests = h.inFlight.Active()
+
+	statusCode := http.StatusOK
+	if health.Status == models.HealthStatusUnhealthy {
+		statusCode = http.StatusServiceUnavailable
+	}
+	h.sendJSONResponse(w, r, statusCode, health)
+}
+
+// ReadyCheck handles GET /ready. It returns 503 while the startup warmup is
+// still running, so load balancers hold traffic until caches are primed.
+func (h *SearchHandler) ReadyCheck(w http.ResponseWriter, r *http.Request) {
+	if !h.searchService.Ready() {
+		h.sendJSONResponse(w, r, http.StatusServiceUnavailable, models.ReadyStatus{Status: models.ReadyStatusWarmingUp})
+		return
 	}
-	h.sendJSONResponse(w, http.StatusOK, response)
+	h.sendJSONResponse(w, r, http.StatusOK, models.ReadyStatus{Status: models.ReadyStatusReady})
 }
 
-// sendJSONResponse sends a JSON response
-func (h *SearchHandler) sendJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
+// sendJSONResponse sends a JSON response, wrapped with request metadata
+// when the response envelope is enabled
+func (h *SearchHandler) sendJSONResponse(w http.ResponseWriter, r *http.Request, statusCode int, data interface{}) {
+	if h.envelope {
+		data = models.DataEnvelope{
+			Data: data,
+			Meta: models.ResponseMeta{
+				RequestID: middleware.GetReqID(r.Context()),
+				Timestamp: h.inZone(time.Now()),
+			},
+		}
+	}
+	h.writeJSON(w, r, statusCode, data)
+}
+
+// writeJSON writes a JSON body. The body is encoded before anything is
+// written, so a value that cannot be encoded produces a clean 500 instead
+// of a success status with a truncated body.
+func (h *SearchHandler) writeJSON(w http.ResponseWriter, r *http.Request, statusCode int, data interface{}) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	if h.prettyJSON(r) {
+		encoder.SetIndent("", "  ")
+	}
+	if err := encoder.Encode(data); err != nil {
+		log.Printf("[%s] Failed to encode JSON response: %v", middleware.GetReqID(r.Context()), err)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		if h.envelope {
+			w.Write([]byte(`{"error":{"code":500,"message":"Failed to encode response"}}` + "\n"))
+		} else {
+			w.Write([]byte(`{"error":"Failed to encode response"}` + "\n"))
+		}
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(data)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		log.Printf("[%s] Failed to write JSON response: %v", middleware.GetReqID(r.Context()), err)
+	}
+}
+
+// prettyJSON reports whether a response body should be indented. The
+// ?pretty parameter wins over the configured default; a value that is not a
+// boolean is ignored rather than failing the request.
+func (h *SearchHandler) prettyJSON(r *http.Request) bool {
+	if pretty, err := strconv.ParseBool(r.URL.Query().Get("pretty")); err == nil {
+		return pretty
+	}
+	return h.pretty
+}
+
+// SendError writes an error response the way the handlers do, for
+// middleware that answers before a handler is reached. A nil handler uses
+// the default settings.
+func (h *SearchHandler) SendError(w http.ResponseWriter, r *http.Request, statusCode int, error string, message string) {
+	if h == nil {
+		h = NewSearchHandler(nil)
+	}
+	h.sendErrorResponse(w, r, statusCode, error, message)
 }
 
 // sendErrorResponse sends an error response
-func (h *SearchHandler) sendErrorResponse(w http.ResponseWriter, statusCode int, error string, message string) {
+func (h *SearchHandler) sendErrorResponse(w http.ResponseWriter, r *http.Request, statusCode int, error string, message string) {
 	response := models.ErrorResponse{
 		Error:   error,
 		Message: message,
 	}
-	h.sendJSONResponse(w, statusCode, response)
+	h.sendError(w, r, statusCode, response)
+}
+
+// sendValidationError sends a 400 response listing the fields that failed
+// validation. The first failure is also used as the message.
+func (h *SearchHandler) sendValidationError(w http.ResponseWriter, r *http.Request, fieldErrs []models.FieldError) {
+	response := models.ErrorResponse{
+		Error:   "Validation failed",
+		Message: fieldErrs[0].Message,
+		Fields:  fieldErrs,
+	}
+	h.sendError(w, r, http.StatusBadRequest, response)
+}
+
+// sendError writes an error response, converted to the envelope's error
+// format when the envelope is enabled. Fixed messages are translated to the
+// language the client prefers.
+func (h *SearchHandler) sendError(w http.ResponseWriter, r *http.Request, statusCode int, response models.ErrorResponse) {
+	lang := i18n.Negotiate(r.Header.Get("Accept-Language"), h.language)
+	response.Error = i18n.Translate(lang, response.Error)
+	response.Message = i18n.Translate(lang, response.Message)
+	w.Header().Set("Content-Language", lang)
+	w.Header().Add("Vary", "Accept-Language")
+
+	if !h.envelope {
+		h.writeJSON(w, r, statusCode, response)
+		return
+	}
+
+	h.writeJSON(w, r, statusCode, models.ErrorEnvelope{
+		Error: models.EnvelopeError{
+			Code:    statusCode,
+			Message: response.Error,
+			Detail:  response.Message,
+			Fields:  response.Fields,
+		},
+	})
 }
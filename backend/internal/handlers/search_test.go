@@ -1,20 +1,31 @@
 package handlers
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"event-to-insight/internal/ai"
+	"event-to-insight/internal/config"
 	"event-to-insight/internal/database"
 	"event-to-insight/internal/models"
 	"event-to-insight/internal/service"
+	"event-to-insight/internal/textutil"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -96,140 +107,2798 @@ func TestSearchHandler_SearchQuery(t *testing.T) {
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
+
+	decodeError := func(body string) (int, models.ErrorResponse) {
+		req := httptest.NewRequest("POST", "/search-query", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		handler.SearchQuery(w, req)
+
+		var response models.ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	t.Run("MissingQueryField", func(t *testing.T) {
+		code, response := decodeError(`{}`)
+
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, "query field is required", response.Message)
+		assert.Equal(t, []models.FieldError{{Field: "query", Message: "query field is required"}}, response.Fields)
+	})
+
+	t.Run("EmptyQueryField", func(t *testing.T) {
+		code, response := decodeError(`{"query":""}`)
+
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, "query cannot be empty", response.Message)
+	})
+
+	t.Run("WhitespaceQueryField", func(t *testing.T) {
+		code, response := decodeError(`{"query":"   "}`)
+
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, "query cannot be empty", response.Message)
+	})
+
+	t.Run("QueryTooLong", func(t *testing.T) {
+		code, response := decodeError(`{"query":"` + strings.Repeat("a", 2001) + `"}`)
+
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, "Validation failed", response.Error)
+		require.Len(t, response.Fields, 1)
+		assert.Equal(t, "query", response.Fields[0].Field)
+		assert.Equal(t, "query must be at most 2000 characters", response.Fields[0].Message)
+	})
+
+	t.Run("UnknownField", func(t *testing.T) {
+		code, response := decodeError(`{"querry":"vpn"}`)
+
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, "Invalid JSON", response.Error)
+		assert.Contains(t, response.Message, "querry")
+	})
+
+	t.Run("InvalidUTF8", func(t *testing.T) {
+		code, response := decodeError("{\"query\":\"vpn \xff\xfe setup\"}")
+
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, "Invalid UTF-8", response.Error)
+		assert.Equal(t, "request body must be valid UTF-8", response.Message)
+	})
+
+	t.Run("UnicodeQuery", func(t *testing.T) {
+		requestBody := models.SearchRequest{Query: "Wie setze ich mein Passwort zurück? 密码"}
+		body, err := json.Marshal(requestBody)
+		require.NoError(t, err)
+
+		req := httptest.NewRequest("POST", "/search-query", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		handler.SearchQuery(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.SearchResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, requestBody.Query, response.Query)
+	})
+}
+
+func TestSearchHandler_ProviderOverride(t *testing.T) {
+	dbPath := "test_handler_provider.db"
+	db, err := database.NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	defer os.Remove(dbPath)
+	defer db.Close()
+	require.NoError(t, db.Initialize())
+
+	cfg := config.DefaultConfig()
+	cfg.AllowProviderOverride = true
+	handler := NewSearchHandler(service.NewSearchServiceWithConfig(db, ai.NewMockAIService(), cfg))
+
+	search := func(provider string) int {
+		req := httptest.NewRequest("POST", "/search-query", strings.NewReader(`{"query":"vpn"}`))
+		req.Header.Set("X-AI-Provider", provider)
+		w := httptest.NewRecorder()
+
+		handler.SearchQuery(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, search("mock"))
+	assert.Equal(t, http.StatusBadRequest, search("unknown"))
+}
+
+func TestSearchHandler_ValidateSearchQuery(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	var reached bool
+	validated := handler.ValidateSearchQuery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	send := func(target, body string) (int, models.ErrorResponse) {
+		reached = false
+		req := httptest.NewRequest("POST", target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		validated.ServeHTTP(w, req)
+
+		var response models.ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	t.Run("ValidRequest", func(t *testing.T) {
+		code, _ := send("/search-query?dry_run=true&min_relevance=0.5&fields=summary&format=html", `{"query":"vpn"}`)
+
+		assert.Equal(t, http.StatusNoContent, code)
+		assert.True(t, reached)
+	})
+
+	t.Run("ListsEveryInvalidField", func(t *testing.T) {
+		code, response := send("/search-query?dry_run=maybe&min_relevance=2&fields=all&format=markdown", `{"query":"  "}`)
+
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.False(t, reached)
+		assert.Equal(t, "Validation failed", response.Error)
+		assert.Equal(t, "query cannot be empty", response.Message)
+		assert.Equal(t, []models.FieldError{
+			{Field: "query", Message: "query cannot be empty"},
+			{Field: "dry_run", Message: "dry_run must be true or false"},
+			{Field: "min_relevance", Message: "min_relevance must be between 0 and 1"},
+			{Field: "fields", Message: "fields must be one of: full, summary"},
+			{Field: "format", Message: "format must be one of: text, html"},
+		}, response.Fields)
+	})
+
+	t.Run("InvalidParametersWithValidBody", func(t *testing.T) {
+		code, response := send("/search-query?min_relevance=abc&fields=all", `{"query":"vpn"}`)
+
+		assert.Equal(t, http.StatusBadRequest, code)
+		require.Len(t, response.Fields, 2)
+		assert.Equal(t, "min_relevance", response.Fields[0].Field)
+		assert.Equal(t, "fields", response.Fields[1].Field)
+	})
+
+	t.Run("MalformedBody", func(t *testing.T) {
+		code, response := send("/search-query?dry_run=maybe", `{"query":`)
+
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.False(t, reached)
+		assert.Equal(t, "Invalid JSON", response.Error)
+	})
+}
+
+func TestSearchHandler_DryRun(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	search := func(target string) *httptest.ResponseRecorder {
+		body := []byte(`{"query":"How do I reset my password?"}`)
+		req := httptest.NewRequest("POST", target, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.SearchQuery(w, req)
+		return w
+	}
+
+	t.Run("DryRunResponse", func(t *testing.T) {
+		w := search("/search-query?dry_run=true")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.SearchResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.True(t, response.DryRun)
+		assert.Equal(t, 0, response.QueryID)
+		assert.Equal(t, 0, response.ResultID)
+		assert.NotEmpty(t, response.AIRelevantArticles)
+	})
+
+	t.Run("RegularResponse", func(t *testing.T) {
+		w := search("/search-query")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), "dry_run")
+
+		var response models.SearchResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.NotZero(t, response.ResultID)
+	})
+
+	t.Run("InvalidDryRunValue", func(t *testing.T) {
+		w := search("/search-query?dry_run=perhaps")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestSearchHandler_SharedSearch(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		w := httptest.NewRecorder()
+		handler.SharedSearch(w, req)
+		return w
+	}
+
+	t.Run("NotComputed", func(t *testing.T) {
+		w := get("/search-query?q=" + url.QueryEscape("How do I set up VPN?"))
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		var response models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "Search not computed", response.Error)
+	})
+
+	t.Run("ServedFromCache", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/search-query", strings.NewReader(`{"query":"How do I set up VPN?"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.SearchQuery(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var posted models.SearchResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &posted))
+
+		w = get("/search-query?q=" + url.QueryEscape("how do i set up vpn"))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var shared models.SearchResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &shared))
+		assert.Equal(t, posted.AISummaryAnswer, shared.AISummaryAnswer)
+		assert.True(t, shared.DryRun)
+		assert.Zero(t, shared.QueryID)
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		testCases := []struct {
+			target  string
+			message string
+		}{
+			{"/search-query", "q field is required"},
+			{"/search-query?q=", "q cannot be empty"},
+			{"/search-query?q=" + strings.Repeat("a", 2001), "q must be at most 2000 characters"},
+		}
+
+		for _, tc := range testCases {
+			w := get(tc.target)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, tc.target)
+			var response models.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			require.Len(t, response.Fields, 1, tc.target)
+			assert.Equal(t, "q", response.Fields[0].Field)
+			assert.Equal(t, tc.message, response.Fields[0].Message)
+		}
+	})
+
+	t.Run("InvalidUTF8", func(t *testing.T) {
+		w := get("/search-query?q=vpn%ff")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		w := get("/search-query?q=vpn&fields=everything")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestSearchHandler_SearchBatch(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	searchBatch := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/search-query/batch", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.SearchBatch(w, req)
+		return w
+	}
+
+	t.Run("MixedResults", func(t *testing.T) {
+		w := searchBatch(`{"queries": ["How do I reset my password?", "   ", "VPN not connecting"]}`)
+
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var results []models.BatchSearchResult
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &results))
+		require.Len(t, results, 3)
+
+		require.NotNil(t, results[0].Result)
+		assert.Equal(t, "How do I reset my password?", results[0].Result.Query)
+		assert.NotEmpty(t, results[0].Result.AIRelevantArticles)
+
+		assert.Nil(t, results[1].Result)
+		assert.Equal(t, "query cannot be empty", results[1].Error)
+
+		require.NotNil(t, results[2].Result)
+		assert.Equal(t, "VPN not connecting", results[2].Result.Query)
+		assert.Empty(t, results[2].Error)
+	})
+
+	t.Run("KeepsOrder", func(t *testing.T) {
+		queries := make([]string, 20)
+		for i := range queries {
+			queries[i] = fmt.Sprintf("question %d about email", i)
+		}
+		body, _ := json.Marshal(map[string][]string{"queries": queries})
+
+		w := searchBatch(string(body))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var results []models.BatchSearchResult
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &results))
+		require.Len(t, results, len(queries))
+		for i, result := range results {
+			assert.Equal(t, queries[i], result.Query)
+			require.NotNil(t, result.Result)
+			assert.Equal(t, queries[i], result.Result.Query)
+		}
+	})
+
+	t.Run("InvalidBatches", func(t *testing.T) {
+		tooMany, _ := json.Marshal(map[string][]string{"queries": make([]string, 51)})
+
+		testCases := map[string]string{
+			"missing":  `{}`,
+			"empty":    `{"queries": []}`,
+			"tooMany":  string(tooMany),
+			"notArray": `{"queries": "vpn"}`,
+		}
+		for name, body := range testCases {
+			w := searchBatch(body)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, name)
+		}
+
+		w := searchBatch(string(tooMany))
+		assert.Contains(t, w.Body.String(), "queries must be at most 50 items")
+	})
+}
+
+func TestSearchHandler_MinRelevance(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	search := func(target string) *httptest.ResponseRecorder {
+		body := []byte(`{"query":"How do I reset my password?"}`)
+		req := httptest.NewRequest("POST", target, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.SearchQuery(w, req)
+		return w
+	}
+
+	t.Run("DropsWeakMatches", func(t *testing.T) {
+		var all, strong models.SearchResponse
+
+		w := search("/search-query?dry_run=true")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &all))
+
+		// Only the password article mentions the keyword in its title
+		w = search("/search-query?dry_run=true&min_relevance=0.8")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &strong))
+
+		assert.Greater(t, len(all.AIRelevantArticles), 1)
+		require.Len(t, strong.AIRelevantArticles, 1)
+		assert.Equal(t, "Password Reset Instructions", strong.AIRelevantArticles[0].Title)
+	})
+
+	t.Run("InvalidValues", func(t *testing.T) {
+		for _, value := range []string{"-0.1", "1.5", "high", "NaN"} {
+			w := search("/search-query?min_relevance=" + value)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, value)
+		}
+	})
+}
+
+func TestSearchHandler_ArticleScope(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	search := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/search-query?dry_run=true", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.SearchQuery(w, req)
+		return w
+	}
+
+	t.Run("ScopedSearch", func(t *testing.T) {
+		w := search(`{"query": "How do I reset my password?", "article_ids": [2, 3]}`)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response models.SearchResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, 2, response.ArticlesConsidered)
+		for _, article := range response.AIRelevantArticles {
+			assert.Contains(t, []int{2, 3}, article.ID)
+		}
+	})
+
+	t.Run("UnknownArticles", func(t *testing.T) {
+		w := search(`{"query": "How do I reset my password?", "article_ids": [2, 999]}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "Invalid article_ids")
+		assert.Contains(t, w.Body.String(), "999")
+	})
+
+	t.Run("InvalidIDs", func(t *testing.T) {
+		for body, message := range map[string]string{
+			`{"query": "vpn", "article_ids": [0]}`:    "article_ids[0] must be greater than 0",
+			`{"query": "vpn", "article_ids": [2, 2]}`: "article_ids must not contain duplicates",
+		} {
+			w := search(body)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, body)
+			assert.Contains(t, w.Body.String(), message, body)
+		}
+	})
+}
+
+func TestSearchHandler_Fields(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	search := func(target string) *httptest.ResponseRecorder {
+		body := []byte(`{"query":"How do I reset my password?"}`)
+		req := httptest.NewRequest("POST", target, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.SearchQuery(w, req)
+		return w
+	}
+
+	t.Run("SummaryIsSmaller", func(t *testing.T) {
+		full := search("/search-query?fields=full")
+		summary := search("/search-query?fields=summary")
+
+		assert.Equal(t, http.StatusOK, full.Code)
+		assert.Equal(t, http.StatusOK, summary.Code)
+		assert.Less(t, summary.Body.Len(), full.Body.Len())
+
+		var response struct {
+			Query              string                   `json:"query"`
+			AIRelevantArticles []map[string]interface{} `json:"ai_relevant_articles"`
+		}
+		assert.NoError(t, json.Unmarshal(summary.Body.Bytes(), &response))
+		assert.NotEmpty(t, response.Query)
+		require.NotEmpty(t, response.AIRelevantArticles)
+		assert.NotEmpty(t, response.AIRelevantArticles[0]["title"])
+		assert.NotContains(t, response.AIRelevantArticles[0], "content")
+	})
+
+	t.Run("FullByDefault", func(t *testing.T) {
+		w := search("/search-query")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response models.SearchResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.NotEmpty(t, response.AIRelevantArticles)
+		assert.NotEmpty(t, response.AIRelevantArticles[0].Content)
+	})
+
+	t.Run("SummaryOfBatch", func(t *testing.T) {
+		body := []byte(`{"queries":["How do I reset my password?","VPN configuration guide"]}`)
+		req := httptest.NewRequest("POST", "/search-query/batch?fields=summary", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.SearchBatch(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var results []struct {
+			Result struct {
+				AIRelevantArticles []map[string]interface{} `json:"ai_relevant_articles"`
+				SuggestedArticles  []map[string]interface{} `json:"suggested_articles"`
+			} `json:"result"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &results))
+		require.Len(t, results, 2)
+		for _, result := range results {
+			for _, article := range append(result.Result.AIRelevantArticles, result.Result.SuggestedArticles...) {
+				assert.Contains(t, article, "title")
+				assert.NotContains(t, article, "content")
+			}
+		}
+	})
+
+	t.Run("InvalidFields", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, search("/search-query?fields=everything").Code)
+	})
+}
+
+func TestSearchHandler_ContentFormat(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	getArticle := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", "1")
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		handler.GetArticle(w, req)
+		return w
+	}
+
+	t.Run("TextByDefault", func(t *testing.T) {
+		for _, target := range []string{"/articles/1", "/articles/1?format=text"} {
+			w := getArticle(target)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			var article models.Article
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &article))
+			assert.NotContains(t, article.Content, "<ol>", target)
+			assert.Contains(t, article.Content, "1) ", target)
+		}
+	})
+
+	t.Run("ArticleAsHTML", func(t *testing.T) {
+		w := getArticle("/articles/1?format=html")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var article models.Article
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &article))
+		assert.True(t, strings.HasPrefix(article.Content, "<p>"), article.Content)
+		assert.Contains(t, article.Content, "<ol><li>")
+		assert.NotContains(t, article.Content, "1) ")
+
+		// The HTML rendering is a different representation
+		assert.NotEqual(t, getArticle("/articles/1").Header().Get("ETag"), w.Header().Get("ETag"))
+	})
+
+	t.Run("AllArticlesAsHTML", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/articles?format=html", nil)
+		w := httptest.NewRecorder()
+		handler.GetAllArticles(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var articles []models.Article
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &articles))
+		require.NotEmpty(t, articles)
+		for _, article := range articles {
+			assert.Contains(t, article.Content, "<ol><li>", article.Title)
+		}
+	})
+
+	t.Run("SearchResultsAsHTML", func(t *testing.T) {
+		body := []byte(`{"query":"How do I reset my password?"}`)
+		req := httptest.NewRequest("POST", "/search-query?dry_run=true&format=html", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.SearchQuery(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response models.SearchResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.NotEmpty(t, response.AIRelevantArticles)
+		assert.Contains(t, response.AIRelevantArticles[0].Content, "<ol><li>")
+	})
+
+	t.Run("InvalidFormat", func(t *testing.T) {
+		w := getArticle("/articles/1?format=markdown")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		var response models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "Invalid format parameter", response.Error)
+	})
+}
+
+func TestSearchHandler_GetAllArticles(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	req := httptest.NewRequest("GET", "/articles", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetAllArticles(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var articles []models.Article
+	err := json.Unmarshal(w.Body.Bytes(), &articles)
+	assert.NoError(t, err)
+	assert.Greater(t, len(articles), 0)
+
+	t.Run("WordAndCharCounts", func(t *testing.T) {
+		var counted []models.ArticleResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &counted))
+
+		for _, article := range counted {
+			assert.Equal(t, textutil.WordCount(article.Content), article.WordCount)
+			assert.Equal(t, utf8.RuneCountInString(article.Content), article.CharCount)
+		}
+		// "To reset your password: 1) Go to the login page ..."
+		assert.Equal(t, 42, counted[0].WordCount)
+	})
+
+	t.Run("Paginated", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.GetAllArticles(w, httptest.NewRequest("GET", "/articles?page=2&page_size=3", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var page []models.Article
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		assert.Equal(t, articles[3:6], page)
+	})
+
+	t.Run("PastTheEnd", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.GetAllArticles(w, httptest.NewRequest("GET", "/articles?page=50", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, "[]", w.Body.String())
+	})
+
+	t.Run("InvalidPage", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.GetAllArticles(w, httptest.NewRequest("GET", "/articles?page=0", nil))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestSearchHandler_ExportArticles(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	t.Run("AllArticlesAsNDJSON", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.ExportArticles(w, httptest.NewRequest("GET", "/articles/export", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+		var exported []models.Article
+		scanner := bufio.NewScanner(w.Body)
+		for scanner.Scan() {
+			var article models.Article
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &article))
+			exported = append(exported, article)
+		}
+		require.NoError(t, scanner.Err())
+
+		require.Len(t, exported, 10)
+		for i := 1; i < len(exported); i++ {
+			assert.Less(t, exported[i-1].ID, exported[i].ID)
+		}
+		assert.Equal(t, "Password Reset Instructions", exported[0].Title)
+		assert.NotEmpty(t, exported[0].Content)
+	})
+
+	t.Run("CategoryFilterRejected", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.ExportArticles(w, httptest.NewRequest("GET", "/articles/export?category=network", nil))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "no categories")
+	})
+}
+
+func TestSearchHandler_SearchArticles(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		w := httptest.NewRecorder()
+		handler.SearchArticles(w, req)
+		return w
+	}
+
+	t.Run("Matches", func(t *testing.T) {
+		w := get("/articles/search?q=" + url.QueryEscape("VPN connection"))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var articles []models.Article
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &articles))
+		require.NotEmpty(t, articles)
+		assert.Contains(t, articles[0].Title, "VPN")
+		for i := 1; i < len(articles); i++ {
+			assert.GreaterOrEqual(t, articles[i-1].Score, articles[i].Score)
+		}
+	})
+
+	t.Run("NoMatches", func(t *testing.T) {
+		w := get("/articles/search?q=kubernetes")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, "[]", w.Body.String())
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		w := get("/articles/search?q=password&page_size=1")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var articles []models.Article
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &articles))
+		assert.Len(t, articles, 1)
+	})
+
+	t.Run("OutOfRangePageSize", func(t *testing.T) {
+		w := get("/articles/search?q=password&page_size=1000")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("MissingQuery", func(t *testing.T) {
+		for _, target := range []string{"/articles/search", "/articles/search?q=%20"} {
+			w := get(target)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, target)
+			var response models.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, "q", response.Fields[0].Field)
+		}
+	})
+}
+
+// gatedAIService holds every analysis until release is closed
+type gatedAIService struct {
+	release chan struct{}
+}
+
+func (g gatedAIService) AnalyzeQuery(ctx context.Context, query string, articles []models.Article) (*ai.AIAnalysisResult, error) {
+	<-g.release
+	return ai.NewMockAIService().AnalyzeQuery(ctx, query, articles)
+}
+
+func TestSearchHandler_EstimateSearchQuery(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	estimate := func(t *testing.T, body string) (*httptest.ResponseRecorder, models.SearchEstimate) {
+		req := httptest.NewRequest("POST", "/search-query/estimate", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.EstimateSearchQuery(w, req)
+
+		var response models.SearchEstimate
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		}
+		return w, response
+	}
+
+	t.Run("ScalesWithKnowledgeBase", func(t *testing.T) {
+		w, before := estimate(t, `{"query": "How do I reset my password?"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		assert.Equal(t, 10, before.ArticlesConsidered)
+		assert.Greater(t, before.EstimatedInputTokens, 0)
+		assert.Greater(t, before.EstimatedCost, 0.0)
+
+		req := httptest.NewRequest("POST", "/admin/articles/import", strings.NewReader(`{"articles": [
+			{"title": "Docking Stations", "content": "`+strings.Repeat("Plug the dock into the USB-C port. ", 30)+`"}
+		]}`))
+		req.Header.Set("Content-Type", "application/json")
+		imported := httptest.NewRecorder()
+		handler.ImportArticles(imported, req)
+		require.Equal(t, http.StatusCreated, imported.Code, imported.Body.String())
+
+		w, after := estimate(t, `{"query": "How do I reset my password?"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 11, after.ArticlesConsidered)
+		assert.Greater(t, after.EstimatedInputTokens, before.EstimatedInputTokens)
+		assert.Greater(t, after.EstimatedCost, before.EstimatedCost)
+
+		// Nothing is searched or stored
+		stats, err := handler.searchService.GetStats(context.Background())
+		require.NoError(t, err)
+		assert.Zero(t, stats.TotalQueries)
+	})
+
+	t.Run("ScopedArticles", func(t *testing.T) {
+		w, response := estimate(t, `{"query": "vpn", "article_ids": [1, 2]}`)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 2, response.ArticlesConsidered)
+	})
+
+	t.Run("InvalidQuery", func(t *testing.T) {
+		w, _ := estimate(t, `{"query": "  "}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestSearchHandler_CheckSearchQuery(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	check := func(t *testing.T, body string) models.QueryValidation {
+		req := httptest.NewRequest("POST", "/search-query/validate", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.CheckSearchQuery(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"errors":`)
+		var response models.QueryValidation
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		response := check(t, `{"query": "How do I reset my password?"}`)
+
+		assert.True(t, response.Valid)
+		assert.Empty(t, response.Errors)
+
+		// Nothing is searched or stored
+		stats, err := handler.searchService.GetStats(context.Background())
+		require.NoError(t, err)
+		assert.Zero(t, stats.TotalQueries)
+	})
+
+	invalid := []struct {
+		name  string
+		body  string
+		error string
+	}{
+		{"Empty", `{"query": ""}`, "query cannot be empty"},
+		{"Whitespace", `{"query": "  \t\n "}`, "query cannot be empty"},
+		{"Missing", `{}`, "query field is required"},
+		{"TooLong", `{"query": "` + strings.Repeat("a", 2001) + `"}`, "query must be at most 2000 characters"},
+		{"InvalidUTF8", "{\"query\": \"\xff\xfe\"}", "request body must be valid UTF-8"},
+		{"InvalidJSON", `{"query": `, "request body is not valid JSON"},
+		{"UnknownField", `{"query": "vpn", "extra": true}`, "request body is not valid JSON"},
+		{"DuplicateArticleIDs", `{"query": "vpn", "article_ids": [1, 1]}`, "article_ids must not contain duplicates"},
+	}
+	for _, tc := range invalid {
+		t.Run(tc.name, func(t *testing.T) {
+			response := check(t, tc.body)
+
+			assert.False(t, response.Valid)
+			require.Len(t, response.Errors, 1)
+			assert.Contains(t, response.Errors[0], tc.error)
+		})
+	}
+
+	t.Run("BodyTooLarge", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/search-query/validate", strings.NewReader(`{"query": "vpn"}`))
+		w := httptest.NewRecorder()
+		req.Body = http.MaxBytesReader(w, req.Body, 4)
+		handler.CheckSearchQuery(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response models.QueryValidation
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.False(t, response.Valid)
+		assert.Equal(t, []string{"request body is too large"}, response.Errors)
+	})
+}
+
+func TestSearchHandler_ReadyCheck(t *testing.T) {
+	dbPath := "test_ready.db"
+	db, err := database.NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	require.NoError(t, db.Initialize())
+	defer func() {
+		db.Close()
+		os.Remove(dbPath)
+	}()
+
+	aiService := gatedAIService{release: make(chan struct{})}
+	searchService := service.NewSearchService(db, aiService)
+	handler := NewSearchHandler(searchService)
+
+	ready := func() (int, models.ReadyStatus) {
+		req := httptest.NewRequest("GET", "/ready", nil)
+		w := httptest.NewRecorder()
+		handler.ReadyCheck(w, req)
+
+		var response models.ReadyStatus
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+
+	code, response := ready()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, models.ReadyStatusReady, response.Status)
+
+	done := searchService.StartWarmup(context.Background(), []string{"vpn setup"})
+
+	code, response = ready()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, models.ReadyStatusWarmingUp, response.Status)
+
+	close(aiService.release)
+	<-done
+
+	code, response = ready()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, models.ReadyStatusReady, response.Status)
+}
+
+// unreachableAIService analyzes queries like the mock but fails health checks
+type unreachableAIService struct {
+	*ai.MockAIService
+}
+
+func (unreachableAIService) Ping(ctx context.Context) error {
+	return errors.New("connection refused")
+}
+
+func TestSearchHandler_HealthCheck(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	t.Run("Shallow", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/health", nil)
+		w := httptest.NewRecorder()
+
+		handler.HealthCheck(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.HealthStatus
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, "healthy", response.Status)
+		assert.Equal(t, "event-to-insight-backend", response.Service)
+		assert.Equal(t, map[string]string{"database": "ok"}, response.Dependencies)
+	})
+
+	t.Run("Deep", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/health?deep=true", nil)
+		w := httptest.NewRecorder()
+
+		handler.HealthCheck(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.HealthStatus
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "ok", response.Dependencies["database"])
+		assert.Equal(t, "ok", response.Dependencies["ai"])
+		assert.Contains(t, response.Dependencies, "disk")
+		assert.Contains(t, w.Body.String(), `"disk_free_bytes":`)
+		assert.NotNil(t, response.DiskFreeBytes)
+	})
+
+	t.Run("Uptime", func(t *testing.T) {
+		original := startTime
+		defer SetStartTime(original)
+		SetStartTime(time.Now().Add(-90 * time.Second))
+
+		req := httptest.NewRequest("GET", "/health", nil)
+		w := httptest.NewRecorder()
+
+		handler.HealthCheck(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"uptime_seconds":`)
+
+		var response models.HealthStatus
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "healthy", response.Status)
+		assert.GreaterOrEqual(t, response.UptimeSeconds, int64(90))
+		assert.False(t, response.StartedAt.IsZero())
+		assert.False(t, response.Time.Before(response.StartedAt))
+		assert.WithinDuration(t, time.Now(), response.Time, 5*time.Second)
+	})
+
+	t.Run("InvalidDeep", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/health?deep=maybe", nil)
+		w := httptest.NewRecorder()
+
+		handler.HealthCheck(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("AIUnreachable", func(t *testing.T) {
+		dbPath := "test_health_ai.db"
+		db, err := database.NewSQLiteDB(dbPath)
+		require.NoError(t, err)
+		defer os.Remove(dbPath)
+		defer db.Close()
+		require.NoError(t, db.Initialize())
+
+		handler := NewSearchHandler(service.NewSearchService(db, unreachableAIService{ai.NewMockAIService()}))
+
+		req := httptest.NewRequest("GET", "/health?deep=true", nil)
+		w := httptest.NewRecorder()
+
+		handler.HealthCheck(w, req)
+
+		// Reads still work without the AI, so the service stays up
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.HealthStatus
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "degraded", response.Status)
+		assert.Equal(t, "ok", response.Dependencies["database"])
+		assert.Equal(t, "degraded", response.Dependencies["ai"])
+		require.Len(t, response.Warnings, 1)
+		assert.Contains(t, response.Warnings[0], "connection refused")
+	})
+
+	t.Run("DatabaseDown", func(t *testing.T) {
+		dbPath := "test_health_db.db"
+		db, err := database.NewSQLiteDB(dbPath)
+		require.NoError(t, err)
+		defer os.Remove(dbPath)
+		require.NoError(t, db.Close())
+
+		handler := NewSearchHandler(service.NewSearchService(db, ai.NewMockAIService()))
+
+		req := httptest.NewRequest("GET", "/health", nil)
+		w := httptest.NewRecorder()
+
+		handler.HealthCheck(w, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+		var response models.HealthStatus
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "unhealthy", response.Status)
+		assert.Equal(t, "unavailable", response.Dependencies["database"])
+	})
+}
+
+// erroringAIService fails every analysis with err
+type erroringAIService struct {
+	err error
+}
+
+func (s erroringAIService) AnalyzeQuery(ctx context.Context, query string, articles []models.Article) (*ai.AIAnalysisResult, error) {
+	return nil, s.err
+}
+
+// waitingAIService answers only once ctx is done, as a provider that never
+// responds would
+type waitingAIService struct{}
+
+func (waitingAIService) AnalyzeQuery(ctx context.Context, query string, articles []models.Article) (*ai.AIAnalysisResult, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// busyDB fails every write as if another writer kept the database locked
+type busyDB struct {
+	database.DatabaseInterface
+}
+
+func (busyDB) CreateQuery(ctx context.Context, query string) (*models.Query, error) {
+	return nil, database.ErrBusy
+}
+
+func (busyDB) RecordArticleView(ctx context.Context, articleID int) error {
+	return database.ErrBusy
+}
+
+func (busyDB) GetResultByShareToken(ctx context.Context, token string) (*models.SearchResult, error) {
+	return nil, database.ErrBusy
+}
+
+func TestSearchHandler_SearchErrors(t *testing.T) {
+	search := func(handler *SearchHandler, target string) (int, models.ErrorResponse) {
+		req := httptest.NewRequest("POST", target, strings.NewReader(`{"query":"vpn"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.SearchQuery(w, req)
+
+		var response models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+
+	newHandler := func(t *testing.T, aiService ai.AIServiceInterface) *SearchHandler {
+		dbPath := "test_search_errors.db"
+		db, err := database.NewSQLiteDB(dbPath)
+		require.NoError(t, err)
+		require.NoError(t, db.Initialize())
+		t.Cleanup(func() {
+			db.Close()
+			os.Remove(dbPath)
+		})
+		return NewSearchHandler(service.NewSearchService(db, aiService))
+	}
+
+	t.Run("AIFailureIsBadGateway", func(t *testing.T) {
+		handler := newHandler(t, erroringAIService{errors.New("invalid API key")})
+
+		code, response := search(handler, "/search-query")
+
+		assert.Equal(t, http.StatusBadGateway, code)
+		assert.Equal(t, "AI service error", response.Error)
+		assert.Contains(t, response.Message, "invalid API key")
+	})
+
+	t.Run("AITimeoutIsServiceUnavailable", func(t *testing.T) {
+		handler := newHandler(t, erroringAIService{fmt.Errorf("generate content: %w", context.DeadlineExceeded)})
+
+		code, response := search(handler, "/search-query")
+
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, "AI service unavailable", response.Error)
+	})
+
+	t.Run("ExpiredDeadlineIsServiceUnavailable", func(t *testing.T) {
+		handler := newHandler(t, waitingAIService{})
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		req := httptest.NewRequest("POST", "/search-query", strings.NewReader(`{"query":"vpn"}`)).WithContext(ctx)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.SearchQuery(w, req)
+
+		var response models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "AI service unavailable", response.Error)
+	})
+
+	t.Run("StorageFailureIsInternalError", func(t *testing.T) {
+		dbPath := "test_search_errors_closed.db"
+		db, err := database.NewSQLiteDB(dbPath)
+		require.NoError(t, err)
+		defer os.Remove(dbPath)
+		require.NoError(t, db.Close())
+		handler := NewSearchHandler(service.NewSearchService(db, ai.NewMockAIService()))
+
+		code, response := search(handler, "/search-query")
+
+		assert.Equal(t, http.StatusInternalServerError, code)
+		assert.Equal(t, "Failed to process search query", response.Error)
+		assert.Contains(t, response.Message, "failed to get articles")
+	})
+
+	t.Run("DatabaseBusyIsServiceUnavailable", func(t *testing.T) {
+		dbPath := "test_search_errors_busy.db"
+		db, err := database.NewSQLiteDB(dbPath)
+		require.NoError(t, err)
+		require.NoError(t, db.Initialize())
+		defer func() {
+			db.Close()
+			os.Remove(dbPath)
+		}()
+		handler := NewSearchHandler(service.NewSearchService(busyDB{db}, ai.NewMockAIService()))
+
+		req := httptest.NewRequest("POST", "/search-query", strings.NewReader(`{"query":"vpn"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.SearchQuery(w, req)
+
+		var response models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "1", w.Header().Get("Retry-After"))
+		assert.Equal(t, "Database busy", response.Error)
+
+		req = httptest.NewRequest("POST", "/articles/1/view", nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", "1")
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		w = httptest.NewRecorder()
+		handler.RecordArticleView(w, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	})
+
+	t.Run("AIBusyIsTooManyRequests", func(t *testing.T) {
+		handler := newHandler(t, ai.NewMockAIService())
+		w := httptest.NewRecorder()
+
+		handler.sendSearchError(w, httptest.NewRequest("POST", "/search-query", nil), "Failed to process search query", service.ErrAIBusy)
+
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	})
+
+	t.Run("SearchInProgressIsConflict", func(t *testing.T) {
+		handler := newHandler(t, ai.NewMockAIService())
+		w := httptest.NewRecorder()
+
+		handler.sendSearchError(w, httptest.NewRequest("POST", "/search-query", nil), "Failed to process search query", service.ErrSearchInProgress)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	})
+
+	t.Run("IdempotencyKeyReusedIsUnprocessable", func(t *testing.T) {
+		handler := newHandler(t, ai.NewMockAIService())
+		send := func(body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("POST", "/search-query", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Idempotency-Key", "reused")
+			w := httptest.NewRecorder()
+			handler.SearchQuery(w, req)
+			return w
+		}
+
+		require.Equal(t, http.StatusOK, send(`{"query":"vpn"}`).Code)
+		assert.Equal(t, http.StatusOK, send(`{"query":"vpn"}`).Code)
+
+		w := send(`{"query":"printer"}`)
+		var response models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, "Idempotency key reused", response.Error)
+	})
+
+	t.Run("InvalidOptionsAreBadRequest", func(t *testing.T) {
+		handler := newHandler(t, ai.NewMockAIService())
+
+		code, response := search(handler, "/search-query?min_relevance=2")
+
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, "Validation failed", response.Error)
+		assert.Equal(t, []models.FieldError{{Field: "min_relevance", Message: "min_relevance must be between 0 and 1"}}, response.Fields)
+	})
+}
+
+func TestSearchHandler_GetArticle(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	t.Run("ValidArticleID", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/articles/1", nil)
+		// Set URL parameter manually for chi router
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", "1")
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+		w := httptest.NewRecorder()
+
+		handler.GetArticle(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var article models.Article
+		err := json.Unmarshal(w.Body.Bytes(), &article)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, article.ID)
+	})
+
+	t.Run("InvalidArticleID", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/articles/invalid", nil)
+		// Set URL parameter manually for chi router
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", "invalid")
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+		w := httptest.NewRecorder()
+
+		handler.GetArticle(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("NonExistentArticleID", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/articles/999", nil)
+		// Set URL parameter manually for chi router
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", "999")
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+		w := httptest.NewRecorder()
+
+		handler.GetArticle(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("NegativeArticleID", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/articles/-1", nil)
+		// Set URL parameter manually for chi router
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", "-1")
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+		w := httptest.NewRecorder()
+
+		handler.GetArticle(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("WordAndCharCounts", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.ImportArticles(w, httptest.NewRequest("POST", "/admin/articles/import", strings.NewReader(`{"articles": [
+			{"title": "Réinitialiser le mot de passe", "content": "1) Ouvrez le portail 2) Cliquez sur « Mot de passe oublié » — c’est fait. 密码重置"}
+		]}`)))
+		require.Equal(t, http.StatusCreated, w.Code)
+		var imported models.ImportResult
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &imported))
+		id := strconv.Itoa(imported.Articles[0].ID)
+
+		for _, target := range []string{"/articles/" + id, "/articles/" + id + "?format=html"} {
+			req := httptest.NewRequest("GET", target, nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", id)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			w := httptest.NewRecorder()
+			handler.GetArticle(w, req)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			var article models.ArticleResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &article))
+			// Counted on the stored content, whatever the format
+			assert.Equal(t, 14, article.WordCount, target)
+			assert.Equal(t, 78, article.CharCount, target)
+		}
+	})
+}
+
+func TestSearchHandler_ArticleHistory(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	withID := func(req *http.Request, id string) *http.Request {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	}
+
+	updateArticle := func(id string, body string) *httptest.ResponseRecorder {
+		req := withID(httptest.NewRequest("PUT", "/articles/"+id, strings.NewReader(body)), id)
+		w := httptest.NewRecorder()
+		handler.UpdateArticle(w, req)
+		return w
+	}
+
+	getHistory := func(id string) *httptest.ResponseRecorder {
+		req := withID(httptest.NewRequest("GET", "/articles/"+id+"/history", nil), id)
+		w := httptest.NewRecorder()
+		handler.GetArticleHistory(w, req)
+		return w
+	}
+
+	t.Run("UpdateAndHistory", func(t *testing.T) {
+		w := updateArticle("2", `{"title": "VPN Setup v2", "content": "Install the new client."}`)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var article models.Article
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &article))
+		assert.Equal(t, "VPN Setup v2", article.Title)
+
+		w = updateArticle("2", `{"title": "VPN Setup v3", "content": "Install the newer client."}`)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = getHistory("2")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var history []models.ArticleVersion
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+		require.Len(t, history, 2)
+		assert.Equal(t, "VPN Setup v2", history[0].Title)
+		assert.Equal(t, 2, history[1].ArticleID)
+	})
+
+	t.Run("EmptyHistory", func(t *testing.T) {
+		w := getHistory("3")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, "[]", w.Body.String())
+	})
+
+	t.Run("ValidationErrors", func(t *testing.T) {
+		for _, body := range []string{`{"title": "Only a title"}`, `{"title": " ", "content": "Body"}`, `{"content": "Body"}`} {
+			w := updateArticle("2", body)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		}
+	})
+
+	t.Run("UnknownArticle", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, updateArticle("999", `{"title": "Title", "content": "Body"}`).Code)
+		assert.Equal(t, http.StatusNotFound, getHistory("999").Code)
+	})
+
+	t.Run("InvalidID", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, updateArticle("abc", `{"title": "Title", "content": "Body"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, getHistory("abc").Code)
+	})
+}
+
+func TestSearchHandler_ETag(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	getArticle := func(id string, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/articles/"+id, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+		w := httptest.NewRecorder()
+		handler.GetArticle(w, req)
+		return w
+	}
+
+	getAll := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/articles", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		handler.GetAllArticles(w, req)
+		return w
+	}
+
+	t.Run("ArticleETagIsStable", func(t *testing.T) {
+		first := getArticle("1", "")
+		second := getArticle("1", "")
+
+		assert.Equal(t, http.StatusOK, first.Code)
+		assert.NotEmpty(t, first.Header().Get("ETag"))
+		assert.Equal(t, first.Header().Get("ETag"), second.Header().Get("ETag"))
+		assert.NotEqual(t, first.Header().Get("ETag"), getArticle("2", "").Header().Get("ETag"))
+	})
+
+	t.Run("PrettyBodyHasOwnETag", func(t *testing.T) {
+		compact := getArticle("1", "")
+
+		req := httptest.NewRequest("GET", "/articles/1?pretty=true", nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", "1")
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		pretty := httptest.NewRecorder()
+		handler.GetArticle(pretty, req)
+
+		require.Equal(t, http.StatusOK, pretty.Code)
+		assert.NotEqual(t, compact.Body.String(), pretty.Body.String())
+		assert.NotEqual(t, compact.Header().Get("ETag"), pretty.Header().Get("ETag"))
+	})
+
+	t.Run("ArticleMatchingIfNoneMatch", func(t *testing.T) {
+		etag := getArticle("1", "").Header().Get("ETag")
+
+		w := getArticle("1", etag)
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.String())
+		assert.Equal(t, etag, w.Header().Get("ETag"))
+	})
+
+	t.Run("ArticleStaleIfNoneMatch", func(t *testing.T) {
+		w := getArticle("1", `"stale"`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotEqual(t, `"stale"`, w.Header().Get("ETag"))
+		assert.NotEmpty(t, w.Body.String())
+	})
+
+	t.Run("ArticleListMatchingIfNoneMatch", func(t *testing.T) {
+		etag := getAll("").Header().Get("ETag")
+		assert.NotEmpty(t, etag)
+
+		assert.Equal(t, http.StatusNotModified, getAll(etag).Code)
+		assert.Equal(t, http.StatusNotModified, getAll(`"other", W/`+etag).Code)
+		assert.Equal(t, http.StatusOK, getAll(`"stale"`).Code)
+	})
+}
+
+func TestSearchHandler_CacheControl(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	getArticle := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/articles/"+id, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		handler.GetArticle(w, req)
+		return w
+	}
+
+	listArticles := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.GetAllArticles(w, httptest.NewRequest("GET", "/articles", nil))
+		return w
+	}
+
+	t.Run("ArticleReads", func(t *testing.T) {
+		handler.SetArticleCacheMaxAge(120)
+		defer handler.SetArticleCacheMaxAge(0)
+
+		w := getArticle("1")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "public, max-age=120", w.Header().Get("Cache-Control"))
+
+		w = listArticles()
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "public, max-age=120", w.Header().Get("Cache-Control"))
+	})
+
+	t.Run("NotModifiedKeepsHeader", func(t *testing.T) {
+		handler.SetArticleCacheMaxAge(120)
+		defer handler.SetArticleCacheMaxAge(0)
+
+		etag := listArticles().Header().Get("ETag")
+		req := httptest.NewRequest("GET", "/articles", nil)
+		req.Header.Set("If-None-Match", etag)
+		w := httptest.NewRecorder()
+		handler.GetAllArticles(w, req)
+
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Equal(t, "public, max-age=120", w.Header().Get("Cache-Control"))
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		assert.Empty(t, getArticle("1").Header().Get("Cache-Control"))
+		assert.Empty(t, listArticles().Header().Get("Cache-Control"))
+	})
+
+	t.Run("MissingArticleNotCached", func(t *testing.T) {
+		handler.SetArticleCacheMaxAge(120)
+		defer handler.SetArticleCacheMaxAge(0)
+
+		w := getArticle("999")
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Empty(t, w.Header().Get("Cache-Control"))
+	})
+
+	t.Run("SearchNoStore", func(t *testing.T) {
+		handler.SetArticleCacheMaxAge(120)
+		defer handler.SetArticleCacheMaxAge(0)
+
+		req := httptest.NewRequest("POST", "/search-query", strings.NewReader(`{"query": "vpn"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.SearchQuery(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+		req = httptest.NewRequest("POST", "/search-query/batch", strings.NewReader(`{"queries": ["vpn", "email"]}`))
+		w = httptest.NewRecorder()
+		handler.SearchBatch(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	})
+}
+
+func TestArticlesETag(t *testing.T) {
+	base := models.Article{ID: 1, Title: "Title", Content: "Content"}
+
+	assert.Equal(t, articlesETag(base), articlesETag(base))
+	assert.NotEqual(t, articlesETag(base), articlesETag(models.Article{ID: 1, Title: "Title", Content: "Changed"}))
+	assert.NotEqual(t,
+		articlesETag(models.Article{ID: 1, Title: "ab", Content: "c"}),
+		articlesETag(models.Article{ID: 1, Title: "a", Content: "bc"}))
+
+	// Every other field counts too
+	changed := []models.Article{
+		{ID: 1, Title: "Title", Content: "Content", Keywords: "vpn"},
+		{ID: 1, Title: "Title", Content: "Content", Summary: "Summary"},
+		{ID: 1, Title: "Title", Content: "Content", Score: 0.5},
+		{ID: 1, Title: "Title", Content: "Content", UpdatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+	}
+	for _, article := range changed {
+		assert.NotEqual(t, articlesETag(base), articlesETag(article))
+	}
+}
+
+func TestSearchHandler_ArticleViews(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	recordView := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/articles/"+id+"/view", nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+		w := httptest.NewRecorder()
+		handler.RecordArticleView(w, req)
+		return w
+	}
+
+	t.Run("RecordView", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, recordView("2").Code)
+		assert.Equal(t, http.StatusNoContent, recordView("2").Code)
+		assert.Equal(t, http.StatusNoContent, recordView("5").Code)
+	})
+
+	t.Run("InvalidArticleID", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, recordView("abc").Code)
+	})
+
+	t.Run("NonExistentArticle", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, recordView("999").Code)
+	})
+
+	t.Run("PopularArticles", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/articles/popular", nil)
+		w := httptest.NewRecorder()
+
+		handler.GetPopularArticles(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var popular []models.PopularArticle
+		err := json.Unmarshal(w.Body.Bytes(), &popular)
+		assert.NoError(t, err)
+		require.Len(t, popular, 2)
+		assert.Equal(t, 2, popular[0].ID)
+		assert.Equal(t, 2, popular[0].ViewCount)
+	})
+
+	t.Run("PopularArticlesPagination", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/articles/popular?page=2&page_size=1", nil)
+		w := httptest.NewRecorder()
+
+		handler.GetPopularArticles(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var popular []models.PopularArticle
+		err := json.Unmarshal(w.Body.Bytes(), &popular)
+		assert.NoError(t, err)
+		require.Len(t, popular, 1)
+		assert.Equal(t, 5, popular[0].ID)
+	})
+
+	t.Run("InvalidPagination", func(t *testing.T) {
+		for _, query := range []string{"page=0", "page=abc", "page_size=0", "page_size=1000"} {
+			req := httptest.NewRequest("GET", "/articles/popular?"+query, nil)
+			w := httptest.NewRecorder()
+
+			handler.GetPopularArticles(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		}
+	})
+
+	t.Run("ConfiguredPageSizes", func(t *testing.T) {
+		handler.SetPageSizes(1, 2)
+		defer handler.SetPageSizes(defaultPageSize, maxPageSize)
+
+		req := httptest.NewRequest("GET", "/articles/popular", nil)
+		w := httptest.NewRecorder()
+		handler.GetPopularArticles(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var popular []models.PopularArticle
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &popular))
+		assert.Len(t, popular, 1)
+
+		req = httptest.NewRequest("GET", "/articles/popular?page_size=3", nil)
+		w = httptest.NewRecorder()
+		handler.GetPopularArticles(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "page_size must be between 1 and 2")
+	})
+}
+
+func TestSearchHandler_Reindex(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	req := httptest.NewRequest("POST", "/admin/reindex", nil)
+	w := httptest.NewRecorder()
+
+	handler.Reindex(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var result models.ReindexResult
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, 10, result.ArticlesIndexed)
+}
+
+func TestSearchHandler_RerunQuery(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	rerun := func(id string, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", target, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		handler.RerunQuery(w, req)
+		return w
+	}
+
+	search := func(query string) models.SearchResponse {
+		req := httptest.NewRequest("POST", "/search-query", strings.NewReader(`{"query":"`+query+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.SearchQuery(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response models.SearchResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	t.Run("ReturnsFreshResult", func(t *testing.T) {
+		original := search("vpn help")
+		id := strconv.Itoa(original.QueryID)
+
+		w := rerun(id, "/queries/"+id+"/rerun")
+
+		require.Equal(t, http.StatusOK, w.Code)
+		var response models.SearchResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, original.QueryID, response.QueryID)
+		assert.Greater(t, response.ResultID, original.ResultID)
+	})
+
+	t.Run("UnknownQuery", func(t *testing.T) {
+		w := rerun("999", "/queries/999/rerun")
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "Query not found")
+	})
+
+	t.Run("InvalidID", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, rerun("abc", "/queries/abc/rerun").Code)
+	})
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		id := strconv.Itoa(search("vpn help").QueryID)
+
+		w := rerun(id, "/queries/"+id+"/rerun?fields=everything")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestSearchHandler_ShareQuery(t *testing.T) {
+	dbPath := "test_share.db"
+	db, err := database.NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	require.NoError(t, db.Initialize())
+	defer func() {
+		db.Close()
+		os.Remove(dbPath)
+	}()
+	handler := NewSearchHandler(service.NewSearchService(db, ai.NewMockAIService()))
+
+	withParam := func(req *http.Request, key, value string) *http.Request {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add(key, value)
+		return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	}
+	share := func(handler *SearchHandler, id string) *httptest.ResponseRecorder {
+		req := withParam(httptest.NewRequest("POST", "/queries/"+id+"/share", nil), "id", id)
+		w := httptest.NewRecorder()
+		handler.ShareQuery(w, req)
+		return w
+	}
+	getShared := func(token string) *httptest.ResponseRecorder {
+		req := withParam(httptest.NewRequest("GET", "/shared/"+token, nil), "token", token)
+		w := httptest.NewRecorder()
+		handler.GetSharedResult(w, req)
+		return w
+	}
+
+	req := httptest.NewRequest("POST", "/search-query", strings.NewReader(`{"query":"vpn help"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.SearchQuery(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var searched models.SearchResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &searched))
+	queryID := strconv.Itoa(searched.QueryID)
+
+	t.Run("SharedResultIsReadable", func(t *testing.T) {
+		w := share(handler, queryID)
+
+		require.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		var link models.ShareLink
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+		assert.NotEmpty(t, link.Token)
+		assert.True(t, link.ExpiresAt.After(time.Now()))
+
+		w = getShared(link.Token)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		var shared models.SharedResult
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &shared))
+		assert.Equal(t, "vpn help", shared.Query)
+		assert.Equal(t, searched.AISummaryAnswer, shared.AISummaryAnswer)
+		assert.Len(t, shared.AIRelevantArticles, len(searched.AIRelevantArticles))
+		assert.NotContains(t, w.Body.String(), "query_id")
+		assert.NotContains(t, w.Body.String(), "result_id")
+	})
+
+	t.Run("ExpiredToken", func(t *testing.T) {
+		cfg := config.DefaultConfig()
+		cfg.ShareTokenTTL = time.Nanosecond
+		shortLived := NewSearchHandler(service.NewSearchServiceWithConfig(db, ai.NewMockAIService(), cfg))
+
+		w := share(shortLived, queryID)
+		require.Equal(t, http.StatusCreated, w.Code)
+		var link models.ShareLink
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+		time.Sleep(time.Millisecond)
+
+		w = getShared(link.Token)
+
+		assert.Equal(t, http.StatusGone, w.Code)
+		assert.Contains(t, w.Body.String(), "Share link expired")
+	})
+
+	t.Run("UnknownToken", func(t *testing.T) {
+		w := getShared("not-a-token")
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "Share link not found")
+	})
+
+	t.Run("DatabaseBusy", func(t *testing.T) {
+		busy := NewSearchHandler(service.NewSearchService(busyDB{db}, ai.NewMockAIService()))
+		req := withParam(httptest.NewRequest("GET", "/shared/some-token", nil), "token", "some-token")
+		w := httptest.NewRecorder()
+		busy.GetSharedResult(w, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	})
+
+	t.Run("UnknownQuery", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, share(handler, "999").Code)
+	})
+
+	t.Run("InvalidID", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, share(handler, "abc").Code)
+	})
+}
+
+func TestSearchHandler_ImportArticles(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	importArticles := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/admin/articles/import", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.ImportArticles(w, req)
+		return w
+	}
+
+	countArticles := func(t *testing.T) int {
+		articles, err := handler.searchService.GetAllArticles(context.Background())
+		require.NoError(t, err)
+		return len(articles)
+	}
+
+	t.Run("ReportsEveryError", func(t *testing.T) {
+		before := countArticles(t)
+
+		w := importArticles(`{"articles": [
+			{"content": "Missing its title"},
+			{"title": "Printer Drivers", "content": "Download them from the vendor."},
+			{"title": "Blank content", "content": "  "},
+			{"title": "` + strings.Repeat("x", 201) + `"}
+		]}`)
+
+		require.Equal(t, http.StatusBadRequest, w.Code)
+
+		var response models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "Validation failed", response.Error)
+
+		type rowError struct {
+			index int
+			field string
+		}
+		var got []rowError
+		for _, fieldErr := range response.Fields {
+			require.NotNil(t, fieldErr.Index)
+			assert.NotEmpty(t, fieldErr.Message)
+			got = append(got, rowError{*fieldErr.Index, fieldErr.Field})
+		}
+		assert.Equal(t, []rowError{{0, "title"}, {2, "content"}, {3, "title"}, {3, "content"}}, got)
+		assert.Equal(t, "title must be at most 200 characters", response.Fields[2].Message)
+
+		// The valid article is not stored either
+		assert.Equal(t, before, countArticles(t))
+	})
+
+	t.Run("IndexZeroIsReported", func(t *testing.T) {
+		w := importArticles(`{"articles": [{"title": " ", "content": "Body"}]}`)
+
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"index":0`)
+	})
+
+	t.Run("EmptyBatch", func(t *testing.T) {
+		w := importArticles(`{"articles": []}`)
+
+		require.Equal(t, http.StatusBadRequest, w.Code)
+
+		var response models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Fields, 1)
+		assert.Nil(t, response.Fields[0].Index)
+		assert.Equal(t, "articles", response.Fields[0].Field)
+	})
+
+	t.Run("RepeatedTitleInBatch", func(t *testing.T) {
+		w := importArticles(`{"articles": [
+			{"title": "Desk Booking", "content": "Use the workplace app."},
+			{"title": "desk booking", "content": "Use the workplace app."}
+		]}`)
+
+		require.Equal(t, http.StatusBadRequest, w.Code)
+
+		var response models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Fields, 1)
+		assert.Equal(t, 1, *response.Fields[0].Index)
+		assert.Equal(t, "title repeats the title of article 0", response.Fields[0].Message)
+	})
+
+	t.Run("ImportsValidBatch", func(t *testing.T) {
+		before := countArticles(t)
+
+		w := importArticles(`{"articles": [
+			{"title": "Printer Drivers", "content": "Download them from the vendor."},
+			{"title": "Badge Access", "content": "Request a new badge from facilities."}
+		]}`)
+
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		var result models.ImportResult
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		assert.Equal(t, 2, result.ArticlesImported)
+		require.Len(t, result.Articles, 2)
+		assert.Equal(t, "Badge Access", result.Articles[1].Title)
+		assert.Greater(t, result.Articles[1].ID, result.Articles[0].ID)
+		assert.Equal(t, before+2, countArticles(t))
+	})
+
+	t.Run("Keywords", func(t *testing.T) {
+		w := importArticles(`{"articles": [
+			{"title": "Parking Permits", "content": "Apply on the facilities portal.", "keywords": " parking, permit "},
+			{"title": "Long Keywords", "content": "Body", "keywords": "` + strings.Repeat("k", 501) + `"}
+		]}`)
+
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		var response models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Fields, 1)
+		assert.Equal(t, 1, *response.Fields[0].Index)
+		assert.Equal(t, "keywords must be at most 500 characters", response.Fields[0].Message)
+
+		w = importArticles(`{"articles": [
+			{"title": "Parking Permits", "content": "Apply on the facilities portal.", "keywords": " parking, permit "}
+		]}`)
+
+		require.Equal(t, http.StatusCreated, w.Code)
+		var result models.ImportResult
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		require.Len(t, result.Articles, 1)
+		assert.Equal(t, "parking, permit", result.Articles[0].Keywords)
+	})
+}
+
+func TestSearchHandler_DuplicateTitles(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	importArticle := func(title string) *httptest.ResponseRecorder {
+		body := `{"articles": [{"title": "` + title + `", "content": "Ask facilities."}]}`
+		req := httptest.NewRequest("POST", "/admin/articles/import", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ImportArticles(w, req)
+		return w
+	}
+
+	t.Run("CreateSameTitleTwice", func(t *testing.T) {
+		require.Equal(t, http.StatusCreated, importArticle("Badge Access").Code)
+
+		w := importArticle("BADGE ACCESS")
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		var response models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "Duplicate article title", response.Error)
+		assert.Contains(t, response.Message, `"Badge Access"`)
+	})
+
+	t.Run("UpdateToTakenTitle", func(t *testing.T) {
+		body := `{"title": "VPN Connection Setup", "content": "Copied content"}`
+		req := httptest.NewRequest("PUT", "/articles/1", strings.NewReader(body))
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", "1")
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+
+		handler.UpdateArticle(w, req)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+}
+
+func TestSearchHandler_ArticleLimits(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	update := func(title, content string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"title": title, "content": content})
+		req := httptest.NewRequest("PUT", "/articles/1", bytes.NewReader(body))
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", "1")
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		handler.UpdateArticle(w, req)
+		return w
+	}
+
+	fieldErrors := func(t *testing.T, w *httptest.ResponseRecorder) []models.FieldError {
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		var response models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Fields
+	}
+
+	t.Run("DefaultLimits", func(t *testing.T) {
+		w := update(strings.Repeat("t", 200), strings.Repeat("c", 50000))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		fields := fieldErrors(t, update(strings.Repeat("t", 201), strings.Repeat("c", 50001)))
+		require.Len(t, fields, 2)
+		assert.Equal(t, "title must be at most 200 characters", fields[0].Message)
+		assert.Equal(t, "content must be at most 50000 characters", fields[1].Message)
+	})
+
+	t.Run("ConfiguredLimits", func(t *testing.T) {
+		handler.SetArticleLimits(10, 20)
+		defer handler.SetArticleLimits(defaultMaxTitleChars, defaultMaxContentChars)
+
+		// Limits count characters, not bytes
+		w := update(strings.Repeat("é", 10), strings.Repeat("c", 20))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		fields := fieldErrors(t, update(strings.Repeat("é", 11), strings.Repeat("c", 20)))
+		require.Len(t, fields, 1)
+		assert.Equal(t, "title must be at most 10 characters", fields[0].Message)
+
+		fields = fieldErrors(t, update("Short", strings.Repeat("c", 21)))
+		require.Len(t, fields, 1)
+		assert.Equal(t, "content must be at most 20 characters", fields[0].Message)
+	})
+
+	t.Run("ImportRows", func(t *testing.T) {
+		handler.SetArticleLimits(10, 20)
+		defer handler.SetArticleLimits(defaultMaxTitleChars, defaultMaxContentChars)
+
+		body := `{"articles": [
+			{"title": "Desk Setup", "content": "` + strings.Repeat("c", 20) + `"},
+			{"title": "Desk Setup 2", "content": "` + strings.Repeat("c", 21) + `"}
+		]}`
+		req := httptest.NewRequest("POST", "/admin/articles/import", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ImportArticles(w, req)
+
+		fields := fieldErrors(t, w)
+		require.Len(t, fields, 2)
+		for _, field := range fields {
+			assert.Equal(t, 1, *field.Index)
+		}
+		assert.Equal(t, "title", fields[0].Field)
+		assert.Equal(t, "content", fields[1].Field)
+	})
+}
+
+func TestSearchHandler_SearchQuota(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	now := time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC)
+	quota := NewSearchQuota(2, []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}, NewMemoryQuotaStore())
+	quota.now = func() time.Time { return now }
+	handler.SetSearchQuota(quota)
+	defer handler.SetSearchQuota(nil)
+
+	search := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/search-query", strings.NewReader(`{"query": "vpn"}`))
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.SearchQuery(w, req)
+		return w
+	}
+
+	t.Run("RejectsOverLimit", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, search("203.0.113.1:4000").Code)
+		assert.Equal(t, http.StatusOK, search("203.0.113.1:4001").Code)
+
+		w := search("203.0.113.1:4002")
+
+		require.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "3601", w.Header().Get("Retry-After"))
+		var response models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "Daily search quota exceeded", response.Error)
+		assert.Contains(t, response.Message, "2024-03-02T00:00:00Z")
+	})
+
+	t.Run("CountsPerClient", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, search("203.0.113.2:4000").Code)
+	})
+
+	t.Run("InvalidRequestsDoNotCount", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/search-query", strings.NewReader(`{"query": ""}`))
+		req.RemoteAddr = "203.0.113.2:4000"
+		w := httptest.NewRecorder()
+		handler.SearchQuery(w, req)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+
+		assert.Equal(t, http.StatusOK, search("203.0.113.2:4000").Code)
+	})
+
+	t.Run("ExemptClients", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusOK, search("10.1.2.3:4000").Code)
+		}
+	})
+
+	t.Run("BatchCountsEachQuery", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/search-query/batch", strings.NewReader(`{"queries": ["vpn", "email", "password"]}`))
+		req.RemoteAddr = "203.0.113.3:4000"
+		w := httptest.NewRecorder()
+		handler.SearchBatch(w, req)
+
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	})
+
+	t.Run("SharedSearchCounts", func(t *testing.T) {
+		get := func() int {
+			req := httptest.NewRequest("GET", "/search-query?q=vpn", nil)
+			req.RemoteAddr = "203.0.113.4:4000"
+			w := httptest.NewRecorder()
+			handler.SharedSearch(w, req)
+			return w.Code
+		}
+
+		assert.NotEqual(t, http.StatusTooManyRequests, get())
+		assert.NotEqual(t, http.StatusTooManyRequests, get())
+		assert.Equal(t, http.StatusTooManyRequests, get())
+	})
+
+	t.Run("ResetsNextDay", func(t *testing.T) {
+		now = now.Add(time.Hour)
+
+		assert.Equal(t, http.StatusOK, search("203.0.113.1:4000").Code)
+	})
+}
+
+func TestSearchHandler_Purge(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	purge := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", target, nil)
+		w := httptest.NewRecorder()
+		handler.Purge(w, req)
+		return w
+	}
+
+	t.Run("KeepsRecentQueries", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/search-query", strings.NewReader(`{"query":"vpn help"}`))
+		req.Header.Set("Content-Type", "application/json")
+		handler.SearchQuery(httptest.NewRecorder(), req)
+
+		w := purge("/admin/purge?older_than=30d")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var result models.PurgeResult
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		assert.Zero(t, result.QueriesDeleted)
+		assert.Zero(t, result.ResultsDeleted)
+	})
+
+	t.Run("InvalidOlderThan", func(t *testing.T) {
+		for _, target := range []string{"/admin/purge", "/admin/purge?older_than=0d", "/admin/purge?older_than=soon"} {
+			w := purge(target)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, target)
+		}
+	})
+}
+
+func TestSearchHandler_GetStats(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	req := httptest.NewRequest("GET", "/stats", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetStats(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var stats models.Stats
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, 10, stats.TotalArticles)
+}
+
+func TestSearchHandler_GetConfig(t *testing.T) {
+	dbPath := "test_config.db"
+	db, err := database.NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	require.NoError(t, db.Initialize())
+	defer func() {
+		db.Close()
+		os.Remove(dbPath)
+	}()
+
+	cfg := config.DefaultConfig()
+	cfg.GeminiKey = "AIzaSyExampleGeminiKey1234wxyz"
+	cfg.AdminAPIKey = "short-key"
+	cfg.MaxPageSize = 42
+	cfg.AIQueueTimeout = 15 * time.Second
+	handler := NewSearchHandler(service.NewSearchServiceWithConfig(db, ai.NewMockAIService(), cfg))
+
+	req := httptest.NewRequest("GET", "/admin/config", nil)
+	w := httptest.NewRecorder()
+	handler.GetConfig(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.NotContains(t, w.Body.String(), cfg.GeminiKey)
+	assert.NotContains(t, w.Body.String(), cfg.AdminAPIKey)
+
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "****wxyz", response["GeminiKey"])
+	assert.Equal(t, "****", response["AdminAPIKey"])
+	assert.Equal(t, float64(42), response["MaxPageSize"])
+	assert.Equal(t, "15s", response["AIQueueTimeout"])
+	assert.Equal(t, "newest", response["RankTies"])
+}
+
+func TestSearchHandler_TopQueries(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	for _, query := range []string{"Reset password?", "reset password", "VPN down"} {
+		body, _ := json.Marshal(models.SearchRequest{Query: query})
+		req := httptest.NewRequest("POST", "/search-query", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		handler.SearchQuery(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	t.Run("Defaults", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/queries/top", nil)
+		w := httptest.NewRecorder()
+
+		handler.TopQueries(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var topQueries []models.TopQuery
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &topQueries))
+		require.Len(t, topQueries, 2)
+		assert.Equal(t, "reset password", topQueries[0].Query)
+		assert.Equal(t, 2, topQueries[0].Count)
+	})
+
+	t.Run("WindowAndLimit", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/queries/top?window=1h&limit=1", nil)
+		w := httptest.NewRecorder()
+
+		handler.TopQueries(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var topQueries []models.TopQuery
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &topQueries))
+		assert.Len(t, topQueries, 1)
+	})
+
+	t.Run("InvalidParameters", func(t *testing.T) {
+		for _, query := range []string{"window=abc", "window=0d", "window=-1h", "limit=0", "limit=101", "limit=abc"} {
+			req := httptest.NewRequest("GET", "/queries/top?"+query, nil)
+			w := httptest.NewRecorder()
+
+			handler.TopQueries(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		}
+	})
 }
 
-func TestSearchHandler_GetAllArticles(t *testing.T) {
+func TestSearchHandler_Backup(t *testing.T) {
+	ctx := context.Background()
+
 	handler, cleanup := setupTestHandler(t)
 	defer cleanup()
 
-	req := httptest.NewRequest("GET", "/articles", nil)
+	req := httptest.NewRequest("GET", "/admin/backup", nil)
 	w := httptest.NewRecorder()
 
-	handler.GetAllArticles(w, req)
+	handler.Backup(w, req)
 
-	assert.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/vnd.sqlite3", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment; filename=")
 
-	var articles []models.Article
-	err := json.Unmarshal(w.Body.Bytes(), &articles)
+	backupPath := t.TempDir() + "/backup.db"
+	require.NoError(t, os.WriteFile(backupPath, w.Body.Bytes(), 0600))
+
+	backup, err := database.NewSQLiteDB(backupPath)
+	require.NoError(t, err)
+	defer backup.Close()
+
+	articles, err := backup.GetAllArticles(ctx)
 	assert.NoError(t, err)
-	assert.Greater(t, len(articles), 0)
+	assert.Len(t, articles, 10)
 }
 
-func TestSearchHandler_HealthCheck(t *testing.T) {
+func TestSearchHandler_ErrorResponses(t *testing.T) {
 	handler, cleanup := setupTestHandler(t)
 	defer cleanup()
 
-	req := httptest.NewRequest("GET", "/health", nil)
-	w := httptest.NewRecorder()
+	t.Run("SendJSONResponse", func(t *testing.T) {
+		w := httptest.NewRecorder()
 
-	handler.HealthCheck(w, req)
+		data := map[string]string{"test": "value"}
+		handler.sendJSONResponse(w, httptest.NewRequest("GET", "/", nil), http.StatusOK, data)
 
-	assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
 
-	var response map[string]string
-	err := json.Unmarshal(w.Body.Bytes(), &response)
-	assert.NoError(t, err)
-	assert.Equal(t, "healthy", response["status"])
+		var response map[string]string
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, "value", response["test"])
+	})
+
+	t.Run("SendErrorResponse", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		handler.sendErrorResponse(w, httptest.NewRequest("GET", "/", nil), http.StatusBadRequest, "Test Error", "Test Message")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		var response models.ErrorResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, "Test Error", response.Error)
+		assert.Equal(t, "Test Message", response.Message)
+	})
+
+	t.Run("UnencodableValue", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		// Channels cannot be encoded as JSON
+		data := map[string]interface{}{"ch": make(chan int)}
+		handler.sendJSONResponse(w, httptest.NewRequest("GET", "/", nil), http.StatusOK, data)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		var response models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "Failed to encode response", response.Error)
+	})
 }
 
-func TestSearchHandler_GetArticle(t *testing.T) {
+func TestSearchHandler_ResponseTimezone(t *testing.T) {
 	handler, cleanup := setupTestHandler(t)
 	defer cleanup()
 
-	t.Run("ValidArticleID", func(t *testing.T) {
-		req := httptest.NewRequest("GET", "/articles/1", nil)
-		// Set URL parameter manually for chi router
-		rctx := chi.NewRouteContext()
-		rctx.URLParams.Add("id", "1")
-		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	timestamps := func(t *testing.T, w *httptest.ResponseRecorder, fields ...string) []string {
+		require.Equal(t, http.StatusOK, w.Code)
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		var values []string
+		for _, field := range fields {
+			value, ok := body[field].(string)
+			require.True(t, ok, field)
+			values = append(values, value)
+		}
+		return values
+	}
 
+	search := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/search-query", strings.NewReader(`{"query": "vpn"}`))
 		w := httptest.NewRecorder()
+		handler.SearchQuery(w, req)
+		return w
+	}
 
-		handler.GetArticle(w, req)
+	health := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.HealthCheck(w, httptest.NewRequest("GET", "/health", nil))
+		return w
+	}
 
-		assert.Equal(t, http.StatusOK, w.Code)
+	t.Run("UTCByDefault", func(t *testing.T) {
+		for _, value := range timestamps(t, search(), "timestamp") {
+			assert.True(t, strings.HasSuffix(value, "Z"), value)
+		}
+	})
+
+	location, err := time.LoadLocation("Asia/Kolkata")
+	require.NoError(t, err)
+	handler.SetResponseTimezone(location)
+	defer handler.SetResponseTimezone(time.UTC)
+
+	t.Run("SearchResponse", func(t *testing.T) {
+		for _, value := range timestamps(t, search(), "timestamp") {
+			assert.True(t, strings.HasSuffix(value, "+05:30"), value)
+		}
+	})
+
+	t.Run("HealthCheck", func(t *testing.T) {
+		for _, value := range timestamps(t, health(), "started_at", "time") {
+			assert.True(t, strings.HasSuffix(value, "+05:30"), value)
+		}
+	})
+
+	t.Run("EnvelopeMeta", func(t *testing.T) {
+		handler.SetResponseEnvelope(true)
+		defer handler.SetResponseEnvelope(false)
+
+		var envelope struct {
+			Meta map[string]interface{} `json:"meta"`
+		}
+		require.NoError(t, json.Unmarshal(health().Body.Bytes(), &envelope))
+		assert.True(t, strings.HasSuffix(envelope.Meta["timestamp"].(string), "+05:30"))
+	})
+}
 
+func TestSearchHandler_ResponseEnvelope(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	getArticle := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/articles/"+id, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+		ctx = context.WithValue(ctx, middleware.RequestIDKey, "req-123")
+		w := httptest.NewRecorder()
+		handler.GetArticle(w, req.WithContext(ctx))
+		return w
+	}
+
+	t.Run("BareByDefault", func(t *testing.T) {
+		w := getArticle("1")
+		assert.Equal(t, http.StatusOK, w.Code)
 		var article models.Article
-		err := json.Unmarshal(w.Body.Bytes(), &article)
-		assert.NoError(t, err)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &article))
 		assert.Equal(t, 1, article.ID)
+
+		w = getArticle("999")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		var response models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "Article not found", response.Error)
 	})
 
-	t.Run("InvalidArticleID", func(t *testing.T) {
-		req := httptest.NewRequest("GET", "/articles/invalid", nil)
-		// Set URL parameter manually for chi router
-		rctx := chi.NewRouteContext()
-		rctx.URLParams.Add("id", "invalid")
-		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	handler.SetResponseEnvelope(true)
+	defer handler.SetResponseEnvelope(false)
 
-		w := httptest.NewRecorder()
+	t.Run("WrapsData", func(t *testing.T) {
+		w := getArticle("1")
 
-		handler.GetArticle(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var envelope struct {
+			Data models.Article      `json:"data"`
+			Meta models.ResponseMeta `json:"meta"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &envelope))
+		assert.Equal(t, 1, envelope.Data.ID)
+		assert.Equal(t, "req-123", envelope.Meta.RequestID)
+		assert.WithinDuration(t, time.Now(), envelope.Meta.Timestamp, time.Minute)
+	})
+
+	t.Run("WrapsErrors", func(t *testing.T) {
+		w := getArticle("999")
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		var envelope models.ErrorEnvelope
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &envelope))
+		assert.Equal(t, http.StatusNotFound, envelope.Error.Code)
+		assert.Equal(t, "Article not found", envelope.Error.Message)
+		assert.NotContains(t, w.Body.String(), `"data"`)
+	})
+
+	t.Run("WrapsValidationErrors", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/search-query", strings.NewReader(`{"query":""}`))
+		w := httptest.NewRecorder()
+		handler.SearchQuery(w, req)
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
+		var envelope models.ErrorEnvelope
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &envelope))
+		assert.Equal(t, http.StatusBadRequest, envelope.Error.Code)
+		assert.Equal(t, "Validation failed", envelope.Error.Message)
+		assert.Equal(t, "query cannot be empty", envelope.Error.Detail)
+		require.Len(t, envelope.Error.Fields, 1)
+		assert.Equal(t, "query", envelope.Error.Fields[0].Field)
 	})
 
-	t.Run("NonExistentArticleID", func(t *testing.T) {
-		req := httptest.NewRequest("GET", "/articles/999", nil)
-		// Set URL parameter manually for chi router
-		rctx := chi.NewRouteContext()
-		rctx.URLParams.Add("id", "999")
-		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	t.Run("UnencodableValue", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.sendJSONResponse(w, httptest.NewRequest("GET", "/", nil), http.StatusOK, make(chan int))
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		var envelope models.ErrorEnvelope
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &envelope))
+		assert.Equal(t, "Failed to encode response", envelope.Error.Message)
+	})
+}
+
+func TestSearchHandler_PrettyJSON(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
 
+	getArticle := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", "1")
 		w := httptest.NewRecorder()
+		handler.GetArticle(w, req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx)))
+		return w
+	}
 
-		handler.GetArticle(w, req)
+	t.Run("CompactByDefault", func(t *testing.T) {
+		w := getArticle("/articles/1")
 
-		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		assert.True(t, strings.HasPrefix(w.Body.String(), `{"id":1,`))
+		assert.Equal(t, 1, strings.Count(w.Body.String(), "\n"))
 	})
 
-	t.Run("NegativeArticleID", func(t *testing.T) {
-		req := httptest.NewRequest("GET", "/articles/-1", nil)
-		// Set URL parameter manually for chi router
+	t.Run("Requested", func(t *testing.T) {
+		w := getArticle("/articles/1?pretty=true")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		assert.True(t, strings.HasPrefix(w.Body.String(), "{\n  \"id\": 1,\n"))
+
+		var article models.Article
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &article))
+		assert.Equal(t, 1, article.ID)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/articles/abc?pretty=true", nil)
 		rctx := chi.NewRouteContext()
-		rctx.URLParams.Add("id", "-1")
-		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		rctx.URLParams.Add("id", "abc")
+		w := httptest.NewRecorder()
+		handler.GetArticle(w, req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx)))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.True(t, strings.HasPrefix(w.Body.String(), "{\n  \"error\": "))
+	})
+
+	t.Run("InvalidValueIgnored", func(t *testing.T) {
+		w := getArticle("/articles/1?pretty=yes")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.True(t, strings.HasPrefix(w.Body.String(), `{"id":1,`))
+	})
+
+	handler.SetPrettyJSON(true)
+	defer handler.SetPrettyJSON(false)
+
+	t.Run("Configured", func(t *testing.T) {
+		w := getArticle("/articles/1")
+		assert.True(t, strings.HasPrefix(w.Body.String(), "{\n  \"id\": 1,\n"))
+	})
+
+	t.Run("DisabledByRequest", func(t *testing.T) {
+		w := getArticle("/articles/1?pretty=false")
+		assert.True(t, strings.HasPrefix(w.Body.String(), `{"id":1,`))
+	})
+}
+
+func TestSearchHandler_Metrics(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	inFlight := NewInFlight(3)
+	handler.SetInFlight(inFlight)
+	require.True(t, inFlight.Acquire())
+	require.True(t, inFlight.Acquire())
+	defer inFlight.Release()
+	defer inFlight.Release()
 
+	t.Run("Counters", func(t *testing.T) {
 		w := httptest.NewRecorder()
+		handler.Metrics(w, httptest.NewRequest("GET", "/metrics", nil))
 
-		handler.GetArticle(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		assert.JSONEq(t, `{"in_flight_requests": 2, "max_in_flight_requests": 3, "rejected_requests": 0}`, w.Body.String())
+	})
 
-		assert.Equal(t, http.StatusNotFound, w.Code)
+	t.Run("Health", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.HealthCheck(w, httptest.NewRequest("GET", "/health", nil))
+
+		assert.Contains(t, w.Body.String(), `"in_flight_requests":2`)
 	})
 }
 
-func TestSearchHandler_ErrorResponses(t *testing.T) {
+func TestSearchHandler_PublicArticleFields(t *testing.T) {
 	handler, cleanup := setupTestHandler(t)
 	defer cleanup()
+	handler.SetPublicArticleFields([]string{"id", "title", "snippet"})
+	handler.SetArticleCacheMaxAge(60)
 
-	t.Run("SendJSONResponse", func(t *testing.T) {
+	read := func(handle http.HandlerFunc, target, id string, authenticated bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+		if authenticated {
+			ctx = WithAuthenticated(ctx)
+		}
 		w := httptest.NewRecorder()
+		handle(w, req.WithContext(ctx))
+		return w
+	}
 
-		data := map[string]string{"test": "value"}
-		handler.sendJSONResponse(w, http.StatusOK, data)
+	t.Run("AnonymousGetsTeaser", func(t *testing.T) {
+		w := read(handler.GetArticle, "/articles/1", "1", false)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var article models.ArticleResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &article))
+		assert.Equal(t, 1, article.ID)
+		assert.NotEmpty(t, article.Title)
+		assert.Empty(t, article.Content)
+		assert.Empty(t, article.Keywords)
+		assert.NotEmpty(t, article.Snippet)
+		assert.LessOrEqual(t, len([]rune(article.Snippet)), publicSnippetChars+1)
+		assert.Equal(t, "public, max-age=60", w.Header().Get("Cache-Control"))
+		assert.Equal(t, "Authorization, X-API-Key", w.Header().Get("Vary"))
+	})
 
+	t.Run("AuthenticatedGetsFullArticle", func(t *testing.T) {
+		w := read(handler.GetArticle, "/articles/1", "1", true)
 		assert.Equal(t, http.StatusOK, w.Code)
-		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
 
-		var response map[string]string
-		err := json.Unmarshal(w.Body.Bytes(), &response)
-		assert.NoError(t, err)
-		assert.Equal(t, "value", response["test"])
+		var article models.ArticleResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &article))
+		assert.NotEmpty(t, article.Content)
+		assert.Empty(t, article.Snippet)
+		assert.Equal(t, "private, max-age=60", w.Header().Get("Cache-Control"))
 	})
 
-	t.Run("SendErrorResponse", func(t *testing.T) {
+	t.Run("ETagsDiffer", func(t *testing.T) {
+		anonymous := read(handler.GetArticle, "/articles/1", "1", false).Header().Get("ETag")
+		authenticated := read(handler.GetArticle, "/articles/1", "1", true).Header().Get("ETag")
+		assert.NotEqual(t, anonymous, authenticated)
+	})
+
+	t.Run("Lists", func(t *testing.T) {
+		for name, handle := range map[string]http.HandlerFunc{
+			"/articles":              handler.GetAllArticles,
+			"/articles/search?q=vpn": handler.SearchArticles,
+		} {
+			w := read(handle, name, "", false)
+			assert.Equal(t, http.StatusOK, w.Code, name)
+			assert.NotContains(t, w.Body.String(), `"content"`, name)
+
+			var articles []models.ArticleResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &articles), name)
+			require.NotEmpty(t, articles, name)
+			for _, article := range articles {
+				assert.Empty(t, article.Content, name)
+				assert.NotEmpty(t, article.Snippet, name)
+			}
+		}
+	})
+
+	t.Run("Export", func(t *testing.T) {
+		w := read(handler.ExportArticles, "/articles/export", "", false)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), `"content"`)
+		assert.Contains(t, w.Body.String(), `"title"`)
+		assert.Contains(t, w.Body.String(), `"snippet"`)
+	})
+
+	t.Run("Popular", func(t *testing.T) {
+		require.NoError(t, handler.searchService.RecordArticleView(context.Background(), 1))
+
+		w := read(handler.GetPopularArticles, "/articles/popular", "", false)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var articles []models.PopularArticle
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &articles))
+		require.NotEmpty(t, articles)
+		assert.Empty(t, articles[0].Content)
+		assert.NotEmpty(t, articles[0].Snippet)
+		assert.NotContains(t, w.Body.String(), `"content"`)
+	})
+
+	search := func(authenticated bool) models.SearchResponse {
+		req := httptest.NewRequest("POST", "/search-query", strings.NewReader(`{"query":"How do I reset my password?"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if authenticated {
+			req = req.WithContext(WithAuthenticated(req.Context()))
+		}
 		w := httptest.NewRecorder()
+		handler.SearchQuery(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
 
-		handler.sendErrorResponse(w, http.StatusBadRequest, "Test Error", "Test Message")
+		var response models.SearchResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.NotEmpty(t, response.AIRelevantArticles)
+		return response
+	}
 
-		assert.Equal(t, http.StatusBadRequest, w.Code)
-		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	t.Run("SearchAnswers", func(t *testing.T) {
+		for _, article := range search(false).AIRelevantArticles {
+			assert.NotEmpty(t, article.Title)
+			assert.Empty(t, article.Content)
+		}
+		for _, article := range search(true).AIRelevantArticles {
+			assert.NotEmpty(t, article.Content)
+		}
+	})
 
-		var response models.ErrorResponse
-		err := json.Unmarshal(w.Body.Bytes(), &response)
-		assert.NoError(t, err)
-		assert.Equal(t, "Test Error", response.Error)
-		assert.Equal(t, "Test Message", response.Message)
+	t.Run("SharedResult", func(t *testing.T) {
+		link, err := handler.searchService.ShareQueryResult(context.Background(), search(true).QueryID)
+		require.NoError(t, err)
+
+		req := httptest.NewRequest("GET", "/shared/"+link.Token, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("token", link.Token)
+		w := httptest.NewRecorder()
+		handler.GetSharedResult(w, req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx)))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var result models.SharedResult
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		require.NotEmpty(t, result.AIRelevantArticles)
+		assert.Empty(t, result.AIRelevantArticles[0].Content)
+		assert.NotContains(t, w.Body.String(), `"content"`)
+	})
+
+	t.Run("HistoryNeedsKey", func(t *testing.T) {
+		w := read(handler.GetArticleHistory, "/articles/1/history", "1", false)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = read(handler.GetArticleHistory, "/articles/1/history", "1", true)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	handler.SetPublicArticleFields(nil)
+
+	t.Run("EverythingPublicByDefault", func(t *testing.T) {
+		w := read(handler.GetArticle, "/articles/1", "1", false)
+
+		var article models.ArticleResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &article))
+		assert.NotEmpty(t, article.Content)
+		assert.Empty(t, article.Snippet)
+		assert.Empty(t, w.Header().Get("Vary"))
 	})
 }
 
@@ -238,7 +2907,7 @@ func TestSearchHandler_EdgeCases(t *testing.T) {
 	defer cleanup()
 
 	t.Run("LargeQuery", func(t *testing.T) {
-		largeQuery := strings.Repeat("test ", 1000) // Very long query
+		largeQuery := strings.Repeat("test ", 400) // Longest allowed query
 		requestBody := models.SearchRequest{
 			Query: largeQuery,
 		}
@@ -323,3 +2992,65 @@ func TestSearchHandler_EdgeCases(t *testing.T) {
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
 }
+
+func TestSearchHandler_ErrorLanguage(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	getArticle := func(id, acceptLanguage string) (*httptest.ResponseRecorder, models.ErrorResponse) {
+		req := httptest.NewRequest("GET", "/articles/"+id+"?format=pdf", nil)
+		if acceptLanguage != "" {
+			req.Header.Set("Accept-Language", acceptLanguage)
+		}
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		handler.GetArticle(w, req)
+
+		var response models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w, response
+	}
+
+	t.Run("English", func(t *testing.T) {
+		w, response := getArticle("1", "")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "Invalid format parameter", response.Error)
+		assert.Equal(t, "format must be 'text' or 'html'", response.Message)
+		assert.Equal(t, "en", w.Header().Get("Content-Language"))
+	})
+
+	t.Run("Spanish", func(t *testing.T) {
+		w, response := getArticle("1", "es-ES,es;q=0.9,en;q=0.8")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "Parámetro format no válido", response.Error)
+		assert.Equal(t, "format debe ser 'text' o 'html'", response.Message)
+		assert.Equal(t, "es", w.Header().Get("Content-Language"))
+		assert.Contains(t, w.Header().Values("Vary"), "Accept-Language")
+	})
+
+	t.Run("UnsupportedLanguageUsesDefault", func(t *testing.T) {
+		handler.SetDefaultLanguage("es")
+		defer handler.SetDefaultLanguage("en")
+
+		_, response := getArticle("abc", "fr-FR")
+
+		assert.Equal(t, "ID de artículo no válido", response.Error)
+	})
+
+	t.Run("ValidationErrors", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/search-query", strings.NewReader(`{"query":""}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept-Language", "es")
+		w := httptest.NewRecorder()
+		handler.ValidateSearchQuery(http.HandlerFunc(handler.SearchQuery)).ServeHTTP(w, req)
+
+		var response models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "La validación falló", response.Error)
+	})
+}
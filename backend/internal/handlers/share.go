@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"event-to-insight/internal/service"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ShareQuery handles POST /queries/{id}/share, minting a short-lived link
+// to the query's latest result that can be read without knowing its IDs
+func (h *SearchHandler) ShareQuery(w http.ResponseWriter, r *http.Request) {
+	setNoStore(w)
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.sendErrorResponse(w, r, http.StatusBadRequest, "Invalid query ID", "")
+		return
+	}
+
+	link, err := h.searchService.ShareQueryResult(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			h.sendErrorResponse(w, r, http.StatusNotFound, "Query result not found", "")
+			return
+		}
+		h.sendStorageError(w, r, "Failed to share query result", err)
+		return
+	}
+
+	link.ExpiresAt = h.inZone(link.ExpiresAt)
+	h.sendJSONResponse(w, r, http.StatusCreated, link)
+}
+
+// GetSharedResult handles GET /shared/{token}, returning the search result
+// a share link gives access to. Unknown tokens get 404 and expired ones 410.
+func (h *SearchHandler) GetSharedResult(w http.ResponseWriter, r *http.Request) {
+	setNoStore(w)
+
+	result, err := h.searchService.GetSharedResult(r.Context(), chi.URLParam(r, "token"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			h.sendErrorResponse(w, r, http.StatusNotFound, "Share link not found", "")
+			return
+		}
+		if errors.Is(err, service.ErrShareExpired) {
+			h.sendErrorResponse(w, r, http.StatusGone, "Share link expired", "")
+			return
+		}
+		h.sendStorageError(w, r, "Failed to get shared result", err)
+		return
+	}
+
+	result.AnsweredAt = h.inZone(result.AnsweredAt)
+	if h.restricted(r) {
+		h.sendJSONResponse(w, r, http.StatusOK, &publicSharedResult{
+			SharedResult:       result,
+			AIRelevantArticles: h.publicArticles(result.AIRelevantArticles),
+		})
+		return
+	}
+	h.sendJSONResponse(w, r, http.StatusOK, result)
+}
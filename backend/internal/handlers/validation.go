@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"errors"
+	"event-to-insight/internal/models"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/go-playground/validator/v10/non-standard/validators"
+)
+
+// validate checks request bodies against their `validate` struct tags
+var validate = newValidator()
+
+// newValidator creates a validator that reports fields by their JSON names
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	v.RegisterValidation("notblank", validators.NotBlank)
+	v.RegisterValidation("relevance", isRelevance)
+	return v
+}
+
+// isRelevance checks that a string is a relevance threshold between 0 and 1
+func isRelevance(fl validator.FieldLevel) bool {
+	value, err := strconv.ParseFloat(fl.Field().String(), 64)
+	return err == nil && value >= 0 && value <= 1
+}
+
+// validateRequest validates a request body and converts any failures into
+// field errors suitable for an ErrorResponse
+func validateRequest(body interface{}) []models.FieldError {
+	err := validate.Struct(body)
+	if err == nil {
+		return nil
+	}
+
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return []models.FieldError{{Message: err.Error()}}
+	}
+
+	fieldErrs := make([]models.FieldError, 0, len(validationErrs))
+	for _, fe := range validationErrs {
+		fieldErrs = append(fieldErrs, models.FieldError{
+			Field:   fe.Field(),
+			Message: fieldErrorMessage(fe),
+		})
+	}
+	return fieldErrs
+}
+
+// fieldErrorMessage describes a single failed validation rule
+func fieldErrorMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return fmt.Sprintf("%s field is required", fe.Field())
+	case "notblank":
+		return fmt.Sprintf("%s cannot be empty", fe.Field())
+	case "min":
+		return fmt.Sprintf("%s must be at least %s %s", fe.Field(), fe.Param(), sizeUnit(fe))
+	case "max":
+		return fmt.Sprintf("%s must be at most %s %s", fe.Field(), fe.Param(), sizeUnit(fe))
+	case "boolean":
+		return fmt.Sprintf("%s must be true or false", fe.Field())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", fe.Field(), strings.Join(strings.Fields(fe.Param()), ", "))
+	case "gt":
+		return fmt.Sprintf("%s must be greater than %s", fe.Field(), fe.Param())
+	case "unique":
+		return fmt.Sprintf("%s must not contain duplicates", fe.Field())
+	case "relevance":
+		return fmt.Sprintf("%s must be between 0 and 1", fe.Field())
+	default:
+		return fmt.Sprintf("%s failed the %s rule", fe.Field(), fe.Tag())
+	}
+}
+
+// sizeUnit names what min and max count for a field: items for lists,
+// characters for strings
+func sizeUnit(fe validator.FieldError) string {
+	switch fe.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return "items"
+	default:
+		return "characters"
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultTopQueriesWindow is how far back top queries look by default
+	defaultTopQueriesWindow = 7 * 24 * time.Hour
+	// defaultTopQueriesLimit is how many top queries are returned by default
+	defaultTopQueriesLimit = 20
+	// maxTopQueriesLimit caps how many top queries a single request can return
+	maxTopQueriesLimit = 100
+)
+
+// parseWindow parses a time window such as "7d" or "12h". Days are accepted
+// in addition to the units understood by time.ParseDuration.
+func parseWindow(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("window must be a positive duration such as 7d or 12h")
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	window, err := time.ParseDuration(value)
+	if err != nil || window <= 0 {
+		return 0, fmt.Errorf("window must be a positive duration such as 7d or 12h")
+	}
+	return window, nil
+}
+
+// parseTopQueriesParams reads the window and limit query parameters
+func parseTopQueriesParams(r *http.Request) (window time.Duration, limit int, err error) {
+	window = defaultTopQueriesWindow
+	limit = defaultTopQueriesLimit
+
+	if value := r.URL.Query().Get("window"); value != "" {
+		window, err = parseWindow(value)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxTopQueriesLimit {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxTopQueriesLimit)
+		}
+	}
+
+	return window, limit, nil
+}
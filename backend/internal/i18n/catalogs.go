@@ -0,0 +1,75 @@
+package i18n
+
+// catalogs maps each language other than English to its translations,
+// keyed by the English message
+var catalogs = map[string]map[string]string{
+	"es": {
+		// Error titles
+		"Validation failed":               "La validación falló",
+		"Invalid request body":            "Cuerpo de la solicitud no válido",
+		"Invalid JSON":                    "JSON no válido",
+		"Request body too large":          "Cuerpo de la solicitud demasiado grande",
+		"Invalid UTF-8":                   "UTF-8 no válido",
+		"Invalid article ID":              "ID de artículo no válido",
+		"Invalid query ID":                "ID de consulta no válido",
+		"Invalid query parameters":        "Parámetros de consulta no válidos",
+		"Invalid pagination parameters":   "Parámetros de paginación no válidos",
+		"Invalid deep parameter":          "Parámetro deep no válido",
+		"Invalid filter":                  "Filtro no válido",
+		"Invalid format parameter":        "Parámetro format no válido",
+		"Invalid min_relevance parameter": "Parámetro min_relevance no válido",
+		"Invalid article_ids":             "article_ids no válido",
+		"Invalid X-AI-Provider header":    "Cabecera X-AI-Provider no válida",
+		"Invalid search request":          "Solicitud de búsqueda no válida",
+		"Article not found":               "Artículo no encontrado",
+		"Query not found":                 "Consulta no encontrada",
+		"Query result not found":          "Resultado de la consulta no encontrado",
+		"Search not computed":             "Búsqueda no calculada",
+		"Share link not found":            "Enlace compartido no encontrado",
+		"Share link expired":              "El enlace compartido ha caducado",
+		"Duplicate article title":         "Título de artículo duplicado",
+		"Too many requests":               "Demasiadas solicitudes",
+		"Search in progress":              "Búsqueda en curso",
+		"Idempotency key reused":          "Clave de idempotencia reutilizada",
+		"Unauthorized":                    "No autorizado",
+		"Not found":                       "No encontrado",
+		"Method not allowed":              "Método no permitido",
+		"Server busy":                     "Servidor ocupado",
+		"Daily search quota exceeded":     "Cuota diaria de búsquedas superada",
+		"AI service unavailable":          "Servicio de IA no disponible",
+		"AI service error":                "Error del servicio de IA",
+		"Database busy":                   "Base de datos ocupada",
+		"Failed to back up database":      "No se pudo hacer la copia de seguridad de la base de datos",
+		"Failed to estimate search query": "No se pudo estimar la consulta de búsqueda",
+		"Failed to export articles":       "No se pudieron exportar los artículos",
+		"Failed to get article history":   "No se pudo obtener el historial del artículo",
+		"Failed to get articles":          "No se pudieron obtener los artículos",
+		"Failed to get popular articles":  "No se pudieron obtener los artículos populares",
+		"Failed to get shared result":     "No se pudo obtener el resultado compartido",
+		"Failed to get stats":             "No se pudieron obtener las estadísticas",
+		"Failed to get top queries":       "No se pudieron obtener las consultas más frecuentes",
+		"Failed to import articles":       "No se pudieron importar los artículos",
+		"Failed to process search batch":  "No se pudo procesar el lote de búsquedas",
+		"Failed to process search query":  "No se pudo procesar la consulta de búsqueda",
+		"Failed to purge queries":         "No se pudieron purgar las consultas",
+		"Failed to record article view":   "No se pudo registrar la visita al artículo",
+		"Failed to reindex articles":      "No se pudieron reindexar los artículos",
+		"Failed to rerun query":           "No se pudo volver a ejecutar la consulta",
+		"Failed to search articles":       "No se pudieron buscar los artículos",
+		"Failed to share query result":    "No se pudo compartir el resultado de la consulta",
+		"Failed to update article":        "No se pudo actualizar el artículo",
+
+		// Fixed messages
+		"q must be valid UTF-8":                             "q debe ser UTF-8 válido",
+		"deep must be true or false":                        "deep debe ser true o false",
+		"format must be 'text' or 'html'":                   "format debe ser 'text' o 'html'",
+		"articles have no categories to filter by":          "los artículos no tienen categorías por las que filtrar",
+		"older_than is required, such as 30d":               "older_than es obligatorio, por ejemplo 30d",
+		"API key is required":                               "Se requiere la clave de API",
+		"Invalid API key":                                   "Clave de API no válida",
+		"too many requests in flight, retry shortly":        "demasiadas solicitudes en curso, vuelva a intentarlo en breve",
+		"run this search with POST /api/search-query first": "ejecute primero esta búsqueda con POST /api/search-query",
+		"a search with this idempotency key is in progress": "hay una búsqueda en curso con esta clave de idempotencia",
+		"idempotency key was used for a different query":    "la clave de idempotencia se usó para otra consulta",
+	},
+}
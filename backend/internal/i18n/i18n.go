@@ -0,0 +1,89 @@
+// Package i18n translates the fixed messages of error responses. Messages
+// are written in English and looked up by their English text, so a message
+// missing from a catalog, such as one naming a specific error, is returned
+// in English.
+package i18n
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLanguage is the language messages are written in
+const DefaultLanguage = "en"
+
+// Supported reports whether messages can be given in lang, a primary
+// language subtag such as "es"
+func Supported(lang string) bool {
+	if lang == DefaultLanguage {
+		return true
+	}
+	_, ok := catalogs[lang]
+	return ok
+}
+
+// Languages lists the supported languages, English first
+func Languages() []string {
+	languages := make([]string, 0, len(catalogs))
+	for lang := range catalogs {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+	return append([]string{DefaultLanguage}, languages...)
+}
+
+// Translate returns message in lang, or unchanged when lang is English or
+// its catalog has no translation for it
+func Translate(lang, message string) string {
+	if translated, ok := catalogs[lang][message]; ok {
+		return translated
+	}
+	return message
+}
+
+// Negotiate picks the supported language a client prefers most in its
+// Accept-Language header, such as "es-MX,es;q=0.9,en;q=0.5". Regions are
+// ignored. It returns fallback when the header names no supported
+// language or accepts any.
+func Negotiate(acceptLanguage, fallback string) string {
+	type preference struct {
+		lang    string
+		quality float64
+	}
+
+	var preferences []preference
+	for _, entry := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(entry), ";")
+		if tag == "" {
+			continue
+		}
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		if quality <= 0 {
+			continue
+		}
+		primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		preferences = append(preferences, preference{lang: primary, quality: quality})
+	}
+	// Equally preferred languages keep the client's order
+	sort.SliceStable(preferences, func(i, j int) bool {
+		return preferences[i].quality > preferences[j].quality
+	})
+
+	for _, p := range preferences {
+		if p.lang == "*" {
+			return fallback
+		}
+		if Supported(p.lang) {
+			return p.lang
+		}
+	}
+	return fallback
+}
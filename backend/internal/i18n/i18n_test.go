@@ -0,0 +1,46 @@
+package i18n
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestNegotiate tests picking a language from an Accept-Language header
+func TestNegotiate(t *testing.T) {
+	t.Run("Supported", func(t *testing.T) {
+		assert.Equal(t, "es", Negotiate("es", "en"))
+		assert.Equal(t, "es", Negotiate("es-MX", "en"))
+		assert.Equal(t, "en", Negotiate("en-GB,es;q=0.5", "es"))
+	})
+
+	t.Run("Quality", func(t *testing.T) {
+		assert.Equal(t, "es", Negotiate("en;q=0.4, es;q=0.9", "en"))
+		assert.Equal(t, "es", Negotiate("fr, es;q=0.8, en;q=0.7", "en"))
+		assert.Equal(t, "en", Negotiate("es;q=0, en;q=0.1", "es"))
+	})
+
+	t.Run("Fallback", func(t *testing.T) {
+		assert.Equal(t, "es", Negotiate("", "es"))
+		assert.Equal(t, "es", Negotiate("fr-CA, de", "es"))
+		assert.Equal(t, "es", Negotiate("*", "es"))
+		assert.Equal(t, "en", Negotiate("es;q=abc", "en"))
+	})
+}
+
+// TestTranslate tests looking up messages in the catalogs
+func TestTranslate(t *testing.T) {
+	assert.Equal(t, "Artículo no encontrado", Translate("es", "Article not found"))
+	assert.Equal(t, "Article not found", Translate("en", "Article not found"))
+	assert.Equal(t, "Article not found", Translate("fr", "Article not found"))
+
+	// Messages naming a specific error are not in the catalogs
+	assert.Equal(t, "unexpected EOF", Translate("es", "unexpected EOF"))
+}
+
+// TestLanguages tests listing the supported languages
+func TestLanguages(t *testing.T) {
+	assert.Equal(t, []string{"en", "es"}, Languages())
+	assert.True(t, Supported("es"))
+	assert.False(t, Supported("fr"))
+}
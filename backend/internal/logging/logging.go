@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+// queryIDKey is the context key of the ID of the query being processed
+type queryIDKey struct{}
+
+// WithQueryID returns a context carrying the ID of the query being
+// processed, so every log line written with it can be correlated
+func WithQueryID(ctx context.Context, queryID int) context.Context {
+	return context.WithValue(ctx, queryIDKey{}, queryID)
+}
+
+// QueryID returns the query ID stored by WithQueryID
+func QueryID(ctx context.Context) (int, bool) {
+	queryID, ok := ctx.Value(queryIDKey{}).(int)
+	return queryID, ok
+}
+
+// New returns a logger that writes to handler, adding the query ID of the
+// context passed to methods such as InfoContext as a query_id attribute
+func New(handler slog.Handler) *slog.Logger {
+	return slog.New(contextHandler{handler})
+}
+
+// contextHandler adds values stored in the context to each record
+type contextHandler struct {
+	slog.Handler
+}
+
+// Handle adds the context's query ID to the record
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if queryID, ok := QueryID(ctx); ok {
+		record.AddAttrs(slog.Int("query_id", queryID))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+// WithAttrs keeps loggers derived with With adding context values
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup keeps loggers derived with WithGroup adding context values
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,53 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogger(t *testing.T) {
+	ctx := context.Background()
+
+	newLogger := func() (*slog.Logger, *bytes.Buffer) {
+		var buf bytes.Buffer
+		return New(slog.NewTextHandler(&buf, nil)), &buf
+	}
+
+	t.Run("AddsQueryID", func(t *testing.T) {
+		logger, buf := newLogger()
+
+		logger.InfoContext(WithQueryID(ctx, 42), "analyzing query")
+
+		assert.Contains(t, buf.String(), "msg=\"analyzing query\" query_id=42")
+	})
+
+	t.Run("WithoutQueryID", func(t *testing.T) {
+		logger, buf := newLogger()
+
+		logger.InfoContext(ctx, "reindexing articles")
+
+		assert.NotContains(t, buf.String(), "query_id")
+	})
+
+	t.Run("DerivedLoggers", func(t *testing.T) {
+		logger, buf := newLogger()
+
+		logger.With("component", "search").WithGroup("ai").InfoContext(WithQueryID(ctx, 7), "done", "cached", true)
+
+		assert.Contains(t, buf.String(), "component=search")
+		assert.Contains(t, buf.String(), "ai.query_id=7")
+	})
+
+	t.Run("QueryIDRoundTrip", func(t *testing.T) {
+		_, ok := QueryID(ctx)
+		assert.False(t, ok)
+
+		queryID, ok := QueryID(WithQueryID(ctx, 3))
+		assert.True(t, ok)
+		assert.Equal(t, 3, queryID)
+	})
+}
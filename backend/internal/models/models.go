@@ -1,12 +1,104 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Article represents a knowledge base article
 type Article struct {
 	ID      int    `json:"id" db:"id"`
 	Title   string `json:"title" db:"title"`
 	Content string `json:"content" db:"content"`
+	// Keywords are curated, comma-separated terms the AI is shown alongside
+	// the content, so it can match on them rather than the full prose
+	Keywords string `json:"keywords,omitempty" db:"keywords"`
+	// Summary is a one-paragraph abstract of the content, written by the AI
+	// on import when AUTO_SUMMARIZE is enabled
+	Summary string `json:"summary,omitempty" db:"summary"`
+	// Score is how well the article matched a search, between 0 and 1. It
+	// is only set in search responses.
+	Score float64 `json:"score,omitempty" db:"-"`
+	// UpdatedAt is when the article was created or last edited. It breaks
+	// ties between equally relevant articles and is not sent to clients.
+	UpdatedAt time.Time `json:"-" db:"updated_at"`
+}
+
+// ArticleResponse is an article as returned by the article endpoints, with
+// the length of its content for showing reading time. The counts are
+// computed from the stored content when responding and are not stored.
+type ArticleResponse struct {
+	Article
+	WordCount int `json:"word_count"`
+	CharCount int `json:"char_count"`
+	// Snippet is the start of the content, given to clients without the
+	// API key in place of content they may not read
+	Snippet string `json:"snippet,omitempty"`
+}
+
+// ArticleVersion is the content an article had before an edit
+type ArticleVersion struct {
+	ID        int       `json:"id" db:"id"`
+	ArticleID int       `json:"article_id" db:"article_id"`
+	Title     string    `json:"title" db:"title"`
+	Content   string    `json:"content" db:"content"`
+	EditedAt  time.Time `json:"edited_at" db:"edited_at"`
+}
+
+// PopularArticle represents an article together with its view count
+type PopularArticle struct {
+	Article
+	ViewCount    int       `json:"view_count" db:"view_count"`
+	LastViewedAt time.Time `json:"last_viewed_at" db:"last_viewed_at"`
+	// Snippet is the start of the content, given to clients without the
+	// API key in place of content they may not read
+	Snippet string `json:"snippet,omitempty" db:"-"`
+}
+
+// Health states reported for the service and each of its dependencies
+const (
+	HealthStatusHealthy   = "healthy"
+	HealthStatusDegraded  = "degraded"
+	HealthStatusUnhealthy = "unhealthy"
+
+	DependencyOK          = "ok"
+	DependencyDegraded    = "degraded"
+	DependencyUnavailable = "unavailable"
+)
+
+// HealthStatus is the response of the health check
+type HealthStatus struct {
+	Status       string            `json:"status"`
+	Service      string            `json:"service"`
+	Dependencies map[string]string `json:"dependencies"`
+	Warnings     []string          `json:"warnings,omitempty"`
+	// AICircuit is the state of the AI provider's circuit breaker: closed,
+	// open or half-open. It is omitted when the breaker is disabled.
+	AICircuit string `json:"ai_circuit,omitempty"`
+	// AIFallbacks counts searches answered by keyword matching since the
+	// server started because the AI provider kept failing
+	AIFallbacks int64 `json:"ai_fallbacks,omitempty"`
+	// DiskFreeBytes is the space left on the database's filesystem. Only
+	// deep checks measure it.
+	DiskFreeBytes *uint64 `json:"disk_free_bytes,omitempty"`
+	// InFlightRequests is how many other requests were being served
+	InFlightRequests int64 `json:"in_flight_requests"`
+	// StartedAt is when the server started, and Time when the check ran
+	StartedAt     time.Time `json:"started_at"`
+	UptimeSeconds int64     `json:"uptime_seconds"`
+	Time          time.Time `json:"time"`
+}
+
+// Metrics is the response of GET /metrics
+type Metrics struct {
+	// InFlightRequests is how many requests were being served, not
+	// counting health checks and metrics reads
+	InFlightRequests int64 `json:"in_flight_requests"`
+	// MaxInFlightRequests is the most served at once before new ones get
+	// 503, zero for no limit
+	MaxInFlightRequests int64 `json:"max_in_flight_requests"`
+	// RejectedRequests counts the requests turned away since startup
+	RejectedRequests int64 `json:"rejected_requests"`
 }
 
 // Query represents a user search query
@@ -16,6 +108,23 @@ type Query struct {
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
+// TopQuery is a frequently asked query, grouped by its normalized text
+type TopQuery struct {
+	Query       string    `json:"query"`
+	Count       int       `json:"count"`
+	LastAskedAt time.Time `json:"last_asked_at"`
+}
+
+// IdempotencyRecord is a search reserved under an idempotency key. Response
+// holds the JSON of the search's response, and is nil while the search is
+// still running.
+type IdempotencyRecord struct {
+	Key       string    `json:"key"`
+	Query     string    `json:"query"`
+	Response  []byte    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 // SearchResult represents the result of a search query
 type SearchResult struct {
 	ID                 int       `json:"id" db:"id"`
@@ -23,11 +132,26 @@ type SearchResult struct {
 	AISummaryAnswer    string    `json:"ai_summary_answer" db:"ai_summary_answer"`
 	AIRelevantArticles []int     `json:"ai_relevant_articles"` // JSON array in DB
 	CreatedAt          time.Time `json:"created_at" db:"created_at"`
+	// Scores are the AI's scores of the relevant articles it rated, by
+	// article ID
+	Scores map[int]float64 `json:"-"`
+}
+
+// MarshalJSON writes a result without articles as an empty array rather
+// than null, so clients always get an array
+func (r SearchResult) MarshalJSON() ([]byte, error) {
+	type plain SearchResult
+	if r.AIRelevantArticles == nil {
+		r.AIRelevantArticles = []int{}
+	}
+	return json.Marshal(plain(r))
 }
 
 // SearchRequest represents the incoming search request
 type SearchRequest struct {
-	Query string `json:"query" validate:"required,min=1"`
+	Query string `json:"query" validate:"required,notblank,max=2000"`
+	// ArticleIDs optionally scopes the search to these articles
+	ArticleIDs []int `json:"article_ids,omitempty"`
 }
 
 // SearchResponse represents the search response
@@ -35,12 +159,157 @@ type SearchResponse struct {
 	Query              string    `json:"query"`
 	AISummaryAnswer    string    `json:"ai_summary_answer"`
 	AIRelevantArticles []Article `json:"ai_relevant_articles"`
-	QueryID            int       `json:"query_id"`
-	Timestamp          time.Time `json:"timestamp"`
+	// SuggestedArticles are keyword matches offered when the AI found none
+	SuggestedArticles []Article `json:"suggested_articles,omitempty"`
+	QueryID           int       `json:"query_id"`
+	// ResultID identifies the stored answer, so feedback can refer to it.
+	// It is zero for dry runs, which store nothing.
+	ResultID  int       `json:"result_id,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	// DryRun is set when nothing was persisted for this search
+	DryRun bool `json:"dry_run,omitempty"`
+	// KnowledgeBaseEmpty is set when there were no articles to search
+	KnowledgeBaseEmpty bool `json:"knowledge_base_empty,omitempty"`
+	// Escalate is set when the query should be raised with IT immediately
+	Escalate bool `json:"escalate,omitempty"`
+	// ArticlesConsidered is how many articles the AI was given to answer from
+	ArticlesConsidered int `json:"articles_considered"`
+	// DroppedArticleIDs are article IDs the AI cited that do not exist,
+	// reported for debugging
+	DroppedArticleIDs []int `json:"dropped_article_ids,omitempty"`
+	// FinishReason is why the AI stopped generating, reported in debug mode
+	FinishReason string `json:"finish_reason,omitempty"`
+	// AIFallback is set when the AI provider kept failing, so the answer
+	// came from keyword matching instead
+	AIFallback bool `json:"ai_fallback,omitempty"`
+	// Truncated is set when a limit hid part of the knowledge base from the
+	// answer; Notes explain which limits applied
+	Truncated bool     `json:"truncated,omitempty"`
+	Notes     []string `json:"notes,omitempty"`
+}
+
+// ShareLink gives read-only access to one search result until it expires.
+// URL is the path the result is read from.
+type ShareLink struct {
+	Token     string    `json:"token"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SharedResult is a search result read through a share link. It leaves out
+// the query and result IDs.
+type SharedResult struct {
+	Query              string    `json:"query"`
+	AISummaryAnswer    string    `json:"ai_summary_answer"`
+	AIRelevantArticles []Article `json:"ai_relevant_articles"`
+	AnsweredAt         time.Time `json:"answered_at"`
+}
+
+// BatchSearchResult is the outcome of one query in a batch search. Exactly
+// one of Result and Error is set.
+type BatchSearchResult struct {
+	Query  string          `json:"query"`
+	Result *SearchResponse `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Stats summarizes the contents of the database
+type Stats struct {
+	TotalArticles       int     `json:"total_articles"`
+	TotalQueries        int     `json:"total_queries"`
+	TotalSearchResults  int     `json:"total_search_results"`
+	QueriesLast24h      int     `json:"queries_last_24h"`
+	AvgRelevantArticles float64 `json:"avg_relevant_articles_per_query"`
+}
+
+// Readiness states reported by the readiness check
+const (
+	ReadyStatusReady     = "ready"
+	ReadyStatusWarmingUp = "warming_up"
+)
+
+// ReadyStatus is the response of the readiness check
+type ReadyStatus struct {
+	Status string `json:"status"`
+}
+
+// QueryValidation is the response of POST /search-query/validate. Errors
+// is empty, not null, when the query is valid.
+type QueryValidation struct {
+	Valid  bool     `json:"valid"`
+	Errors []string `json:"errors"`
+}
+
+// SearchEstimate is the response of POST /search-query/estimate: the size
+// of the prompt a search would send and what the AI call would cost at
+// most, assuming the answer uses all of MaxOutputTokens
+type SearchEstimate struct {
+	Provider             string  `json:"provider"`
+	ArticlesConsidered   int     `json:"articles_considered"`
+	PromptChars          int     `json:"prompt_chars"`
+	EstimatedInputTokens int     `json:"estimated_input_tokens"`
+	MaxOutputTokens      int     `json:"max_output_tokens"`
+	EstimatedCost        float64 `json:"estimated_cost"`
+}
+
+// ReindexResult reports the outcome of rebuilding the search index
+type ReindexResult struct {
+	ArticlesIndexed int   `json:"articles_indexed"`
+	DurationMS      int64 `json:"duration_ms"`
+}
+
+// PurgeResult reports how many old queries and their results were deleted
+type PurgeResult struct {
+	QueriesDeleted       int `json:"queries_deleted"`
+	ResultsDeleted       int `json:"results_deleted"`
+	ExpiredSharesDeleted int `json:"expired_shares_deleted"`
+}
+
+// ImportResult lists the articles created by a bulk import
+type ImportResult struct {
+	ArticlesImported int       `json:"articles_imported"`
+	Articles         []Article `json:"articles"`
 }
 
 // ErrorResponse represents an error response
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message,omitempty"`
+	Error   string       `json:"error"`
+	Message string       `json:"message,omitempty"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+// DataEnvelope wraps a successful response when the response envelope is
+// enabled
+type DataEnvelope struct {
+	Data interface{}  `json:"data"`
+	Meta ResponseMeta `json:"meta"`
+}
+
+// ResponseMeta describes the request an enveloped response answers
+type ResponseMeta struct {
+	RequestID string    `json:"request_id,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ErrorEnvelope wraps an error response when the response envelope is
+// enabled
+type ErrorEnvelope struct {
+	Error EnvelopeError `json:"error"`
+}
+
+// EnvelopeError is an error in the envelope format. Code is the HTTP
+// status; Message and Detail match ErrorResponse's error and message.
+type EnvelopeError struct {
+	Code    int          `json:"code"`
+	Message string       `json:"message"`
+	Detail  string       `json:"detail,omitempty"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError describes why a single request field failed validation. Index
+// is the position of the failing item when the request holds a list.
+type FieldError struct {
+	Index   *int   `json:"index,omitempty"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
 }
@@ -54,6 +54,11 @@ func TestArticleModel(t *testing.T) {
 		assert.Equal(t, 0, article.ID)
 		assert.Equal(t, "", article.Title)
 		assert.Equal(t, "", article.Content)
+
+		// Empty content is still sent, projections are left to the handlers
+		jsonData, err := json.Marshal(article)
+		assert.NoError(t, err)
+		assert.Contains(t, string(jsonData), `"content":""`)
 	})
 
 	t.Run("ArticleWithLongContent", func(t *testing.T) {
@@ -207,10 +212,10 @@ func TestSearchResultModel(t *testing.T) {
 
 		assert.Nil(t, result.AIRelevantArticles)
 
-		// Test JSON handling of nil slice
+		// A nil slice is written as an empty array
 		jsonData, err := json.Marshal(result)
 		assert.NoError(t, err)
-		assert.Contains(t, string(jsonData), `"ai_relevant_articles":null`)
+		assert.Contains(t, string(jsonData), `"ai_relevant_articles":[]`)
 	})
 
 	t.Run("SearchResultWithLargeRelevantArticles", func(t *testing.T) {
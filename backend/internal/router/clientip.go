@@ -0,0 +1,91 @@
+package router
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// clientIPKey is the context key of the resolved client IP
+type clientIPKey struct{}
+
+// ClientIP resolves the IP of the client behind a request. X-Forwarded-For
+// and X-Real-IP are only believed when the connecting peer is one of the
+// trusted proxies, so clients cannot spoof their address by sending the
+// headers themselves. The IP is stored in the request context and in
+// r.RemoteAddr, so the request log shows it.
+func ClientIP(trusted []netip.Prefix) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := resolveClientIP(r, trusted)
+			r = r.WithContext(context.WithValue(r.Context(), clientIPKey{}, ip))
+			r.RemoteAddr = ip
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIPFromContext returns the client IP resolved by ClientIP, or an
+// empty string when the middleware did not run
+func ClientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// resolveClientIP returns the client's IP. X-Forwarded-For is read from the
+// right, skipping trusted proxies, since earlier entries can be forged by
+// the client.
+func resolveClientIP(r *http.Request, trusted []netip.Prefix) string {
+	peer, ok := parseIP(r.RemoteAddr)
+	if !ok {
+		return r.RemoteAddr
+	}
+	if !isTrusted(peer, trusted) {
+		return peer.String()
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		client := peer
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop, ok := parseIP(strings.TrimSpace(hops[i]))
+			if !ok {
+				break
+			}
+			client = hop
+			if !isTrusted(hop, trusted) {
+				break
+			}
+		}
+		return client.String()
+	}
+
+	if realIP, ok := parseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ok {
+		return realIP.String()
+	}
+	return peer.String()
+}
+
+// parseIP parses an address with or without a port
+func parseIP(addr string) (netip.Addr, bool) {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap(), true
+}
+
+// isTrusted reports whether ip is in one of the trusted proxy ranges
+func isTrusted(ip netip.Addr, trusted []netip.Prefix) bool {
+	for _, prefix := range trusted {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
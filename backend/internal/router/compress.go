@@ -0,0 +1,143 @@
+package router
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// Compress gzips response bodies for clients that send Accept-Encoding: gzip.
+// Bodies smaller than minSize are sent uncompressed since the gzip framing
+// would outweigh any savings.
+func Compress(minSize int) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !acceptsGzip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, minSize: minSize, status: http.StatusOK}
+			defer cw.finish()
+
+			w.Header().Add("Vary", "Accept-Encoding")
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// acceptsGzip reports whether the request accepts gzip encoded responses
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		encoding = strings.TrimSpace(strings.SplitN(encoding, ";", 2)[0])
+		if strings.EqualFold(encoding, "gzip") {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter buffers the response until it knows whether the body is
+// large enough to be worth compressing
+type compressWriter struct {
+	http.ResponseWriter
+	minSize     int
+	status      int
+	wroteHeader bool
+	buf         bytes.Buffer
+	gz          *gzip.Writer
+	passthrough bool
+}
+
+// Unwrap returns the underlying writer, so http.ResponseController can
+// reach it to change deadlines
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// WriteHeader records the status code; it is sent once the encoding is known
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = code
+}
+
+// Write buffers small bodies and switches to gzip once minSize is reached
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	cw.wroteHeader = true
+
+	switch {
+	case cw.gz != nil:
+		return cw.gz.Write(p)
+	case cw.passthrough:
+		return cw.ResponseWriter.Write(p)
+	}
+
+	cw.buf.Write(p)
+	if cw.buf.Len() >= cw.minSize {
+		if err := cw.startGzip(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush starts compressing immediately so streamed responses reach the client
+func (cw *compressWriter) Flush() {
+	if cw.gz == nil && !cw.passthrough {
+		if err := cw.startGzip(); err != nil {
+			return
+		}
+	}
+	if cw.gz != nil {
+		cw.gz.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// startGzip sends the headers for a compressed response and writes any
+// buffered bytes through the gzip writer
+func (cw *compressWriter) startGzip() error {
+	header := cw.Header()
+	if header.Get("Content-Encoding") != "" || !bodyAllowed(cw.status) {
+		cw.passthrough = true
+		cw.ResponseWriter.WriteHeader(cw.status)
+		_, err := cw.ResponseWriter.Write(cw.buf.Bytes())
+		cw.buf.Reset()
+		return err
+	}
+
+	header.Set("Content-Encoding", "gzip")
+	header.Del("Content-Length")
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	cw.gz = gzip.NewWriter(cw.ResponseWriter)
+	_, err := cw.gz.Write(cw.buf.Bytes())
+	cw.buf.Reset()
+	return err
+}
+
+// finish writes out a buffered body that never reached minSize, or closes
+// the gzip stream
+func (cw *compressWriter) finish() {
+	switch {
+	case cw.gz != nil:
+		cw.gz.Close()
+	case cw.passthrough:
+	default:
+		cw.ResponseWriter.WriteHeader(cw.status)
+		if cw.buf.Len() > 0 {
+			cw.ResponseWriter.Write(cw.buf.Bytes())
+		}
+	}
+}
+
+// bodyAllowed reports whether the status code permits a response body
+func bodyAllowed(status int) bool {
+	return status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified
+}
@@ -0,0 +1,54 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// routeMethods are the methods checked when building an Allow header
+var routeMethods = []string{
+	http.MethodGet,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+// notFound responds with a JSON error for paths that match no route
+func notFound(errs ErrorWriter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		errs.SendError(w, r, http.StatusNotFound, "Not found", fmt.Sprintf("no route for %s", r.URL.Path))
+	}
+}
+
+// methodNotAllowed responds to requests whose path exists under a different
+// method. The Allow header lists the methods the route accepts. OPTIONS
+// requests are answered with 204 and the same header.
+func methodNotAllowed(mux *chi.Mux, errs ErrorWriter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", strings.Join(allowedMethods(mux, r.URL.Path), ", "))
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		errs.SendError(w, r, http.StatusMethodNotAllowed, "Method not allowed",
+			fmt.Sprintf("%s is not supported for %s", r.Method, r.URL.Path))
+	}
+}
+
+// allowedMethods returns the methods routed for path, always including
+// OPTIONS
+func allowedMethods(mux *chi.Mux, path string) []string {
+	var allowed []string
+	for _, method := range routeMethods {
+		if mux.Match(chi.NewRouteContext(), method, path) {
+			allowed = append(allowed, method)
+		}
+	}
+	return append(allowed, http.MethodOptions)
+}
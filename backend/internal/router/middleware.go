@@ -0,0 +1,168 @@
+package router
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"event-to-insight/internal/handlers"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// AdminAuth protects admin and write endpoints with a shared API key sent
+// either as a bearer token or in the X-API-Key header. When no key is
+// configured the middleware is a no-op so local development keeps working.
+func AdminAuth(apiKey string, errs ErrorWriter) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if apiKey == "" {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			provided := providedAPIKey(r)
+			if provided == "" {
+				errs.SendError(w, r, http.StatusUnauthorized, "Unauthorized", "API key is required")
+				return
+			}
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(apiKey)) != 1 {
+				errs.SendError(w, r, http.StatusUnauthorized, "Unauthorized", "Invalid API key")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(handlers.WithAuthenticated(r.Context())))
+		})
+	}
+}
+
+// LimitInFlight counts each request as in flight while it is served,
+// answering 503 with Retry-After once inFlight's limit is reached. Requests
+// to the exempt paths, such as health probes, are neither counted nor
+// turned away, so an overloaded server still reports its state.
+func LimitInFlight(inFlight *handlers.InFlight, errs ErrorWriter, exempt ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, path := range exempt {
+				if r.URL.Path == path {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			if !inFlight.Acquire() {
+				w.Header().Set("Retry-After", "1")
+				errs.SendError(w, r, http.StatusServiceUnavailable, "Server busy", "too many requests in flight, retry shortly")
+				return
+			}
+			defer inFlight.Release()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// OptionalAuth lets requests through with or without the API key, marking
+// those that carry it as authenticated so handlers can show them more. A
+// wrong key is still rejected. When no key is configured every request
+// counts as authenticated.
+func OptionalAuth(apiKey string, errs ErrorWriter) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			provided := providedAPIKey(r)
+			switch {
+			case apiKey == "":
+				// Without a key there is nothing to hold back
+			case provided == "":
+				next.ServeHTTP(w, r)
+				return
+			case subtle.ConstantTimeCompare([]byte(provided), []byte(apiKey)) != 1:
+				errs.SendError(w, r, http.StatusUnauthorized, "Unauthorized", "Invalid API key")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(handlers.WithAuthenticated(r.Context())))
+		})
+	}
+}
+
+// providedAPIKey returns the API key a request carries in the X-API-Key
+// header or as a bearer token
+func providedAPIKey(r *http.Request) string {
+	provided := r.Header.Get("X-API-Key")
+	if auth := r.Header.Get("Authorization"); provided == "" && strings.HasPrefix(auth, "Bearer ") {
+		provided = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return provided
+}
+
+// MaxBodySize limits request bodies to limit bytes. Requests that declare a
+// larger Content-Length are rejected up front; bodies without a declared
+// length are cut off by http.MaxBytesReader so handlers can report a 413.
+func MaxBodySize(limit int64, errs ErrorWriter) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				errs.SendError(w, r, http.StatusRequestEntityTooLarge, "Request body too large", "")
+				return
+			}
+
+			if r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, limit)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// BufferBody reads the request body into memory so it can be read more
+// than once: r.Body is replaced by a copy and r.GetBody returns a fresh one,
+// so middleware can inspect the body and the handler still decode it. It
+// must run after MaxBodySize, which bounds what is buffered. Streamed
+// bodies, such as file uploads, are passed through unread.
+func BufferBody(errs ErrorWriter) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body == nil || r.Body == http.NoBody || isStreamed(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			data, err := io.ReadAll(r.Body)
+			r.Body.Close()
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					errs.SendError(w, r, http.StatusRequestEntityTooLarge, "Request body too large", "")
+					return
+				}
+				errs.SendError(w, r, http.StatusBadRequest, "Invalid request body", err.Error())
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(data))
+			r.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(data)), nil
+			}
+			r.ContentLength = int64(len(data))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isStreamed reports whether a request body is meant to be streamed
+// rather than held in memory
+func isStreamed(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/octet-stream" || strings.HasPrefix(mediaType, "multipart/")
+}
+
+// ErrorWriter writes the error responses of middleware that runs before
+// the handlers. *handlers.SearchHandler is one, so these errors come in the
+// same format and language as the handlers' own.
+type ErrorWriter interface {
+	SendError(w http.ResponseWriter, r *http.Request, statusCode int, error string, message string)
+}
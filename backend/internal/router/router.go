@@ -1,7 +1,9 @@
 package router
 
 import (
+	"event-to-insight/internal/config"
 	"event-to-insight/internal/handlers"
+	"net/http"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -9,14 +11,39 @@ import (
 	"github.com/go-chi/cors"
 )
 
-// SetupRouter sets up the HTTP router with all routes
+// SetupRouter sets up the HTTP router with all routes using the default configuration
 func SetupRouter(searchHandler *handlers.SearchHandler) *chi.Mux {
+	return SetupRouterWithConfig(searchHandler, config.DefaultConfig())
+}
+
+// SetupRouterWithConfig sets up the HTTP router with all routes
+func SetupRouterWithConfig(searchHandler *handlers.SearchHandler, cfg *config.Config) *chi.Mux {
 	r := chi.NewRouter()
 
+	// Keep error responses JSON, like the rest of the API
+	r.NotFound(notFound(searchHandler))
+	r.MethodNotAllowed(methodNotAllowed(r, searchHandler))
+
+	// Invalid entries are rejected when the configuration is validated at
+	// startup; if any slip through, no proxy is trusted
+	trustedProxies, _ := cfg.TrustedProxyPrefixes()
+
+	// Health probes and metrics stay answerable while requests are shed
+	inFlight := handlers.NewInFlight(0)
+	if searchHandler != nil {
+		inFlight = searchHandler.InFlight()
+	}
+
 	// Middleware
+	r.Use(middleware.RequestID)
+	r.Use(Tracing)
+	r.Use(ClientIP(trustedProxies))
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(60 * time.Second))
+	r.Use(LimitInFlight(inFlight, searchHandler, "/api/health", "/api/ready", "/api/metrics"))
+	r.Use(Compress(cfg.CompressMinBytes))
+	r.Use(MaxBodySize(cfg.MaxBodyBytes, searchHandler))
+	r.Use(BufferBody(searchHandler))
 
 	// CORS configuration
 	r.Use(cors.Handler(cors.Options{
@@ -26,9 +53,13 @@ func SetupRouter(searchHandler *handlers.SearchHandler) *chi.Mux {
 			"Accept",
 			"Accept-Language",
 			"Access-Control-Request-Headers",
+			"Authorization",
 			"Access-Control-Request-Method",
 			"Connection",
 			"Content-Type",
+			"Idempotency-Key",
+			"X-AI-Provider",
+			"X-API-Key",
 			"Origin",
 			"Referer",
 			"Sec-Fetch-Dest",
@@ -38,23 +69,86 @@ func SetupRouter(searchHandler *handlers.SearchHandler) *chi.Mux {
 			"sec-ch-ua-platform",
 			"sec-ch-ua",
 			"sec-ch-ua-mobile"},
-		ExposedHeaders:   []string{"Link"},
+		ExposedHeaders:   []string{"Link", "ETag", "Retry-After"},
 		AllowCredentials: true,
-		MaxAge:           300,
+		MaxAge:           cfg.CORSMaxAge,
 	}))
 
 	// Routes
 	r.Route("/api", func(r chi.Router) {
-		// Health check
-		r.Get("/health", searchHandler.HealthCheck)
+		// Health checks and article reads are cheap, so they give up early
+		r.Group(func(r chi.Router) {
+			r.Use(routeTimeout(cfg.ReadRouteTimeout))
+
+			r.Get("/health", searchHandler.HealthCheck)
+			r.Get("/ready", searchHandler.ReadyCheck)
+			r.Get("/metrics", searchHandler.Metrics)
+		})
+
+		// Reads are open to everyone, but key holders may see more fields
+		r.Group(func(r chi.Router) {
+			r.Use(routeTimeout(cfg.ReadRouteTimeout))
+			r.Use(OptionalAuth(cfg.AdminAPIKey, searchHandler))
+
+			r.Get("/articles", searchHandler.GetAllArticles)
+			r.Get("/articles/popular", searchHandler.GetPopularArticles)
+			r.Get("/articles/search", searchHandler.SearchArticles)
+			r.Get("/articles/{id}", searchHandler.GetArticle)
+			r.Get("/articles/{id}/history", searchHandler.GetArticleHistory)
+			r.Get("/shared/{token}", searchHandler.GetSharedResult)
+		})
 
-		// Search endpoints
-		r.Post("/search-query", searchHandler.SearchQuery)
+		// The export streams the whole knowledge base, so it runs until it
+		// is done or the client goes away
+		r.With(OptionalAuth(cfg.AdminAPIKey, searchHandler)).Get("/articles/export", searchHandler.ExportArticles)
 
-		// Article endpoints
-		r.Get("/articles", searchHandler.GetAllArticles)
-		r.Get("/articles/{id}", searchHandler.GetArticle)
+		// Searches wait on the AI provider. Their articles are limited to
+		// the public fields like the reads above.
+		r.Group(func(r chi.Router) {
+			r.Use(routeTimeout(cfg.SearchRouteTimeout))
+			r.Use(OptionalAuth(cfg.AdminAPIKey, searchHandler))
+
+			r.Get("/search-query", searchHandler.SharedSearch)
+			r.With(searchHandler.ValidateSearchQuery).Post("/search-query", searchHandler.SearchQuery)
+			r.Post("/search-query/batch", searchHandler.SearchBatch)
+			r.With(AdminAuth(cfg.AdminAPIKey, searchHandler)).Post("/queries/{id}/rerun", searchHandler.RerunQuery)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(routeTimeout(cfg.RouteTimeout))
+
+			r.With(AdminAuth(cfg.AdminAPIKey, searchHandler)).Put("/articles/{id}", searchHandler.UpdateArticle)
+			r.Post("/articles/{id}/view", searchHandler.RecordArticleView)
+			r.Post("/search-query/validate", searchHandler.CheckSearchQuery)
+			r.With(searchHandler.ValidateSearchQuery).Post("/search-query/estimate", searchHandler.EstimateSearchQuery)
+
+			// Stats and top queries expose what users ask, so they share the admin key
+			r.With(AdminAuth(cfg.AdminAPIKey, searchHandler)).Get("/stats", searchHandler.GetStats)
+			r.With(AdminAuth(cfg.AdminAPIKey, searchHandler)).Get("/queries/top", searchHandler.TopQueries)
+			// Query IDs are sequential, so sharing is kept to agents holding the key
+			r.With(AdminAuth(cfg.AdminAPIKey, searchHandler)).Post("/queries/{id}/share", searchHandler.ShareQuery)
+
+			// Admin endpoints
+			r.Route("/admin", func(r chi.Router) {
+				r.Use(AdminAuth(cfg.AdminAPIKey, searchHandler))
+
+				r.Post("/reindex", searchHandler.Reindex)
+				r.Post("/purge", searchHandler.Purge)
+				r.Get("/backup", searchHandler.Backup)
+				r.Get("/config", searchHandler.GetConfig)
+				r.Post("/articles/import", searchHandler.ImportArticles)
+			})
+		})
 	})
 
 	return r
 }
+
+// routeTimeout cancels a request's context after timeout, answering 504
+// once the handler gives up. Zero or less applies no limit.
+func routeTimeout(timeout time.Duration) func(next http.Handler) http.Handler {
+	if timeout <= 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	return middleware.Timeout(timeout)
+}
@@ -1,18 +1,33 @@
 package router
 
 import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
 	"event-to-insight/internal/ai"
+	"event-to-insight/internal/config"
 	"event-to-insight/internal/database"
 	"event-to-insight/internal/handlers"
+	"event-to-insight/internal/models"
 	"event-to-insight/internal/service"
+	"event-to-insight/internal/tracing"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // setupTestRouter creates a test router with all dependencies
@@ -78,6 +93,49 @@ func TestRouterMiddleware(t *testing.T) {
 		assert.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), "GET")
 	})
 
+	t.Run("PreflightCaching", func(t *testing.T) {
+		cfg := config.DefaultConfig()
+		cfg.CORSMaxAge = 600
+		router := SetupRouterWithConfig(handlers.NewSearchHandler(nil), cfg)
+
+		req := httptest.NewRequest("OPTIONS", "/api/search-query", nil)
+		req.Header.Set("Origin", "http://localhost:3000")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		req.Header.Set("Access-Control-Request-Headers", "Content-Type, Idempotency-Key")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+		assert.Equal(t, "POST", w.Header().Get("Access-Control-Allow-Methods"))
+		assert.Equal(t, "Content-Type, Idempotency-Key", w.Header().Get("Access-Control-Allow-Headers"))
+	})
+
+	t.Run("PreflightWithAPIKey", func(t *testing.T) {
+		for _, header := range []string{"X-API-Key", "Authorization"} {
+			req := httptest.NewRequest("OPTIONS", "/api/admin/reindex", nil)
+			req.Header.Set("Origin", "http://localhost:3000")
+			req.Header.Set("Access-Control-Request-Method", "POST")
+			req.Header.Set("Access-Control-Request-Headers", header)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.CanonicalHeaderKey(header), w.Header().Get("Access-Control-Allow-Headers"))
+		}
+	})
+
+	t.Run("DefaultPreflightMaxAge", func(t *testing.T) {
+		req := httptest.NewRequest("OPTIONS", "/api/health", nil)
+		req.Header.Set("Origin", "http://localhost:3000")
+		req.Header.Set("Access-Control-Request-Method", "GET")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, "300", w.Header().Get("Access-Control-Max-Age"))
+	})
+
 	t.Run("RequestLogging", func(t *testing.T) {
 		req := httptest.NewRequest("GET", "/api/health", nil)
 		w := httptest.NewRecorder()
@@ -144,6 +202,35 @@ func TestRouterRoutes(t *testing.T) {
 		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
 	})
 
+	t.Run("PopularArticlesEndpoint", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/articles/popular", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	})
+
+	t.Run("ArticleSearchEndpoint", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/articles/search?q=vpn", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	})
+
+	t.Run("ArticleViewEndpoint", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/articles/1/view", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+	})
+
 	t.Run("SearchEndpoint", func(t *testing.T) {
 		req := httptest.NewRequest("POST", "/api/search-query", nil)
 		w := httptest.NewRecorder()
@@ -154,6 +241,39 @@ func TestRouterRoutes(t *testing.T) {
 		assert.NotEqual(t, http.StatusNotFound, w.Code)
 	})
 
+	t.Run("SharedSearchEndpoint", func(t *testing.T) {
+		post := httptest.NewRequest("POST", "/api/search-query", strings.NewReader(`{"query":"printer jam"}`))
+		router.ServeHTTP(httptest.NewRecorder(), post)
+
+		req := httptest.NewRequest("GET", "/api/search-query?q=printer+jam", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	})
+
+	t.Run("BatchSearchEndpoint", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/search-query/batch", strings.NewReader(`{"queries": ["vpn help"]}`))
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	})
+
+	t.Run("ValidateSearchEndpoint", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/search-query/validate", strings.NewReader(`{"query": ""}`))
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"valid":false`)
+	})
+
 	t.Run("NonExistentRoute", func(t *testing.T) {
 		req := httptest.NewRequest("GET", "/api/nonexistent", nil)
 		w := httptest.NewRecorder()
@@ -182,6 +302,54 @@ func TestRouterRoutes(t *testing.T) {
 	})
 }
 
+// TestRouterErrorsMatchHandlers tests that errors written before a handler
+// is reached use the handlers' envelope and language
+func TestRouterErrorsMatchHandlers(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.AdminAPIKey = "admin-secret"
+	cfg.MaxBodyBytes = 16
+	handler := handlers.NewSearchHandler(nil)
+	handler.SetResponseEnvelope(true)
+	router := SetupRouterWithConfig(handler, cfg)
+
+	requests := map[string]struct {
+		req     *http.Request
+		code    int
+		message string
+	}{
+		"NotFound":         {httptest.NewRequest("GET", "/api/nonexistent", nil), http.StatusNotFound, "No encontrado"},
+		"MethodNotAllowed": {httptest.NewRequest("DELETE", "/api/health", nil), http.StatusMethodNotAllowed, "Método no permitido"},
+		"AdminAuth":        {httptest.NewRequest("GET", "/api/stats", nil), http.StatusUnauthorized, "No autorizado"},
+		"BodyTooLarge":     {httptest.NewRequest("POST", "/api/search-query", strings.NewReader(strings.Repeat("x", 17))), http.StatusRequestEntityTooLarge, "Cuerpo de la solicitud demasiado grande"},
+	}
+	for name, tc := range requests {
+		t.Run(name, func(t *testing.T) {
+			tc.req.Header.Set("Accept-Language", "es")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, tc.req)
+
+			assert.Equal(t, tc.code, w.Code)
+			assert.Equal(t, "es", w.Header().Get("Content-Language"))
+			var envelope models.ErrorEnvelope
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &envelope))
+			assert.Equal(t, tc.code, envelope.Error.Code)
+			assert.Equal(t, tc.message, envelope.Error.Message)
+		})
+	}
+
+	t.Run("InvalidKey", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/articles", nil)
+		req.Header.Set("X-API-Key", "wrong")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		var envelope models.ErrorEnvelope
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &envelope))
+		assert.Equal(t, "Invalid API key", envelope.Error.Detail)
+	})
+}
+
 // TestRouterHTTPMethods tests different HTTP methods
 func TestRouterHTTPMethods(t *testing.T) {
 	router, cleanup := setupTestRouter(t)
@@ -227,6 +395,60 @@ func TestRouterHTTPMethods(t *testing.T) {
 				"%s should not be allowed for /api/health", method)
 		}
 	})
+
+	t.Run("AllowHeader", func(t *testing.T) {
+		testCases := []struct {
+			method string
+			path   string
+			allow  string
+		}{
+			{"DELETE", "/api/health", "GET, OPTIONS"},
+			{"DELETE", "/api/search-query", "GET, POST, OPTIONS"},
+			{"DELETE", "/api/articles/1", "GET, PUT, OPTIONS"},
+			{"POST", "/api/articles/1/history", "GET, OPTIONS"},
+			{"GET", "/api/articles/1/view", "POST, OPTIONS"},
+			{"GET", "/api/admin/reindex", "POST, OPTIONS"},
+		}
+
+		for _, tc := range testCases {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusMethodNotAllowed, w.Code, "%s %s", tc.method, tc.path)
+			assert.Equal(t, tc.allow, w.Header().Get("Allow"), "%s %s", tc.method, tc.path)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+			var response models.ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, "Method not allowed", response.Error)
+		}
+	})
+
+	t.Run("OPTIONS", func(t *testing.T) {
+		req := httptest.NewRequest("OPTIONS", "/api/articles", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "GET, OPTIONS", w.Header().Get("Allow"))
+	})
+
+	t.Run("UnknownRoute", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/nonexistent", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		var response models.ErrorResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "Not found", response.Error)
+	})
 }
 
 // TestRouterContentTypes tests content type handling
@@ -255,21 +477,579 @@ func TestRouterContentTypes(t *testing.T) {
 	})
 }
 
+// TestRouterCompression tests gzip compression of responses
+func TestRouterCompression(t *testing.T) {
+	router, cleanup := setupTestRouter(t)
+	defer cleanup()
+
+	t.Run("LargeResponseIsCompressed", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/articles", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		reader, err := gzip.NewReader(w.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(reader)
+		require.NoError(t, err)
+
+		var articles []models.Article
+		assert.NoError(t, json.Unmarshal(body, &articles))
+		assert.NotEmpty(t, articles)
+	})
+
+	t.Run("SmallResponseIsNotCompressed", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/health", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Content-Encoding"))
+		assert.Contains(t, w.Body.String(), "healthy")
+	})
+
+	t.Run("NoAcceptEncoding", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/articles", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Content-Encoding"))
+		assert.True(t, json.Valid(w.Body.Bytes()))
+	})
+
+	t.Run("ConfiguredThreshold", func(t *testing.T) {
+		cfg := config.DefaultConfig()
+		cfg.CompressMinBytes = 1
+		router := SetupRouterWithConfig(nil, cfg)
+		router.Get("/tiny", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		})
+
+		req := httptest.NewRequest("GET", "/tiny", nil)
+		req.Header.Set("Accept-Encoding", "gzip, deflate")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	})
+
+	t.Run("NoBodyStatus", func(t *testing.T) {
+		etagReq := httptest.NewRequest("GET", "/api/articles", nil)
+		etagRec := httptest.NewRecorder()
+		router.ServeHTTP(etagRec, etagReq)
+
+		req := httptest.NewRequest("GET", "/api/articles", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		req.Header.Set("If-None-Match", etagRec.Header().Get("ETag"))
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Header().Get("Content-Encoding"))
+		assert.Zero(t, w.Body.Len())
+	})
+}
+
+// TestRouterBodyLimit tests that oversized bodies are rejected with 413
+func TestRouterBodyLimit(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.MaxBodyBytes = 64
+
+	dbPath := "test_router_limit.db"
+	db, err := database.NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	defer os.Remove(dbPath)
+	defer db.Close()
+	require.NoError(t, db.Initialize())
+
+	searchService := service.NewSearchService(db, ai.NewMockAIService())
+	router := SetupRouterWithConfig(handlers.NewSearchHandler(searchService), cfg)
+
+	t.Run("OversizedBody", func(t *testing.T) {
+		body := `{"query":"` + strings.Repeat("a", 100) + `"}`
+		req := httptest.NewRequest("POST", "/api/search-query", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	})
+
+	t.Run("OversizedChunkedBody", func(t *testing.T) {
+		body := `{"query":"` + strings.Repeat("a", 100) + `"}`
+		req := httptest.NewRequest("POST", "/api/search-query", io.NopCloser(strings.NewReader(body)))
+		req.ContentLength = -1
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+		var response models.ErrorResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "Request body too large", response.Error)
+	})
+
+	t.Run("BodyWithinLimit", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/search-query", strings.NewReader(`{"query":"vpn"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("ChunkedBodyWithinLimit", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/search-query", io.NopCloser(strings.NewReader(`{"query":"vpn"}`)))
+		req.ContentLength = -1
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.SearchResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "vpn", response.Query)
+	})
+}
+
+// TestRouterAdminAuth tests that admin endpoints require the API key
+func TestRouterAdminAuth(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.AdminAPIKey = "admin-secret"
+
+	dbPath := "test_router_admin.db"
+	db, err := database.NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	defer os.Remove(dbPath)
+	defer db.Close()
+	require.NoError(t, db.Initialize())
+
+	searchService := service.NewSearchService(db, ai.NewMockAIService())
+	router := SetupRouterWithConfig(handlers.NewSearchHandler(searchService), cfg)
+
+	t.Run("ReindexWithoutKey", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/admin/reindex", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("ReindexWithKey", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/admin/reindex", nil)
+		req.Header.Set("X-API-Key", "admin-secret")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "articles_indexed")
+	})
+
+	t.Run("PurgeWithoutKey", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/admin/purge?older_than=30d", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("PurgeWithKey", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/admin/purge?older_than=30d", nil)
+		req.Header.Set("X-API-Key", "admin-secret")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "queries_deleted")
+	})
+
+	t.Run("ImportWithoutKey", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/admin/articles/import", strings.NewReader(`{"articles": [{"title": "Badge Access", "content": "Ask facilities."}]}`))
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("ImportWithKey", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/admin/articles/import", strings.NewReader(`{"articles": [{"title": "Badge Access", "content": "Ask facilities."}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", "admin-secret")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"articles_imported":1`)
+	})
+
+	t.Run("RerunWithoutKey", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/queries/1/rerun", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("RerunWithKey", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/queries/999/rerun", nil)
+		req.Header.Set("X-API-Key", "admin-secret")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("ConfigWithoutKey", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/admin/config", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("ConfigWithKey", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/admin/config", nil)
+		req.Header.Set("X-API-Key", "admin-secret")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"MaxPageSize":100`)
+	})
+
+	t.Run("StatsWithoutKey", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/stats", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("StatsWithKey", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/stats", nil)
+		req.Header.Set("Authorization", "Bearer admin-secret")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "total_articles")
+	})
+
+	t.Run("TopQueriesWithoutKey", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/queries/top", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("TopQueriesWithKey", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/queries/top?window=30d&limit=5", nil)
+		req.Header.Set("X-API-Key", "admin-secret")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("UpdateArticleWithoutKey", func(t *testing.T) {
+		req := httptest.NewRequest("PUT", "/api/articles/1", strings.NewReader(`{"title": "Title", "content": "Body"}`))
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("UpdateArticleWithKey", func(t *testing.T) {
+		req := httptest.NewRequest("PUT", "/api/articles/1", strings.NewReader(`{"title": "Title", "content": "Body"}`))
+		req.Header.Set("X-API-Key", "admin-secret")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("BackupWithoutKey", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/admin/backup", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("PublicEndpointsStayOpen", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/articles", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
+
 // TestRouterErrorHandling tests error scenarios
+// TestRouterPublicArticleFields tests that article reads show more to key holders
+func TestRouterPublicArticleFields(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.AdminAPIKey = "admin-secret"
+
+	dbPath := "test_router_public.db"
+	db, err := database.NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	defer os.Remove(dbPath)
+	defer db.Close()
+	require.NoError(t, db.Initialize())
+
+	searchHandler := handlers.NewSearchHandler(service.NewSearchService(db, ai.NewMockAIService()))
+	searchHandler.SetPublicArticleFields([]string{"title"})
+	router := SetupRouterWithConfig(searchHandler, cfg)
+
+	getArticle := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/articles/1", nil)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Anonymous", func(t *testing.T) {
+		w := getArticle("")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var article models.ArticleResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &article))
+		assert.NotEmpty(t, article.Title)
+		assert.Empty(t, article.Content)
+	})
+
+	t.Run("WithKey", func(t *testing.T) {
+		w := getArticle("admin-secret")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var article models.ArticleResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &article))
+		assert.NotEmpty(t, article.Content)
+	})
+
+	t.Run("WrongKey", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, getArticle("guess").Code)
+	})
+
+	t.Run("SearchAnswers", func(t *testing.T) {
+		search := func(key string) models.SearchResponse {
+			req := httptest.NewRequest("POST", "/api/search-query", strings.NewReader(`{"query":"How do I reset my password?"}`))
+			req.Header.Set("Content-Type", "application/json")
+			if key != "" {
+				req.Header.Set("X-API-Key", key)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			var response models.SearchResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			require.NotEmpty(t, response.AIRelevantArticles)
+			return response
+		}
+
+		assert.Empty(t, search("").AIRelevantArticles[0].Content)
+		assert.NotEmpty(t, search("admin-secret").AIRelevantArticles[0].Content)
+	})
+
+	t.Run("HealthIgnoresKey", func(t *testing.T) {
+		for _, target := range []string{"/api/health", "/api/ready"} {
+			req := httptest.NewRequest("GET", target, nil)
+			req.Header.Set("X-API-Key", "stale-key")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code, target)
+		}
+	})
+
+	t.Run("NoKeyConfigured", func(t *testing.T) {
+		router := SetupRouterWithConfig(searchHandler, config.DefaultConfig())
+		req := httptest.NewRequest("GET", "/api/articles/1", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var article models.ArticleResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &article))
+		assert.NotEmpty(t, article.Content)
+	})
+}
+
+// TestRouterExportHasNoTimeout tests that the article export is not cut off
+// by the read route timeout
+func TestRouterExportHasNoTimeout(t *testing.T) {
+	dbPath := "test_router_export.db"
+	db, err := database.NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	defer os.Remove(dbPath)
+	defer db.Close()
+	require.NoError(t, db.Initialize())
+
+	cfg := config.DefaultConfig()
+	cfg.ReadRouteTimeout = time.Nanosecond
+	router := SetupRouterWithConfig(handlers.NewSearchHandler(service.NewSearchService(db, ai.NewMockAIService())), cfg)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/articles/export", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 10, strings.Count(w.Body.String(), "\n"))
+}
+
+// slowExportDB streams its articles slowly, as a large knowledge base would
+type slowExportDB struct {
+	database.DatabaseInterface
+}
+
+func (db slowExportDB) EachArticle(ctx context.Context, fn func(models.Article) error) error {
+	return db.DatabaseInterface.EachArticle(ctx, func(article models.Article) error {
+		time.Sleep(20 * time.Millisecond)
+		return fn(article)
+	})
+}
+
+// TestRouterExportOutlivesWriteTimeout tests that a compressed article
+// export is not cut off by the server's write timeout
+func TestRouterExportOutlivesWriteTimeout(t *testing.T) {
+	dbPath := "test_router_export_write_timeout.db"
+	db, err := database.NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	defer os.Remove(dbPath)
+	defer db.Close()
+	require.NoError(t, db.Initialize())
+
+	cfg := config.DefaultConfig()
+	cfg.CompressMinBytes = 1
+	router := SetupRouterWithConfig(handlers.NewSearchHandler(service.NewSearchService(slowExportDB{db}, ai.NewMockAIService())), cfg)
+	server := httptest.NewUnstartedServer(router)
+	server.Config.WriteTimeout = 50 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	// The default client asks for gzip and decompresses the body itself
+	resp, err := http.Get(server.URL + "/api/articles/export")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, resp.Uncompressed, "the export was not compressed")
+	assert.Equal(t, 10, strings.Count(string(body), "\n"))
+}
+
+// TestRouterInFlightLimit tests load shedding and the in-flight counters
+func TestRouterInFlightLimit(t *testing.T) {
+	dbPath := "test_router_inflight.db"
+	db, err := database.NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	defer os.Remove(dbPath)
+	defer db.Close()
+	require.NoError(t, db.Initialize())
+
+	inFlight := handlers.NewInFlight(1)
+	searchHandler := handlers.NewSearchHandler(service.NewSearchService(db, ai.NewMockAIService()))
+	searchHandler.SetInFlight(inFlight)
+	router := SetupRouterWithConfig(searchHandler, config.DefaultConfig())
+
+	// Hold the only slot, as a slow search would
+	require.True(t, inFlight.Acquire())
+	defer inFlight.Release()
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		return w
+	}
+
+	t.Run("Shed", func(t *testing.T) {
+		w := get("/api/articles")
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	})
+
+	t.Run("HealthStillAnswers", func(t *testing.T) {
+		w := get("/api/health")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var health models.HealthStatus
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &health))
+		assert.Equal(t, int64(1), health.InFlightRequests)
+	})
+
+	t.Run("Metrics", func(t *testing.T) {
+		w := get("/api/metrics")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var metrics models.Metrics
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &metrics))
+		assert.Equal(t, models.Metrics{InFlightRequests: 1, MaxInFlightRequests: 1, RejectedRequests: 1}, metrics)
+	})
+}
+
 func TestRouterErrorHandling(t *testing.T) {
 	router, cleanup := setupTestRouter(t)
 	defer cleanup()
 
 	t.Run("InvalidJSON", func(t *testing.T) {
-		req := httptest.NewRequest("POST", "/api/search-query",
-			httptest.NewRequest("POST", "/", nil).Body)
+		req := httptest.NewRequest("POST", "/api/search-query", strings.NewReader(`{"query":`))
 		req.Header.Set("Content-Type", "application/json")
 		w := httptest.NewRecorder()
 
 		router.ServeHTTP(w, req)
 
-		// Should handle invalid JSON gracefully
-		assert.NotEqual(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "Invalid JSON")
+	})
+
+	t.Run("EmptyBody", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/search-query", nil)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
 
 	t.Run("MalformedURL", func(t *testing.T) {
@@ -342,3 +1122,83 @@ func TestRouterConcurrency(t *testing.T) {
 		}
 	})
 }
+
+// TestRouterTracing tests the spans recorded for a search request
+func TestRouterTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	dbPath := "test_router_tracing.db"
+	db, err := database.NewSQLiteDB(dbPath)
+	require.NoError(t, err)
+	defer os.Remove(dbPath)
+	defer db.Close()
+	require.NoError(t, db.Initialize())
+
+	searchService := service.NewSearchService(database.NewTracedDB(db), ai.NewMockAIService())
+	router := SetupRouter(handlers.NewSearchHandler(searchService))
+
+	query := "How do I reset my password?"
+	req := httptest.NewRequest("POST", "/api/search-query", strings.NewReader(`{"query": "`+query+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	attrs := func(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+		values := make(map[attribute.Key]attribute.Value)
+		for _, attr := range span.Attributes {
+			values[attr.Key] = attr.Value
+		}
+		return values
+	}
+
+	request, ok := spans["POST /api/search-query"]
+	require.True(t, ok, "request span missing")
+	assert.Equal(t, trace.SpanKindServer, request.SpanKind)
+	assert.Equal(t, int64(http.StatusOK), attrs(request)["http.response.status_code"].AsInt64())
+
+	search, ok := spans["SearchService.ProcessSearchQuery"]
+	require.True(t, ok, "search span missing")
+	assert.Equal(t, request.SpanContext.SpanID(), search.Parent.SpanID())
+	assert.Equal(t, int64(len(query)), attrs(search)[tracing.QueryLengthKey].AsInt64())
+	assert.Equal(t, "mock", attrs(search)[tracing.ProviderKey].AsString())
+	assert.Equal(t, int64(10), attrs(search)[tracing.ArticleCountKey].AsInt64())
+
+	analysis, ok := spans["ai.AnalyzeQuery"]
+	require.True(t, ok, "AI span missing")
+	assert.Equal(t, search.SpanContext.SpanID(), analysis.Parent.SpanID())
+	assert.Equal(t, "mock", attrs(analysis)[tracing.ProviderKey].AsString())
+	assert.Equal(t, int64(10), attrs(analysis)[tracing.ArticleCountKey].AsInt64())
+
+	for _, name := range []string{"db.CreateQuery", "db.GetAllArticles", "db.CreateSearchResult", "db.GetArticlesByIDs"} {
+		span, ok := spans[name]
+		require.True(t, ok, "%s span missing", name)
+		assert.Equal(t, search.SpanContext.SpanID(), span.Parent.SpanID(), name)
+		assert.Equal(t, "sqlite", attrs(span)["db.system"].AsString(), name)
+	}
+
+	t.Run("ContinuesCallerTrace", func(t *testing.T) {
+		exporter.Reset()
+		previous := otel.GetTextMapPropagator()
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+		defer otel.SetTextMapPropagator(previous)
+
+		req := httptest.NewRequest("GET", "/api/articles/1", nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+
+		spans := exporter.GetSpans()
+		require.NotEmpty(t, spans)
+		request := spans[len(spans)-1]
+		assert.Equal(t, "GET /api/articles/{id}", request.Name)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", request.SpanContext.TraceID().String())
+	})
+}
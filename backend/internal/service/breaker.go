@@ -0,0 +1,129 @@
+package service
+
+import (
+	"errors"
+	"event-to-insight/internal/ai"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states, as reported by the health check
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// circuitBreaker stops calling an AI provider that keeps failing. After
+// threshold consecutive failures it opens, and calls are refused until the
+// cooldown, or the provider's Retry-After if longer, has passed. It then
+// half-opens, letting a single trial call through: success closes it
+// again, failure reopens it.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	state    string
+	failures int
+	// openUntil is when an open breaker half-opens
+	openUntil time.Time
+	// probing is set while the half-open trial call is in flight
+	probing bool
+}
+
+// newCircuitBreaker creates a closed breaker. A threshold of zero or less
+// disables it, so every call is allowed.
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		state:     BreakerClosed,
+	}
+}
+
+// enabled reports whether the breaker ever refuses calls
+func (b *circuitBreaker) enabled() bool {
+	return b.threshold > 0
+}
+
+// allow reports whether a call may go to the provider. Every allowed call
+// must be followed by record.
+func (b *circuitBreaker) allow() bool {
+	if !b.enabled() {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && !b.now().Before(b.openUntil) {
+		b.state = BreakerHalfOpen
+	}
+	switch b.state {
+	case BreakerClosed:
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return false
+	}
+}
+
+// record reports the outcome of an allowed call. Only AI errors count as
+// failures; a call that never reached the provider, such as one that timed
+// out waiting for a slot, leaves the breaker as it was.
+func (b *circuitBreaker) record(err error) {
+	if !b.enabled() {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	halfOpen := b.state == BreakerHalfOpen
+	b.probing = false
+
+	var aiErr *AIError
+	switch {
+	case err == nil:
+		b.state = BreakerClosed
+		b.failures = 0
+	case errors.As(err, &aiErr):
+		b.failures++
+		if halfOpen || b.failures >= b.threshold {
+			b.open(err)
+		}
+	}
+}
+
+// open refuses calls for the cooldown, or as long as the provider asked
+func (b *circuitBreaker) open(err error) {
+	cooldown := b.cooldown
+	if retryAfter, ok := ai.RetryAfter(err); ok && retryAfter > cooldown {
+		cooldown = retryAfter
+	}
+	b.state = BreakerOpen
+	b.openUntil = b.now().Add(cooldown)
+}
+
+// status returns the breaker's state, its consecutive failures and, when
+// open, when it half-opens
+func (b *circuitBreaker) status() (state string, failures int, openUntil time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && !b.now().Before(b.openUntil) {
+		return BreakerHalfOpen, b.failures, time.Time{}
+	}
+	if b.state == BreakerOpen {
+		return b.state, b.failures, b.openUntil
+	}
+	return b.state, b.failures, time.Time{}
+}
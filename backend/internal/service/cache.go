@@ -0,0 +1,140 @@
+package service
+
+import (
+	"container/list"
+	"encoding/binary"
+	"encoding/hex"
+	"event-to-insight/internal/ai"
+	"event-to-insight/internal/models"
+	"event-to-insight/internal/textutil"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// analysisCache keeps recent AI analyses so repeated questions skip the AI.
+// Each entry remembers the hash of the knowledge base it was computed
+// against, and is ignored once the articles change.
+type analysisCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	// order lists keys from most to least recently used
+	order *list.List
+}
+
+// cacheEntry is a cached analysis and the knowledge base it answered from
+type cacheEntry struct {
+	key    string
+	kbHash string
+	result ai.AIAnalysisResult
+}
+
+// newAnalysisCache creates a cache holding up to capacity analyses. A
+// capacity of zero or less disables caching.
+func newAnalysisCache(capacity int) *analysisCache {
+	return &analysisCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// get returns a copy of the analysis cached for key if it was computed
+// against the knowledge base with hash kbHash
+func (c *analysisCache) get(key, kbHash string) (*ai.AIAnalysisResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if entry.kbHash != kbHash {
+		// The articles changed since this answer was given
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	return cloneAnalysis(&entry.result), true
+}
+
+// put caches a copy of result for key, evicting the least recently used
+// entry when the cache is full
+func (c *analysisCache) put(key, kbHash string, result *ai.AIAnalysisResult) {
+	if c.capacity <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cacheEntry{key: key, kbHash: kbHash, result: *cloneAnalysis(result)}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// analysisCacheKey identifies an analysis by the provider that produced it,
+// the normalized query text and the articles the search was scoped to
+func analysisCacheKey(provider, query string, articleIDs []int) string {
+	key := provider + "\x00" + textutil.NormalizeQuery(query)
+	ids := append([]int(nil), articleIDs...)
+	sort.Ints(ids)
+	for _, id := range ids {
+		key += "\x00" + strconv.Itoa(id)
+	}
+	return key
+}
+
+// cloneAnalysis copies a result so callers may modify it without changing
+// the cached entry
+func cloneAnalysis(result *ai.AIAnalysisResult) *ai.AIAnalysisResult {
+	clone := *result
+	clone.RelevantArticles = append([]int(nil), result.RelevantArticles...)
+	clone.DroppedArticleIDs = append([]int(nil), result.DroppedArticleIDs...)
+	if result.Scores != nil {
+		clone.Scores = make(map[int]float64, len(result.Scores))
+		for id, score := range result.Scores {
+			clone.Scores[id] = score
+		}
+	}
+	return &clone
+}
+
+// knowledgeBaseHash fingerprints the article set, so any added, removed or
+// edited article produces a different hash. It covers every field the
+// prompt is built from, including generated summaries and keywords.
+func knowledgeBaseHash(articles []models.Article) string {
+	hash := fnv.New64a()
+	buf := make([]byte, 8)
+
+	writeField := func(value string) {
+		binary.BigEndian.PutUint64(buf, uint64(len(value)))
+		hash.Write(buf)
+		hash.Write([]byte(value))
+	}
+
+	for _, article := range articles {
+		binary.BigEndian.PutUint64(buf, uint64(article.ID))
+		hash.Write(buf)
+		writeField(article.Title)
+		writeField(article.Content)
+		writeField(article.Keywords)
+		writeField(article.Summary)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"errors"
+	"event-to-insight/internal/models"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// errDiskStatUnsupported is returned by freeDiskBytes on platforms where
+// free space cannot be measured. The disk check is then skipped.
+var errDiskStatUnsupported = errors.New("free disk space cannot be measured on this platform")
+
+// checkDisk reports the free space on the database's filesystem. SQLite
+// writes fail obscurely once it runs out, so falling below
+// DiskWarnFreeBytes degrades the service and below DiskMinFreeBytes makes it
+// unhealthy. In-memory and URI database paths are not checked.
+func (s *SearchService) checkDisk(health *models.HealthStatus) {
+	dbPath := s.cfg.DBPath
+	if dbPath == "" || dbPath == ":memory:" || strings.HasPrefix(dbPath, "file:") {
+		return
+	}
+
+	dir := filepath.Dir(dbPath)
+	free, err := s.statDisk(dir)
+	if errors.Is(err, errDiskStatUnsupported) {
+		return
+	}
+	if err != nil {
+		health.Dependencies["disk"] = models.DependencyDegraded
+		health.Warnings = append(health.Warnings, fmt.Sprintf("free disk space of %s is unknown: %v", dir, err))
+		return
+	}
+
+	health.DiskFreeBytes = &free
+	switch {
+	case s.cfg.DiskMinFreeBytes > 0 && free < uint64(s.cfg.DiskMinFreeBytes):
+		health.Dependencies["disk"] = models.DependencyUnavailable
+		health.Warnings = append(health.Warnings, fmt.Sprintf(
+			"only %d bytes are free on the database's disk, writes are about to fail", free))
+	case s.cfg.DiskWarnFreeBytes > 0 && free < uint64(s.cfg.DiskWarnFreeBytes):
+		health.Dependencies["disk"] = models.DependencyDegraded
+		health.Warnings = append(health.Warnings, fmt.Sprintf(
+			"only %d bytes are free on the database's disk", free))
+	default:
+		health.Dependencies["disk"] = models.DependencyOK
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd
+
+package service
+
+// freeDiskBytes cannot measure free space on this platform
+func freeDiskBytes(dir string) (uint64, error) {
+	return 0, errDiskStatUnsupported
+}
@@ -0,0 +1,15 @@
+//go:build linux || darwin || freebsd
+
+package service
+
+import "syscall"
+
+// freeDiskBytes returns the bytes available to unprivileged writers on the
+// filesystem holding dir
+func freeDiskBytes(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
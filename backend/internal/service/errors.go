@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"event-to-insight/internal/database"
+)
+
+// ErrNotInitialized is returned when the service is missing a dependency
+var ErrNotInitialized = errors.New("service not fully initialized")
+
+// ErrInvalidRelevance is returned when a relevance threshold is outside 0 to 1
+var ErrInvalidRelevance = errors.New("min_relevance must be between 0 and 1")
+
+// ErrUnknownProvider is returned when a request asks for an AI provider
+// that does not exist
+var ErrUnknownProvider = errors.New("unknown AI provider")
+
+// ErrAIBusy is returned when every AI slot stayed busy for the whole queue
+// timeout
+var ErrAIBusy = errors.New("too many AI requests in progress")
+
+// ErrUnknownArticle is returned when a search is scoped to articles that do
+// not exist
+var ErrUnknownArticle = errors.New("unknown article IDs")
+
+// ErrExcludedArticle is returned when a search is scoped to articles that
+// are excluded from searches
+var ErrExcludedArticle = errors.New("article IDs excluded from searches")
+
+// ErrDuplicateTitle is returned when an article would share its title,
+// ignoring case, with another one
+var ErrDuplicateTitle = database.ErrDuplicateTitle
+
+// ErrDatabaseBusy is returned when a write kept finding the database locked
+// by another writer. It is temporary, so the request can be retried.
+var ErrDatabaseBusy = database.ErrBusy
+
+// ErrShareExpired is returned when a share link is read after it expired
+var ErrShareExpired = database.ErrShareExpired
+
+// ErrNotCached is returned for cached-only searches that have no cached
+// analysis
+var ErrNotCached = errors.New("search has not been computed")
+
+// ErrSearchInProgress is returned when a search with the same idempotency
+// key is still running
+var ErrSearchInProgress = errors.New("a search with this idempotency key is in progress")
+
+// ErrIdempotencyKeyReused is returned when an idempotency key is sent again
+// with a different query
+var ErrIdempotencyKeyReused = errors.New("idempotency key was used for a different query")
+
+// ValidationError is returned when the options of a request are invalid.
+// It wraps the specific cause, such as ErrInvalidRelevance.
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string { return e.Err.Error() }
+
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// AIError is returned when the AI service fails to analyze a query
+type AIError struct {
+	Err error
+}
+
+func (e *AIError) Error() string { return "failed to analyze query: " + e.Err.Error() }
+
+func (e *AIError) Unwrap() error { return e.Err }
+
+// Unavailable reports whether the AI service did not answer in time, as
+// opposed to answering with an error
+func (e *AIError) Unavailable() bool {
+	return errors.Is(e.Err, context.DeadlineExceeded)
+}
+
+// StorageError is returned when a database operation fails. Op describes
+// the operation, such as "create query".
+type StorageError struct {
+	Op  string
+	Err error
+}
+
+func (e *StorageError) Error() string { return "failed to " + e.Op + ": " + e.Err.Error() }
+
+func (e *StorageError) Unwrap() error { return e.Err }
@@ -0,0 +1,16 @@
+package service
+
+import "strings"
+
+// matchesEscalation reports whether the query mentions any of the escalation
+// keywords. Keywords may be phrases and are matched case-insensitively.
+func matchesEscalation(query string, keywords []string) bool {
+	query = strings.ToLower(query)
+	for _, keyword := range keywords {
+		keyword = strings.ToLower(strings.TrimSpace(keyword))
+		if keyword != "" && strings.Contains(query, keyword) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"event-to-insight/internal/alert"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// AlertAIFallback is the event of the alert sent when searches keep being
+// answered by the mock AI
+const AlertAIFallback = "ai_fallback"
+
+// fallbackMonitor counts searches answered by the mock AI because the
+// provider kept failing. Once threshold of them happen in a row within
+// window, it sends one alert; the next alert needs the provider to answer
+// again first.
+type fallbackMonitor struct {
+	mu        sync.Mutex
+	threshold int
+	window    time.Duration
+	now       func() time.Time
+	webhook   *alert.Webhook
+
+	total int64
+	// recent holds when each fallback since the provider last answered
+	// happened, dropping those older than window
+	recent  []time.Time
+	alerted bool
+}
+
+// newFallbackMonitor creates a monitor that alerts after threshold
+// fallbacks within window. A threshold of zero or less never alerts.
+func newFallbackMonitor(threshold int, window time.Duration) *fallbackMonitor {
+	return &fallbackMonitor{
+		threshold: threshold,
+		window:    window,
+		now:       time.Now,
+	}
+}
+
+// fallback records a search answered by the mock AI and returns how many
+// happened in a row within the window, and in total
+func (m *fallbackMonitor) fallback() (inARow int, total int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.total++
+	m.recent = append(m.recent, now)
+	for len(m.recent) > 0 && now.Sub(m.recent[0]) > m.window {
+		m.recent = m.recent[1:]
+	}
+
+	if m.webhook != nil && m.threshold > 0 && len(m.recent) >= m.threshold && !m.alerted {
+		m.alerted = true
+		m.webhook.Send(alert.Alert{
+			Event:   AlertAIFallback,
+			Message: fmt.Sprintf("%d searches in a row were answered by the mock AI because the AI provider keeps failing", len(m.recent)),
+			Count:   len(m.recent),
+			Time:    now.UTC(),
+		})
+	}
+	return len(m.recent), m.total
+}
+
+// recovered records that the provider answered, ending the run of fallbacks
+func (m *fallbackMonitor) recovered() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.recent = nil
+	m.alerted = false
+}
+
+// count returns how many searches were answered by the mock AI in total
+func (m *fallbackMonitor) count() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.total
+}
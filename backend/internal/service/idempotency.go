@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"event-to-insight/internal/models"
+	"event-to-insight/internal/textutil"
+	"time"
+)
+
+// idempotencyReservationTTL is how long a search reserved under an
+// idempotency key may run before a retry takes the key over, in case the
+// first attempt died without releasing it
+const idempotencyReservationTTL = 5 * time.Minute
+
+// processIdempotentSearch runs a search sent with an idempotency key. The
+// key is reserved before the AI is called, so concurrent retries get
+// ErrSearchInProgress rather than a second answer. Once the search
+// succeeds its response is stored and returned to later retries; a failed
+// search releases the key so it can be retried.
+func (s *SearchService) processIdempotentSearch(ctx context.Context, queryText string, opts SearchOptions) (*models.SearchResponse, error) {
+	if s.db == nil || s.aiService == nil {
+		return nil, ErrNotInitialized
+	}
+
+	storedText := s.storedQueryText(queryText)
+	record, reserved, err := s.db.ReserveIdempotencyKey(ctx, opts.IdempotencyKey, storedText,
+		time.Now().Add(-idempotencyReservationTTL))
+	if err != nil {
+		return nil, &StorageError{Op: "reserve idempotency key", Err: err}
+	}
+	if !reserved {
+		return s.replaySearch(record, storedText)
+	}
+
+	response, err := s.processSearchQuery(ctx, queryText, opts)
+	if err != nil {
+		s.releaseIdempotencyKey(ctx, opts.IdempotencyKey)
+		return nil, err
+	}
+
+	stored, err := json.Marshal(response)
+	if err == nil {
+		err = s.db.CompleteIdempotencyKey(context.WithoutCancel(ctx), opts.IdempotencyKey, stored)
+	}
+	if err != nil {
+		// The search succeeded, so answer it; a retry runs it again
+		s.logger.WarnContext(ctx, "failed to store idempotent response", "error", err)
+		s.releaseIdempotencyKey(ctx, opts.IdempotencyKey)
+	}
+	return response, nil
+}
+
+// replaySearch answers a retry from the record of the earlier attempt
+func (s *SearchService) replaySearch(record *models.IdempotencyRecord, storedText string) (*models.SearchResponse, error) {
+	if record.Query != storedText {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if record.Response == nil {
+		return nil, ErrSearchInProgress
+	}
+
+	var response models.SearchResponse
+	if err := json.Unmarshal(record.Response, &response); err != nil {
+		return nil, &StorageError{Op: "read stored search response", Err: err}
+	}
+	// Answers stored before an article was excluded no longer link it
+	response.AIRelevantArticles = nonNilArticles(s.searchable(response.AIRelevantArticles))
+	if response.SuggestedArticles != nil {
+		response.SuggestedArticles = s.searchable(response.SuggestedArticles)
+	}
+	return &response, nil
+}
+
+// releaseIdempotencyKey frees the key of a search that did not complete.
+// It runs even if the request was cancelled, since that is a common reason
+// for the search failing.
+func (s *SearchService) releaseIdempotencyKey(ctx context.Context, key string) {
+	if err := s.db.ReleaseIdempotencyKey(context.WithoutCancel(ctx), key); err != nil {
+		s.logger.WarnContext(ctx, "failed to release idempotency key", "error", err)
+	}
+}
+
+// storedQueryText returns queryText as it is stored, masked by the
+// RedactRules when RedactQueries is set
+func (s *SearchService) storedQueryText(queryText string) string {
+	if s.cfg.RedactQueries {
+		return textutil.Redact(queryText, s.cfg.RedactRules)
+	}
+	return queryText
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"event-to-insight/internal/models"
+	"event-to-insight/internal/textutil"
+	"sort"
+)
+
+// matchArticlesByKeywords returns up to limit articles whose title or content
+// contains words from the query, best matches first, along with the total
+// number of matching articles before the limit was applied. Each article's
+// Score is set from the match weights.
+func (s *SearchService) matchArticlesByKeywords(query string, articles []models.Article, limit int) ([]models.Article, int) {
+	keywords := s.keywords(query)
+	if len(keywords) == 0 || limit <= 0 {
+		return nil, 0
+	}
+
+	var matches []models.Article
+	for _, article := range articles {
+		score := textutil.MatchScore(article.Title, article.Content, keywords, s.cfg.TitleMatchWeight, s.cfg.ContentMatchWeight)
+		if score > 0 {
+			article.Score = score
+			matches = append(matches, article)
+		}
+	}
+
+	s.sortByScore(matches)
+
+	total := len(matches)
+	if total > limit {
+		matches = matches[:limit]
+	}
+	return matches, total
+}
+
+// keywords returns the words of query worth matching against articles,
+// without the configured stopwords
+func (s *SearchService) keywords(query string) []string {
+	return textutil.RemoveStopwords(textutil.Tokenize(query), s.cfg.Stopwords)
+}
+
+// rankArticles sets each article's Score from the AI's scores and orders
+// the articles best first, breaking ties as sortByScore does. Articles the
+// AI did not score keep their place after the scored ones.
+func (s *SearchService) rankArticles(articles []models.Article, scores map[int]float64) {
+	scored := 0
+	for i := range articles {
+		articles[i].Score = scores[articles[i].ID]
+		if _, ok := scores[articles[i].ID]; ok {
+			scored++
+		}
+	}
+	sort.SliceStable(articles, func(i, j int) bool {
+		_, iScored := scores[articles[i].ID]
+		_, jScored := scores[articles[j].ID]
+		return iScored && !jScored
+	})
+	s.sortByScore(articles[:scored])
+}
+
+// sortByScore orders articles best first. Equally scored articles are
+// ordered by when they were last updated, newest first unless RankTies is
+// "oldest", and otherwise keep their order.
+func (s *SearchService) sortByScore(articles []models.Article) {
+	oldestFirst := s.cfg.RankTies == "oldest"
+	sort.SliceStable(articles, func(i, j int) bool {
+		a, b := articles[i], articles[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if oldestFirst {
+			return a.UpdatedAt.Before(b.UpdatedAt)
+		}
+		return a.UpdatedAt.After(b.UpdatedAt)
+	})
+}
+
+// orderByIDs orders articles to match ids, such as the ranked IDs stored
+// with a search result
+func orderByIDs(articles []models.Article, ids []int) {
+	position := make(map[int]int, len(ids))
+	for i, id := range ids {
+		position[id] = i
+	}
+	sort.SliceStable(articles, func(i, j int) bool {
+		return position[articles[i].ID] < position[articles[j].ID]
+	})
+}
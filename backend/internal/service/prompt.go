@@ -0,0 +1,72 @@
+package service
+
+import (
+	"event-to-insight/internal/ai"
+	"event-to-insight/internal/models"
+	"event-to-insight/internal/textutil"
+	"sort"
+	"unicode/utf8"
+)
+
+// promptArticles returns the articles to send to provider for query, within
+// the provider's prompt limits. When not all articles fit, those matching
+// the query's keywords best are kept. The kept articles stay in their
+// original order.
+func (s *SearchService) promptArticles(provider, query string, articles []models.Article) []models.Article {
+	limit := s.cfg.PromptLimits[provider]
+	if limit.MaxArticles <= 0 && limit.MaxChars <= 0 {
+		return articles
+	}
+
+	// Rank by keyword match, keeping the original order between equals
+	order := make([]int, len(articles))
+	scores := make([]float64, len(articles))
+	keywords := s.keywords(query)
+	for i, article := range articles {
+		order[i] = i
+		scores[i] = textutil.MatchScore(article.Title, article.Content, keywords, s.cfg.TitleMatchWeight, s.cfg.ContentMatchWeight)
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] > scores[order[j]]
+	})
+
+	keep := make([]bool, len(articles))
+	kept, chars := 0, 0
+	for _, i := range order {
+		if limit.MaxArticles > 0 && kept == limit.MaxArticles {
+			break
+		}
+		size := s.promptSize(articles[i])
+		if limit.MaxChars > 0 && chars+size > limit.MaxChars {
+			continue
+		}
+		keep[i] = true
+		kept++
+		chars += size
+	}
+	if kept == len(articles) {
+		return articles
+	}
+
+	subset := make([]models.Article, 0, kept)
+	for i, article := range articles {
+		if keep[i] {
+			subset = append(subset, article)
+		}
+	}
+	return subset
+}
+
+// promptSize is how many characters of article count towards a prompt
+// limit, which for title-only and excerpt prompts is less than its content
+func (s *SearchService) promptSize(article models.Article) int {
+	size := utf8.RuneCountInString(article.Title)
+	switch ai.PromptFields(s.cfg.PromptArticleFields) {
+	case ai.PromptFieldsTitle:
+		return size
+	case ai.PromptFieldsExcerpt:
+		return size + min(utf8.RuneCountInString(article.Content), s.cfg.PromptExcerptChars)
+	default:
+		return size + utf8.RuneCountInString(article.Content)
+	}
+}
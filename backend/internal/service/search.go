@@ -1,76 +1,1053 @@
 package service
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"event-to-insight/internal/ai"
+	"event-to-insight/internal/alert"
+	"event-to-insight/internal/audit"
+	"event-to-insight/internal/config"
 	"event-to-insight/internal/database"
+	"event-to-insight/internal/logging"
 	"event-to-insight/internal/models"
+	"event-to-insight/internal/textutil"
+	"event-to-insight/internal/tracing"
 	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 )
 
+// ProviderMock routes a single request through the mock AI service
+const ProviderMock = config.ProviderMock
+
+// aiPingTimeout bounds how long a deep health check waits for the AI backend
+const aiPingTimeout = 5 * time.Second
+
 // SearchService handles search operations
 type SearchService struct {
 	db        database.DatabaseInterface
 	aiService ai.AIServiceInterface
+	cfg       *config.Config
+
+	// mockAI serves requests that override the provider to ProviderMock
+	mockAI ai.AIServiceInterface
+
+	// auditLogger records AI exchanges when auditing is enabled
+	auditLogger *audit.Logger
+
+	// breaker stops calling the configured AI service while it keeps failing
+	breaker *circuitBreaker
+
+	// fallbacks counts searches answered by the mock AI while the breaker
+	// is open, alerting when they keep happening
+	fallbacks *fallbackMonitor
+
+	// logger writes operational logs. Lines written while processing a
+	// search carry the query's ID.
+	logger *slog.Logger
+
+	// aiSlots holds a token for each AI analysis in flight, limiting them
+	// to AIMaxConcurrency. It is nil when there is no limit.
+	aiSlots chan struct{}
+
+	// cache reuses analyses of repeated queries while the articles are
+	// unchanged
+	cache *analysisCache
+
+	// excluded holds the IDs of articles left out of every search, which
+	// excludedIDs lists in order
+	excluded    map[int]bool
+	excludedIDs []int
+
+	// reindexMu ensures only one reindex runs at a time
+	reindexMu sync.Mutex
+
+	// warmingUp is set while the startup warmup runs
+	warmingUp atomic.Bool
+
+	// background tracks work that outlives the request starting it, such
+	// as summarizing imported articles
+	background sync.WaitGroup
+
+	// statDisk returns the free bytes of the filesystem holding a directory
+	statDisk func(dir string) (uint64, error)
 }
 
-// NewSearchService creates a new search service
+// NewSearchService creates a new search service using the default configuration
 func NewSearchService(db database.DatabaseInterface, aiService ai.AIServiceInterface) *SearchService {
-	return &SearchService{
+	return NewSearchServiceWithConfig(db, aiService, config.DefaultConfig())
+}
+
+// NewSearchServiceWithConfig creates a new search service
+func NewSearchServiceWithConfig(db database.DatabaseInterface, aiService ai.AIServiceInterface, cfg *config.Config) *SearchService {
+	mockAI := ai.NewMockAIServiceWithWeights(cfg.TitleMatchWeight, cfg.ContentMatchWeight)
+	mockAI.SetFallbackSummary(cfg.FallbackSummary)
+	mockAI.SetPromptFields(ai.PromptFields(cfg.PromptArticleFields), cfg.PromptExcerptChars)
+
+	s := &SearchService{
 		db:        db,
 		aiService: aiService,
+		cfg:       cfg,
+		mockAI:    mockAI,
+		cache:     newAnalysisCache(cfg.AICacheSize),
+		breaker:   newCircuitBreaker(cfg.AIBreakerThreshold, cfg.AIBreakerCooldown),
+		fallbacks: newFallbackMonitor(cfg.AlertFallbackThreshold, cfg.AlertFallbackWindow),
+		logger:    logging.New(slog.Default().Handler()),
+		statDisk:  freeDiskBytes,
+	}
+	if cfg.AIMaxConcurrency > 0 {
+		s.aiSlots = make(chan struct{}, cfg.AIMaxConcurrency)
 	}
+	// Invalid IDs are rejected when the configuration is validated
+	excluded, _ := cfg.SearchExcludedArticleIDs()
+	if len(excluded) > 0 {
+		s.excludedIDs = excluded
+		s.excluded = make(map[int]bool, len(excluded))
+		for _, id := range excluded {
+			s.excluded[id] = true
+		}
+	}
+	return s
+}
+
+// SetLogger replaces the service's logger. Lines written while processing a
+// search still carry the query's ID.
+func (s *SearchService) SetLogger(logger *slog.Logger) {
+	s.logger = logging.New(logger.Handler())
+}
+
+// SetAuditLogger enables audit logging of every AI prompt and response.
+// Passing nil disables it.
+func (s *SearchService) SetAuditLogger(logger *audit.Logger) {
+	s.auditLogger = logger
+}
+
+// SetAlertWebhook sends an alert to webhook when searches keep falling
+// back to the mock AI. Passing nil disables alerts.
+func (s *SearchService) SetAlertWebhook(webhook *alert.Webhook) {
+	s.fallbacks.mu.Lock()
+	defer s.fallbacks.mu.Unlock()
+	s.fallbacks.webhook = webhook
+}
+
+// ContentFormat selects how article content is rendered in responses
+type ContentFormat string
+
+const (
+	// ContentFormatText returns content as stored
+	ContentFormatText ContentFormat = "text"
+	// ContentFormatHTML renders numbered steps as an HTML ordered list
+	ContentFormatHTML ContentFormat = "html"
+)
+
+// SearchOptions adjusts how a single search query is processed
+type SearchOptions struct {
+	// DryRun runs the analysis without writing the query or result
+	DryRun bool
+	// Format selects how article content is rendered, defaulting to text
+	Format ContentFormat
+	// IdempotencyKey identifies retries of the same search. A retry returns
+	// the stored response instead of creating a new query, and fails with
+	// ErrSearchInProgress while the first attempt is running.
+	IdempotencyKey string
+	// Provider overrides the configured AI service for this request. It is
+	// ignored unless the AllowProviderOverride setting is enabled.
+	Provider string
+	// MinRelevance overrides the configured relevance threshold when set
+	MinRelevance *float64
+	// ArticleIDs scopes the search to these articles: only they are sent
+	// to the AI, and it may only cite them. Every ID must exist.
+	ArticleIDs []int
+
+	// cachedOnly answers only from cached analyses, returning ErrNotCached
+	// instead of calling the AI
+	cachedOnly bool
+	// rerun answers this stored query again instead of creating a new one,
+	// always calling the AI
+	rerun *models.Query
 }
 
 // ProcessSearchQuery processes a search query and returns results
-func (s *SearchService) ProcessSearchQuery(queryText string) (*models.SearchResponse, error) {
-	// Create query record
-	query, err := s.db.CreateQuery(queryText)
+func (s *SearchService) ProcessSearchQuery(ctx context.Context, queryText string) (*models.SearchResponse, error) {
+	return s.ProcessSearchQueryWithOptions(ctx, queryText, SearchOptions{})
+}
+
+// ProcessSharedSearch answers a search from a shared link. Nothing is
+// stored, and unless the SearchGetRunsAI setting is enabled only cached
+// analyses are used, returning ErrNotCached for anything else.
+func (s *SearchService) ProcessSharedSearch(ctx context.Context, queryText string, opts SearchOptions) (*models.SearchResponse, error) {
+	opts.DryRun = true
+	opts.IdempotencyKey = ""
+	opts.cachedOnly = !s.cfg.SearchGetRunsAI
+	return s.ProcessSearchQueryWithOptions(ctx, queryText, opts)
+}
+
+// RerunQuery answers a stored query again against the current articles,
+// skipping the analysis cache. Unless opts.DryRun is set, the new result is
+// stored alongside the earlier ones and becomes the query's latest. Returns
+// sql.ErrNoRows if the query does not exist.
+func (s *SearchService) RerunQuery(ctx context.Context, queryID int, opts SearchOptions) (*models.SearchResponse, error) {
+	if s.db == nil {
+		return nil, ErrNotInitialized
+	}
+
+	query, err := s.db.GetQueryByID(ctx, queryID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, &StorageError{Op: "get query", Err: err}
+	}
+
+	opts.IdempotencyKey = ""
+	opts.rerun = query
+	return s.ProcessSearchQueryWithOptions(ctx, query.Query, opts)
+}
+
+// EstimateSearchQuery estimates the prompt size and cost of the AI call a
+// search for queryText would make with opts, without calling the AI or
+// storing anything. The prompt is built from the current articles as it
+// would be sent to Gemini, whichever provider answers.
+func (s *SearchService) EstimateSearchQuery(ctx context.Context, queryText string, opts SearchOptions) (*models.SearchEstimate, error) {
+	if s.db == nil || s.aiService == nil {
+		return nil, ErrNotInitialized
+	}
+	if _, err := s.aiServiceFor(opts.Provider); err != nil {
+		return nil, err
+	}
+
+	if s.cfg.RedactQueries && s.cfg.RedactAIQuery {
+		queryText = textutil.Redact(queryText, s.cfg.RedactRules)
+	}
+
+	articles, err := s.articlesFor(ctx, opts.ArticleIDs)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create query: %w", err)
+		return nil, err
+	}
+
+	provider := s.promptProvider(opts.Provider)
+	estimate := &models.SearchEstimate{Provider: provider}
+	if len(articles) == 0 {
+		// An empty knowledge base is answered without calling the AI
+		return estimate, nil
+	}
+
+	promptArticles := s.promptArticles(provider, queryText, articles)
+	prompt := ai.BuildPrompt(queryText, promptArticles,
+		ai.WithMaxArticleChars(s.cfg.PromptMaxArticleChars),
+		ai.WithArticleKeywords(s.cfg.AIContextKeywords),
+		ai.WithPromptFields(ai.PromptFields(s.cfg.PromptArticleFields), s.cfg.PromptExcerptChars))
+	estimate.ArticlesConsidered = len(promptArticles)
+	estimate.PromptChars = utf8.RuneCountInString(prompt)
+	estimate.EstimatedInputTokens = textutil.EstimateTokens(prompt)
+	estimate.MaxOutputTokens = s.cfg.GeminiMaxOutputTokens
+	estimate.EstimatedCost = float64(estimate.EstimatedInputTokens)/1000*s.cfg.AIInputCostPer1K +
+		float64(estimate.MaxOutputTokens)/1000*s.cfg.AIOutputCostPer1K
+	return estimate, nil
+}
+
+// ProcessSearchQueryWithOptions processes a search query using the given options
+func (s *SearchService) ProcessSearchQueryWithOptions(ctx context.Context, queryText string, opts SearchOptions) (*models.SearchResponse, error) {
+	ctx, span := tracing.Start(ctx, "SearchService.ProcessSearchQuery",
+		tracing.QueryLengthKey.Int(utf8.RuneCountInString(queryText)),
+		tracing.ProviderKey.String(s.promptProvider(opts.Provider)))
+	var response *models.SearchResponse
+	var err error
+	if opts.IdempotencyKey != "" && !opts.DryRun && opts.rerun == nil {
+		response, err = s.processIdempotentSearch(ctx, queryText, opts)
+	} else {
+		response, err = s.processSearchQuery(ctx, queryText, opts)
+	}
+	if response != nil {
+		span.SetAttributes(tracing.ArticleCountKey.Int(response.ArticlesConsidered))
+	}
+	tracing.End(span, err)
+	return response, err
+}
+
+// processSearchQuery does the work of ProcessSearchQueryWithOptions within
+// its span
+func (s *SearchService) processSearchQuery(ctx context.Context, queryText string, opts SearchOptions) (*models.SearchResponse, error) {
+	if s.db == nil || s.aiService == nil {
+		return nil, ErrNotInitialized
 	}
 
-	// Get all articles for AI analysis
-	articles, err := s.db.GetAllArticles()
+	aiService, err := s.aiServiceFor(opts.Provider)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get articles: %w", err)
+		return nil, err
 	}
 
-	// Analyze query with AI
-	aiResult, err := s.aiService.AnalyzeQuery(queryText, articles)
+	minRelevance, err := s.minRelevanceFor(opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to analyze query: %w", err)
+		return nil, err
 	}
 
-	// Save search result
-	_, err = s.db.CreateSearchResult(query.ID, aiResult.Summary, aiResult.RelevantArticles)
+	// Mask sensitive parts of the query before storing it. The AI gets the
+	// original, which it does not keep, unless RedactAIQuery is set.
+	storedText := s.storedQueryText(queryText)
+	if s.cfg.RedactQueries && s.cfg.RedactAIQuery {
+		queryText = storedText
+	}
+
+	// Get the articles for AI analysis before storing anything, so a
+	// request naming invalid articles leaves no query behind
+	articles, err := s.articlesFor(ctx, opts.ArticleIDs)
 	if err != nil {
-		return nil, fmt.Errorf("failed to save search result: %w", err)
+		return nil, err
+	}
+
+	// Create query record, dry runs only get a timestamp
+	query := &models.Query{Query: storedText, CreatedAt: time.Now()}
+	if opts.rerun != nil {
+		query = opts.rerun
+	} else if !opts.DryRun {
+		query, err = s.db.CreateQuery(ctx, storedText)
+		if err != nil {
+			return nil, &StorageError{Op: "create query", Err: err}
+		}
+	}
+	if opts.rerun != nil {
+		ctx = logging.WithQueryID(ctx, query.ID)
+		s.logger.DebugContext(ctx, "rerunning query")
+	} else if !opts.DryRun {
+		ctx = logging.WithQueryID(ctx, query.ID)
+		s.logger.DebugContext(ctx, "query created")
+	}
+
+	// Analyze query with AI, unless there is nothing to analyze it against
+	knowledgeBaseEmpty := len(articles) == 0
+	var aiResult *ai.AIAnalysisResult
+	var articlesConsidered int
+	var aiFallback bool
+	if knowledgeBaseEmpty {
+		aiResult = &ai.AIAnalysisResult{Summary: s.cfg.EmptyKnowledgeBaseMessage}
+	} else {
+		// Only send what fits the provider's context window
+		promptArticles := s.promptArticles(s.promptProvider(opts.Provider), queryText, articles)
+
+		// Reuse an earlier analysis of the same question if the articles
+		// have not changed since
+		kbHash := knowledgeBaseHash(articles)
+		cacheKey := analysisCacheKey(s.providerName(opts.Provider), queryText, opts.ArticleIDs)
+		var cached bool
+		if opts.rerun == nil {
+			aiResult, cached = s.cache.get(cacheKey, kbHash)
+		}
+		if !cached && opts.cachedOnly {
+			return nil, ErrNotCached
+		}
+		useBreaker := s.providerName(opts.Provider) == ""
+		if cached {
+			s.logger.DebugContext(ctx, "reused cached AI analysis")
+		} else if useBreaker && !s.breaker.allow() {
+			// The provider keeps failing, so answer from keyword matching
+			// until it recovers. The answer is not cached as the provider's.
+			inARow, total := s.fallbacks.fallback()
+			s.logger.WarnContext(ctx, "AI circuit breaker is open, answering with the mock AI",
+				"fallbacks_in_a_row", inARow, "fallbacks_total", total)
+			aiResult, err = s.analyze(ctx, s.mockAI, ProviderMock, queryText, promptArticles)
+			if err != nil {
+				return nil, err
+			}
+			aiFallback = true
+		} else {
+			aiResult, err = s.analyze(ctx, aiService, s.promptProvider(opts.Provider), queryText, promptArticles)
+			if useBreaker {
+				s.breaker.record(err)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if useBreaker {
+				s.fallbacks.recovered()
+			}
+			s.cache.put(cacheKey, kbHash, aiResult)
+
+			// The prompt embeds the query and the response may quote it, so
+			// both are masked like the stored query
+			if s.auditLogger != nil {
+				s.auditLogger.Log(audit.Entry{
+					QueryID:  query.ID,
+					Query:    storedText,
+					Prompt:   s.storedQueryText(aiResult.Prompt),
+					Response: s.storedQueryText(aiResult.RawResponse),
+				})
+			}
+		}
+		articlesConsidered = len(promptArticles)
+
+		// Cited articles that no longer exist leave the summary without
+		// links, so recover the closest match to what the summary says
+		if len(opts.ArticleIDs) > 0 {
+			aiResult = restrictToArticles(aiResult, opts.ArticleIDs)
+		}
+		if len(aiResult.DroppedArticleIDs) > 0 {
+			s.logger.WarnContext(ctx, "AI cited unknown articles", "article_ids", aiResult.DroppedArticleIDs)
+			if len(aiResult.RelevantArticles) == 0 {
+				if recovered, _ := s.matchArticlesByKeywords(aiResult.Summary, articles, 1); len(recovered) > 0 {
+					aiResult.RelevantArticles = []int{recovered[0].ID}
+				}
+			}
+		}
+
+		aiResult.RelevantArticles = filterByRelevance(aiResult.RelevantArticles, aiResult.Scores, minRelevance)
+	}
+
+	// Urgent topics always point the user to IT, whatever the AI said
+	escalate := matchesEscalation(queryText, s.cfg.EscalationKeywords)
+	if escalate {
+		aiResult.Summary = strings.TrimSpace(s.cfg.EscalationMessage + " " + aiResult.Summary)
+	}
+
+	// Save search result
+	var resultID int
+	if !opts.DryRun {
+		result, err := s.db.CreateSearchResult(ctx, query.ID, aiResult.Summary, aiResult.RelevantArticles, aiResult.Scores)
+		if err != nil {
+			return nil, &StorageError{Op: "save search result", Err: err}
+		}
+		resultID = result.ID
+		s.logger.DebugContext(ctx, "search result saved", "result_id", resultID)
 	}
 
 	// Get relevant articles details
-	relevantArticles, err := s.db.GetArticlesByIDs(aiResult.RelevantArticles)
+	relevantArticles, err := s.db.GetArticlesByIDs(ctx, aiResult.RelevantArticles)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get relevant articles: %w", err)
+		return nil, &StorageError{Op: "get relevant articles", Err: err}
 	}
+	orderByIDs(relevantArticles, aiResult.RelevantArticles)
+	s.rankArticles(relevantArticles, aiResult.Scores)
+	relevantArticles = nonNilArticles(s.searchable(relevantArticles))
+	s.logger.DebugContext(ctx, "relevant articles loaded", "count", len(relevantArticles))
 
 	// Build response
 	response := &models.SearchResponse{
-		Query:              queryText,
+		Query:              storedText,
 		AISummaryAnswer:    aiResult.Summary,
 		AIRelevantArticles: relevantArticles,
 		QueryID:            query.ID,
+		ResultID:           resultID,
 		Timestamp:          query.CreatedAt,
+		DryRun:             opts.DryRun,
+		KnowledgeBaseEmpty: knowledgeBaseEmpty,
+		Escalate:           escalate,
+		ArticlesConsidered: articlesConsidered,
+		DroppedArticleIDs:  aiResult.DroppedArticleIDs,
+		AIFallback:         aiFallback,
+	}
+	if s.cfg.Debug {
+		response.FinishReason = aiResult.FinishReason
+	}
+
+	// Suggest keyword matches when the AI did not link any article
+	if len(relevantArticles) == 0 && s.cfg.KeywordBackfill {
+		var totalMatches int
+		response.SuggestedArticles, totalMatches = s.matchArticlesByKeywords(queryText, articles, s.cfg.KeywordBackfillLimit)
+		if totalMatches > len(response.SuggestedArticles) {
+			response.Notes = append(response.Notes, fmt.Sprintf(
+				"Showing %d of %d suggested articles.", len(response.SuggestedArticles), totalMatches))
+		}
+	}
+
+	// Tell the user when limits hid part of the knowledge base
+	if knowledgeBaseEmpty {
+		response.Notes = append(response.Notes, "The knowledge base has no articles yet.")
+	}
+	if articlesConsidered > 0 && articlesConsidered < len(articles) {
+		response.Notes = append(response.Notes, fmt.Sprintf(
+			"Only %d of %d articles were analyzed.", articlesConsidered, len(articles)))
 	}
+	if aiResult.TruncatedArticles > 0 {
+		response.Notes = append(response.Notes, fmt.Sprintf(
+			"%d of %d articles were shortened before analysis.", aiResult.TruncatedArticles, articlesConsidered))
+	}
+	response.Truncated = len(response.Notes) > 0
+
+	response.AIRelevantArticles = FormatArticles(response.AIRelevantArticles, opts.Format)
+	response.SuggestedArticles = FormatArticles(response.SuggestedArticles, opts.Format)
 
 	return response, nil
 }
 
+// ProcessSearchBatch processes each query like ProcessSearchQueryWithOptions,
+// running up to BatchConcurrency of them at once. A failing query is
+// reported in its own result without affecting the others. Results are in
+// the same order as queries. An error is only returned when the options
+// themselves are invalid.
+func (s *SearchService) ProcessSearchBatch(ctx context.Context, queries []string, opts SearchOptions) ([]models.BatchSearchResult, error) {
+	if _, err := s.aiServiceFor(opts.Provider); err != nil {
+		return nil, err
+	}
+	if _, err := s.minRelevanceFor(opts); err != nil {
+		return nil, err
+	}
+
+	// Retries of a batch cannot be told apart per query
+	opts.IdempotencyKey = ""
+
+	concurrency := s.cfg.BatchConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]models.BatchSearchResult, len(queries))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, query := range queries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, query string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			results[i].Query = query
+			response, err := s.ProcessSearchQueryWithOptions(ctx, query, opts)
+			if err != nil {
+				results[i].Error = err.Error()
+				return
+			}
+			results[i].Result = response
+		}(i, query)
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+// minRelevanceFor returns the relevance threshold for a request, falling
+// back to the configured default
+func (s *SearchService) minRelevanceFor(opts SearchOptions) (float64, error) {
+	minRelevance := s.cfg.MinRelevance
+	if opts.MinRelevance != nil {
+		minRelevance = *opts.MinRelevance
+	}
+	if !(minRelevance >= 0 && minRelevance <= 1) {
+		return 0, &ValidationError{Err: ErrInvalidRelevance}
+	}
+	return minRelevance, nil
+}
+
+// articlesFor returns the articles a search is analyzed against: all of
+// them, or only articleIDs when the search is scoped. A ValidationError
+// wrapping ErrUnknownArticle lists any scoped ID that does not exist.
+func (s *SearchService) articlesFor(ctx context.Context, articleIDs []int) ([]models.Article, error) {
+	if len(articleIDs) == 0 {
+		articles, err := s.db.GetAllArticles(ctx)
+		if err != nil {
+			return nil, &StorageError{Op: "get articles", Err: err}
+		}
+		return s.searchable(articles), nil
+	}
+
+	articles, err := s.db.GetArticlesByIDs(ctx, articleIDs)
+	if err != nil {
+		return nil, &StorageError{Op: "get articles", Err: err}
+	}
+	found := make(map[int]bool, len(articles))
+	for _, article := range articles {
+		found[article.ID] = true
+	}
+	var missing []int
+	for _, id := range articleIDs {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, &ValidationError{Err: fmt.Errorf("%w: %v", ErrUnknownArticle, missing)}
+	}
+	var excluded []int
+	for _, id := range articleIDs {
+		if s.excluded[id] {
+			excluded = append(excluded, id)
+		}
+	}
+	if len(excluded) > 0 {
+		return nil, &ValidationError{Err: fmt.Errorf("%w: %v", ErrExcludedArticle, excluded)}
+	}
+	sort.Slice(articles, func(i, j int) bool { return articles[i].ID < articles[j].ID })
+	return articles, nil
+}
+
+// searchable drops the articles excluded from searches by the
+// SearchExcludedArticles setting. articles is not modified.
+func (s *SearchService) searchable(articles []models.Article) []models.Article {
+	if len(s.excluded) == 0 {
+		return articles
+	}
+
+	kept := make([]models.Article, 0, len(articles))
+	for _, article := range articles {
+		if !s.excluded[article.ID] {
+			kept = append(kept, article)
+		}
+	}
+	return kept
+}
+
+// restrictToArticles drops cited articles outside a scoped search's
+// articleIDs, reporting them with the other dropped IDs
+func restrictToArticles(result *ai.AIAnalysisResult, articleIDs []int) *ai.AIAnalysisResult {
+	allowed := make(map[int]bool, len(articleIDs))
+	for _, id := range articleIDs {
+		allowed[id] = true
+	}
+
+	restricted := cloneAnalysis(result)
+	restricted.RelevantArticles = restricted.RelevantArticles[:0]
+	for _, id := range result.RelevantArticles {
+		if allowed[id] {
+			restricted.RelevantArticles = append(restricted.RelevantArticles, id)
+		} else {
+			restricted.DroppedArticleIDs = append(restricted.DroppedArticleIDs, id)
+		}
+	}
+	return restricted
+}
+
+// filterByRelevance drops articles scored below minRelevance. Articles
+// without a score are kept, since there is nothing to judge them by.
+func filterByRelevance(ids []int, scores map[int]float64, minRelevance float64) []int {
+	if minRelevance <= 0 {
+		return ids
+	}
+
+	var kept []int
+	for _, id := range ids {
+		if score, scored := scores[id]; scored && score < minRelevance {
+			continue
+		}
+		kept = append(kept, id)
+	}
+	return kept
+}
+
+// analyze runs an AI analysis once a slot is free. Analyses slower than the
+// AISlowThreshold setting are logged, whether or not they succeed. A blank
+// summary from any provider is replaced with the FallbackSummary setting.
+func (s *SearchService) analyze(ctx context.Context, aiService ai.AIServiceInterface, provider, query string, articles []models.Article) (*ai.AIAnalysisResult, error) {
+	if s.aiSlots != nil {
+		if err := s.acquireAISlot(ctx); err != nil {
+			return nil, err
+		}
+		defer func() { <-s.aiSlots }()
+	}
+
+	// The provider delimits the query, but attempts are worth knowing about
+	if ai.SuspectedInjection(query) {
+		s.logger.WarnContext(ctx, "query looks like a prompt injection attempt")
+	}
+
+	ctx, span := tracing.Start(ctx, "ai.AnalyzeQuery",
+		tracing.ProviderKey.String(provider),
+		tracing.QueryLengthKey.Int(utf8.RuneCountInString(query)),
+		tracing.ArticleCountKey.Int(len(articles)))
+	start := time.Now()
+	result, err := aiService.AnalyzeQuery(ctx, query, articles)
+	duration := time.Since(start)
+	tracing.End(span, err)
+	if s.cfg.AISlowThreshold > 0 && duration > s.cfg.AISlowThreshold {
+		s.logger.WarnContext(ctx, "slow AI analysis", "provider", provider,
+			"query_chars", utf8.RuneCountInString(query), "articles", len(articles),
+			"duration_ms", duration.Milliseconds(), "threshold_ms", s.cfg.AISlowThreshold.Milliseconds())
+	}
+	if err != nil {
+		s.logger.WarnContext(ctx, "AI analysis failed", "error", err)
+		return nil, &AIError{Err: err}
+	}
+	if strings.TrimSpace(result.Summary) == "" {
+		s.logger.WarnContext(ctx, "AI returned an empty summary, using the fallback summary", "provider", provider)
+		result.Summary = s.fallbackSummary()
+	}
+	s.logger.DebugContext(ctx, "AI analysis finished",
+		"articles", len(articles), "relevant", len(result.RelevantArticles), "duration_ms", duration.Milliseconds())
+	return result, nil
+}
+
+// fallbackSummary returns the summary given when the AI produces none
+func (s *SearchService) fallbackSummary() string {
+	if s.cfg.FallbackSummary == "" {
+		return ai.DefaultFallbackSummary
+	}
+	return s.cfg.FallbackSummary
+}
+
+// acquireAISlot waits for a free AI slot. It returns ErrAIBusy if none frees
+// up within the queue timeout.
+func (s *SearchService) acquireAISlot(ctx context.Context) error {
+	select {
+	case s.aiSlots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(s.cfg.AIQueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case s.aiSlots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return ErrAIBusy
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// promptProvider returns the name of the provider that analyzes a request,
+// to look up its prompt limits
+func (s *SearchService) promptProvider(provider string) string {
+	if name := s.providerName(provider); name != "" {
+		return name
+	}
+	return s.cfg.AIProvider()
+}
+
+// providerName returns the provider a request's override selects, or ""
+// for the configured service
+func (s *SearchService) providerName(provider string) string {
+	if !s.cfg.AllowProviderOverride {
+		return ""
+	}
+	return provider
+}
+
+// aiServiceFor returns the AI service to use for a request's provider
+// override, falling back to the configured service
+func (s *SearchService) aiServiceFor(provider string) (ai.AIServiceInterface, error) {
+	switch provider = s.providerName(provider); provider {
+	case "":
+		return s.aiService, nil
+	case ProviderMock:
+		return s.mockAI, nil
+	default:
+		return nil, &ValidationError{Err: fmt.Errorf("%w: %q", ErrUnknownProvider, provider)}
+	}
+}
+
+// nonNilArticles returns an empty slice for nil, so responses always carry
+// ai_relevant_articles as [] rather than null
+func nonNilArticles(articles []models.Article) []models.Article {
+	if articles == nil {
+		return []models.Article{}
+	}
+	return articles
+}
+
+// FormatArticles renders the content of each article in the given format.
+// Text returns the articles unchanged.
+func FormatArticles(articles []models.Article, format ContentFormat) []models.Article {
+	if format != ContentFormatHTML || articles == nil {
+		return articles
+	}
+
+	formatted := make([]models.Article, len(articles))
+	for i, article := range articles {
+		if article.Content != "" {
+			article.Content = textutil.StepsToHTML(article.Content)
+		}
+		formatted[i] = article
+	}
+	return formatted
+}
+
 // GetArticleByID retrieves a specific article
-func (s *SearchService) GetArticleByID(id int) (*models.Article, error) {
-	return s.db.GetArticleByID(id)
+func (s *SearchService) GetArticleByID(ctx context.Context, id int) (*models.Article, error) {
+	if s.db == nil {
+		return nil, ErrNotInitialized
+	}
+	return s.db.GetArticleByID(ctx, id)
+}
+
+// UpdateArticle replaces an article's title and content, keeping the
+// previous version in its history. Returns ErrDuplicateTitle if another
+// article already has the title.
+func (s *SearchService) UpdateArticle(ctx context.Context, id int, title, content string) (*models.Article, error) {
+	if s.db == nil {
+		return nil, ErrNotInitialized
+	}
+	if err := s.checkTitleFree(ctx, title, id); err != nil {
+		return nil, err
+	}
+	return s.db.UpdateArticle(ctx, id, title, content)
+}
+
+// ImportArticles stores new articles, all of them or none. Returns
+// ErrDuplicateTitle if an article's title is already taken.
+func (s *SearchService) ImportArticles(ctx context.Context, articles []models.Article) ([]models.Article, error) {
+	if s.db == nil {
+		return nil, ErrNotInitialized
+	}
+	for _, article := range articles {
+		if err := s.checkTitleFree(ctx, article.Title, 0); err != nil {
+			return nil, err
+		}
+	}
+	imported, err := s.db.ImportArticles(ctx, articles)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.InfoContext(ctx, "articles imported", "count", len(imported))
+	if s.cfg.AutoSummarize {
+		s.startSummaries(ctx, imported)
+	}
+	return imported, nil
+}
+
+// checkTitleFree returns ErrDuplicateTitle if an article other than
+// exceptID has the title. The database enforces this too; checking first
+// gives the common case a clear error.
+func (s *SearchService) checkTitleFree(ctx context.Context, title string, exceptID int) error {
+	existing, err := s.db.GetArticleByTitle(ctx, title)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if existing.ID != exceptID {
+		return fmt.Errorf("%w: %q", ErrDuplicateTitle, existing.Title)
+	}
+	return nil
+}
+
+// GetArticleHistory returns the previous versions of an article, newest
+// first. Returns sql.ErrNoRows if the article does not exist.
+func (s *SearchService) GetArticleHistory(ctx context.Context, id int) ([]models.ArticleVersion, error) {
+	if s.db == nil {
+		return nil, ErrNotInitialized
+	}
+	if _, err := s.db.GetArticleByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.db.GetArticleHistory(ctx, id)
 }
 
 // GetAllArticles retrieves all articles
-func (s *SearchService) GetAllArticles() ([]models.Article, error) {
-	return s.db.GetAllArticles()
+func (s *SearchService) GetAllArticles(ctx context.Context) ([]models.Article, error) {
+	if s.db == nil {
+		return nil, ErrNotInitialized
+	}
+	return s.db.GetAllArticles(ctx)
+}
+
+// ExportArticles calls fn with every article in ID order, without loading
+// them all at once. It stops at the first error fn returns.
+func (s *SearchService) ExportArticles(ctx context.Context, fn func(models.Article) error) error {
+	if s.db == nil {
+		return ErrNotInitialized
+	}
+	return s.db.EachArticle(ctx, fn)
+}
+
+// RecordArticleView records that an article was opened by a user
+func (s *SearchService) RecordArticleView(ctx context.Context, id int) error {
+	if s.db == nil {
+		return ErrNotInitialized
+	}
+
+	// Make sure the article exists before counting the view
+	if _, err := s.db.GetArticleByID(ctx, id); err != nil {
+		return err
+	}
+
+	return s.db.RecordArticleView(ctx, id)
+}
+
+// SearchArticles finds articles containing words of query, best matches
+// first. It is a cheap alternative to a full search: the AI is not called
+// and the query is not recorded.
+func (s *SearchService) SearchArticles(ctx context.Context, query string, limit, offset int) ([]models.Article, error) {
+	if s.db == nil {
+		return nil, ErrNotInitialized
+	}
+	articles, err := s.db.KeywordSearchArticles(ctx, s.keywords(query), s.excludedIDs, limit, offset)
+	if err != nil {
+		return nil, &StorageError{Op: "search articles", Err: err}
+	}
+	return articles, nil
+}
+
+// GetPopularArticles retrieves the most viewed articles
+func (s *SearchService) GetPopularArticles(ctx context.Context, limit, offset int) ([]models.PopularArticle, error) {
+	if s.db == nil {
+		return nil, ErrNotInitialized
+	}
+	return s.db.GetPopularArticles(ctx, limit, offset)
+}
+
+// CheckHealth reports the state of the service's dependencies. The database
+// is always checked. The AI backend and free disk space are only checked when
+// deep is set, since reaching the AI may cost tokens. An unreachable AI or
+// low disk space degrades the service, while an unreachable database or a
+// nearly full disk makes it unhealthy.
+func (s *SearchService) CheckHealth(ctx context.Context, deep bool) *models.HealthStatus {
+	health := &models.HealthStatus{
+		Status:       models.HealthStatusHealthy,
+		Dependencies: map[string]string{},
+	}
+
+	if s.db == nil {
+		health.Dependencies["database"] = models.DependencyUnavailable
+		health.Warnings = append(health.Warnings, "database is not configured")
+	} else if err := s.db.Ping(ctx); err != nil {
+		health.Dependencies["database"] = models.DependencyUnavailable
+		health.Warnings = append(health.Warnings, fmt.Sprintf("database is unreachable: %v", err))
+	} else {
+		health.Dependencies["database"] = models.DependencyOK
+	}
+
+	if deep {
+		if err := s.pingAI(ctx); err != nil {
+			health.Dependencies["ai"] = models.DependencyDegraded
+			health.Warnings = append(health.Warnings, fmt.Sprintf("AI provider is unreachable: %v", err))
+		} else {
+			health.Dependencies["ai"] = models.DependencyOK
+		}
+		s.checkDisk(health)
+	}
+
+	if s.breaker.enabled() {
+		state, failures, openUntil := s.breaker.status()
+		health.AICircuit = state
+		health.AIFallbacks = s.fallbacks.count()
+		switch state {
+		case BreakerOpen:
+			health.Dependencies["ai"] = models.DependencyDegraded
+			health.Warnings = append(health.Warnings, fmt.Sprintf(
+				"AI provider failed %d times in a row, calls are paused until %s", failures, openUntil.Format(time.RFC3339)))
+		case BreakerHalfOpen:
+			health.Dependencies["ai"] = models.DependencyDegraded
+			health.Warnings = append(health.Warnings, "AI provider is being retried after repeated failures")
+		}
+	}
+
+	switch {
+	case health.Dependencies["database"] != models.DependencyOK,
+		health.Dependencies["disk"] == models.DependencyUnavailable:
+		health.Status = models.HealthStatusUnhealthy
+	case len(health.Warnings) > 0:
+		health.Status = models.HealthStatusDegraded
+	}
+
+	return health
+}
+
+// pingAI checks the configured AI backend is reachable. Services that
+// cannot be checked are assumed to be reachable.
+func (s *SearchService) pingAI(ctx context.Context) error {
+	if s.aiService == nil {
+		return ErrNotInitialized
+	}
+
+	checker, ok := s.aiService.(ai.HealthChecker)
+	if !ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, aiPingTimeout)
+	defer cancel()
+	return checker.Ping(ctx)
+}
+
+// EffectiveConfig returns the configuration the service runs with, with
+// secrets redacted
+func (s *SearchService) EffectiveConfig() map[string]interface{} {
+	return s.cfg.Redacted()
+}
+
+// GetStats returns aggregate counts for the admin dashboard
+func (s *SearchService) GetStats(ctx context.Context) (*models.Stats, error) {
+	if s.db == nil {
+		return nil, ErrNotInitialized
+	}
+	return s.db.GetStats(ctx)
+}
+
+// TopQueries returns the most frequently asked queries since the given time
+func (s *SearchService) TopQueries(ctx context.Context, since time.Time, limit int) ([]models.TopQuery, error) {
+	if s.db == nil {
+		return nil, ErrNotInitialized
+	}
+	return s.db.TopQueries(ctx, since, limit)
+}
+
+// PurgeQueries deletes queries created before cutoff and their results,
+// along with every expired share token
+func (s *SearchService) PurgeQueries(ctx context.Context, cutoff time.Time) (*models.PurgeResult, error) {
+	if s.db == nil {
+		return nil, ErrNotInitialized
+	}
+
+	result, err := s.db.PurgeQueriesOlderThan(ctx, cutoff)
+	if err != nil {
+		return nil, &StorageError{Op: "purge queries", Err: err}
+	}
+	s.logger.InfoContext(ctx, "purged old queries",
+		"queries", result.QueriesDeleted, "results", result.ResultsDeleted,
+		"expired_shares", result.ExpiredSharesDeleted, "cutoff", cutoff.Format(time.RFC3339))
+	return result, nil
+}
+
+// Reindex rebuilds the article search index
+func (s *SearchService) Reindex(ctx context.Context) (*models.ReindexResult, error) {
+	if s.db == nil {
+		return nil, ErrNotInitialized
+	}
+
+	s.reindexMu.Lock()
+	defer s.reindexMu.Unlock()
+
+	start := time.Now()
+	s.logger.InfoContext(ctx, "reindexing articles")
+
+	count, err := s.db.Reindex(ctx)
+	if err != nil {
+		return nil, &StorageError{Op: "reindex articles", Err: err}
+	}
+
+	result := &models.ReindexResult{
+		ArticlesIndexed: count,
+		DurationMS:      time.Since(start).Milliseconds(),
+	}
+	s.logger.InfoContext(ctx, "reindexed articles", "count", result.ArticlesIndexed, "duration_ms", result.DurationMS)
+
+	return result, nil
+}
+
+// Backup writes a consistent snapshot of the database to w and returns the
+// number of bytes written. The snapshot is staged in a temporary file that
+// is removed afterwards; nothing is written to w if taking it fails.
+func (s *SearchService) Backup(ctx context.Context, w io.Writer) (int64, error) {
+	if s.db == nil {
+		return 0, ErrNotInitialized
+	}
+
+	dir, err := os.MkdirTemp("", "event-to-insight-backup-")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "backup.db")
+	if err := s.db.Backup(ctx, path); err != nil {
+		return 0, fmt.Errorf("failed to back up database: %w", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer file.Close()
+
+	return io.Copy(w, file)
 }
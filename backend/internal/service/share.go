@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"event-to-insight/internal/models"
+	"time"
+)
+
+// shareTokenBytes is how many random bytes make up a share token, enough
+// that tokens cannot be guessed
+const shareTokenBytes = 32
+
+// ShareQueryResult mints a link giving read-only access to the latest
+// result of a query until ShareTokenTTL passes. It returns sql.ErrNoRows if
+// the query does not exist or has no stored result.
+func (s *SearchService) ShareQueryResult(ctx context.Context, queryID int) (*models.ShareLink, error) {
+	if s.db == nil {
+		return nil, ErrNotInitialized
+	}
+
+	result, err := s.db.GetSearchResultByQueryID(ctx, queryID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, &StorageError{Op: "get stored search result", Err: err}
+	}
+
+	token, err := newShareToken()
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(s.cfg.ShareTokenTTL)
+	if err := s.db.CreateShareToken(ctx, result.ID, token, expiresAt); err != nil {
+		return nil, &StorageError{Op: "create share token", Err: err}
+	}
+
+	return &models.ShareLink{
+		Token:     token,
+		URL:       "/api/shared/" + token,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// GetSharedResult returns the search result a share token gives access to.
+// It returns sql.ErrNoRows for an unknown token and ErrShareExpired for an
+// expired one.
+func (s *SearchService) GetSharedResult(ctx context.Context, token string) (*models.SharedResult, error) {
+	if s.db == nil {
+		return nil, ErrNotInitialized
+	}
+
+	result, err := s.db.GetResultByShareToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) || errors.Is(err, ErrShareExpired) {
+			return nil, err
+		}
+		return nil, &StorageError{Op: "get shared search result", Err: err}
+	}
+
+	query, err := s.db.GetQueryByID(ctx, result.QueryID)
+	if err != nil {
+		return nil, &StorageError{Op: "get query", Err: err}
+	}
+
+	articles, err := s.db.GetArticlesByIDs(ctx, result.AIRelevantArticles)
+	if err != nil {
+		return nil, &StorageError{Op: "get relevant articles", Err: err}
+	}
+	orderByIDs(articles, result.AIRelevantArticles)
+	s.rankArticles(articles, result.Scores)
+
+	return &models.SharedResult{
+		Query:              query.Query,
+		AISummaryAnswer:    result.AISummaryAnswer,
+		AIRelevantArticles: nonNilArticles(s.searchable(articles)),
+		AnsweredAt:         result.CreatedAt,
+	}, nil
+}
+
+// newShareToken returns a random, URL-safe share token
+func newShareToken() (string, error) {
+	b := make([]byte, shareTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
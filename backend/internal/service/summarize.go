@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"event-to-insight/internal/ai"
+	"event-to-insight/internal/models"
+	"strings"
+	"time"
+)
+
+// summaryJobTimeout bounds how long the summaries of one import may take
+const summaryJobTimeout = 30 * time.Minute
+
+// Wait blocks until background work started by the service, such as
+// summarizing imported articles, has finished
+func (s *SearchService) Wait() {
+	s.background.Wait()
+}
+
+// startSummaries has the AI summarize newly imported articles in the
+// background, so an import returns as soon as its articles are stored.
+// Each summary is stored as it is written; an article edited in the
+// meantime keeps no summary.
+func (s *SearchService) startSummaries(ctx context.Context, articles []models.Article) {
+	summarizer, ok := s.aiService.(ai.Summarizer)
+	if !ok {
+		s.logger.WarnContext(ctx, "AI service cannot summarize articles, importing them without summaries")
+		return
+	}
+
+	// The job outlives the request, but keeps its logging attributes
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), summaryJobTimeout)
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		defer cancel()
+		s.summarizeImported(ctx, summarizer, articles)
+	}()
+}
+
+// summarizeImported summarizes articles one at a time, so the job takes
+// at most one AI slot from searches. It stops when ctx is done or the
+// circuit breaker opens; an article the AI fails to summarize is left
+// without one.
+func (s *SearchService) summarizeImported(ctx context.Context, summarizer ai.Summarizer, articles []models.Article) {
+	summarized := 0
+	for i, article := range articles {
+		if ctx.Err() != nil {
+			s.logger.WarnContext(ctx, "stopped summarizing imported articles",
+				"summarized", summarized, "remaining", len(articles)-i, "error", ctx.Err())
+			return
+		}
+		if !s.breaker.allow() {
+			s.logger.WarnContext(ctx, "AI circuit breaker is open, leaving imported articles without summaries",
+				"summarized", summarized, "remaining", len(articles)-i)
+			return
+		}
+
+		summary, err := s.summarizeArticle(ctx, summarizer, article)
+		switch {
+		case err == nil:
+			s.breaker.record(nil)
+		case !errors.Is(err, ErrAIBusy) && ctx.Err() == nil:
+			// Only failures of the provider itself count towards the breaker
+			s.breaker.record(&AIError{Err: err})
+		}
+		if err != nil {
+			s.logger.WarnContext(ctx, "could not summarize article, leaving it without a summary",
+				"title", article.Title, "error", err)
+			continue
+		}
+
+		err = s.db.SetArticleSummary(ctx, article.ID, article.Content, strings.TrimSpace(summary))
+		if errors.Is(err, sql.ErrNoRows) {
+			s.logger.DebugContext(ctx, "article changed while being summarized", "article_id", article.ID)
+			continue
+		}
+		if err != nil {
+			s.logger.WarnContext(ctx, "could not store article summary", "article_id", article.ID, "error", err)
+			continue
+		}
+		summarized++
+	}
+	s.logger.InfoContext(ctx, "imported articles summarized", "summarized", summarized, "of", len(articles))
+}
+
+// summarizeArticle asks summarizer for article's summary once an AI slot
+// is free
+func (s *SearchService) summarizeArticle(ctx context.Context, summarizer ai.Summarizer, article models.Article) (string, error) {
+	if s.aiSlots != nil {
+		if err := s.acquireAISlot(ctx); err != nil {
+			return "", err
+		}
+		defer func() { <-s.aiSlots }()
+	}
+	return summarizer.SummarizeArticle(ctx, article)
+}
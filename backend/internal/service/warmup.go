@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// StartWarmup primes the service in the background and returns a channel
+// that is closed once it is done. The articles are loaded, then each query
+// is analyzed as a dry run so its answer is cached without being stored.
+// A failed query is logged and skipped. Ready reports false until the
+// warmup finishes or ctx is done.
+func (s *SearchService) StartWarmup(ctx context.Context, queries []string) <-chan struct{} {
+	s.warmingUp.Store(true)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer s.warmingUp.Store(false)
+		s.warmup(ctx, queries)
+	}()
+	return done
+}
+
+// Ready reports whether the service has finished warming up. It is always
+// true when no warmup was started.
+func (s *SearchService) Ready() bool {
+	return !s.warmingUp.Load()
+}
+
+// warmup runs the warmup steps, stopping early when ctx is done
+func (s *SearchService) warmup(ctx context.Context, queries []string) {
+	if s.db == nil || s.aiService == nil {
+		return
+	}
+
+	start := time.Now()
+	s.logger.InfoContext(ctx, "warming up", "queries", len(queries))
+
+	articles, err := s.db.GetAllArticles(ctx)
+	if err != nil {
+		s.logger.WarnContext(ctx, "warmup could not load articles", "error", err)
+		return
+	}
+	s.logger.InfoContext(ctx, "warmup loaded articles", "count", len(articles))
+
+	warmed := 0
+	for i, query := range queries {
+		if ctx.Err() != nil {
+			s.logger.WarnContext(ctx, "warmup stopped early", "queries_warmed", warmed, "error", ctx.Err())
+			return
+		}
+		if _, err := s.ProcessSearchQueryWithOptions(ctx, query, SearchOptions{DryRun: true}); err != nil {
+			s.logger.WarnContext(ctx, "warmup query failed", "query", query, "error", err)
+			continue
+		}
+		warmed++
+		s.logger.InfoContext(ctx, "warmup query cached", "progress", i+1, "of", len(queries))
+	}
+
+	s.logger.InfoContext(ctx, "warmup complete",
+		"queries_warmed", warmed, "duration_ms", time.Since(start).Milliseconds())
+}
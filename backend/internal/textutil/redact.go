@@ -0,0 +1,102 @@
+package textutil
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// RedactedMark replaces each part of a text removed by Redact
+const RedactedMark = "[REDACTED]"
+
+// Redaction rules understood by Redact
+const (
+	// RedactCard masks payment card numbers: 13 to 19 digits, optionally
+	// grouped with spaces or dashes, that pass the Luhn check
+	RedactCard = "card"
+	// RedactSSN masks US social security numbers written as 123-45-6789
+	RedactSSN = "ssn"
+	// RedactSecret masks API keys with well-known prefixes and values
+	// given for a password, such as "password: hunter2"
+	RedactSecret = "secret"
+)
+
+// RedactionRules lists every rule understood by Redact
+var RedactionRules = []string{RedactCard, RedactSSN, RedactSecret}
+
+var (
+	cardPattern = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	ssnPattern  = regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)
+	// Stripe, AWS, GitHub, Slack and Google key formats
+	secretKeyPattern = regexp.MustCompile(`\b(?:(?:sk|pk|rk)_(?:live|test)_[A-Za-z0-9]{8,}|AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{20,}|xox[abprs]-[A-Za-z0-9-]{10,}|AIza[0-9A-Za-z_-]{35})`)
+	// The label is kept so the query still reads naturally. "is" must stand
+	// alone, so "password isn't working" and "PIN issue" do not match.
+	passwordPattern = regexp.MustCompile(`(?i)\b(password|passwd|pwd|passcode|pin)(\s+is\s+|\s*[:=]\s*)(\S+)`)
+)
+
+// Redact replaces the parts of text matched by the named rules with
+// RedactedMark. Unknown rule names are ignored.
+func Redact(text string, rules []string) string {
+	for _, rule := range rules {
+		switch strings.ToLower(rule) {
+		case RedactCard:
+			text = cardPattern.ReplaceAllStringFunc(text, func(match string) string {
+				if !luhnValid(match) {
+					return match
+				}
+				return RedactedMark
+			})
+		case RedactSSN:
+			text = ssnPattern.ReplaceAllString(text, RedactedMark)
+		case RedactSecret:
+			text = secretKeyPattern.ReplaceAllString(text, RedactedMark)
+			text = passwordPattern.ReplaceAllStringFunc(text, redactPassword)
+		}
+	}
+	return text
+}
+
+// redactPassword masks the value of a password match. After "is", only a
+// value with something other than letters in it counts as a password, so
+// "password is required" or "PIN is wrong." reads as plain English.
+func redactPassword(match string) string {
+	groups := passwordPattern.FindStringSubmatch(match)
+	label, separator, value := groups[1], groups[2], groups[3]
+	if strings.EqualFold(strings.TrimSpace(separator), "is") && onlyLetters(strings.TrimRight(value, ".,;!?")) {
+		return match
+	}
+	return label + separator + RedactedMark
+}
+
+// onlyLetters reports whether s is made of letters only
+func onlyLetters(s string) bool {
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// luhnValid reports whether the digits of number pass the Luhn checksum
+// used by payment cards, so order and ticket numbers are left alone
+func luhnValid(number string) bool {
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		digit := int(c - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,258 @@
+package textutil
+
+import (
+	"html"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// minTokenLength drops very short words such as "a", "do" or "my" that
+// would otherwise match almost every article
+const minTokenLength = 3
+
+// Tokenize splits text into lowercase words made of letters and digits,
+// skipping words shorter than minTokenLength and duplicates
+func Tokenize(text string) []string {
+	all := words(text)
+
+	seen := make(map[string]bool, len(all))
+	tokens := make([]string, 0, len(all))
+	for _, word := range all {
+		if seen[word] {
+			continue
+		}
+		seen[word] = true
+		tokens = append(tokens, word)
+	}
+
+	return tokens
+}
+
+// DefaultStopwords are common English words that say little about what a
+// query is looking for. Words shorter than minTokenLength are already
+// dropped by Tokenize.
+var DefaultStopwords = []string{
+	"about", "and", "any", "are", "can", "could", "does", "for", "from",
+	"get", "has", "have", "how", "into", "its", "not", "our", "should",
+	"that", "the", "their", "there", "this", "was", "what", "when",
+	"where", "which", "who", "why", "will", "with", "would", "you", "your",
+}
+
+// RemoveStopwords returns the tokens that are not stopwords, comparing
+// case-insensitively and keeping their order. tokens is not modified.
+func RemoveStopwords(tokens []string, stopwords []string) []string {
+	if len(stopwords) == 0 {
+		return tokens
+	}
+
+	skip := make(map[string]bool, len(stopwords))
+	for _, stopword := range stopwords {
+		skip[strings.ToLower(stopword)] = true
+	}
+
+	kept := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if !skip[strings.ToLower(token)] {
+			kept = append(kept, token)
+		}
+	}
+	return kept
+}
+
+// Truncate shortens text to at most maxRunes runes, appending "…" when it
+// was cut. It reports whether truncation happened. A maxRunes of zero or
+// less disables truncation.
+func Truncate(text string, maxRunes int) (string, bool) {
+	if maxRunes <= 0 || utf8.RuneCountInString(text) <= maxRunes {
+		return text, false
+	}
+
+	runes := []rune(text)
+	return strings.TrimRightFunc(string(runes[:maxRunes]), unicode.IsSpace) + "…", true
+}
+
+// NormalizeQuery reduces a query to a canonical form so that the same
+// question asked with different casing, spacing or trailing punctuation
+// compares equal
+func NormalizeQuery(query string) string {
+	query = strings.Join(strings.Fields(strings.ToLower(query)), " ")
+	return strings.TrimRightFunc(query, func(r rune) bool {
+		return unicode.IsPunct(r) || unicode.IsSpace(r)
+	})
+}
+
+// FoldTitle lowercases the ASCII letters of a title and nothing else, so
+// titles compare equal exactly when SQLite's NOCASE collation says they do
+func FoldTitle(title string) string {
+	return strings.Map(func(r rune) rune {
+		if 'A' <= r && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, title)
+}
+
+// Default match weights: a keyword in an article's title counts twice as
+// much as one only in its content
+const (
+	DefaultTitleWeight   = 2.0
+	DefaultContentWeight = 1.0
+)
+
+// MatchScore rates how well a title and content cover lowercase keywords,
+// between 0 and 1. Each keyword found in the title adds titleWeight and
+// each found only in the content adds contentWeight; the total is divided
+// by the most the keywords could score.
+func MatchScore(title, content string, keywords []string, titleWeight, contentWeight float64) float64 {
+	maxWeight := math.Max(titleWeight, contentWeight)
+	if len(keywords) == 0 || maxWeight <= 0 {
+		return 0
+	}
+
+	title = strings.ToLower(title)
+	content = strings.ToLower(content)
+
+	var total float64
+	for _, keyword := range keywords {
+		if strings.Contains(title, keyword) {
+			total += titleWeight
+		} else if strings.Contains(content, keyword) {
+			total += contentWeight
+		}
+	}
+	return total / (maxWeight * float64(len(keywords)))
+}
+
+// ExtractKeywords picks up to limit words that best describe an article:
+// those used most often, with a word in the title counting twice. Stopwords
+// and words shorter than minTokenLength are skipped, and ties keep the
+// order in which the words first appear.
+func ExtractKeywords(title, content string, stopwords []string, limit int) []string {
+	counts := make(map[string]int)
+	for _, word := range RemoveStopwords(words(title), stopwords) {
+		counts[word] += 2
+	}
+	for _, word := range RemoveStopwords(words(content), stopwords) {
+		counts[word]++
+	}
+
+	keywords := Tokenize(title + " " + content)
+	keywords = RemoveStopwords(keywords, stopwords)
+	sort.SliceStable(keywords, func(i, j int) bool {
+		return counts[keywords[i]] > counts[keywords[j]]
+	})
+	if len(keywords) > limit {
+		keywords = keywords[:limit]
+	}
+	return keywords
+}
+
+// words splits text like Tokenize but keeps repeated words
+func words(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	kept := fields[:0]
+	for _, field := range fields {
+		if len([]rune(field)) >= minTokenLength {
+			kept = append(kept, field)
+		}
+	}
+	return kept
+}
+
+// WordCount counts the words in text: runs of letters, digits, combining
+// marks and apostrophes, so "don't" and "réinitialiser" are one word each.
+// Scripts written without spaces, such as Chinese, count one word per run.
+func WordCount(text string) int {
+	return len(strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r) && r != '\'' && r != '’'
+	}))
+}
+
+// stepPattern matches a step marker such as "1)" or "2." at the start of the
+// text or after whitespace
+var stepPattern = regexp.MustCompile(`(?:^|\s)(\d{1,3})[.)]\s+`)
+
+// charsPerToken is the average number of characters in a model token for
+// English text
+const charsPerToken = 4
+
+// EstimateTokens estimates how many model tokens text takes, rounding up.
+// It is a heuristic for sizing prompts, not an exact tokenizer count.
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + charsPerToken - 1) / charsPerToken
+}
+
+// StepsToHTML renders step-numbered text such as "Intro: 1) Do this 2) Do
+// that" as HTML, with the steps in an ordered list and any text before or
+// after them in paragraphs. All text is HTML-escaped.
+func StepsToHTML(text string) string {
+	text = strings.TrimSpace(text)
+
+	// Only numbers that continue the sequence start a step, so an address
+	// such as "port 993." elsewhere in the text is left alone
+	var markerStarts, stepStarts []int
+	next := 1
+	for _, m := range stepPattern.FindAllStringSubmatchIndex(text, -1) {
+		if n, _ := strconv.Atoi(text[m[2]:m[3]]); n != next {
+			continue
+		}
+		markerStarts = append(markerStarts, m[0])
+		stepStarts = append(stepStarts, m[1])
+		next++
+	}
+	if len(markerStarts) == 0 {
+		return paragraph(text)
+	}
+
+	var b strings.Builder
+	b.WriteString(paragraph(text[:markerStarts[0]]))
+	b.WriteString("<ol>")
+	var trailing string
+	for i, start := range stepStarts {
+		end := len(text)
+		if i+1 < len(markerStarts) {
+			end = markerStarts[i+1]
+		}
+		step := strings.TrimSpace(text[start:end])
+		if i == len(stepStarts)-1 {
+			// Closing remarks after the last step are not part of it
+			step, trailing = splitFirstSentence(step)
+		}
+		b.WriteString("<li>" + html.EscapeString(step) + "</li>")
+	}
+	b.WriteString("</ol>")
+	b.WriteString(paragraph(trailing))
+	return b.String()
+}
+
+// paragraph wraps escaped text in a <p> element, or returns "" for blank text
+func paragraph(text string) string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return ""
+	}
+	return "<p>" + html.EscapeString(text) + "</p>"
+}
+
+// splitFirstSentence splits text after its first sentence when another
+// sentence starting with a capital letter follows it
+func splitFirstSentence(text string) (string, string) {
+	for i, r := range text {
+		if !strings.ContainsRune(".!?", r) || i+2 >= len(text) || text[i+1] != ' ' {
+			continue
+		}
+		rest := strings.TrimSpace(text[i+1:])
+		if first, _ := utf8.DecodeRuneInString(rest); unicode.IsUpper(first) {
+			return text[:i+1], rest
+		}
+	}
+	return text, ""
+}
@@ -0,0 +1,241 @@
+package textutil
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTokenize tests splitting text into keyword tokens
+func TestTokenize(t *testing.T) {
+	t.Run("LowercasesAndSplitsOnPunctuation", func(t *testing.T) {
+		assert.Equal(t, []string{"how", "reset", "password", "vpn"}, Tokenize("How do I reset my Password? VPN!"))
+	})
+
+	t.Run("DropsDuplicates", func(t *testing.T) {
+		assert.Equal(t, []string{"email", "setup"}, Tokenize("email setup EMAIL Setup"))
+	})
+
+	t.Run("Unicode", func(t *testing.T) {
+		assert.Equal(t, []string{"réinitialiser", "mot", "passe"}, Tokenize("réinitialiser mot de passe"))
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		assert.Empty(t, Tokenize("  ?! "))
+	})
+}
+
+// TestRemoveStopwords tests dropping noise words from tokens
+func TestRemoveStopwords(t *testing.T) {
+	t.Run("DropsStopwords", func(t *testing.T) {
+		tokens := Tokenize("How do I reset the VPN password for my laptop?")
+
+		assert.Equal(t, []string{"reset", "vpn", "password", "laptop"}, RemoveStopwords(tokens, DefaultStopwords))
+	})
+
+	t.Run("CaseInsensitive", func(t *testing.T) {
+		assert.Equal(t, []string{"printer"}, RemoveStopwords([]string{"printer", "jammed"}, []string{"JAMMED"}))
+	})
+
+	t.Run("DoesNotModifyTokens", func(t *testing.T) {
+		tokens := []string{"the", "printer"}
+
+		RemoveStopwords(tokens, DefaultStopwords)
+
+		assert.Equal(t, []string{"the", "printer"}, tokens)
+	})
+
+	t.Run("NoStopwords", func(t *testing.T) {
+		assert.Equal(t, []string{"how", "vpn"}, RemoveStopwords([]string{"how", "vpn"}, nil))
+	})
+
+	t.Run("OnlyStopwords", func(t *testing.T) {
+		assert.Empty(t, RemoveStopwords(Tokenize("what is the"), DefaultStopwords))
+	})
+}
+
+// TestTruncate tests shortening text on rune boundaries
+func TestTruncate(t *testing.T) {
+	t.Run("ShortTextUnchanged", func(t *testing.T) {
+		text, truncated := Truncate("short", 10)
+		assert.Equal(t, "short", text)
+		assert.False(t, truncated)
+	})
+
+	t.Run("ExactLengthUnchanged", func(t *testing.T) {
+		text, truncated := Truncate("exact", 5)
+		assert.Equal(t, "exact", text)
+		assert.False(t, truncated)
+	})
+
+	t.Run("LongTextTruncated", func(t *testing.T) {
+		text, truncated := Truncate("abcdefghij", 4)
+		assert.Equal(t, "abcd…", text)
+		assert.True(t, truncated)
+	})
+
+	t.Run("TrailingSpaceTrimmed", func(t *testing.T) {
+		text, _ := Truncate("step one then two", 9)
+		assert.Equal(t, "step one…", text)
+	})
+
+	t.Run("MultibyteRunesNotSplit", func(t *testing.T) {
+		text, truncated := Truncate("密码重置问题", 3)
+		assert.Equal(t, "密码重…", text)
+		assert.True(t, truncated)
+		assert.True(t, utf8.ValidString(text))
+	})
+
+	t.Run("ZeroDisables", func(t *testing.T) {
+		text, truncated := Truncate("anything at all", 0)
+		assert.Equal(t, "anything at all", text)
+		assert.False(t, truncated)
+	})
+}
+
+// TestNormalizeQuery tests reducing queries to a canonical form
+func TestNormalizeQuery(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"How do I reset my password?", "how do i reset my password"},
+		{"  how do I   reset my\tPASSWORD  ", "how do i reset my password"},
+		{"VPN not working!!!", "vpn not working"},
+		{"What's wrong with Wi-Fi?", "what's wrong with wi-fi"},
+		{"", ""},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, NormalizeQuery(tc.input), "input: %q", tc.input)
+	}
+}
+
+// TestFoldTitle tests that only ASCII letters are folded, as SQLite's NOCASE
+// collation does
+func TestFoldTitle(t *testing.T) {
+	assert.Equal(t, "vpn setup", FoldTitle("VPN Setup"))
+	assert.Equal(t, FoldTitle("vpn setup"), FoldTitle("VPN SETUP"))
+	assert.NotEqual(t, FoldTitle("ÉCRAN"), FoldTitle("écran"))
+	assert.Equal(t, "écran", FoldTitle("éCRAN"))
+}
+
+// TestStepsToHTML tests rendering step-numbered text as HTML
+func TestStepsToHTML(t *testing.T) {
+	t.Run("IntroStepsAndClosingText", func(t *testing.T) {
+		html := StepsToHTML("To reset your password: 1) Go to the login page 2) Click 'Forgot Password' 3) Follow the link. The link expires in 24 hours.")
+		assert.Equal(t, "<p>To reset your password:</p>"+
+			"<ol><li>Go to the login page</li><li>Click &#39;Forgot Password&#39;</li><li>Follow the link.</li></ol>"+
+			"<p>The link expires in 24 hours.</p>", html)
+	})
+
+	t.Run("DottedMarkers", func(t *testing.T) {
+		assert.Equal(t, "<ol><li>Open settings</li><li>Save</li></ol>", StepsToHTML("1. Open settings 2. Save"))
+	})
+
+	t.Run("IgnoresNumbersOutOfSequence", func(t *testing.T) {
+		html := StepsToHTML("Setup: 1) Use port 993. then restart 2) Add printer at 192.168.1.100 3) Done")
+		assert.Equal(t, "<p>Setup:</p><ol><li>Use port 993. then restart</li>"+
+			"<li>Add printer at 192.168.1.100</li><li>Done</li></ol>", html)
+	})
+
+	t.Run("PlainTextBecomesParagraph", func(t *testing.T) {
+		assert.Equal(t, "<p>Contact IT for help.</p>", StepsToHTML("Contact IT for help."))
+		assert.Equal(t, "", StepsToHTML("   "))
+	})
+
+	t.Run("EscapesHTML", func(t *testing.T) {
+		html := StepsToHTML(`<script>alert("x")</script> 1) Click <b>OK</b> & wait`)
+		assert.Equal(t, "<p>&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;</p>"+
+			"<ol><li>Click &lt;b&gt;OK&lt;/b&gt; &amp; wait</li></ol>", html)
+	})
+}
+
+// TestMatchScore tests weighting keyword matches in titles and contents
+func TestMatchScore(t *testing.T) {
+	keywords := []string{"vpn", "password"}
+
+	testCases := []struct {
+		name     string
+		title    string
+		content  string
+		expected float64
+	}{
+		{"BothInTitle", "VPN Password Help", "", 1},
+		{"OneInTitle", "VPN Setup", "nothing else", 0.5},
+		{"OneInContent", "Setup", "Connect to the VPN", 0.25},
+		{"TitleAndContent", "VPN Setup", "Use your domain password", 0.75},
+		{"NoMatch", "Printers", "Add a printer", 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			score := MatchScore(tc.title, tc.content, keywords, DefaultTitleWeight, DefaultContentWeight)
+			assert.Equal(t, tc.expected, score)
+		})
+	}
+
+	t.Run("NoKeywords", func(t *testing.T) {
+		assert.Zero(t, MatchScore("VPN", "VPN", nil, DefaultTitleWeight, DefaultContentWeight))
+	})
+
+	t.Run("ZeroWeights", func(t *testing.T) {
+		assert.Zero(t, MatchScore("VPN", "VPN", keywords, 0, 0))
+	})
+}
+
+// TestExtractKeywords tests picking the words that best describe an article
+func TestExtractKeywords(t *testing.T) {
+	title := "VPN Connection Setup"
+	content := "Install the VPN client, then connect with your domain password. Reconnect the client if the connection drops."
+
+	t.Run("MostFrequentFirst", func(t *testing.T) {
+		keywords := ExtractKeywords(title, content, DefaultStopwords, 3)
+		// "setup" ties with "client" but comes first
+		assert.Equal(t, []string{"vpn", "connection", "setup"}, keywords)
+	})
+
+	t.Run("SkipsStopwords", func(t *testing.T) {
+		keywords := ExtractKeywords(title, content, DefaultStopwords, 100)
+		assert.NotContains(t, keywords, "the")
+		assert.NotContains(t, keywords, "your")
+		assert.Contains(t, keywords, "password")
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		assert.Empty(t, ExtractKeywords("", "a an to", DefaultStopwords, 5))
+	})
+}
+
+// TestWordCount tests counting words for reading length
+func TestWordCount(t *testing.T) {
+	t.Run("SplitsOnSpacesAndPunctuation", func(t *testing.T) {
+		assert.Equal(t, 10, WordCount("To reset your password: 1) Go to the login page"))
+	})
+
+	t.Run("Apostrophes", func(t *testing.T) {
+		assert.Equal(t, 3, WordCount("Don't panic, it’s"))
+	})
+
+	t.Run("Unicode", func(t *testing.T) {
+		assert.Equal(t, 4, WordCount("réinitialiser le mot\u00a0de"))
+		assert.Equal(t, 2, WordCount("पासवर्ड रीसेट"))
+		assert.Equal(t, 2, WordCount("Пароль — сбросить"))
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		assert.Zero(t, WordCount(""))
+		assert.Zero(t, WordCount(" \n\t- "))
+	})
+}
+
+// TestEstimateTokens tests the token count heuristic
+func TestEstimateTokens(t *testing.T) {
+	assert.Zero(t, EstimateTokens(""))
+	assert.Equal(t, 1, EstimateTokens("VPN"))
+	assert.Equal(t, 2, EstimateTokens("password"))
+	assert.Equal(t, 4, EstimateTokens("reset password"))
+	// Characters, not bytes, are counted
+	assert.Equal(t, 4, EstimateTokens("réinitialiser le"))
+}
@@ -49,6 +49,7 @@ export interface SearchResponse {
   ai_summary_answer: string;
   ai_relevant_articles: Article[];
   query_id: number;
+  result_id?: number;
   timestamp: string;
 }
 